@@ -12,17 +12,35 @@ import (
 	"etcd-admin-backend/internal/middleware"
 	"etcd-admin-backend/internal/services"
 	"etcd-admin-backend/pkg/database"
+	"etcd-admin-backend/pkg/secrets"
 )
 
 func main() {
 	// 命令行参数
 	var migrate = flag.Bool("migrate", false, "Run database migration")
 	var rollback = flag.Bool("rollback", false, "Rollback database migration")
+	var rotateKeys = flag.Bool("rotate-keys", false, "Re-encrypt stored credentials with the current encryption key")
 	flag.Parse()
 
 	// 加载配置
 	cfg := config.LoadConfig()
 
+	// 加载凭据加密密钥
+	keyring, err := secrets.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	if keyring == nil {
+		log.Println("Warning: ENCRYPTION_KEY is not set, connection credentials will be stored in plaintext")
+	}
+	secrets.SetDefault(keyring)
+
+	// 加载备份签名与加密密钥
+	backupCrypto, err := services.NewBackupCrypto(cfg.Backup)
+	if err != nil {
+		log.Fatalf("Failed to load backup keys: %v", err)
+	}
+
 	// 设置Gin模式
 	gin.SetMode(cfg.Server.GinMode)
 
@@ -45,13 +63,22 @@ func main() {
 		return
 	}
 
+	if *rotateKeys {
+		log.Println("Rotating encryption keys...")
+		if _, err := database.RotateEncryptionKeys(cfg); err != nil {
+			log.Fatalf("Key rotation failed: %v", err)
+		}
+		log.Println("Key rotation completed successfully")
+		return
+	}
+
 	// 初始化数据库连接
 	if err := database.InitDatabase(cfg); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
 	// 初始化etcd服务
-	etcdService := services.NewEtcdService()
+	etcdService := services.NewEtcdService(cfg)
 
 	// 创建 Gin 路由
 	r := gin.Default()
@@ -77,7 +104,7 @@ func main() {
 	})
 
 	// 设置API路由
-	handlers.SetupRoutes(r, cfg, etcdService)
+	handlers.SetupRoutes(r, cfg, etcdService, backupCrypto)
 
 	// 启动服务器
 	port := ":" + cfg.Server.Port
@@ -3,14 +3,25 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Redis    RedisConfig
-	Server   ServerConfig
+	Database   DatabaseConfig
+	Redis      RedisConfig
+	Server     ServerConfig
+	OAuth      OAuthConfig
+	LDAP       LDAPConfig
+	Login      LoginConfig
+	Encryption EncryptionConfig
+	Etcd       EtcdConfig
+	Backup     BackupConfig
+	GitSync    GitSyncConfig
+	Webhook    WebhookConfig
 }
 
 type DatabaseConfig struct {
@@ -36,6 +47,117 @@ type ServerConfig struct {
 	GinMode string
 }
 
+// EncryptionConfig 连接凭据加密配置
+type EncryptionConfig struct {
+	Key              string   // base64编码的32字节主密钥
+	KeyFile          string   // 主密钥文件，与Key二选一
+	PreviousKeys     []string // 轮换前的旧密钥，仅用于解密
+	PreviousKeyFiles []string
+}
+
+// EtcdConfig etcd客户端连接池配置
+type EtcdConfig struct {
+	ClientIdleTimeout   time.Duration // 客户端空闲超过该时间后关闭
+	HealthCheckInterval time.Duration // 后台健康检查间隔
+}
+
+// BackupConfig 定时备份配置
+type BackupConfig struct {
+	Directory        string // 备份文件存放目录
+	SchedulerEnabled bool   // 是否在本进程中运行定时任务
+
+	SigningKey       string   // base64编码的32字节Ed25519种子，配置后导出的备份默认签名
+	SigningKeyFile   string   // 签名密钥文件，与SigningKey二选一
+	TrustedKeys      []string // 其他实例的签名公钥（base64），导入时接受其签名
+	RequireSignature bool     // 导入时拒绝未签名的备份
+	AgeRecipients    []string // 默认的age接收者公钥，用于加密定时备份
+	AgeIdentityFile  string   // age私钥文件，用于导入时解密
+}
+
+// GitSyncConfig Git同步配置
+type GitSyncConfig struct {
+	Directory   string        // 仓库工作目录，每个同步配置一个子目录
+	Timeout     time.Duration // 单次git命令的超时时间
+	AuthorName  string        // 推送时的提交者
+	AuthorEmail string
+	AllowLocal  bool // 允许本地路径和file://仓库，仅用于测试
+}
+
+// WebhookConfig Webhook投递配置
+type WebhookConfig struct {
+	Timeout           time.Duration // 单次投递的超时时间
+	MaxAttempts       int           // 每个事件最多投递次数
+	BackoffBase       time.Duration // 第一次重试前的等待时间，之后按指数增长
+	BackoffMax        time.Duration // 重试等待时间上限
+	DeliveryRetention time.Duration // 已结束的投递记录保留时间
+	AllowPrivate      bool          // 允许投递到回环、私有和链路本地等内部地址
+}
+
+// LDAPConfig LDAP / Active Directory 认证配置
+type LDAPConfig struct {
+	Enabled            bool
+	URL                string // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CAFile             string
+	BindDN             string // 用于搜索用户的服务账户
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // 如 (uid=%s) 或 (sAMAccountName=%s)
+	UsernameAttribute  string
+	EmailAttribute     string
+	GroupBaseDN        string // 为空时使用用户条目的memberOf属性
+	GroupFilter        string // 如 (member=%s)，%s为用户DN
+	GroupNameAttribute string
+	AutoProvision      bool
+	AutoLink           bool              // 允许目录邮箱与现有账户相同时登录该账户
+	RoleMapping        map[string]string // LDAP组 -> 角色
+	Timeout            time.Duration
+}
+
+// LoginConfig 登录防暴力破解配置
+type LoginConfig struct {
+	MaxUserFailures int           // 同一用户名连续失败次数上限
+	MaxIPFailures   int           // 同一IP连续失败次数上限
+	BackoffBase     time.Duration // 每次失败后的基础等待时间，按指数增长
+	LockoutDuration time.Duration // 达到上限后的锁定时长
+	FailureWindow   time.Duration // 超过该时间未失败则重新计数
+}
+
+// OAuthConfig 第三方登录配置
+type OAuthConfig struct {
+	OIDC   OIDCConfig
+	GitHub GitHubConfig
+}
+
+// OIDCConfig 通用OIDC提供方配置
+type OIDCConfig struct {
+	Enabled        bool
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	AllowedDomains []string
+	GroupsClaim    string
+	AutoLink       bool              // 允许已验证邮箱与现有账户相同时登录该账户
+	RoleMapping    map[string]string // IdP组 -> 角色
+}
+
+// GitHubConfig GitHub OAuth配置
+type GitHubConfig struct {
+	Enabled        bool
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	BaseURL        string // OAuth授权地址，GitHub Enterprise或测试时可修改
+	APIURL         string
+	AllowedOrgs    []string
+	AllowedDomains []string
+	AutoLink       bool              // 允许已验证邮箱与现有账户相同时登录该账户
+	RoleMapping    map[string]string // org/team -> 角色
+}
+
 func LoadConfig() *Config {
 	// 加载.env文件
 	if err := godotenv.Load(); err != nil {
@@ -63,6 +185,94 @@ func LoadConfig() *Config {
 			JWTKey:  getEnv("JWT_SECRET", "your-secret-key"),
 			GinMode: getEnv("GIN_MODE", "debug"),
 		},
+		LDAP: LDAPConfig{
+			Enabled:            getEnvBool("LDAP_ENABLED", false),
+			URL:                getEnv("LDAP_URL", "ldap://localhost:389"),
+			StartTLS:           getEnvBool("LDAP_START_TLS", false),
+			InsecureSkipVerify: getEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+			CAFile:             getEnv("LDAP_CA_FILE", ""),
+			BindDN:             getEnv("LDAP_BIND_DN", ""),
+			BindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:             getEnv("LDAP_BASE_DN", ""),
+			UserFilter:         getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+			UsernameAttribute:  getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+			EmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			GroupBaseDN:        getEnv("LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:        getEnv("LDAP_GROUP_FILTER", "(member=%s)"),
+			GroupNameAttribute: getEnv("LDAP_GROUP_NAME_ATTRIBUTE", "cn"),
+			AutoProvision:      getEnvBool("LDAP_AUTO_PROVISION", true),
+			AutoLink:           getEnvBool("LDAP_AUTO_LINK", false),
+			RoleMapping:        getEnvMap("LDAP_ROLE_MAPPING", ""),
+			Timeout:            getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+		},
+		Encryption: EncryptionConfig{
+			Key:              getEnv("ENCRYPTION_KEY", ""),
+			KeyFile:          getEnv("ENCRYPTION_KEY_FILE", ""),
+			PreviousKeys:     getEnvList("ENCRYPTION_PREVIOUS_KEYS", ""),
+			PreviousKeyFiles: getEnvList("ENCRYPTION_PREVIOUS_KEY_FILES", ""),
+		},
+		Etcd: EtcdConfig{
+			ClientIdleTimeout:   getEnvDuration("ETCD_CLIENT_IDLE_TIMEOUT", 10*time.Minute),
+			HealthCheckInterval: getEnvDuration("ETCD_HEALTH_CHECK_INTERVAL", 30*time.Second),
+		},
+		Backup: BackupConfig{
+			Directory:        getEnv("BACKUP_DIR", "./backups"),
+			SchedulerEnabled: getEnvBool("BACKUP_SCHEDULER_ENABLED", true),
+			SigningKey:       getEnv("BACKUP_SIGNING_KEY", ""),
+			SigningKeyFile:   getEnv("BACKUP_SIGNING_KEY_FILE", ""),
+			TrustedKeys:      getEnvList("BACKUP_TRUSTED_KEYS", ""),
+			RequireSignature: getEnvBool("BACKUP_REQUIRE_SIGNATURE", false),
+			AgeRecipients:    getEnvList("BACKUP_AGE_RECIPIENTS", ""),
+			AgeIdentityFile:  getEnv("BACKUP_AGE_IDENTITY_FILE", ""),
+		},
+		GitSync: GitSyncConfig{
+			Directory:   getEnv("GIT_SYNC_DIR", "./gitsync"),
+			Timeout:     getEnvDuration("GIT_SYNC_TIMEOUT", 2*time.Minute),
+			AuthorName:  getEnv("GIT_SYNC_AUTHOR_NAME", "etcd-admin"),
+			AuthorEmail: getEnv("GIT_SYNC_AUTHOR_EMAIL", "etcd-admin@localhost"),
+			AllowLocal:  getEnvBool("GIT_SYNC_ALLOW_LOCAL", false),
+		},
+		Webhook: WebhookConfig{
+			Timeout:           getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts:       getEnvInt("WEBHOOK_MAX_ATTEMPTS", 6),
+			BackoffBase:       getEnvDuration("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+			BackoffMax:        getEnvDuration("WEBHOOK_BACKOFF_MAX", time.Hour),
+			DeliveryRetention: getEnvDuration("WEBHOOK_DELIVERY_RETENTION", 7*24*time.Hour),
+			AllowPrivate:      getEnvBool("WEBHOOK_ALLOW_PRIVATE", false),
+		},
+		Login: LoginConfig{
+			MaxUserFailures: getEnvInt("LOGIN_MAX_USER_FAILURES", 5),
+			MaxIPFailures:   getEnvInt("LOGIN_MAX_IP_FAILURES", 20),
+			BackoffBase:     getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+			LockoutDuration: getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			FailureWindow:   getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		},
+		OAuth: OAuthConfig{
+			OIDC: OIDCConfig{
+				Enabled:        getEnvBool("OIDC_ENABLED", false),
+				IssuerURL:      getEnv("OIDC_ISSUER_URL", ""),
+				ClientID:       getEnv("OIDC_CLIENT_ID", ""),
+				ClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+				RedirectURL:    getEnv("OIDC_REDIRECT_URL", "http://localhost:5173/oauth/oidc/callback"),
+				Scopes:         getEnvList("OIDC_SCOPES", "openid,profile,email"),
+				AllowedDomains: getEnvList("OIDC_ALLOWED_DOMAINS", ""),
+				GroupsClaim:    getEnv("OIDC_GROUPS_CLAIM", "groups"),
+				AutoLink:       getEnvBool("OIDC_AUTO_LINK", false),
+				RoleMapping:    getEnvMap("OIDC_ROLE_MAPPING", ""),
+			},
+			GitHub: GitHubConfig{
+				Enabled:        getEnvBool("GITHUB_OAUTH_ENABLED", false),
+				ClientID:       getEnv("GITHUB_CLIENT_ID", ""),
+				ClientSecret:   getEnv("GITHUB_CLIENT_SECRET", ""),
+				RedirectURL:    getEnv("GITHUB_REDIRECT_URL", "http://localhost:5173/oauth/github/callback"),
+				BaseURL:        getEnv("GITHUB_BASE_URL", "https://github.com"),
+				APIURL:         getEnv("GITHUB_API_URL", "https://api.github.com/"),
+				AllowedOrgs:    getEnvList("GITHUB_ALLOWED_ORGS", ""),
+				AllowedDomains: getEnvList("GITHUB_ALLOWED_DOMAINS", ""),
+				AutoLink:       getEnvBool("GITHUB_AUTO_LINK", false),
+				RoleMapping:    getEnvMap("GITHUB_ROLE_MAPPING", ""),
+			},
+		},
 	}
 }
 
@@ -73,3 +283,54 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvBool 获取布尔类型环境变量
+func getEnvBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return defaultValue
+}
+
+// getEnvInt 获取整数类型环境变量
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration 获取时间间隔类型环境变量，如 "15m"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList 获取逗号分隔的列表环境变量
+func getEnvList(key, defaultValue string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap 获取形如 "a:x,b:y" 的映射环境变量
+func getEnvMap(key, defaultValue string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range getEnvList(key, defaultValue) {
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 {
+			continue
+		}
+		result[strings.TrimSpace(item[:idx])] = strings.TrimSpace(item[idx+1:])
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// AdminHandler 管理员处理器
+type AdminHandler struct {
+	loginGuard   *services.LoginGuard
+	auditService *services.AuditService
+}
+
+// NewAdminHandler 创建管理员处理器
+func NewAdminHandler(loginGuard *services.LoginGuard, auditService *services.AuditService) *AdminHandler {
+	return &AdminHandler{
+		loginGuard:   loginGuard,
+		auditService: auditService,
+	}
+}
+
+// UnlockUser 解除用户的登录锁定
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "User not found",
+		})
+		return
+	}
+
+	if err := h.loginGuard.UnlockUser(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to unlock user",
+		})
+		return
+	}
+
+	h.recordAdminAction(c, models.AuditUserUnlocked, "user:"+user.Username)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "User unlocked successfully",
+	})
+}
+
+// UnlockIP 解除IP的登录锁定
+func (h *AdminHandler) UnlockIP(c *gin.Context) {
+	ip := c.Param("ip")
+	if err := h.loginGuard.UnlockIP(ip); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to unlock IP",
+		})
+		return
+	}
+
+	h.recordAdminAction(c, models.AuditUserUnlocked, "ip:"+ip)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "IP unlocked successfully",
+	})
+}
+
+// ListAuditLogs 查询审计日志，支持按动作和用户名过滤
+func (h *AdminHandler) ListAuditLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	query := database.GetDB().Model(&models.AuditLog{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username = ?", username)
+	}
+
+	var total int64
+	var logs []models.AuditLog
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Audit logs retrieved successfully",
+		"data": gin.H{
+			"total": total,
+			"logs":  logs,
+		},
+	})
+}
+
+// recordAdminAction 记录管理员操作
+func (h *AdminHandler) recordAdminAction(c *gin.Context, action, target string) {
+	userID := c.GetUint("user_id")
+	h.auditService.Record(&models.AuditLog{
+		UserID:   &userID,
+		Username: c.GetString("username"),
+		Action:   action,
+		Target:   target,
+		IP:       c.ClientIP(),
+	})
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"time"
 
@@ -10,17 +14,28 @@ import (
 	"etcd-admin-backend/internal/config"
 	"etcd-admin-backend/internal/middleware"
 	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
 	"etcd-admin-backend/pkg/database"
 )
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	cfg *config.Config
+	cfg          *config.Config
+	mfaService   *services.MFAService
+	ldapService  *services.LDAPService
+	loginGuard   *services.LoginGuard
+	auditService *services.AuditService
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{cfg: cfg}
+func NewAuthHandler(cfg *config.Config, mfaService *services.MFAService, ldapService *services.LDAPService, loginGuard *services.LoginGuard, auditService *services.AuditService) *AuthHandler {
+	return &AuthHandler{
+		cfg:          cfg,
+		mfaService:   mfaService,
+		ldapService:  ldapService,
+		loginGuard:   loginGuard,
+		auditService: auditService,
+	}
 }
 
 // LoginRequest 登录请求结构
@@ -36,19 +51,46 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// MFALoginRequest 两步登录第二步请求
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
 // LoginResponse 登录响应结构
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  UserProfile `json:"user"`
+	Token            string       `json:"token,omitempty"`
+	User             *UserProfile `json:"user,omitempty"`
+	MFARequired      bool         `json:"mfa_required,omitempty"`       // 需要提交验证码完成登录
+	MFAToken         string       `json:"mfa_token,omitempty"`          // 第二步使用的中间令牌
+	MFASetupRequired bool         `json:"mfa_setup_required,omitempty"` // 策略要求先绑定MFA
 }
 
 // UserProfile 用户信息结构
 type UserProfile struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
-	IsActive bool   `json:"is_active"`
+	ID           uint   `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	IsActive     bool   `json:"is_active"`
+	AuthProvider string `json:"auth_provider"`
+	AvatarURL    string `json:"avatar_url,omitempty"`
+	MFAEnabled   bool   `json:"mfa_enabled"`
+}
+
+// newUserProfile 由用户模型构建用户信息
+func newUserProfile(user *models.User) UserProfile {
+	return UserProfile{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Role:         user.Role,
+		IsActive:     user.IsActive,
+		AuthProvider: user.AuthProvider,
+		AvatarURL:    user.AvatarURL,
+		MFAEnabled:   user.MFAEnabled,
+	}
 }
 
 // Login 用户登录
@@ -63,39 +105,244 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// 检查是否处于锁定期
+	if h.rejectIfLocked(c, req.Username) {
+		return
+	}
+
 	// 查找用户
 	var user models.User
-	if err := database.GetDB().Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	err := database.GetDB().Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Database error",
+		})
+		return
+	}
+	userFound := err == nil
+
+	switch {
+	case userFound && user.AuthProvider != models.AuthProviderLDAP:
+		// 本地账户验证密码
+		if err := user.CheckPassword(req.Password); err != nil {
+			h.recordLoginFailure(c, user.Username, &user.ID, "invalid password")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Invalid username or password",
+			})
+			return
+		}
+	case h.ldapService.Enabled():
+		// 目录账户或本地不存在的用户交给LDAP验证
+		ldapUser, err := h.ldapService.Login(req.Username, req.Password)
+		if errors.Is(err, services.ErrIdentityConflict) {
+			// 目录账户的邮箱属于其他本地账户，不自动接管
+			h.recordLoginFailure(c, req.Username, nil, "ldap: "+err.Error())
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "An existing account already uses this email, contact an administrator",
+			})
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, services.ErrLDAPInvalidCredentials) && !errors.Is(err, services.ErrIdentityNotAllowed) {
+				log.Printf("LDAP authentication error for %s: %v", req.Username, err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"status":  "error",
+					"message": "Authentication service unavailable",
+				})
+				return
+			}
+			h.recordLoginFailure(c, req.Username, nil, "ldap: "+err.Error())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"status":  "error",
 				"message": "Invalid username or password",
 			})
 			return
 		}
+		user = *ldapUser
+	default:
+		reason := "unknown user"
+		if userFound {
+			reason = "ldap authentication is disabled"
+		}
+		h.recordLoginFailure(c, req.Username, nil, reason)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid username or password",
+		})
+		return
+	}
+
+	// 启用MFA的用户在第二步成功后才清除失败计数
+	if !user.MFAEnabled {
+		h.recordLoginSuccess(c, &user)
+	}
+
+	respondLogin(c, h.cfg, h.mfaService, &user)
+}
+
+// LoginMFA 两步登录：校验验证码或恢复码并签发JWT
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	userID, err := middleware.ParseMFAToken(req.MFAToken, h.cfg)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid or expired MFA token",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid or expired MFA token",
+		})
+		return
+	}
+
+	if h.rejectIfLocked(c, user.Username) {
+		return
+	}
+
+	if err := h.mfaService.Verify(&user, req.Code, req.RecoveryCode); err != nil {
+		h.recordLoginFailure(c, user.Username, &user.ID, "invalid verification code")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid verification code",
+		})
+		return
+	}
+
+	h.recordLoginSuccess(c, &user)
+	issueLoginToken(c, h.cfg, &user, false)
+}
+
+// rejectIfLocked 用户名或IP处于锁定期时返回429
+func (h *AuthHandler) rejectIfLocked(c *gin.Context, username string) bool {
+	wait, err := h.loginGuard.Check(username, c.ClientIP())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": "Database error",
 		})
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	h.auditService.Record(&models.AuditLog{
+		Username: username,
+		Action:   models.AuditLoginBlocked,
+		IP:       c.ClientIP(),
+	})
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"status":      "error",
+		"message":     "Too many failed login attempts, please try again later",
+		"retry_after": retryAfter,
+	})
+	return true
+}
+
+// recordLoginFailure 记录失败次数和审计日志
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, username string, userID *uint, reason string) {
+	locked, err := h.loginGuard.RecordFailure(username, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", username, err)
+	}
+	if locked {
+		reason += ", account locked"
+	}
+
+	h.auditService.Record(&models.AuditLog{
+		UserID:   userID,
+		Username: username,
+		Action:   models.AuditLoginFailed,
+		IP:       c.ClientIP(),
+		Detail:   reason,
+	})
+}
+
+// recordLoginSuccess 清除失败计数并记录审计日志
+func (h *AuthHandler) recordLoginSuccess(c *gin.Context, user *models.User) {
+	if err := h.loginGuard.RecordSuccess(user.Username); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", user.Username, err)
+	}
+
+	h.auditService.Record(&models.AuditLog{
+		UserID:   &user.ID,
+		Username: user.Username,
+		Action:   models.AuditLoginSuccess,
+		IP:       c.ClientIP(),
+	})
+}
+
+// respondLogin 身份校验通过后的统一处理：按MFA状态返回中间令牌或正式令牌
+func respondLogin(c *gin.Context, cfg *config.Config, mfaService *services.MFAService, user *models.User) {
+	if user.MFAEnabled {
+		mfaToken, err := middleware.GenerateMFAToken(user.ID, user.Username, cfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Failed to generate token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Verification code required",
+			"data": LoginResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+			},
+		})
 		return
 	}
 
-	// 验证密码
-	if err := user.CheckPassword(req.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+	setupRequired, err := mfaService.IsRequired(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Invalid username or password",
+			"message": "Failed to load MFA policy",
 		})
 		return
 	}
 
+	issueLoginToken(c, cfg, user, setupRequired)
+}
+
+// issueLoginToken 更新登录时间并签发JWT
+func issueLoginToken(c *gin.Context, cfg *config.Config, user *models.User, mfaSetupRequired bool) {
 	// 更新最后登录时间
 	now := time.Now()
 	user.LastLogin = &now
-	database.GetDB().Save(&user)
+	database.GetDB().Model(user).UpdateColumn("last_login", now)
 
 	// 生成JWT令牌
-	token, err := middleware.GenerateToken(user.ID, user.Username, user.Role, h.cfg)
+	var token string
+	var err error
+	if mfaSetupRequired {
+		token, err = middleware.GenerateMFASetupToken(user.ID, user.Username, user.Role, cfg)
+	} else {
+		token, err = middleware.GenerateToken(user.ID, user.Username, user.Role, cfg)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -104,18 +351,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	profile := newUserProfile(user)
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Login successful",
 		"data": LoginResponse{
-			Token: token,
-			User: UserProfile{
-				ID:       user.ID,
-				Username: user.Username,
-				Email:    user.Email,
-				Role:     user.Role,
-				IsActive: user.IsActive,
-			},
+			Token:            token,
+			User:             &profile,
+			MFASetupRequired: mfaSetupRequired,
 		},
 	})
 }
@@ -153,11 +396,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// 创建新用户
 	user := models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: req.Password,
-		Role:     models.RoleUser,
-		IsActive: true,
+		Username:     req.Username,
+		Email:        req.Email,
+		Password:     req.Password,
+		Role:         models.RoleUser,
+		IsActive:     true,
+		AuthProvider: models.AuthProviderLocal,
 	}
 
 	if err := database.GetDB().Create(&user).Error; err != nil {
@@ -171,13 +415,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"status":  "success",
 		"message": "User registered successfully",
-		"data": UserProfile{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-			IsActive: user.IsActive,
-		},
+		"data":    newUserProfile(&user),
 	})
 }
 
@@ -204,13 +442,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Profile retrieved successfully",
-		"data": UserProfile{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-			IsActive: user.IsActive,
-		},
+		"data":    newUserProfile(&user),
 	})
 }
 
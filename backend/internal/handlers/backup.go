@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,25 +21,32 @@ import (
 
 // BackupHandler 备份处理器
 type BackupHandler struct {
-	etcdService *services.EtcdService
+	etcdService    *services.EtcdService
+	backupService  *services.BackupService
+	scheduler      *services.BackupScheduler
+	webhookService *services.WebhookService
 }
 
 // NewBackupHandler 创建备份处理器
-func NewBackupHandler(etcdService *services.EtcdService) *BackupHandler {
+func NewBackupHandler(etcdService *services.EtcdService, backupService *services.BackupService, scheduler *services.BackupScheduler, webhookService *services.WebhookService) *BackupHandler {
 	return &BackupHandler{
-		etcdService: etcdService,
+		etcdService:    etcdService,
+		backupService:  backupService,
+		scheduler:      scheduler,
+		webhookService: webhookService,
 	}
 }
 
-// BackupData 备份数据结构
+// BackupData 备份数据结构（json格式导出的文档结构）
 type BackupData struct {
 	ConnectionName string                 `json:"connection_name"`
 	ConnectionID   uint                   `json:"connection_id"`
 	ExportTime     time.Time              `json:"export_time"`
+	Revision       int64                  `json:"revision"` // 导出时读取的etcd revision
 	Data           map[string]interface{} `json:"data"`
 }
 
-// ImportRequest 导入请求
+// ImportRequest 导入请求（json格式备份，同时兼容导出的json文件）
 type ImportRequest struct {
 	Data      map[string]interface{} `json:"data" binding:"required"`
 	Overwrite bool                   `json:"overwrite"` // 是否覆盖已存在的key
@@ -61,51 +73,211 @@ func (h *BackupHandler) ExportBackup(c *gin.Context) {
 		return
 	}
 
-	// 获取前缀参数
-	prefix := c.DefaultQuery("prefix", "")
+	format := c.DefaultQuery("format", services.ExportFormatJSON)
+	if !services.IsValidExportFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported export format",
+		})
+		return
+	}
+	pageSize, _ := strconv.ParseInt(c.DefaultQuery("page_size", "0"), 10, 64)
+	useGzip := c.DefaultQuery("gzip", "false") == "true"
+
+	// tar.gz格式本身已压缩
+	if format == services.ExportFormatTarGz {
+		useGzip = false
+	}
+
+	seal := h.sealOptions(c)
 
-	// 从etcd获取所有KV数据
-	kvData, err := h.etcdService.GetAllKV(&connection, prefix)
+	// 指定存储位置时保存到存储，不通过响应下载
+	if storageParam := c.Query("storage_id"); storageParam != "" {
+		h.storeExport(c, &connection, storageParam, format, useGzip, seal)
+		return
+	}
+
+	// 设置下载文件名
+	ext, contentType := services.ExportFileType(format)
+	filename := fmt.Sprintf("etcd-backup-%s-%s.%s",
+		connection.Name,
+		time.Now().Format("20060102-150405"),
+		ext)
+	if useGzip {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	if suffix := h.backupService.Crypto().FileSuffix(seal); suffix != "" {
+		filename += suffix
+		contentType = "application/octet-stream"
+	}
+
+	out := &exportWriter{c: c, filename: filename, contentType: contentType}
+	sealed, err := h.backupService.Crypto().Seal(out, seal)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "Failed to export data",
+			"message": "Invalid encryption or signing options",
 			"error":   err.Error(),
 		})
 		return
 	}
+	var w io.Writer = sealed
+	var gz *gzip.Writer
+	if useGzip {
+		gz = gzip.NewWriter(sealed)
+		w = gz
+	}
+
+	// 分页读取并直接写入响应
+	result, err := h.backupService.Export(c.Request.Context(), &connection, w, services.ExportOptions{
+		Prefix:   c.DefaultQuery("prefix", ""),
+		Format:   format,
+		PageSize: pageSize,
+	})
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = sealed.Close()
+	}
+	if err != nil {
+		if !out.started {
+			c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
+				"status":  "error",
+				"message": "Failed to export data",
+				"error":   err.Error(),
+			})
+			return
+		}
 
-	// 转换为适合导出的格式
-	exportData := make(map[string]interface{})
-	for key, value := range kvData {
-		// 尝试解析JSON
-		var jsonValue interface{}
-		if err := json.Unmarshal([]byte(value), &jsonValue); err != nil {
-			// 如果不是JSON，存储原始字符串
-			exportData[key] = value
-		} else {
-			exportData[key] = jsonValue
+		// 已开始输出时无法再返回错误状态，关闭连接让客户端感知传输不完整
+		log.Printf("Export of connection %d aborted after %d keys: %v", connection.ID, result.Count, err)
+		if hijacker, ok := c.Writer.(http.Hijacker); ok {
+			if netConn, _, err := hijacker.Hijack(); err == nil {
+				netConn.Close()
+			}
 		}
 	}
+}
 
-	backup := BackupData{
-		ConnectionName: connection.Name,
-		ConnectionID:   connection.ID,
-		ExportTime:     time.Now(),
-		Data:           exportData,
+// storeExport 导出到存储位置，完成后返回执行记录
+func (h *BackupHandler) storeExport(c *gin.Context, connection *models.Connection, storageParam, format string, useGzip bool, seal services.SealOptions) {
+	storageID, err := strconv.ParseUint(storageParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid storage_id",
+		})
+		return
 	}
 
-	// 设置下载文件名
-	filename := fmt.Sprintf("etcd-backup-%s-%s.json",
-		connection.Name,
-		time.Now().Format("20060102-150405"))
+	run, err := h.scheduler.StoreExport(c.Request.Context(), connection, uint(storageID), c.DefaultQuery("prefix", ""), format, useGzip, seal)
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrStorageNotFound) || errors.Is(err, services.ErrInvalidSealOptions) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to store backup",
+			"error":   err.Error(),
+			"data":    run,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Backup stored successfully",
+		"data":    run,
+	})
+}
+
+// sealOptions 解析导出的加密与签名参数
+// 口令通过 X-Backup-Passphrase 请求头传递，避免出现在URL和访问日志中
+func (h *BackupHandler) sealOptions(c *gin.Context) services.SealOptions {
+	opts := services.SealOptions{
+		Passphrase: c.GetHeader("X-Backup-Passphrase"),
+		Sign:       h.backupService.Crypto().CanSign(),
+	}
+	if recipients := c.Query("recipients"); recipients != "" {
+		opts.Recipients = strings.Split(recipients, ",")
+	}
+	if c.Query("encrypt") == "true" && opts.Passphrase == "" && len(opts.Recipients) == 0 {
+		opts.DefaultRecipients = true
+	}
+	if sign := c.Query("sign"); sign != "" {
+		opts.Sign = sign == "true"
+	}
+	return opts
+}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.Header("Content-Type", "application/json")
-	c.JSON(http.StatusOK, backup)
+// importMapping 解析导入的键名映射：mapping为JSON格式的完整配置，
+// source_prefix、target_prefix、include、exclude查询参数会覆盖其中对应的字段
+func importMapping(c *gin.Context, mapping string) (models.KeyMapping, error) {
+	var result models.KeyMapping
+	if mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &result); err != nil {
+			return result, err
+		}
+	}
+	if value, ok := c.GetQuery("source_prefix"); ok {
+		result.SourcePrefix = value
+	}
+	if value, ok := c.GetQuery("target_prefix"); ok {
+		result.TargetPrefix = value
+	}
+	if values := c.QueryArray("include"); len(values) > 0 {
+		result.Include = values
+	}
+	if values := c.QueryArray("exclude"); len(values) > 0 {
+		result.Exclude = values
+	}
+	return result, nil
+}
+
+// GetSigningKey 获取本实例的备份签名公钥
+func (h *BackupHandler) GetSigningKey(c *gin.Context) {
+	publicKey, keyID := h.backupService.Crypto().PublicKey()
+	if publicKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Backup signing key is not configured",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"algorithm":  "ed25519",
+			"key_id":     keyID,
+			"public_key": publicKey,
+		},
+	})
+}
+
+// exportWriter 首次写入时才设置下载响应头，之前出错仍可返回JSON错误
+type exportWriter struct {
+	c           *gin.Context
+	filename    string
+	contentType string
+	started     bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", w.filename))
+		w.c.Header("Content-Type", w.contentType)
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
 }
 
 // ImportBackup 导入备份
+// 请求体可以是备份文件内容，也可以是multipart表单中的file字段；format为空时自动识别格式
 func (h *BackupHandler) ImportBackup(c *gin.Context) {
 	connectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -126,58 +298,193 @@ func (h *BackupHandler) ImportBackup(c *gin.Context) {
 		return
 	}
 
-	var req ImportRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+	opts := services.ImportOptions{
+		Overwrite:  c.DefaultQuery("overwrite", "false") == "true",
+		DryRun:     c.DefaultQuery("dry_run", "false") == "true",
+		Prune:      c.DefaultQuery("prune", "false") == "true",
+		ShowValues: c.DefaultQuery("show_values", "false") == "true",
+	}
+
+	// 只读连接只允许预览
+	if connection.IsReadOnly && !opts.DryRun {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
-			"message": "Invalid request data",
-			"error":   err.Error(),
+			"message": "Connection is read-only, cannot import data",
 		})
 		return
 	}
 
-	successCount := 0
-	errorCount := 0
-	errors := make([]string, 0)
+	// 全量同步会删除范围内的其他键，必须显式指定前缀，prefix= 表示整个键空间
+	if opts.Prune {
+		prefix, ok := c.GetQuery("prefix")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "prefix is required when prune is enabled",
+			})
+			return
+		}
+		opts.Prefix = prefix
+	}
 
-	// 导入数据到etcd
-	for key, value := range req.Data {
-		// 如果不覆盖，先检查key是否存在
-		if !req.Overwrite {
-			if _, err := h.etcdService.GetValue(&connection, key); err == nil {
-				// key已存在，跳过
-				continue
-			}
+	if value := c.Query("revision"); value != "" {
+		revision, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || revision <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid revision",
+			})
+			return
 		}
+		opts.Revision = revision
+	}
 
-		// 将值转换为JSON字符串
-		valueBytes, err := json.Marshal(value)
-		if err != nil {
-			errorCount++
-			errors = append(errors, fmt.Sprintf("Failed to serialize value for key %s: %v", key, err))
-			continue
+	if value := c.Query("chunk_size"); value != "" {
+		chunkSize, err := strconv.Atoi(value)
+		if err != nil || chunkSize <= 0 || chunkSize > services.MaxImportChunkSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("chunk_size must be between 1 and %d", services.MaxImportChunkSize),
+			})
+			return
 		}
+		opts.ChunkSize = chunkSize
+	}
+
+	format := c.DefaultQuery("format", "")
+	if format == "auto" {
+		format = ""
+	}
+	if format != "" && !services.IsValidExportFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported import format",
+		})
+		return
+	}
 
-		// 设置到etcd
-		if err := h.etcdService.SetValue(&connection, key, string(valueBytes)); err != nil {
-			errorCount++
-			errors = append(errors, fmt.Sprintf("Failed to set key %s: %v", key, err))
-			continue
+	// 获取备份内容，加密备份的口令通过请求头或表单字段传递
+	var body io.Reader = c.Request.Body
+	passphrase := c.GetHeader("X-Backup-Passphrase")
+	mapping := c.Query("mapping")
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if passphrase == "" {
+			passphrase = c.PostForm("passphrase")
+		}
+		if mapping == "" {
+			mapping = c.PostForm("mapping")
+		}
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Backup file is required",
+				"error":   err.Error(),
+			})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Failed to read backup file",
+				"error":   err.Error(),
+			})
+			return
 		}
+		defer file.Close()
+		body = file
+	}
+
+	if opts.Mapping, err = importMapping(c, mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid key mapping",
+			"error":   err.Error(),
+		})
+		return
+	}
 
-		successCount++
+	opts.Format = format
+	opts.Passphrase = passphrase
+	result, err := h.backupService.Import(c.Request.Context(), &connection, body, opts)
+	if !opts.DryRun {
+		h.emitImport(c, &connection, result, err)
+	}
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusBadRequest)
+		if errors.Is(err, services.ErrImportConflict) {
+			status = http.StatusConflict
+		}
+		response := gin.H{
+			"status":  "error",
+			"message": "Failed to import data",
+			"error":   err.Error(),
+		}
+		// 中途失败时返回已导入的统计
+		if result != nil {
+			response["data"] = result
+		}
+		c.JSON(status, response)
+		return
 	}
 
+	message := "Import completed"
+	if result.DryRun {
+		message = "Import preview"
+	}
 	response := gin.H{
 		"status":        "success",
-		"message":       "Import completed",
-		"success_count": successCount,
-		"error_count":   errorCount,
+		"message":       message,
+		"format":        result.Format,
+		"dry_run":       result.DryRun,
+		"revision":      result.Revision,
+		"added":         result.Added,
+		"changed":       result.Changed,
+		"unchanged":     result.Unchanged,
+		"deleted":       result.Deleted,
+		"filtered":      result.Filtered,
+		"success_count": result.SuccessCount,
+		"skipped_count": result.SkippedCount,
+		"error_count":   result.ErrorCount,
+		"encrypted":     result.Encrypted,
+		"signed":        result.Signed,
+	}
+	if result.SignerKeyID != "" {
+		response["signer_key_id"] = result.SignerKeyID
+	}
+	if result.Items != nil {
+		response["items"] = result.Items
 	}
 
-	if len(errors) > 0 {
-		response["errors"] = errors
+	if len(result.Errors) > 0 {
+		response["errors"] = result.Errors
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// emitImport 通知连接的Webhook导入结果
+func (h *BackupHandler) emitImport(c *gin.Context, connection *models.Connection, result *services.ImportResult, err error) {
+	event := services.WebhookEventImportCompleted
+	data := map[string]interface{}{
+		"user_id":  c.GetUint("user_id"),
+		"username": c.GetString("username"),
+	}
+	if result != nil {
+		data["format"] = result.Format
+		data["revision"] = result.Revision
+		data["added"] = result.Added
+		data["changed"] = result.Changed
+		data["unchanged"] = result.Unchanged
+		data["deleted"] = result.Deleted
+		data["success_count"] = result.SuccessCount
+		data["skipped_count"] = result.SkippedCount
+		data["error_count"] = result.ErrorCount
+	}
+	if err != nil {
+		event = services.WebhookEventImportFailed
+		data["error"] = err.Error()
+	}
+	h.webhookService.Emit(connection.ID, event, "", data)
+}
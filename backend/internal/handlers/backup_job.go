@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// BackupJobHandler 定时备份任务处理器
+type BackupJobHandler struct {
+	scheduler *services.BackupScheduler
+	storages  *services.BackupStorageService
+}
+
+// NewBackupJobHandler 创建定时备份任务处理器
+func NewBackupJobHandler(scheduler *services.BackupScheduler, storages *services.BackupStorageService) *BackupJobHandler {
+	return &BackupJobHandler{
+		scheduler: scheduler,
+		storages:  storages,
+	}
+}
+
+// BackupJobRequest 创建/更新备份任务请求
+type BackupJobRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Schedule      string `json:"schedule" binding:"required"` // cron表达式
+	Type          string `json:"type"`                        // export（默认）或 snapshot
+	Prefix        string `json:"prefix"`
+	Format        string `json:"format"`     // 导出格式，默认etcdctl
+	StorageID     uint   `json:"storage_id"` // 存储位置，默认内置本地存储
+	Gzip          *bool  `json:"gzip"`       // 默认true
+	Encrypt       bool   `json:"encrypt"`    // 使用 BACKUP_AGE_RECIPIENTS 加密
+	Enabled       *bool  `json:"enabled"`
+	KeepLast      int    `json:"keep_last" binding:"min=0"`
+	KeepDailyDays int    `json:"keep_daily_days" binding:"min=0"`
+}
+
+// BackupJobResponse 备份任务响应，附带下次执行时间
+type BackupJobResponse struct {
+	models.BackupJob
+	NextRunAt *time.Time `json:"next_run_at"`
+}
+
+// apply 将请求应用到任务
+func (r *BackupJobRequest) apply(job *models.BackupJob) {
+	job.Name = r.Name
+	job.Schedule = r.Schedule
+	job.Type = r.Type
+	job.Prefix = r.Prefix
+	job.Format = r.Format
+	job.StorageID = r.StorageID
+	job.KeepLast = r.KeepLast
+	job.KeepDailyDays = r.KeepDailyDays
+	job.Encrypt = r.Encrypt
+	if r.Gzip != nil {
+		job.Gzip = *r.Gzip
+	}
+	if r.Enabled != nil {
+		job.Enabled = *r.Enabled
+	}
+}
+
+// ListJobs 获取连接的备份任务列表
+func (h *BackupJobHandler) ListJobs(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var jobs []models.BackupJob
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).Order("id").Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list backup jobs",
+		})
+		return
+	}
+
+	data := make([]BackupJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		data = append(data, h.jobResponse(job))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// CreateJob 创建备份任务
+func (h *BackupJobHandler) CreateJob(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var req BackupJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	job := models.BackupJob{
+		ConnectionID: connection.ID,
+		Gzip:         true,
+		Enabled:      true,
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	req.apply(&job)
+	if err := h.validateJob(&job); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid backup job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to create backup job",
+		})
+		return
+	}
+	if err := h.scheduler.Reload(&job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to schedule backup job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Backup job created successfully",
+		"data":    h.jobResponse(job),
+	})
+}
+
+// UpdateJob 更新备份任务
+func (h *BackupJobHandler) UpdateJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	var req BackupJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.apply(job)
+	if err := h.validateJob(job); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid backup job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := database.GetDB().Save(job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to update backup job",
+		})
+		return
+	}
+	if err := h.scheduler.Reload(job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to schedule backup job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Backup job updated successfully",
+		"data":    h.jobResponse(*job),
+	})
+}
+
+// DeleteJob 删除备份任务，已生成的备份文件保留，可通过备份接口单独删除
+func (h *BackupJobHandler) DeleteJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	h.scheduler.Remove(job.ID)
+	if err := database.GetDB().Delete(job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete backup job",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Backup job deleted successfully",
+	})
+}
+
+// RunJob 立即执行备份任务，备份在后台进行
+func (h *BackupJobHandler) RunJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.scheduler.RunNow(job.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBackupJobRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to start backup job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "Backup job started",
+		"data":    run,
+	})
+}
+
+// ListRuns 获取备份任务的执行历史
+func (h *BackupJobHandler) ListRuns(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var runs []models.BackupRun
+	if err := database.GetDB().Where("job_id = ?", job.ID).Order("id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list backup runs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   runs,
+	})
+}
+
+// ListBackups 获取连接已保存的备份文件
+func (h *BackupJobHandler) ListBackups(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var runs []models.BackupRun
+	if err := database.GetDB().
+		Where("connection_id = ? AND status = ? AND pruned = ?", connection.ID, models.BackupRunSuccess, false).
+		Order("id DESC").
+		Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list backups",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   runs,
+	})
+}
+
+// DownloadBackup 下载已保存的备份文件
+func (h *BackupJobHandler) DownloadBackup(c *gin.Context) {
+	run, ok := h.getBackup(c)
+	if !ok {
+		return
+	}
+
+	reader, err := h.scheduler.OpenBackup(c.Request.Context(), run)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to read backup file",
+			"error":   err.Error(),
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("X-Backup-Checksum-SHA256", run.Checksum)
+	c.DataFromReader(http.StatusOK, run.Size, "application/octet-stream", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%s", run.FileName),
+	})
+}
+
+// DeleteBackup 删除已保存的备份文件，执行记录保留
+func (h *BackupJobHandler) DeleteBackup(c *gin.Context) {
+	run, ok := h.getBackup(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduler.DeleteBackup(c.Request.Context(), run); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete backup",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Backup deleted successfully",
+	})
+}
+
+// validateJob 校验任务配置及存储位置
+func (h *BackupJobHandler) validateJob(job *models.BackupJob) error {
+	if err := h.scheduler.ValidateBackupJob(job); err != nil {
+		return err
+	}
+	_, err := h.storages.Get(job.StorageID)
+	return err
+}
+
+// jobResponse 组装任务响应
+func (h *BackupJobHandler) jobResponse(job models.BackupJob) BackupJobResponse {
+	return BackupJobResponse{
+		BackupJob: job,
+		NextRunAt: h.scheduler.NextRun(job.ID),
+	}
+}
+
+// getConnection 解析路径中的连接
+func (h *BackupJobHandler) getConnection(c *gin.Context) (*models.Connection, bool) {
+	connectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid connection_id",
+		})
+		return nil, false
+	}
+
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, uint(connectionID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return nil, false
+	}
+	return &connection, true
+}
+
+// getJob 解析路径中的备份任务，任务必须属于该连接
+func (h *BackupJobHandler) getJob(c *gin.Context) (*models.BackupJob, bool) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return nil, false
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("job_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid job ID",
+		})
+		return nil, false
+	}
+
+	var job models.BackupJob
+	if err := database.GetDB().Where("id = ? AND connection_id = ?", uint(jobID), connection.ID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Backup job not found",
+		})
+		return nil, false
+	}
+	return &job, true
+}
+
+// getBackup 解析路径中已保存的备份
+func (h *BackupJobHandler) getBackup(c *gin.Context) (*models.BackupRun, bool) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return nil, false
+	}
+
+	runID, err := strconv.ParseUint(c.Param("run_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid backup ID",
+		})
+		return nil, false
+	}
+
+	var run models.BackupRun
+	if err := database.GetDB().
+		Where("id = ? AND connection_id = ? AND status = ? AND pruned = ?", uint(runID), connection.ID, models.BackupRunSuccess, false).
+		First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Backup not found",
+		})
+		return nil, false
+	}
+	return &run, true
+}
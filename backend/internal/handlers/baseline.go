@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// BaselineHandler 漂移检测基线处理器
+type BaselineHandler struct {
+	driftService *services.DriftService
+}
+
+// NewBaselineHandler 创建基线处理器
+func NewBaselineHandler(driftService *services.DriftService) *BaselineHandler {
+	return &BaselineHandler{
+		driftService: driftService,
+	}
+}
+
+// BaselineRequest 创建基线请求，期望状态取自集群当前状态
+type BaselineRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Prefix   string `json:"prefix"`
+	Schedule string `json:"schedule"` // cron表达式，为空时只能手动检查
+	Enabled  *bool  `json:"enabled"`  // 默认true
+}
+
+// UpdateBaselineRequest 更新基线请求，期望状态通过capture或import替换
+type UpdateBaselineRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Schedule string `json:"schedule"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// BaselineResponse 基线响应，附带下次检查时间
+type BaselineResponse struct {
+	models.Baseline
+	NextCheckAt *time.Time `json:"next_check_at"`
+}
+
+// ListBaselines 获取连接的基线列表
+func (h *BaselineHandler) ListBaselines(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var baselines []models.Baseline
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).Order("id").Find(&baselines).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list baselines",
+		})
+		return
+	}
+
+	data := make([]BaselineResponse, 0, len(baselines))
+	for _, baseline := range baselines {
+		data = append(data, h.baselineResponse(baseline))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// CreateBaseline 以集群中前缀下的当前键值创建基线
+func (h *BaselineHandler) CreateBaseline(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var req BaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	baseline := &models.Baseline{
+		ConnectionID: connection.ID,
+		Name:         req.Name,
+		Prefix:       req.Prefix,
+		Schedule:     req.Schedule,
+		Enabled:      true,
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	if req.Enabled != nil {
+		baseline.Enabled = *req.Enabled
+	}
+	if !h.validateBaseline(c, baseline) {
+		return
+	}
+
+	if err := h.driftService.Capture(c.Request.Context(), connection, baseline); err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
+			"status":  "error",
+			"message": "Failed to capture baseline",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !h.reload(c, baseline) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Baseline created successfully",
+		"data":    h.baselineResponse(*baseline),
+	})
+}
+
+// ImportBaseline 以备份文件中前缀下的键值创建基线
+// 请求体可以是备份文件内容，也可以是multipart表单中的file字段；format为空时自动识别格式
+func (h *BaselineHandler) ImportBaseline(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	baseline := &models.Baseline{
+		ConnectionID: connection.ID,
+		Name:         c.Query("name"),
+		Prefix:       c.Query("prefix"),
+		Schedule:     c.Query("schedule"),
+		Enabled:      c.DefaultQuery("enabled", "true") == "true",
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	if baseline.Name == "" || len(baseline.Name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Baseline name is required and must not exceed 100 characters",
+		})
+		return
+	}
+	if !h.validateBaseline(c, baseline) {
+		return
+	}
+	h.loadBackup(c, baseline, http.StatusCreated, "Baseline created successfully")
+}
+
+// GetBaseline 获取基线详情
+func (h *BaselineHandler) GetBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   h.baselineResponse(*baseline),
+	})
+}
+
+// UpdateBaseline 更新基线名称与检查计划
+func (h *BaselineHandler) UpdateBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateBaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	baseline.Name = req.Name
+	baseline.Schedule = req.Schedule
+	if req.Enabled != nil {
+		baseline.Enabled = *req.Enabled
+	}
+	if !h.validateBaseline(c, baseline) {
+		return
+	}
+
+	if err := database.GetDB().Save(baseline).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to update baseline",
+		})
+		return
+	}
+	if !h.reload(c, baseline) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Baseline updated successfully",
+		"data":    h.baselineResponse(*baseline),
+	})
+}
+
+// DeleteBaseline 删除基线及其检查报告
+func (h *BaselineHandler) DeleteBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	if err := h.driftService.Delete(baseline); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete baseline",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Baseline deleted successfully",
+	})
+}
+
+// CaptureBaseline 以集群当前状态替换基线的期望状态
+func (h *BaselineHandler) CaptureBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, baseline.ConnectionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return
+	}
+
+	if err := h.driftService.Capture(c.Request.Context(), &connection, baseline); err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
+			"status":  "error",
+			"message": "Failed to capture baseline",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Baseline captured",
+		"data":    h.baselineResponse(*baseline),
+	})
+}
+
+// ReloadBaseline 以备份文件替换基线的期望状态，请求格式与ImportBaseline相同
+func (h *BaselineHandler) ReloadBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+	h.loadBackup(c, baseline, http.StatusOK, "Baseline loaded")
+}
+
+// ListItems 获取基线的期望键值
+func (h *BaselineHandler) ListItems(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	var items []models.KVItem
+	if err := database.GetDB().Where("baseline_id = ?", baseline.ID).
+		Order("`key`").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list baseline items",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   items,
+		"total":  baseline.KeyCount,
+	})
+}
+
+// CheckBaseline 立即检查集群与基线的差异
+func (h *BaselineHandler) CheckBaseline(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.driftService.Check(c.Request.Context(), baseline.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrDriftCheckRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to check baseline",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Drift check completed",
+		"data":    report,
+	})
+}
+
+// ListReports 获取基线的检查报告列表，不包含键的明细
+func (h *BaselineHandler) ListReports(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	query := database.GetDB().Omit("missing", "unexpected", "changed").
+		Where("baseline_id = ?", baseline.ID).Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var reports []models.DriftReport
+	if err := query.Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list drift reports",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   reports,
+	})
+}
+
+// GetReport 获取检查报告详情
+func (h *BaselineHandler) GetReport(c *gin.Context) {
+	baseline, ok := h.getBaseline(c)
+	if !ok {
+		return
+	}
+
+	reportID, err := strconv.ParseUint(c.Param("report_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid report_id",
+		})
+		return
+	}
+
+	var report models.DriftReport
+	if err := database.GetDB().Where("baseline_id = ?", baseline.ID).First(&report, uint(reportID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Drift report not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   report,
+	})
+}
+
+// loadBackup 读取请求中的备份作为基线的期望状态
+func (h *BaselineHandler) loadBackup(c *gin.Context, baseline *models.Baseline, status int, message string) {
+	format := c.Query("format")
+	if format != "" && !services.IsValidExportFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported import format",
+		})
+		return
+	}
+
+	// 获取备份内容，加密备份的口令通过请求头或表单字段传递
+	var body io.Reader = c.Request.Body
+	passphrase := c.GetHeader("X-Backup-Passphrase")
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if passphrase == "" {
+			passphrase = c.PostForm("passphrase")
+		}
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Backup file is required",
+				"error":   err.Error(),
+			})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Failed to read backup file",
+				"error":   err.Error(),
+			})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	if err := h.driftService.LoadBackup(body, passphrase, format, baseline); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to load backup",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !h.reload(c, baseline) {
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"status":  "success",
+		"message": message,
+		"data":    h.baselineResponse(*baseline),
+	})
+}
+
+// validateBaseline 校验基线配置，失败时写入响应
+func (h *BaselineHandler) validateBaseline(c *gin.Context, baseline *models.Baseline) bool {
+	if err := h.driftService.ValidateBaseline(baseline); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid baseline",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// reload 更新基线的检查计划，失败时写入响应
+func (h *BaselineHandler) reload(c *gin.Context, baseline *models.Baseline) bool {
+	if err := h.driftService.Reload(baseline); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to schedule drift check",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// baselineResponse 构造基线响应
+func (h *BaselineHandler) baselineResponse(baseline models.Baseline) BaselineResponse {
+	return BaselineResponse{
+		Baseline:    baseline,
+		NextCheckAt: h.driftService.NextCheck(baseline.ID),
+	}
+}
+
+// getConnection 解析路径中的连接
+func (h *BaselineHandler) getConnection(c *gin.Context) (*models.Connection, bool) {
+	connectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid connection_id",
+		})
+		return nil, false
+	}
+
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, uint(connectionID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return nil, false
+	}
+	return &connection, true
+}
+
+// getBaseline 解析路径中的基线，基线必须属于该连接
+func (h *BaselineHandler) getBaseline(c *gin.Context) (*models.Baseline, bool) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return nil, false
+	}
+
+	baselineID, err := strconv.ParseUint(c.Param("baseline_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid baseline_id",
+		})
+		return nil, false
+	}
+
+	var baseline models.Baseline
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).First(&baseline, uint(baselineID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Baseline not found",
+		})
+		return nil, false
+	}
+	return &baseline, true
+}
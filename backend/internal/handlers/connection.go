@@ -14,34 +14,51 @@ import (
 
 // ConnectionHandler 连接管理处理器
 type ConnectionHandler struct {
-	etcdService *services.EtcdService
+	etcdService    *services.EtcdService
+	webhookService *services.WebhookService
 }
 
 // NewConnectionHandler 创建连接处理器
-func NewConnectionHandler(etcdService *services.EtcdService) *ConnectionHandler {
+func NewConnectionHandler(etcdService *services.EtcdService, webhookService *services.WebhookService) *ConnectionHandler {
 	return &ConnectionHandler{
-		etcdService: etcdService,
+		etcdService:    etcdService,
+		webhookService: webhookService,
 	}
 }
 
 // CreateConnectionRequest 创建连接请求
 type CreateConnectionRequest struct {
-	Name        string   `json:"name" binding:"required"`
-	Endpoints   []string `json:"endpoints" binding:"required"`
-	Username    string   `json:"username"`
-	Password    string   `json:"password"`
-	Description string   `json:"description"`
-	IsReadOnly  bool     `json:"is_readonly"`
+	Name           string   `json:"name" binding:"required"`
+	Endpoints      []string `json:"endpoints" binding:"required"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Description    string   `json:"description"`
+	IsReadOnly     bool     `json:"is_readonly"`
+	IsProduction   bool     `json:"is_production"`
+	TLSEnabled     bool     `json:"tls_enabled"`
+	TLSCACert      string   `json:"tls_ca_cert"`
+	TLSCert        string   `json:"tls_cert"`
+	TLSKey         string   `json:"tls_key"`
+	DialTimeout    int      `json:"dial_timeout" binding:"omitempty,min=1,max=300"`     // 秒，默认5
+	RequestTimeout int      `json:"request_timeout" binding:"omitempty,min=1,max=3600"` // 秒，默认10
 }
 
 // UpdateConnectionRequest 更新连接请求
+// Password 和 TLSKey 只写：不传表示保持不变，传空字符串表示清除
 type UpdateConnectionRequest struct {
-	Name        string   `json:"name" binding:"required"`
-	Endpoints   []string `json:"endpoints" binding:"required"`
-	Username    string   `json:"username"`
-	Password    string   `json:"password"`
-	Description string   `json:"description"`
-	IsReadOnly  bool     `json:"is_readonly"`
+	Name           string   `json:"name" binding:"required"`
+	Endpoints      []string `json:"endpoints" binding:"required"`
+	Username       string   `json:"username"`
+	Password       *string  `json:"password"`
+	Description    string   `json:"description"`
+	IsReadOnly     bool     `json:"is_readonly"`
+	IsProduction   bool     `json:"is_production"`
+	TLSEnabled     *bool    `json:"tls_enabled"`
+	TLSCACert      *string  `json:"tls_ca_cert"`
+	TLSCert        *string  `json:"tls_cert"`
+	TLSKey         *string  `json:"tls_key"`
+	DialTimeout    *int     `json:"dial_timeout" binding:"omitempty,min=1,max=300"`
+	RequestTimeout *int     `json:"request_timeout" binding:"omitempty,min=1,max=3600"`
 }
 
 // ListConnections 获取连接列表
@@ -86,17 +103,24 @@ func (h *ConnectionHandler) CreateConnection(c *gin.Context) {
 	}
 
 	connection := models.Connection{
-		Name:        req.Name,
-		Endpoints:   string(endpointsJSON),
-		Username:    req.Username,
-		Password:    req.Password,
-		Description: req.Description,
-		IsActive:    true,
-		IsReadOnly:  req.IsReadOnly,
+		Name:           req.Name,
+		Endpoints:      string(endpointsJSON),
+		Username:       req.Username,
+		Password:       req.Password,
+		Description:    req.Description,
+		IsActive:       true,
+		IsReadOnly:     req.IsReadOnly,
+		IsProduction:   req.IsProduction,
+		TLSEnabled:     req.TLSEnabled,
+		TLSCACert:      req.TLSCACert,
+		TLSCert:        req.TLSCert,
+		TLSKey:         req.TLSKey,
+		DialTimeout:    req.DialTimeout,
+		RequestTimeout: req.RequestTimeout,
 	}
 
 	// 测试连接
-	if err := h.etcdService.TestConnection(&connection); err != nil {
+	if err := h.etcdService.TestConnection(c.Request.Context(), &connection); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": "Failed to connect to etcd",
@@ -112,6 +136,7 @@ func (h *ConnectionHandler) CreateConnection(c *gin.Context) {
 		})
 		return
 	}
+	h.emit(c, &connection, services.WebhookEventConnectionCreated)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"status":  "success",
@@ -188,22 +213,39 @@ func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
 		return
 	}
 
-	// 创建临时连接用于测试
-	testConnection := models.Connection{
-		Name:        req.Name,
-		Endpoints:   string(endpointsJSON),
-		Username:    req.Username,
-		Password:    req.Password,
-		Description: req.Description,
-		IsReadOnly:  req.IsReadOnly,
-		TLSEnabled:  connection.TLSEnabled, // 保持原有TLS设置
-		CertFile:    connection.CertFile,
-		KeyFile:     connection.KeyFile,
-		CAFile:      connection.CAFile,
+	// 在副本上应用修改用于测试，未传入的凭据保持原值
+	testConnection := connection
+	testConnection.ID = 0 // 使用临时客户端测试，不影响连接池中的客户端
+	testConnection.Name = req.Name
+	testConnection.Endpoints = string(endpointsJSON)
+	testConnection.Username = req.Username
+	testConnection.Description = req.Description
+	testConnection.IsReadOnly = req.IsReadOnly
+	testConnection.IsProduction = req.IsProduction
+	if req.Password != nil {
+		testConnection.Password = *req.Password
+	}
+	if req.TLSEnabled != nil {
+		testConnection.TLSEnabled = *req.TLSEnabled
+	}
+	if req.TLSCACert != nil {
+		testConnection.TLSCACert = *req.TLSCACert
+	}
+	if req.TLSCert != nil {
+		testConnection.TLSCert = *req.TLSCert
+	}
+	if req.TLSKey != nil {
+		testConnection.TLSKey = *req.TLSKey
+	}
+	if req.DialTimeout != nil {
+		testConnection.DialTimeout = *req.DialTimeout
+	}
+	if req.RequestTimeout != nil {
+		testConnection.RequestTimeout = *req.RequestTimeout
 	}
 
 	// 测试连接
-	if err := h.etcdService.TestConnection(&testConnection); err != nil {
+	if err := h.etcdService.TestConnection(c.Request.Context(), &testConnection); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": "Failed to connect to etcd with new settings",
@@ -212,16 +254,9 @@ func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
 		return
 	}
 
-	// 关闭旧的etcd客户端连接
-	h.etcdService.CloseClient(uint(id))
-
-	// 更新连接信息
-	connection.Name = req.Name
-	connection.Endpoints = string(endpointsJSON)
-	connection.Username = req.Username
-	connection.Password = req.Password
-	connection.Description = req.Description
-	connection.IsReadOnly = req.IsReadOnly
+	// 更新连接信息，连接池根据配置哈希自动重建客户端
+	testConnection.ID = connection.ID
+	connection = testConnection
 
 	if err := database.GetDB().Save(&connection).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -230,6 +265,9 @@ func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
 		})
 		return
 	}
+	// 移出旧客户端，镜像等长时间持有客户端的Watch随之使用新配置重新开始
+	h.etcdService.CloseClient(connection.ID)
+	h.emit(c, &connection, services.WebhookEventConnectionUpdated)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
@@ -249,16 +287,26 @@ func (h *ConnectionHandler) DeleteConnection(c *gin.Context) {
 		return
 	}
 
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return
+	}
+
 	// 关闭客户端连接
-	h.etcdService.CloseClient(uint(id))
+	h.etcdService.CloseClient(connection.ID)
 
-	if err := database.GetDB().Delete(&models.Connection{}, uint(id)).Error; err != nil {
+	if err := database.GetDB().Delete(&connection).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": "Failed to delete connection",
 		})
 		return
 	}
+	h.emit(c, &connection, services.WebhookEventConnectionDeleted)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
@@ -286,8 +334,8 @@ func (h *ConnectionHandler) TestConnection(c *gin.Context) {
 		return
 	}
 
-	if err := h.etcdService.TestConnection(&connection); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+	if err := h.etcdService.TestConnection(c.Request.Context(), &connection); err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusBadRequest), gin.H{
 			"status":  "error",
 			"message": "Connection test failed",
 			"error":   err.Error(),
@@ -300,3 +348,12 @@ func (h *ConnectionHandler) TestConnection(c *gin.Context) {
 		"message": "Connection test successful",
 	})
 }
+
+// emit 发送连接事件，包含操作的用户；连接信息不包含密码和TLS私钥
+func (h *ConnectionHandler) emit(c *gin.Context, connection *models.Connection, event string) {
+	h.webhookService.EmitConnection(connection, event, map[string]interface{}{
+		"connection": connection,
+		"user_id":    c.GetUint("user_id"),
+		"username":   c.GetString("username"),
+	})
+}
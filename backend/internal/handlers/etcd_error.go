@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"etcd-admin-backend/internal/services"
+)
+
+// statusClientClosedRequest 客户端已断开连接（nginx约定的499）
+const statusClientClosedRequest = 499
+
+// etcdErrorStatus 将etcd服务错误映射为HTTP状态码，无法识别时使用fallback
+func etcdErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrEtcdTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, services.ErrEtcdPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrEtcdUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	}
+	return fallback
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// GitSyncHandler Git同步处理器
+type GitSyncHandler struct {
+	gitSyncService *services.GitSyncService
+}
+
+// NewGitSyncHandler 创建Git同步处理器
+func NewGitSyncHandler(gitSyncService *services.GitSyncService) *GitSyncHandler {
+	return &GitSyncHandler{
+		gitSyncService: gitSyncService,
+	}
+}
+
+// GitSyncRequest 创建/更新Git同步请求
+type GitSyncRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Prefix   string `json:"prefix"`
+	RepoURL  string `json:"repo_url" binding:"required,max=500"` // 本地路径或git远程地址
+	Branch   string `json:"branch" binding:"max=100"`            // 默认main
+	Path     string `json:"path" binding:"max=255"`              // 仓库中的目录，默认根目录
+	Format   string `json:"format"`                              // 推送时新建文件的格式，yaml（默认）或json
+	Mode     string `json:"mode"`                                // apply（默认）或report
+	Prune    bool   `json:"prune"`
+	Schedule string `json:"schedule"` // cron表达式，为空时只能手动同步
+	Enabled  *bool  `json:"enabled"`  // 默认true
+}
+
+// PushRequest 推送请求
+type PushRequest struct {
+	Message string `json:"message" binding:"max=1000"` // 提交说明，为空时自动生成
+}
+
+// GitSyncResponse 同步配置响应，附带下次同步时间
+type GitSyncResponse struct {
+	models.GitSync
+	NextSyncAt *time.Time `json:"next_sync_at"`
+}
+
+// apply 将请求应用到同步配置
+func (r *GitSyncRequest) apply(gs *models.GitSync) {
+	gs.Name = r.Name
+	gs.Prefix = r.Prefix
+	gs.RepoURL = r.RepoURL
+	gs.Branch = r.Branch
+	gs.Path = r.Path
+	gs.Format = r.Format
+	gs.Mode = r.Mode
+	gs.Prune = r.Prune
+	gs.Schedule = r.Schedule
+	if r.Enabled != nil {
+		gs.Enabled = *r.Enabled
+	}
+}
+
+// ListGitSyncs 获取连接的Git同步列表
+func (h *GitSyncHandler) ListGitSyncs(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var syncs []models.GitSync
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).Order("id").Find(&syncs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list git syncs",
+		})
+		return
+	}
+
+	data := make([]GitSyncResponse, 0, len(syncs))
+	for _, gs := range syncs {
+		data = append(data, h.gitSyncResponse(gs))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// CreateGitSync 创建Git同步
+func (h *GitSyncHandler) CreateGitSync(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var req GitSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	gs := models.GitSync{
+		ConnectionID: connection.ID,
+		Enabled:      true,
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	req.apply(&gs)
+	if !h.saveGitSync(c, &gs) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Git sync created successfully",
+		"data":    h.gitSyncResponse(gs),
+	})
+}
+
+// GetGitSync 获取Git同步详情
+func (h *GitSyncHandler) GetGitSync(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   h.gitSyncResponse(*gs),
+	})
+}
+
+// UpdateGitSync 更新Git同步
+func (h *GitSyncHandler) UpdateGitSync(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	var req GitSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.apply(gs)
+	if !h.saveGitSync(c, gs) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Git sync updated successfully",
+		"data":    h.gitSyncResponse(*gs),
+	})
+}
+
+// DeleteGitSync 删除Git同步及其执行记录
+func (h *GitSyncHandler) DeleteGitSync(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	if err := h.gitSyncService.Delete(gs); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrGitSyncRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to delete git sync",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Git sync deleted successfully",
+	})
+}
+
+// Pull 拉取仓库并将差异写入etcd，dry_run=true或report模式时只返回差异
+func (h *GitSyncHandler) Pull(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	dryRun := c.DefaultQuery("dry_run", "false") == "true"
+	run, err := h.gitSyncService.Pull(c.Request.Context(), gs.ID, dryRun, services.GitSyncTriggerManual, c.GetUint("user_id"))
+	if err != nil {
+		h.runError(c, "Failed to pull from repository", run, err)
+		return
+	}
+
+	message := "Pull completed"
+	if run.DryRun {
+		message = "Pull preview"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+		"data":    run,
+	})
+}
+
+// Push 将前缀下的当前键值提交并推送到仓库
+func (h *GitSyncHandler) Push(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	var req PushRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid request data",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	run, err := h.gitSyncService.Push(c.Request.Context(), gs.ID, req.Message, c.GetUint("user_id"))
+	if err != nil {
+		h.runError(c, "Failed to push to repository", run, err)
+		return
+	}
+
+	message := "Push completed"
+	if len(run.Changes) == 0 {
+		message = "Repository is up to date"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+		"data":    run,
+	})
+}
+
+// ListRuns 获取Git同步的执行记录，不包含变更的键
+func (h *GitSyncHandler) ListRuns(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	query := database.GetDB().Omit("changes").Where("sync_id = ?", gs.ID).Order("id DESC").Limit(limit)
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+
+	var runs []models.GitSyncRun
+	if err := query.Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list git sync runs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   runs,
+	})
+}
+
+// GetRun 获取执行记录详情
+func (h *GitSyncHandler) GetRun(c *gin.Context) {
+	gs, ok := h.getGitSync(c)
+	if !ok {
+		return
+	}
+
+	runID, err := strconv.ParseUint(c.Param("run_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid run_id",
+		})
+		return
+	}
+
+	var run models.GitSyncRun
+	if err := database.GetDB().Where("sync_id = ?", gs.ID).First(&run, uint(runID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Git sync run not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   run,
+	})
+}
+
+// runError 返回拉取或推送失败的响应，已保存的执行记录一并返回
+func (h *GitSyncHandler) runError(c *gin.Context, message string, run *models.GitSyncRun, err error) {
+	status := etcdErrorStatus(err, http.StatusInternalServerError)
+	switch {
+	case errors.Is(err, services.ErrGitSyncRunning), errors.Is(err, services.ErrImportConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrGitSyncReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrGitCommand):
+		status = http.StatusBadGateway
+	}
+	response := gin.H{
+		"status":  "error",
+		"message": message,
+		"error":   err.Error(),
+	}
+	if run != nil {
+		response["data"] = run
+	}
+	c.JSON(status, response)
+}
+
+// saveGitSync 校验并保存同步配置，然后更新调度
+func (h *GitSyncHandler) saveGitSync(c *gin.Context, gs *models.GitSync) bool {
+	if err := h.gitSyncService.ValidateGitSync(gs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid git sync",
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	if err := database.GetDB().Save(gs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save git sync",
+		})
+		return false
+	}
+	if err := h.gitSyncService.Reload(gs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to schedule git sync",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// gitSyncResponse 构造同步配置响应
+func (h *GitSyncHandler) gitSyncResponse(gs models.GitSync) GitSyncResponse {
+	return GitSyncResponse{
+		GitSync:    gs,
+		NextSyncAt: h.gitSyncService.NextSync(gs.ID),
+	}
+}
+
+// getConnection 解析路径中的连接
+func (h *GitSyncHandler) getConnection(c *gin.Context) (*models.Connection, bool) {
+	connectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid connection_id",
+		})
+		return nil, false
+	}
+
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, uint(connectionID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return nil, false
+	}
+	return &connection, true
+}
+
+// getGitSync 解析路径中的同步配置，配置必须属于该连接
+func (h *GitSyncHandler) getGitSync(c *gin.Context) (*models.GitSync, bool) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return nil, false
+	}
+
+	syncID, err := strconv.ParseUint(c.Param("sync_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid sync_id",
+		})
+		return nil, false
+	}
+
+	var gs models.GitSync
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).First(&gs, uint(syncID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Git sync not found",
+		})
+		return nil, false
+	}
+	return &gs, true
+}
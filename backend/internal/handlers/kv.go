@@ -14,13 +14,15 @@ import (
 
 // KVHandler KV操作处理器
 type KVHandler struct {
-	etcdService *services.EtcdService
+	etcdService    *services.EtcdService
+	webhookService *services.WebhookService
 }
 
 // NewKVHandler 创建KV处理器
-func NewKVHandler(etcdService *services.EtcdService) *KVHandler {
+func NewKVHandler(etcdService *services.EtcdService, webhookService *services.WebhookService) *KVHandler {
 	return &KVHandler{
-		etcdService: etcdService,
+		etcdService:    etcdService,
+		webhookService: webhookService,
 	}
 }
 
@@ -65,9 +67,9 @@ func (h *KVHandler) ListKeys(c *gin.Context) {
 	prefix := c.DefaultQuery("prefix", "")
 
 	// 从etcd获取键列表
-	keys, err := h.etcdService.ListKeys(&connection, prefix)
+	keys, err := h.etcdService.ListKeys(c.Request.Context(), &connection, prefix)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"status":  "error",
 			"message": "Failed to list keys",
 			"error":   err.Error(),
@@ -125,9 +127,9 @@ func (h *KVHandler) GetValue(c *gin.Context) {
 	}
 
 	// 从etcd获取值
-	value, err := h.etcdService.GetValue(&connection, key)
+	value, err := h.etcdService.GetValue(c.Request.Context(), &connection, key)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"status":  "error",
 			"message": "Key not found or failed to get value",
 			"error":   err.Error(),
@@ -222,8 +224,8 @@ func (h *KVHandler) SetValue(c *gin.Context) {
 	}
 
 	// 设置到etcd
-	if err := h.etcdService.SetValue(&connection, key, string(valueBytes)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	if err := h.etcdService.SetValue(c.Request.Context(), &connection, key, string(valueBytes)); err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"status":  "error",
 			"message": "Failed to set value",
 			"error":   err.Error(),
@@ -291,8 +293,8 @@ func (h *KVHandler) DeleteKey(c *gin.Context) {
 	}
 
 	// 从etcd删除键
-	if err := h.etcdService.DeleteKey(&connection, key); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	if err := h.etcdService.DeleteKey(c.Request.Context(), &connection, key); err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"status":  "error",
 			"message": "Failed to delete key",
 			"error":   err.Error(),
@@ -300,6 +302,12 @@ func (h *KVHandler) DeleteKey(c *gin.Context) {
 		return
 	}
 
+	h.webhookService.Emit(connection.ID, services.WebhookEventKeyDeleted, key, map[string]interface{}{
+		"key":      key,
+		"user_id":  c.GetUint("user_id"),
+		"username": c.GetString("username"),
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Key deleted successfully",
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// MFAHandler 两步验证处理器
+type MFAHandler struct {
+	mfaService *services.MFAService
+}
+
+// NewMFAHandler 创建两步验证处理器
+func NewMFAHandler(mfaService *services.MFAService) *MFAHandler {
+	return &MFAHandler{
+		mfaService: mfaService,
+	}
+}
+
+// MFACodeRequest 验证码请求
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Enroll 开始绑定TOTP，返回密钥和二维码内容
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "MFA is already enabled",
+		})
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to start MFA enrollment",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Scan the QR code and verify with a code to finish enrollment",
+		"data":    enrollment,
+	})
+}
+
+// Verify 提交首个验证码完成绑定，返回一次性恢复码
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfaService.Activate(user, req.Code)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrMFAInvalidCode) || errors.Is(err, services.ErrMFANotEnrolled) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to enable MFA",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "MFA enabled successfully, please sign in again",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// Disable 关闭自己的MFA，需要提交当前验证码
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.Verify(user, req.Code, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid verification code",
+		})
+		return
+	}
+
+	if err := h.mfaService.Disable(user, false); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrMFARequired) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to disable MFA",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "MFA disabled successfully",
+	})
+}
+
+// GetPolicy 获取MFA策略（管理员）
+func (h *MFAHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.mfaService.GetPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to load MFA policy",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "MFA policy retrieved successfully",
+		"data":    policy,
+	})
+}
+
+// UpdatePolicy 更新MFA策略（管理员）
+func (h *MFAHandler) UpdatePolicy(c *gin.Context) {
+	var policy services.MFAPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.mfaService.SavePolicy(&policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save MFA policy",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "MFA policy updated successfully",
+		"data":    policy,
+	})
+}
+
+// ResetUserMFA 重置指定用户的MFA（管理员，用于设备丢失）
+func (h *MFAHandler) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "User not found",
+		})
+		return
+	}
+
+	if err := h.mfaService.Disable(&user, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to reset MFA",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "MFA reset successfully",
+	})
+}
+
+// currentUser 获取当前登录用户，失败时已写入响应
+func (h *MFAHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := database.GetDB().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "User not found",
+		})
+		return nil, false
+	}
+	return &user, true
+}
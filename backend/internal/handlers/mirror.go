@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// MirrorHandler 连接间镜像处理器
+type MirrorHandler struct {
+	mirrorService *services.MirrorService
+}
+
+// NewMirrorHandler 创建镜像处理器
+func NewMirrorHandler(mirrorService *services.MirrorService) *MirrorHandler {
+	return &MirrorHandler{
+		mirrorService: mirrorService,
+	}
+}
+
+// MirrorRequest 创建镜像请求
+type MirrorRequest struct {
+	Name               string `json:"name" binding:"required,max=100"`
+	SourceConnectionID uint   `json:"source_connection_id" binding:"required"`
+	TargetConnectionID uint   `json:"target_connection_id" binding:"required"`
+	SourcePrefix       string `json:"source_prefix"`
+	TargetPrefix       string `json:"target_prefix"` // 为空时与源前缀相同
+}
+
+// MirrorResponse 镜像信息，运行中的镜像附带运行状态和同步延迟
+type MirrorResponse struct {
+	models.Mirror
+	State          *services.MirrorState `json:"state,omitempty"`
+	SourceRevision int64                 `json:"source_revision,omitempty"`
+	LagRevisions   *int64                `json:"lag_revisions,omitempty"` // 源当前revision与已应用revision之差
+}
+
+// ListMirrors 获取镜像列表
+func (h *MirrorHandler) ListMirrors(c *gin.Context) {
+	var mirrors []models.Mirror
+	if err := database.GetDB().Order("id").Find(&mirrors).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list mirrors",
+		})
+		return
+	}
+
+	data := make([]MirrorResponse, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		data = append(data, MirrorResponse{
+			Mirror: mirror,
+			State:  h.mirrorService.State(mirror.ID),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// CreateMirror 创建镜像，创建后立即开始全量同步
+func (h *MirrorHandler) CreateMirror(c *gin.Context) {
+	var req MirrorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.TargetPrefix == "" {
+		req.TargetPrefix = req.SourcePrefix
+	}
+
+	var source, target models.Connection
+	if err := database.GetDB().First(&source, req.SourceConnectionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Source connection not found",
+		})
+		return
+	}
+	if err := database.GetDB().First(&target, req.TargetConnectionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Target connection not found",
+		})
+		return
+	}
+	if target.IsReadOnly {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Target connection is read-only",
+		})
+		return
+	}
+
+	mirror := models.Mirror{
+		Name:               req.Name,
+		SourceConnectionID: req.SourceConnectionID,
+		TargetConnectionID: req.TargetConnectionID,
+		SourcePrefix:       req.SourcePrefix,
+		TargetPrefix:       req.TargetPrefix,
+		CreatedBy:          c.GetUint("user_id"),
+	}
+	if err := h.mirrorService.Create(&mirror); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidMirror) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to create mirror",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Mirror created successfully",
+		"data":    mirror,
+	})
+}
+
+// GetMirror 获取镜像详情，运行中的镜像返回同步延迟
+func (h *MirrorHandler) GetMirror(c *gin.Context) {
+	mirror, ok := h.getMirror(c)
+	if !ok {
+		return
+	}
+
+	response := MirrorResponse{
+		Mirror: *mirror,
+		State:  h.mirrorService.State(mirror.ID),
+	}
+	if response.State != nil {
+		// 源不可用时只返回已保存的状态
+		if revision, err := h.mirrorService.SourceRevision(c.Request.Context(), mirror); err == nil {
+			lag := max(revision-response.State.AppliedRevision, 0)
+			response.SourceRevision = revision
+			response.LagRevisions = &lag
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   response,
+	})
+}
+
+// PauseMirror 暂停镜像
+func (h *MirrorHandler) PauseMirror(c *gin.Context) {
+	mirror, ok := h.getMirror(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mirrorService.Pause(mirror); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrMirrorNotRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to pause mirror",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Mirror paused",
+		"data":    mirror,
+	})
+}
+
+// ResumeMirror 恢复镜像
+func (h *MirrorHandler) ResumeMirror(c *gin.Context) {
+	mirror, ok := h.getMirror(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mirrorService.Resume(mirror); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to resume mirror",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Mirror resumed",
+		"data":    mirror,
+	})
+}
+
+// StopMirror 停止镜像，再次恢复时重新全量同步
+func (h *MirrorHandler) StopMirror(c *gin.Context) {
+	mirror, ok := h.getMirror(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mirrorService.StopMirror(mirror); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to stop mirror",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Mirror stopped",
+		"data":    mirror,
+	})
+}
+
+// DeleteMirror 删除镜像，目标中已同步的键保留
+func (h *MirrorHandler) DeleteMirror(c *gin.Context) {
+	mirror, ok := h.getMirror(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mirrorService.Delete(mirror); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete mirror",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Mirror deleted successfully",
+	})
+}
+
+// getMirror 解析路径中的镜像
+func (h *MirrorHandler) getMirror(c *gin.Context) (*models.Mirror, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid mirror ID",
+		})
+		return nil, false
+	}
+
+	var mirror models.Mirror
+	if err := database.GetDB().First(&mirror, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Mirror not found",
+		})
+		return nil, false
+	}
+	return &mirror, true
+}
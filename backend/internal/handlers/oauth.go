@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/services"
+)
+
+const (
+	// oauthSessionCookie 保存登录会话的Cookie，回调时校验state与发起登录的浏览器一致
+	oauthSessionCookie = "etcd_admin_oauth"
+	oauthSessionPath   = "/api/v1/auth/oauth"
+)
+
+// OAuthHandler 第三方登录处理器
+type OAuthHandler struct {
+	cfg          *config.Config
+	oauthService *services.OAuthService
+	mfaService   *services.MFAService
+}
+
+// NewOAuthHandler 创建第三方登录处理器
+func NewOAuthHandler(cfg *config.Config, oauthService *services.OAuthService, mfaService *services.MFAService) *OAuthHandler {
+	return &OAuthHandler{
+		cfg:          cfg,
+		oauthService: oauthService,
+		mfaService:   mfaService,
+	}
+}
+
+// OAuthCallbackRequest 授权回调请求
+type OAuthCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// ListProviders 获取已启用的第三方登录方式
+func (h *OAuthHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Providers retrieved successfully",
+		"data": gin.H{
+			"providers": h.oauthService.Providers(),
+		},
+	})
+}
+
+// Login 获取第三方授权跳转地址
+func (h *OAuthHandler) Login(c *gin.Context) {
+	url, state, session, err := h.oauthService.AuthCodeURL(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrOAuthProviderDisabled) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to start OAuth login",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.setSessionCookie(c, session, int(services.OAuthSessionTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Authorization URL generated successfully",
+		"data": gin.H{
+			"url":   url,
+			"state": state,
+		},
+	})
+}
+
+// Callback 处理授权回调并签发JWT
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	var req OAuthCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 会话只能使用一次
+	session, _ := c.Cookie(oauthSessionCookie)
+	h.setSessionCookie(c, "", -1)
+
+	identity, err := h.oauthService.Exchange(c.Request.Context(), c.Param("provider"), req.Code, req.State, session)
+	if err != nil {
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, services.ErrOAuthProviderDisabled):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrIdentityNotAllowed):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "OAuth login failed",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	user, err := h.oauthService.LinkUser(identity)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrIdentityNotAllowed):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrIdentityConflict):
+			// 不自动接管现有账户，需要管理员处理
+			log.Printf("OAuth login of %s subject %s refused: email %s belongs to an existing account", identity.Provider, identity.Subject, identity.Email)
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to link user account",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	respondLogin(c, h.cfg, h.mfaService, user)
+}
+
+// setSessionCookie 设置或清除登录会话Cookie，maxAge小于0时清除
+func (h *OAuthHandler) setSessionCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthSessionCookie, value, maxAge, oauthSessionPath, "", secure, true)
+}
@@ -0,0 +1,515 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+const (
+	testOIDCClientID     = "etcd-admin"
+	testOIDCClientSecret = "client-secret"
+	testOIDCRedirectURL  = "http://localhost:5173/oauth/oidc/callback"
+)
+
+// mockOIDCProvider 进程内的OIDC提供方：发现文档、JWKS、授权码换取令牌（校验PKCE）和userinfo
+type mockOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthRequest // 授权码 -> 授权请求
+
+	// 签发的身份
+	subject       string
+	email         string
+	emailVerified bool
+	groups        []string
+	nonce         string // 非空时id_token使用该nonce而不是授权请求中的
+}
+
+// mockAuthRequest 授权请求中与令牌相关的参数
+type mockAuthRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockOIDCProvider{
+		t:             t,
+		key:           key,
+		codes:         make(map[string]mockAuthRequest),
+		subject:       "user-1",
+		email:         "alice@example.com",
+		emailVerified: true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/userinfo", p.userinfo)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"userinfo_endpoint":                     p.server.URL + "/userinfo",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *mockOIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	encode := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encode(p.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	req, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	nonce := req.nonce
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.server.URL,
+		"sub":   p.subject,
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+		"email": p.email,
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		p.t.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access-" + p.subject,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (p *mockOIDCProvider) userinfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access-"+p.subject {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"sub":            p.subject,
+		"email":          p.email,
+		"email_verified": p.emailVerified,
+		"groups":         p.groups,
+	})
+}
+
+// authorize 模拟用户在提供方完成授权，返回回调中的授权码
+func (p *mockOIDCProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := u.Query()
+	if !strings.HasPrefix(authURL, p.server.URL+"/authorize?") {
+		p.t.Fatalf("unexpected authorization url %s", authURL)
+	}
+	if query.Get("client_id") != testOIDCClientID || query.Get("redirect_uri") != testOIDCRedirectURL {
+		p.t.Fatalf("unexpected client in authorization url %s", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization url is missing the PKCE challenge: %s", authURL)
+	}
+	if query.Get("nonce") == "" || query.Get("state") == "" {
+		p.t.Fatalf("authorization url is missing the state or nonce: %s", authURL)
+	}
+
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.codes[code] = mockAuthRequest{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	p.mu.Unlock()
+	return code
+}
+
+// oauthLogin 发起的一次登录
+type oauthLogin struct {
+	state  string
+	code   string
+	cookie *http.Cookie
+}
+
+// oauthTestEnv 测试用的数据库、配置和路由
+type oauthTestEnv struct {
+	provider *mockOIDCProvider
+	cfg      *config.Config
+	router   *gin.Engine
+}
+
+func newOAuthTestEnv(t *testing.T, configure func(cfg *config.OIDCConfig)) *oauthTestEnv {
+	gin.SetMode(gin.TestMode)
+	provider := newMockOIDCProvider(t)
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")},
+		Server:   config.ServerConfig{JWTKey: "test-jwt-key"},
+		OAuth: config.OAuthConfig{OIDC: config.OIDCConfig{
+			Enabled:      true,
+			IssuerURL:    provider.server.URL,
+			ClientID:     testOIDCClientID,
+			ClientSecret: testOIDCClientSecret,
+			RedirectURL:  testOIDCRedirectURL,
+			Scopes:       []string{"openid", "profile", "email"},
+			GroupsClaim:  "groups",
+		}},
+	}
+	if configure != nil {
+		configure(&cfg.OAuth.OIDC)
+	}
+	if err := database.InitDatabase(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	handler := NewOAuthHandler(cfg, services.NewOAuthService(cfg), services.NewMFAService())
+	router.GET("/api/v1/auth/oauth/:provider/login", handler.Login)
+	router.POST("/api/v1/auth/oauth/:provider/callback", handler.Callback)
+	return &oauthTestEnv{provider: provider, cfg: cfg, router: router}
+}
+
+// login 获取授权地址和会话Cookie，并在提供方完成授权
+func (e *oauthTestEnv) login(t *testing.T) oauthLogin {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oauth/oidc/login", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			URL   string `json:"url"`
+			State string `json:"state"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	login := oauthLogin{state: resp.Data.State, code: e.provider.authorize(resp.Data.URL)}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oauthSessionCookie {
+			login.cookie = cookie
+		}
+	}
+	if login.cookie == nil || !login.cookie.HttpOnly || login.cookie.Path != oauthSessionPath {
+		t.Fatalf("login did not set an HttpOnly session cookie: %v", w.Result().Cookies())
+	}
+	return login
+}
+
+// callback 以浏览器的身份提交回调
+func (e *oauthTestEnv) callback(cookie *http.Cookie, code, state string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(OAuthCallbackRequest{Code: code, State: state})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/oauth/oidc/callback", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// loginResponse 解析登录成功的响应
+func loginResponse(t *testing.T, w *httptest.ResponseRecorder) LoginResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data LoginResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Token == "" || resp.Data.User == nil {
+		t.Fatalf("callback did not issue a token: %s", w.Body)
+	}
+	return resp.Data
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestOAuthCallbackProvisionsUser(t *testing.T) {
+	env := newOAuthTestEnv(t, func(cfg *config.OIDCConfig) {
+		cfg.RoleMapping = map[string]string{"etcd-admins": models.RoleAdmin}
+	})
+	env.provider.groups = []string{"etcd-admins"}
+
+	login := env.login(t)
+	first := loginResponse(t, env.callback(login.cookie, login.code, login.state))
+
+	var user models.User
+	if err := database.GetDB().First(&user, first.User.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.AuthProvider != models.AuthProviderOIDC || user.ExternalID != "user-1" || user.Email != "alice@example.com" {
+		t.Errorf("unexpected provisioned user: %+v", user)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("role = %q, want %q from the group mapping", user.Role, models.RoleAdmin)
+	}
+
+	// 再次登录使用同一账户
+	login = env.login(t)
+	second := loginResponse(t, env.callback(login.cookie, login.code, login.state))
+	if second.User.ID != first.User.ID {
+		t.Errorf("second login signed in as user %d, want %d", second.User.ID, first.User.ID)
+	}
+	var count int64
+	database.GetDB().Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users exist after two logins, want 1", count)
+	}
+
+	// 从映射的组中移除后，下次登录降级为普通用户
+	env.provider.groups = nil
+	login = env.login(t)
+	third := loginResponse(t, env.callback(login.cookie, login.code, login.state))
+	if err := database.GetDB().First(&user, third.User.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleUser {
+		t.Errorf("role after leaving the admin group = %q, want %q", user.Role, models.RoleUser)
+	}
+}
+
+func TestOAuthCallbackRejectsInvalidState(t *testing.T) {
+	env := newOAuthTestEnv(t, nil)
+
+	tests := []struct {
+		name     string
+		callback func(login, other oauthLogin) *httptest.ResponseRecorder
+	}{
+		{
+			name: "missing cookie",
+			callback: func(login, _ oauthLogin) *httptest.ResponseRecorder {
+				return env.callback(nil, login.code, login.state)
+			},
+		},
+		{
+			name: "state mismatch",
+			callback: func(login, _ oauthLogin) *httptest.ResponseRecorder {
+				return env.callback(login.cookie, login.code, "forged-state")
+			},
+		},
+		{
+			// 攻击者把自己发起的登录的state和授权码交给另一个浏览器
+			name: "state from another browser",
+			callback: func(login, other oauthLogin) *httptest.ResponseRecorder {
+				return env.callback(login.cookie, other.code, other.state)
+			},
+		},
+		{
+			name: "tampered cookie",
+			callback: func(login, _ oauthLogin) *httptest.ResponseRecorder {
+				cookie := *login.cookie
+				cookie.Value += "x"
+				return env.callback(&cookie, login.code, login.state)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.callback(env.login(t), env.login(t))
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status %d, want 401: %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	var count int64
+	database.GetDB().Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d users were created by rejected callbacks", count)
+	}
+}
+
+func TestOAuthCallbackSessionIsSingleUse(t *testing.T) {
+	env := newOAuthTestEnv(t, nil)
+
+	login := env.login(t)
+	w := env.callback(login.cookie, login.code, login.state)
+	loginResponse(t, w)
+
+	var cleared bool
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oauthSessionCookie && cookie.MaxAge < 0 {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Errorf("callback did not clear the session cookie")
+	}
+}
+
+func TestOAuthCallbackRejectsNonceMismatch(t *testing.T) {
+	env := newOAuthTestEnv(t, nil)
+	env.provider.nonce = "replayed-nonce"
+
+	login := env.login(t)
+	if w := env.callback(login.cookie, login.code, login.state); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401: %s", w.Code, w.Body)
+	}
+}
+
+func TestOAuthCallbackAccountLinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		autoLink      bool
+		emailVerified bool
+		linkedTo      string // 现有账户已关联的GitHub身份
+		wantStatus    int
+	}{
+		{name: "auto-link disabled", autoLink: false, emailVerified: true, wantStatus: http.StatusConflict},
+		{name: "email not verified", autoLink: true, emailVerified: false, wantStatus: http.StatusConflict},
+		{name: "linked to another identity", autoLink: true, emailVerified: true, linkedTo: "gh-1", wantStatus: http.StatusConflict},
+		{name: "auto-link enabled", autoLink: true, emailVerified: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOAuthTestEnv(t, func(cfg *config.OIDCConfig) {
+				cfg.AutoLink = tt.autoLink
+				cfg.RoleMapping = map[string]string{"etcd-admins": models.RoleAdmin}
+			})
+			env.provider.emailVerified = tt.emailVerified
+			env.provider.groups = []string{"etcd-admins"}
+
+			local := models.User{
+				Username: "alice",
+				Email:    "alice@example.com",
+				Password: "password123",
+				Role:     models.RoleUser,
+				IsActive: true,
+			}
+			if tt.linkedTo != "" {
+				local.AuthProvider = models.AuthProviderGitHub
+				local.ExternalID = tt.linkedTo
+			}
+			if err := database.GetDB().Create(&local).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			login := env.login(t)
+			w := env.callback(login.cookie, login.code, login.state)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if resp := loginResponse(t, w); resp.User.ID != local.ID {
+					t.Errorf("signed in as user %d, want the existing user %d", resp.User.ID, local.ID)
+				}
+			}
+
+			// 关联后记录外部身份并按映射同步角色，未关联时现有账户不被修改；本地密码都仍然有效
+			var user models.User
+			if err := database.GetDB().First(&user, local.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			wantProvider, wantExternalID, wantRole := local.AuthProvider, local.ExternalID, models.RoleUser
+			if wantProvider == "" {
+				wantProvider = models.AuthProviderLocal
+			}
+			if tt.wantStatus == http.StatusOK {
+				wantProvider, wantExternalID, wantRole = models.AuthProviderOIDC, "user-1", models.RoleAdmin
+			}
+			if user.AuthProvider != wantProvider || user.ExternalID != wantExternalID || user.Role != wantRole {
+				t.Errorf("account = provider %q external_id %q role %q, want %q %q %q",
+					user.AuthProvider, user.ExternalID, user.Role, wantProvider, wantExternalID, wantRole)
+			}
+			if err := user.CheckPassword("password123"); err != nil {
+				t.Errorf("existing account password no longer works: %v", err)
+			}
+			var count int64
+			database.GetDB().Model(&models.User{}).Count(&count)
+			if count != 1 {
+				t.Errorf("%d users exist, want only the existing account", count)
+			}
+
+			// 关联后按外部ID查找，IdP中的邮箱改变后仍登录同一账户
+			if tt.wantStatus == http.StatusOK {
+				env.provider.email = "alice@new.example.com"
+				login := env.login(t)
+				if resp := loginResponse(t, env.callback(login.cookie, login.code, login.state)); resp.User.ID != local.ID {
+					t.Errorf("login after the email changed signed in as user %d, want %d", resp.User.ID, local.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// PipelineHandler 环境晋级流水线处理器
+type PipelineHandler struct {
+	pipelineService *services.PipelineService
+}
+
+// NewPipelineHandler 创建流水线处理器
+func NewPipelineHandler(pipelineService *services.PipelineService) *PipelineHandler {
+	return &PipelineHandler{
+		pipelineService: pipelineService,
+	}
+}
+
+// PipelineRequest 创建或更新流水线请求
+type PipelineRequest struct {
+	Name         string                       `json:"name" binding:"required,max=100"`
+	Description  string                       `json:"description" binding:"max=255"`
+	Environments []models.PipelineEnvironment `json:"environments" binding:"required"`
+	Ignore       []string                     `json:"ignore"`
+}
+
+// PromoteRequest 晋级请求
+type PromoteRequest struct {
+	From           string `json:"from" binding:"required"` // 晋级到该环境的下一个环境
+	IncludeDeletes bool   `json:"include_deletes"`         // 下一个环境中多出的键作为删除变更
+}
+
+// ApplyPromotionRequest 应用晋级请求
+type ApplyPromotionRequest struct {
+	Keys []string `json:"keys"` // 要应用的相对键，为空时应用全部待应用的变更
+}
+
+// ListPipelines 获取流水线列表
+func (h *PipelineHandler) ListPipelines(c *gin.Context) {
+	var pipelines []models.Pipeline
+	if err := database.GetDB().Order("id").Find(&pipelines).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list pipelines",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   pipelines,
+	})
+}
+
+// CreatePipeline 创建流水线
+func (h *PipelineHandler) CreatePipeline(c *gin.Context) {
+	var req PipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	pipeline := models.Pipeline{
+		Name:         req.Name,
+		Description:  req.Description,
+		Environments: req.Environments,
+		Ignore:       req.Ignore,
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	if !h.savePipeline(c, &pipeline) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Pipeline created successfully",
+		"data":    pipeline,
+	})
+}
+
+// GetPipeline 获取流水线详情
+func (h *PipelineHandler) GetPipeline(c *gin.Context) {
+	pipeline, ok := h.getPipeline(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   pipeline,
+	})
+}
+
+// UpdatePipeline 更新流水线，已创建的晋级不受影响
+func (h *PipelineHandler) UpdatePipeline(c *gin.Context) {
+	pipeline, ok := h.getPipeline(c)
+	if !ok {
+		return
+	}
+
+	var req PipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	pipeline.Name = req.Name
+	pipeline.Description = req.Description
+	pipeline.Environments = req.Environments
+	pipeline.Ignore = req.Ignore
+	if !h.savePipeline(c, pipeline) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Pipeline updated successfully",
+		"data":    pipeline,
+	})
+}
+
+// DeletePipeline 删除流水线及其晋级记录
+func (h *PipelineHandler) DeletePipeline(c *gin.Context) {
+	pipeline, ok := h.getPipeline(c)
+	if !ok {
+		return
+	}
+
+	if err := h.pipelineService.Delete(pipeline); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete pipeline",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Pipeline deleted successfully",
+	})
+}
+
+// Promote 比较指定环境与下一个环境，创建待应用的晋级
+func (h *PipelineHandler) Promote(c *gin.Context) {
+	pipeline, ok := h.getPipeline(c)
+	if !ok {
+		return
+	}
+
+	var req PromoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	promotion, err := h.pipelineService.Promote(c.Request.Context(), pipeline, req.From, req.IncludeDeletes, c.GetUint("user_id"))
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrInvalidPipeline) || errors.Is(err, services.ErrInvalidDiffOptions) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to create promotion",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if promotion == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "No changes to promote",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Promotion created",
+		"data":    promotion,
+	})
+}
+
+// ListPromotions 获取流水线的晋级列表，可按状态过滤
+func (h *PipelineHandler) ListPromotions(c *gin.Context) {
+	pipeline, ok := h.getPipeline(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	query := database.GetDB().Where("pipeline_id = ?", pipeline.ID).Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var promotions []models.Promotion
+	if err := query.Find(&promotions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list promotions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   promotions,
+	})
+}
+
+// GetPromotion 获取晋级详情及其变更，可按变更状态过滤
+func (h *PipelineHandler) GetPromotion(c *gin.Context) {
+	promotion, ok := h.getPromotion(c)
+	if !ok {
+		return
+	}
+
+	query := database.GetDB().Where("promotion_id = ?", promotion.ID).Order("`key`")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&promotion.Items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch promotion items",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   promotion,
+	})
+}
+
+// ApplyPromotion 应用晋级中全部或指定键的变更
+func (h *PipelineHandler) ApplyPromotion(c *gin.Context) {
+	promotion, ok := h.getPromotion(c)
+	if !ok {
+		return
+	}
+
+	var req ApplyPromotionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid request data",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	var target models.Connection
+	if err := database.GetDB().First(&target, promotion.TargetConnectionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Target connection not found",
+		})
+		return
+	}
+	if target.IsReadOnly {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Target connection is read-only",
+		})
+		return
+	}
+
+	result, err := h.pipelineService.Apply(c.Request.Context(), promotion, req.Keys, c.GetUint("user_id"))
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrPromotionClosed) || errors.Is(err, services.ErrImportConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to apply promotion",
+			"error":   err.Error(),
+			"data":    result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Promotion applied",
+		"data":    result,
+	})
+}
+
+// DiscardPromotion 放弃晋级，剩余的变更不再应用
+func (h *PipelineHandler) DiscardPromotion(c *gin.Context) {
+	promotion, ok := h.getPromotion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.pipelineService.Discard(promotion); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPromotionClosed) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to discard promotion",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Promotion discarded",
+		"data":    promotion,
+	})
+}
+
+// savePipeline 校验并保存流水线
+func (h *PipelineHandler) savePipeline(c *gin.Context, pipeline *models.Pipeline) bool {
+	if err := h.pipelineService.ValidatePipeline(pipeline); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid pipeline",
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	var count int64
+	database.GetDB().Model(&models.Pipeline{}).Where("name = ? AND id <> ?", pipeline.Name, pipeline.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Pipeline name already exists",
+		})
+		return false
+	}
+
+	if err := database.GetDB().Save(pipeline).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save pipeline",
+		})
+		return false
+	}
+	return true
+}
+
+// getPipeline 解析路径中的流水线
+func (h *PipelineHandler) getPipeline(c *gin.Context) (*models.Pipeline, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid pipeline ID",
+		})
+		return nil, false
+	}
+
+	var pipeline models.Pipeline
+	if err := database.GetDB().First(&pipeline, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Pipeline not found",
+		})
+		return nil, false
+	}
+	return &pipeline, true
+}
+
+// getPromotion 解析路径中的晋级
+func (h *PipelineHandler) getPromotion(c *gin.Context) (*models.Promotion, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid promotion ID",
+		})
+		return nil, false
+	}
+
+	var promotion models.Promotion
+	if err := database.GetDB().First(&promotion, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Promotion not found",
+		})
+		return nil, false
+	}
+	return &promotion, true
+}
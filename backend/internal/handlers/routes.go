@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 
 	"etcd-admin-backend/internal/config"
@@ -9,13 +11,65 @@ import (
 )
 
 // SetupRoutes 设置路由
-func SetupRoutes(r *gin.Engine, cfg *config.Config, etcdService *services.EtcdService) {
+func SetupRoutes(r *gin.Engine, cfg *config.Config, etcdService *services.EtcdService, backupCrypto *services.BackupCrypto) {
 	// 创建处理器
-	authHandler := NewAuthHandler(cfg)
-	connectionHandler := NewConnectionHandler(etcdService)
-	kvHandler := NewKVHandler(etcdService)
-	backupHandler := NewBackupHandler(etcdService)
-	transferHandler := NewTransferHandler(etcdService)
+	mfaService := services.NewMFAService()
+	loginGuard := services.NewLoginGuard(cfg)
+	auditService := services.NewAuditService()
+	authHandler := NewAuthHandler(cfg, mfaService, services.NewLDAPService(cfg), loginGuard, auditService)
+	adminHandler := NewAdminHandler(loginGuard, auditService)
+	oauthHandler := NewOAuthHandler(cfg, services.NewOAuthService(cfg), mfaService)
+	mfaHandler := NewMFAHandler(mfaService)
+	tokenHandler := NewTokenHandler()
+
+	// Webhook通知，其他服务在操作完成后通过它发送事件
+	webhookService := services.NewWebhookService(cfg, etcdService)
+	if err := webhookService.Start(); err != nil {
+		log.Printf("Failed to start webhooks: %v", err)
+	}
+	connectionHandler := NewConnectionHandler(etcdService, webhookService)
+	webhookHandler := NewWebhookHandler(webhookService)
+	kvHandler := NewKVHandler(etcdService, webhookService)
+
+	// 后台传输任务
+	transferService := services.NewTransferService(etcdService, webhookService)
+	if err := transferService.Start(); err != nil {
+		log.Printf("Failed to recover transfer jobs: %v", err)
+	}
+	transferHandler := NewTransferHandler(etcdService, transferService)
+
+	// 连接间持续镜像
+	mirrorService := services.NewMirrorService(etcdService, webhookService)
+	if err := mirrorService.Start(); err != nil {
+		log.Printf("Failed to start mirrors: %v", err)
+	}
+	mirrorHandler := NewMirrorHandler(mirrorService)
+	pipelineHandler := NewPipelineHandler(services.NewPipelineService(etcdService, webhookService))
+
+	// 备份存储与定时备份调度器
+	backupService := services.NewBackupService(etcdService, backupCrypto)
+	backupStorages := services.NewBackupStorageService(cfg)
+	backupScheduler := services.NewBackupScheduler(cfg, etcdService, backupService, backupStorages, webhookService)
+	if err := backupScheduler.Start(); err != nil {
+		log.Printf("Failed to start backup scheduler: %v", err)
+	}
+	backupHandler := NewBackupHandler(etcdService, backupService, backupScheduler, webhookService)
+	backupJobHandler := NewBackupJobHandler(backupScheduler, backupStorages)
+
+	// 漂移检测
+	driftService := services.NewDriftService(etcdService, backupService)
+	if err := driftService.Start(); err != nil {
+		log.Printf("Failed to start drift checks: %v", err)
+	}
+	baselineHandler := NewBaselineHandler(driftService)
+
+	// Git同步
+	gitSyncService := services.NewGitSyncService(cfg, etcdService, webhookService)
+	if err := gitSyncService.Start(); err != nil {
+		log.Printf("Failed to start git syncs: %v", err)
+	}
+	gitSyncHandler := NewGitSyncHandler(gitSyncService)
+	storageLocationHandler := NewStorageLocationHandler(backupStorages)
 
 	// API路由组
 	api := r.Group("/api/v1")
@@ -23,25 +77,60 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, etcdService *services.EtcdSe
 	// 公开路由（不需要认证）
 	{
 		api.POST("/auth/login", authHandler.Login)
+		api.POST("/auth/login/mfa", authHandler.LoginMFA)
 		api.POST("/auth/register", authHandler.Register)
+
+		// 第三方登录
+		api.GET("/auth/oauth/providers", oauthHandler.ListProviders)
+		api.GET("/auth/oauth/:provider/login", oauthHandler.Login)
+		api.POST("/auth/oauth/:provider/callback", oauthHandler.Callback)
 	}
 
 	// 需要认证的路由
 	protected := api.Group("")
-	protected.Use(middleware.JWTAuth(cfg))
+	protected.Use(middleware.JWTAuth(cfg), middleware.EnforceMFASetup(), middleware.RequireTokenScope())
 	{
 		// 用户相关路由
 		protected.GET("/auth/profile", authHandler.GetProfile)
 		protected.POST("/auth/logout", authHandler.Logout)
 
+		// 两步验证路由
+		mfa := protected.Group("/auth/mfa")
+		mfa.Use(middleware.RequireSession())
+		{
+			mfa.POST("/enroll", mfaHandler.Enroll)
+			mfa.POST("/verify", mfaHandler.Verify)
+			mfa.POST("/disable", mfaHandler.Disable)
+		}
+
+		// 个人访问令牌路由
+		tokens := protected.Group("/auth/profile/tokens")
+		tokens.Use(middleware.RequireSession())
+		{
+			tokens.GET("", tokenHandler.ListTokens)
+			tokens.POST("", tokenHandler.CreateToken)
+			tokens.DELETE("/:token_id", tokenHandler.DeleteToken)
+		}
+
 		// 管理员路由
 		admin := protected.Group("/admin")
-		admin.Use(middleware.RequireRole("admin"))
+		admin.Use(middleware.RequireRole("admin"), middleware.RequireScope("admin"))
 		{
 			// 这里可以添加管理员专用的路由
 			admin.GET("/users", func(c *gin.Context) {
 				c.JSON(200, gin.H{"message": "Admin users endpoint"})
 			})
+			admin.GET("/mfa-policy", mfaHandler.GetPolicy)
+			admin.PUT("/mfa-policy", mfaHandler.UpdatePolicy)
+			admin.DELETE("/users/:id/mfa", mfaHandler.ResetUserMFA)
+			admin.POST("/users/:id/unlock", adminHandler.UnlockUser)
+			admin.POST("/ips/:ip/unlock", adminHandler.UnlockIP)
+			admin.GET("/audit-logs", adminHandler.ListAuditLogs)
+
+			// 备份存储位置管理
+			admin.POST("/storage-locations", storageLocationHandler.CreateLocation)
+			admin.PUT("/storage-locations/:id", storageLocationHandler.UpdateLocation)
+			admin.DELETE("/storage-locations/:id", storageLocationHandler.DeleteLocation)
 		}
 
 		// 连接管理路由
@@ -63,13 +152,105 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, etcdService *services.EtcdSe
 			// 备份与导入路由
 			connections.GET("/:id/backup/export", backupHandler.ExportBackup)
 			connections.POST("/:id/backup/import", backupHandler.ImportBackup)
+
+			// 定时备份路由
+			connections.GET("/:id/backup-jobs", backupJobHandler.ListJobs)
+			connections.POST("/:id/backup-jobs", backupJobHandler.CreateJob)
+			connections.PUT("/:id/backup-jobs/:job_id", backupJobHandler.UpdateJob)
+			connections.DELETE("/:id/backup-jobs/:job_id", backupJobHandler.DeleteJob)
+			connections.POST("/:id/backup-jobs/:job_id/run", backupJobHandler.RunJob)
+			connections.GET("/:id/backup-jobs/:job_id/runs", backupJobHandler.ListRuns)
+			connections.GET("/:id/backups", backupJobHandler.ListBackups)
+			connections.GET("/:id/backups/:run_id/download", backupJobHandler.DownloadBackup)
+			connections.DELETE("/:id/backups/:run_id", backupJobHandler.DeleteBackup)
+
+			// 漂移检测路由
+			connections.GET("/:id/baselines", baselineHandler.ListBaselines)
+			connections.POST("/:id/baselines", baselineHandler.CreateBaseline)
+			connections.POST("/:id/baselines/import", baselineHandler.ImportBaseline)
+			connections.GET("/:id/baselines/:baseline_id", baselineHandler.GetBaseline)
+			connections.PUT("/:id/baselines/:baseline_id", baselineHandler.UpdateBaseline)
+			connections.DELETE("/:id/baselines/:baseline_id", baselineHandler.DeleteBaseline)
+			connections.POST("/:id/baselines/:baseline_id/capture", baselineHandler.CaptureBaseline)
+			connections.POST("/:id/baselines/:baseline_id/import", baselineHandler.ReloadBaseline)
+			connections.GET("/:id/baselines/:baseline_id/items", baselineHandler.ListItems)
+			connections.POST("/:id/baselines/:baseline_id/check", baselineHandler.CheckBaseline)
+			connections.GET("/:id/baselines/:baseline_id/reports", baselineHandler.ListReports)
+			connections.GET("/:id/baselines/:baseline_id/reports/:report_id", baselineHandler.GetReport)
+
+			// Git同步路由
+			connections.GET("/:id/git-syncs", gitSyncHandler.ListGitSyncs)
+			connections.POST("/:id/git-syncs", gitSyncHandler.CreateGitSync)
+			connections.GET("/:id/git-syncs/:sync_id", gitSyncHandler.GetGitSync)
+			connections.PUT("/:id/git-syncs/:sync_id", gitSyncHandler.UpdateGitSync)
+			connections.DELETE("/:id/git-syncs/:sync_id", gitSyncHandler.DeleteGitSync)
+			connections.POST("/:id/git-syncs/:sync_id/pull", gitSyncHandler.Pull)
+			connections.POST("/:id/git-syncs/:sync_id/push", gitSyncHandler.Push)
+			connections.GET("/:id/git-syncs/:sync_id/runs", gitSyncHandler.ListRuns)
+			connections.GET("/:id/git-syncs/:sync_id/runs/:run_id", gitSyncHandler.GetRun)
+
+			// Webhook路由
+			connections.GET("/:id/webhooks", webhookHandler.ListWebhooks)
+			connections.POST("/:id/webhooks", webhookHandler.CreateWebhook)
+			connections.GET("/:id/webhooks/:webhook_id", webhookHandler.GetWebhook)
+			connections.PUT("/:id/webhooks/:webhook_id", webhookHandler.UpdateWebhook)
+			connections.DELETE("/:id/webhooks/:webhook_id", webhookHandler.DeleteWebhook)
+			connections.POST("/:id/webhooks/:webhook_id/test", webhookHandler.TestWebhook)
+			connections.GET("/:id/webhooks/:webhook_id/deliveries", webhookHandler.ListDeliveries)
+			connections.GET("/:id/webhooks/:webhook_id/deliveries/:delivery_id", webhookHandler.GetDelivery)
+			connections.POST("/:id/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", webhookHandler.Redeliver)
 		}
 
+		// 备份签名公钥，用于在其他实例中配置信任
+		protected.GET("/backup/signing-key", backupHandler.GetSigningKey)
+
+		// 备份存储位置路由
+		protected.GET("/storage-locations", storageLocationHandler.ListLocations)
+		protected.GET("/storage-locations/:id/objects", storageLocationHandler.ListObjects)
+
 		// KV 传输路由
 		transferGroup := protected.Group("/transfer")
 		{
 			transferGroup.POST("", transferHandler.TransferKV)
+			transferGroup.POST("/diff", transferHandler.DiffKV)
+			transferGroup.POST("/preview", transferHandler.PreviewTransfer)
+			transferGroup.GET("/jobs", transferHandler.ListJobs)
+			transferGroup.GET("/jobs/:job_id", transferHandler.GetJob)
+			transferGroup.GET("/jobs/:job_id/keys", transferHandler.ListJobKeys)
+			transferGroup.POST("/jobs/:job_id/cancel", transferHandler.CancelJob)
+			transferGroup.POST("/jobs/:job_id/rollback", transferHandler.RollbackJob)
+			transferGroup.GET("/jobs/:job_id/events", transferHandler.JobEvents)
 			transferGroup.POST("/copy/:key", transferHandler.CopyKey)
 		}
+
+		// 镜像路由
+		mirrors := protected.Group("/mirrors")
+		{
+			mirrors.GET("", mirrorHandler.ListMirrors)
+			mirrors.POST("", mirrorHandler.CreateMirror)
+			mirrors.GET("/:id", mirrorHandler.GetMirror)
+			mirrors.DELETE("/:id", mirrorHandler.DeleteMirror)
+			mirrors.POST("/:id/pause", mirrorHandler.PauseMirror)
+			mirrors.POST("/:id/resume", mirrorHandler.ResumeMirror)
+			mirrors.POST("/:id/stop", mirrorHandler.StopMirror)
+		}
+
+		// 环境晋级路由
+		pipelines := protected.Group("/pipelines")
+		{
+			pipelines.GET("", pipelineHandler.ListPipelines)
+			pipelines.POST("", pipelineHandler.CreatePipeline)
+			pipelines.GET("/:id", pipelineHandler.GetPipeline)
+			pipelines.PUT("/:id", pipelineHandler.UpdatePipeline)
+			pipelines.DELETE("/:id", pipelineHandler.DeletePipeline)
+			pipelines.POST("/:id/promote", pipelineHandler.Promote)
+			pipelines.GET("/:id/promotions", pipelineHandler.ListPromotions)
+		}
+		promotions := protected.Group("/promotions")
+		{
+			promotions.GET("/:id", pipelineHandler.GetPromotion)
+			promotions.POST("/:id/apply", pipelineHandler.ApplyPromotion)
+			promotions.POST("/:id/discard", pipelineHandler.DiscardPromotion)
+		}
 	}
 }
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// StorageLocationHandler 备份存储位置处理器
+type StorageLocationHandler struct {
+	storages *services.BackupStorageService
+}
+
+// NewStorageLocationHandler 创建备份存储位置处理器
+func NewStorageLocationHandler(storages *services.BackupStorageService) *StorageLocationHandler {
+	return &StorageLocationHandler{
+		storages: storages,
+	}
+}
+
+// StorageLocationRequest 创建/更新存储位置请求
+type StorageLocationRequest struct {
+	Name        string  `json:"name" binding:"required,max=100"`
+	Type        string  `json:"type" binding:"required,oneof=local s3"`
+	Description string  `json:"description"`
+	Path        string  `json:"path"`
+	Endpoint    string  `json:"endpoint"`
+	Region      string  `json:"region"`
+	Bucket      string  `json:"bucket"`
+	Prefix      string  `json:"prefix"`
+	AccessKey   string  `json:"access_key"`
+	SecretKey   *string `json:"secret_key"` // 更新时不传则保持原值
+	UseSSL      bool    `json:"use_ssl"`
+	PathStyle   bool    `json:"path_style"`
+}
+
+// apply 将请求应用到存储位置
+func (r *StorageLocationRequest) apply(location *models.StorageLocation) {
+	location.Name = r.Name
+	location.Type = r.Type
+	location.Description = r.Description
+	location.Path = r.Path
+	location.Endpoint = r.Endpoint
+	location.Region = r.Region
+	location.Bucket = r.Bucket
+	location.Prefix = r.Prefix
+	location.AccessKey = r.AccessKey
+	location.UseSSL = r.UseSSL
+	location.PathStyle = r.PathStyle
+	if r.SecretKey != nil {
+		location.SecretKey = *r.SecretKey
+	}
+}
+
+// ListLocations 获取存储位置列表，第一项为内置的本地存储
+func (h *StorageLocationHandler) ListLocations(c *gin.Context) {
+	var locations []models.StorageLocation
+	if err := database.GetDB().Order("id").Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list storage locations",
+		})
+		return
+	}
+
+	data := append([]models.StorageLocation{{
+		Name: services.DefaultStorageName,
+		Type: models.StorageTypeLocal,
+	}}, locations...)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// CreateLocation 创建存储位置，保存前检查存储是否可用
+func (h *StorageLocationHandler) CreateLocation(c *gin.Context) {
+	var req StorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	location := models.StorageLocation{CreatedBy: c.GetUint("user_id")}
+	req.apply(&location)
+	if !h.checkLocation(c, &location) {
+		return
+	}
+
+	if err := database.GetDB().Create(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to create storage location",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Storage location created successfully",
+		"data":    location,
+	})
+}
+
+// UpdateLocation 更新存储位置
+func (h *StorageLocationHandler) UpdateLocation(c *gin.Context) {
+	location, ok := h.getLocation(c)
+	if !ok {
+		return
+	}
+
+	var req StorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.apply(location)
+	if !h.checkLocation(c, location) {
+		return
+	}
+
+	if err := database.GetDB().Save(location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to update storage location",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Storage location updated successfully",
+		"data":    location,
+	})
+}
+
+// DeleteLocation 删除存储位置，仍被备份任务使用时拒绝删除
+func (h *StorageLocationHandler) DeleteLocation(c *gin.Context) {
+	location, ok := h.getLocation(c)
+	if !ok {
+		return
+	}
+
+	var jobCount int64
+	if err := database.GetDB().Model(&models.BackupJob{}).Where("storage_id = ?", location.ID).Count(&jobCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete storage location",
+		})
+		return
+	}
+	if jobCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Storage location is used by backup jobs",
+		})
+		return
+	}
+
+	if err := database.GetDB().Delete(location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete storage location",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Storage location deleted successfully",
+	})
+}
+
+// ListObjects 列出存储中的备份文件，id为0表示内置的本地存储
+func (h *StorageLocationHandler) ListObjects(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid storage location ID",
+		})
+		return
+	}
+
+	storage, err := h.storages.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Storage location not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	objects, err := storage.List(c.Request.Context(), c.DefaultQuery("prefix", ""))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "Failed to list storage",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   objects,
+	})
+}
+
+// checkLocation 校验配置并检查存储是否可用
+func (h *StorageLocationHandler) checkLocation(c *gin.Context, location *models.StorageLocation) bool {
+	storage, err := services.NewBackupStorage(location)
+	if err == nil {
+		err = storage.Check(c.Request.Context())
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Storage location is not available",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// getLocation 解析路径中的存储位置
+func (h *StorageLocationHandler) getLocation(c *gin.Context) (*models.StorageLocation, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid storage location ID",
+		})
+		return nil, false
+	}
+
+	var location models.StorageLocation
+	if err := database.GetDB().First(&location, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Storage location not found",
+		})
+		return nil, false
+	}
+	return &location, true
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// TokenHandler 个人访问令牌处理器
+type TokenHandler struct{}
+
+// NewTokenHandler 创建令牌处理器
+func NewTokenHandler() *TokenHandler {
+	return &TokenHandler{}
+}
+
+// CreateTokenRequest 创建令牌请求
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ConnectionIDs []uint   `json:"connection_ids"`  // 为空表示不限制连接
+	ExpiresInDays int      `json:"expires_in_days"` // 0表示永不过期
+}
+
+// CreateTokenResponse 创建令牌响应，明文令牌只返回一次
+type CreateTokenResponse struct {
+	Token    string          `json:"token"`
+	APIToken models.APIToken `json:"api_token"`
+}
+
+// ListTokens 获取当前用户的令牌列表
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var tokens []models.APIToken
+	if err := database.GetDB().Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Tokens retrieved successfully",
+		"data":    tokens,
+	})
+}
+
+// CreateToken 创建令牌
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	role := c.GetString("role")
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid scope: " + scope,
+			})
+			return
+		}
+		if scope == models.ScopeAdmin && role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "Only admins can create tokens with admin scope",
+			})
+			return
+		}
+	}
+
+	connectionIDs := make([]string, 0, len(req.ConnectionIDs))
+	for _, id := range req.ConnectionIDs {
+		var count int64
+		database.GetDB().Model(&models.Connection{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Connection not found: " + strconv.FormatUint(uint64(id), 10),
+			})
+			return
+		}
+		connectionIDs = append(connectionIDs, strconv.FormatUint(uint64(id), 10))
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to generate token",
+		})
+		return
+	}
+	plainToken := models.APITokenPrefix + hex.EncodeToString(secret)
+
+	apiToken := models.APIToken{
+		UserID:        c.GetUint("user_id"),
+		Name:          req.Name,
+		TokenPrefix:   plainToken[:len(models.APITokenPrefix)+8],
+		TokenHash:     models.HashAPIToken(plainToken),
+		Scopes:        strings.Join(req.Scopes, ","),
+		ConnectionIDs: strings.Join(connectionIDs, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := database.GetDB().Create(&apiToken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to create token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Token created successfully",
+		"data": CreateTokenResponse{
+			Token:    plainToken,
+			APIToken: apiToken,
+		},
+	})
+}
+
+// DeleteToken 撤销令牌
+func (h *TokenHandler) DeleteToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("token_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid token ID",
+		})
+		return
+	}
+
+	result := database.GetDB().Where("id = ? AND user_id = ?", uint(tokenID), c.GetUint("user_id")).Delete(&models.APIToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete token",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Token not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Token deleted successfully",
+	})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -11,40 +14,73 @@ import (
 	"etcd-admin-backend/pkg/database"
 )
 
+// transferEventInterval SSE推送任务进度的间隔
+const transferEventInterval = time.Second
+
 // TransferHandler KV传输处理器
 type TransferHandler struct {
-	etcdService *services.EtcdService
+	etcdService     *services.EtcdService
+	transferService *services.TransferService
+	diffService     *services.DiffService
 }
 
 // NewTransferHandler 创建传输处理器
-func NewTransferHandler(etcdService *services.EtcdService) *TransferHandler {
+func NewTransferHandler(etcdService *services.EtcdService, transferService *services.TransferService) *TransferHandler {
 	return &TransferHandler{
-		etcdService: etcdService,
+		etcdService:     etcdService,
+		transferService: transferService,
+		diffService:     services.NewDiffService(etcdService),
 	}
 }
 
 // TransferRequest 传输请求
 type TransferRequest struct {
-	SourceConnectionID uint     `json:"source_connection_id" binding:"required"`
-	TargetConnectionID uint     `json:"target_connection_id" binding:"required"`
-	Keys               []string `json:"keys"`          // 指定要传输的keys，为空则传输所有
-	Prefix             string   `json:"prefix"`        // 前缀过滤
-	Overwrite          bool     `json:"overwrite"`     // 是否覆盖目标中已存在的key
-	KeyMapping         bool     `json:"key_mapping"`   // 是否启用键名映射
-	SourcePrefix       string   `json:"source_prefix"` // 源前缀
-	TargetPrefix       string   `json:"target_prefix"` // 目标前缀
+	SourceConnectionID uint               `json:"source_connection_id" binding:"required"`
+	TargetConnectionID uint               `json:"target_connection_id" binding:"required"`
+	Keys               []string           `json:"keys"`            // 指定要传输的keys，为空则传输所有
+	Prefix             string             `json:"prefix"`          // 前缀过滤
+	Overwrite          bool               `json:"overwrite"`       // 是否覆盖目标中已存在的key，未设置conflict_policy时生效
+	ConflictPolicy     string             `json:"conflict_policy"` // skip、overwrite、overwrite_if_newer、merge、fail
+	TimestampField     string             `json:"timestamp_field"` // overwrite_if_newer比较的时间字段（JSON Pointer）
+	KeyMapping         bool               `json:"key_mapping"`     // 是否启用键名映射
+	SourcePrefix       string             `json:"source_prefix"`   // 源前缀
+	TargetPrefix       string             `json:"target_prefix"`   // 目标前缀
+	Mapping            *models.KeyMapping `json:"mapping"`         // 完整的键名映射规则，设置后忽略key_mapping
 }
 
-// TransferResponse 传输响应
-type TransferResponse struct {
-	SuccessCount int      `json:"success_count"`
-	ErrorCount   int      `json:"error_count"`
-	SkippedCount int      `json:"skipped_count"`
-	Errors       []string `json:"errors,omitempty"`
-	Details      []string `json:"details,omitempty"`
+// mapping 将请求中的映射配置转换为键名映射
+func (r *TransferRequest) mapping() models.KeyMapping {
+	if r.Mapping != nil {
+		return *r.Mapping
+	}
+	if r.KeyMapping && r.SourcePrefix != "" && r.TargetPrefix != "" {
+		return models.KeyMapping{SourcePrefix: r.SourcePrefix, TargetPrefix: r.TargetPrefix}
+	}
+	return models.KeyMapping{}
+}
+
+// job 将请求转换为传输任务
+func (r *TransferRequest) job(userID uint) models.TransferJob {
+	job := models.TransferJob{
+		SourceConnectionID: r.SourceConnectionID,
+		TargetConnectionID: r.TargetConnectionID,
+		Keys:               r.Keys,
+		Prefix:             r.Prefix,
+		Overwrite:          r.Overwrite,
+		ConflictPolicy:     r.ConflictPolicy,
+		TimestampField:     r.TimestampField,
+		Mapping:            r.mapping(),
+		CreatedBy:          userID,
+	}
+	job.ConflictPolicy = job.Policy()
+	// 兼容旧的请求：只设置了源前缀时按源前缀读取
+	if job.Prefix == "" && r.KeyMapping {
+		job.Prefix = r.SourcePrefix
+	}
+	return job
 }
 
-// TransferKV 在连接间传输KV数据
+// TransferKV 创建连接间的KV传输任务，任务在后台执行
 func (h *TransferHandler) TransferKV(c *gin.Context) {
 	var req TransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -65,113 +101,384 @@ func (h *TransferHandler) TransferKV(c *gin.Context) {
 		return
 	}
 
-	// 获取源连接配置
-	var sourceConnection models.Connection
-	if err := database.GetDB().First(&sourceConnection, req.SourceConnectionID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	_, targetConnection, ok := h.getConnections(c, req.SourceConnectionID, req.TargetConnectionID)
+	if !ok {
+		return
+	}
+
+	if targetConnection.IsReadOnly {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
-			"message": "Source connection not found",
+			"message": "Target connection is read-only",
 		})
 		return
 	}
 
-	// 获取目标连接配置
-	var targetConnection models.Connection
-	if err := database.GetDB().First(&targetConnection, req.TargetConnectionID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	job := req.job(c.GetUint("user_id"))
+	if err := h.transferService.Submit(&job); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidKeyMapping) || errors.Is(err, services.ErrInvalidConflictPolicy) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
 			"status":  "error",
-			"message": "Target connection not found",
+			"message": "Failed to create transfer job",
+			"error":   err.Error(),
 		})
 		return
 	}
 
-	response := TransferResponse{
-		Errors:  make([]string, 0),
-		Details: make([]string, 0),
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "Transfer job created",
+		"data":    job,
+	})
+}
+
+// PreviewTransfer 按传输请求预览源键到目标键的映射和转换后的值，不写入目标
+func (h *TransferHandler) PreviewTransfer(c *gin.Context) {
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
 	}
 
-	var keysToTransfer []string
-	var err error
+	if req.SourceConnectionID == req.TargetConnectionID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Source and target connections cannot be the same",
+		})
+		return
+	}
+	if _, _, ok := h.getConnections(c, req.SourceConnectionID, req.TargetConnectionID); !ok {
+		return
+	}
 
-	// 确定要传输的键列表
-	if len(req.Keys) > 0 {
-		// 传输指定的键
-		keysToTransfer = req.Keys
-	} else {
-		// 传输所有键或按前缀过滤的键
-		prefix := req.Prefix
-		if req.KeyMapping && req.SourcePrefix != "" {
-			prefix = req.SourcePrefix
-		}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultTransferPreviewLimit)))
+	if err != nil || limit <= 0 || limit > services.MaxTransferPreviewLimit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "limit must be between 1 and " + strconv.Itoa(services.MaxTransferPreviewLimit),
+		})
+		return
+	}
 
-		keysToTransfer, err = h.etcdService.ListKeys(&sourceConnection, prefix)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "Failed to list keys from source connection",
-				"error":   err.Error(),
-			})
-			return
+	job := req.job(c.GetUint("user_id"))
+	preview, err := h.transferService.Preview(c.Request.Context(), &job, limit)
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrInvalidKeyMapping) || errors.Is(err, services.ErrInvalidConflictPolicy) {
+			status = http.StatusBadRequest
 		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to preview transfer",
+			"error":   err.Error(),
+		})
+		return
 	}
 
-	// 传输每个键
-	for _, key := range keysToTransfer {
-		// 从源连接获取值
-		value, err := h.etcdService.GetValue(&sourceConnection, key)
-		if err != nil {
-			response.ErrorCount++
-			response.Errors = append(response.Errors,
-				"Failed to get key '"+key+"' from source: "+err.Error())
-			continue
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   preview,
+	})
+}
 
-		// 确定目标键名
-		targetKey := key
-		if req.KeyMapping && req.SourcePrefix != "" && req.TargetPrefix != "" {
-			// 进行键名映射：将源前缀替换为目标前缀
-			if len(key) >= len(req.SourcePrefix) && key[:len(req.SourcePrefix)] == req.SourcePrefix {
-				targetKey = req.TargetPrefix + key[len(req.SourcePrefix):]
-			}
+// ListJobs 获取传输任务列表，可按状态过滤
+func (h *TransferHandler) ListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	query := database.GetDB().Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var jobs []models.TransferJob
+	if err := query.Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list transfer jobs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   jobs,
+	})
+}
+
+// GetJob 获取传输任务详情
+func (h *TransferHandler) GetJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
+
+// CancelJob 取消执行中的传输任务，当前批次结束后停止，已写入的键不会回滚
+func (h *TransferHandler) CancelJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	if err := h.transferService.Cancel(job.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Transfer job is not running",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "Transfer job cancellation requested",
+	})
+}
+
+// RollbackJob 将任务写入的键恢复为传输前的状态，force=true时同时回滚传输之后被修改过的键
+func (h *TransferHandler) RollbackJob(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	var target models.Connection
+	if err := database.GetDB().First(&target, job.TargetConnectionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Target connection not found",
+		})
+		return
+	}
+	if target.IsReadOnly {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Target connection is read-only",
+		})
+		return
+	}
+
+	result, err := h.transferService.Rollback(c.Request.Context(), job, c.Query("force") == "true")
+	if err != nil {
+		status := etcdErrorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrTransferJobRunning) || errors.Is(err, services.ErrImportConflict) {
+			status = http.StatusConflict
 		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": "Failed to roll back transfer job",
+			"error":   err.Error(),
+			"data":    result,
+		})
+		return
+	}
 
-		// 如果不覆盖，检查目标键是否已存在
-		if !req.Overwrite {
-			if _, err := h.etcdService.GetValue(&targetConnection, targetKey); err == nil {
-				response.SkippedCount++
-				response.Details = append(response.Details,
-					"Skipped existing key: "+targetKey)
-				continue
-			}
+	message := "Transfer job rolled back"
+	if len(result.Modified) > 0 {
+		message = "Transfer job partially rolled back, keys modified since the transfer were kept"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": message,
+		"data":    result,
+	})
+}
+
+// ListJobKeys 获取传输任务中每个键的处理结果，可按decision过滤，同时返回各结果的数量
+func (h *TransferHandler) ListJobKeys(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var rows []struct {
+		Decision string
+		Count    int64
+	}
+	if err := database.GetDB().Model(&models.TransferJobKey{}).
+		Select("decision, COUNT(*) AS count").
+		Where("job_id = ?", job.ID).
+		Group("decision").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch transfer job keys",
+		})
+		return
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Decision] = row.Count
+	}
+
+	query := database.GetDB().Where("job_id = ?", job.ID)
+	if decision := c.Query("decision"); decision != "" {
+		query = query.Where("decision = ?", decision)
+	}
+	var keys []models.TransferJobKey
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to fetch transfer job keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"counts": counts,
+			"keys":   keys,
+		},
+	})
+}
+
+// JobEvents 以SSE推送任务进度，进度变化时发送progress事件，任务结束时发送done事件后关闭
+func (h *TransferHandler) JobEvents(c *gin.Context) {
+	job, ok := h.getJob(c)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(transferEventInterval)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 禁止nginx缓冲
+	var lastUpdated time.Time
+	c.Stream(func(w io.Writer) bool {
+		if job.Finished() {
+			c.SSEvent("done", job)
+			return false
+		}
+		if !job.UpdatedAt.Equal(lastUpdated) {
+			c.SSEvent("progress", job)
+			lastUpdated = job.UpdatedAt
 		}
 
-		// 设置到目标连接
-		if err := h.etcdService.SetValue(&targetConnection, targetKey, value); err != nil {
-			response.ErrorCount++
-			response.Errors = append(response.Errors,
-				"Failed to set key '"+targetKey+"' to target: "+err.Error())
-			continue
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
 		}
+		return database.GetDB().First(job, job.ID).Error == nil
+	})
+}
+
+// DiffSideRequest 比较的一方
+type DiffSideRequest struct {
+	ConnectionID uint   `json:"connection_id" binding:"required"`
+	Prefix       string `json:"prefix"`
+	Revision     int64  `json:"revision"` // 为0时比较最新数据
+}
+
+// DiffRequest 比较请求
+type DiffRequest struct {
+	Source DiffSideRequest `json:"source" binding:"required"`
+	Target DiffSideRequest `json:"target" binding:"required"`
+	Ignore []string        `json:"ignore"` // 匹配相对键的glob，预期不同的键不参与比较
+}
 
-		response.SuccessCount++
-		response.Details = append(response.Details,
-			"Successfully transferred: "+key+" -> "+targetKey)
+// DiffKV 比较两个连接、两个前缀或同一连接两个revision的键值
+func (h *TransferHandler) DiffKV(c *gin.Context) {
+	var req DiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	sourceConnection, targetConnection, ok := h.getConnections(c, req.Source.ConnectionID, req.Target.ConnectionID)
+	if !ok {
+		return
 	}
 
-	status := "success"
-	message := "Transfer completed successfully"
-	if response.ErrorCount > 0 {
-		status = "partial_success"
-		message = "Transfer completed with some errors"
+	diff, err := h.diffService.Compare(c.Request.Context(),
+		services.DiffSide{Connection: sourceConnection, Prefix: req.Source.Prefix, Revision: req.Source.Revision},
+		services.DiffSide{Connection: targetConnection, Prefix: req.Target.Prefix, Revision: req.Target.Revision},
+		req.Ignore)
+	if err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusBadRequest), gin.H{
+			"status":  "error",
+			"message": "Failed to compare keys",
+			"error":   err.Error(),
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":  status,
-		"message": message,
-		"data":    response,
+		"status": "success",
+		"data":   diff,
 	})
 }
 
+// getConnections 获取源连接和目标连接配置
+func (h *TransferHandler) getConnections(c *gin.Context, sourceID, targetID uint) (*models.Connection, *models.Connection, bool) {
+	var sourceConnection models.Connection
+	if err := database.GetDB().First(&sourceConnection, sourceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Source connection not found",
+		})
+		return nil, nil, false
+	}
+
+	var targetConnection models.Connection
+	if err := database.GetDB().First(&targetConnection, targetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Target connection not found",
+		})
+		return nil, nil, false
+	}
+	return &sourceConnection, &targetConnection, true
+}
+
+// getJob 解析路径中的传输任务
+func (h *TransferHandler) getJob(c *gin.Context) (*models.TransferJob, bool) {
+	jobID, err := strconv.ParseUint(c.Param("job_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid job ID",
+		})
+		return nil, false
+	}
+
+	var job models.TransferJob
+	if err := database.GetDB().First(&job, uint(jobID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Transfer job not found",
+		})
+		return nil, false
+	}
+	return &job, true
+}
+
 // CopyKey 复制单个键
 func (h *TransferHandler) CopyKey(c *gin.Context) {
 	sourceConnID, err := strconv.ParseUint(c.Query("source_connection_id"), 10, 32)
@@ -202,7 +509,26 @@ func (h *TransferHandler) CopyKey(c *gin.Context) {
 	}
 
 	targetKey := c.DefaultQuery("target_key", sourceKey)
-	overwrite := c.DefaultQuery("overwrite", "false") == "true"
+	// 未指定策略时保持原有行为：overwrite=true覆盖，否则目标已存在时返回409
+	policy := services.ConflictPolicy{
+		Policy:         c.Query("conflict_policy"),
+		TimestampField: c.Query("timestamp_field"),
+		SameConnection: sourceConnID == targetConnID,
+	}
+	if policy.Policy == "" {
+		policy.Policy = models.ConflictFail
+		if c.DefaultQuery("overwrite", "false") == "true" {
+			policy.Policy = models.ConflictOverwrite
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid conflict policy",
+			"error":   err.Error(),
+		})
+		return
+	}
 
 	// 获取连接配置
 	var sourceConnection, targetConnection models.Connection
@@ -222,44 +548,41 @@ func (h *TransferHandler) CopyKey(c *gin.Context) {
 		return
 	}
 
-	// 从源获取值
-	value, err := h.etcdService.GetValue(&sourceConnection, sourceKey)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	item, err := h.transferService.CopyKey(c.Request.Context(), &sourceConnection, &targetConnection, sourceKey, targetKey, policy)
+	if errors.Is(err, services.ErrTransferConflict) {
+		c.JSON(http.StatusConflict, gin.H{
 			"status":  "error",
-			"message": "Failed to get value from source",
-			"error":   err.Error(),
+			"message": "Target key already exists",
+			"data": gin.H{
+				"source_key": sourceKey,
+				"target_key": targetKey,
+				"decision":   item.Action,
+			},
 		})
 		return
 	}
-
-	// 检查目标是否已存在
-	if !overwrite {
-		if _, err := h.etcdService.GetValue(&targetConnection, targetKey); err == nil {
-			c.JSON(http.StatusConflict, gin.H{
-				"status":  "error",
-				"message": "Target key already exists",
-			})
-			return
-		}
-	}
-
-	// 设置到目标
-	if err := h.etcdService.SetValue(&targetConnection, targetKey, value); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	if err != nil {
+		c.JSON(etcdErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"status":  "error",
-			"message": "Failed to set value to target",
+			"message": "Failed to copy key",
 			"error":   err.Error(),
 		})
 		return
 	}
 
+	// value为复制后目标中的值
+	value := *item.NewValue
+	if item.Action == services.ImportActionSkip || item.Action == services.ImportActionUnchanged {
+		value = *item.OldValue
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Key copied successfully",
-		"data": map[string]interface{}{
+		"data": gin.H{
 			"source_key": sourceKey,
 			"target_key": targetKey,
+			"decision":   item.Action, // add、change、merge、unchanged、skip
 			"value":      value,
 		},
 	})
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/internal/services"
+	"etcd-admin-backend/pkg/database"
+)
+
+// WebhookHandler Webhook处理器
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+// NewWebhookHandler 创建Webhook处理器
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// WebhookRequest 创建/更新Webhook请求
+type WebhookRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	URL           string   `json:"url" binding:"required,max=500"`
+	Secret        string   `json:"secret" binding:"max=255"` // 签名密钥，创建时为空则自动生成，更新时为空则保持不变
+	RotateSecret  bool     `json:"rotate_secret"`            // 更新时重新生成签名密钥
+	Prefix        string   `json:"prefix" binding:"max=255"`
+	Events        []string `json:"events"` // 订阅的事件，支持通配符如import.*，为空时订阅全部
+	IncludeValues bool     `json:"include_values"`
+	Enabled       *bool    `json:"enabled"` // 默认true
+}
+
+// WebhookResponse Webhook响应，签名密钥只在生成或更换后返回一次
+type WebhookResponse struct {
+	models.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// apply 将请求应用到Webhook
+func (r *WebhookRequest) apply(webhook *models.Webhook) {
+	webhook.Name = r.Name
+	webhook.URL = r.URL
+	webhook.Prefix = r.Prefix
+	webhook.Events = r.Events
+	webhook.IncludeValues = r.IncludeValues
+	if r.Secret != "" {
+		webhook.Secret = r.Secret
+	} else if r.RotateSecret {
+		webhook.Secret = ""
+	}
+	if r.Enabled != nil {
+		webhook.Enabled = *r.Enabled
+	}
+}
+
+// ListWebhooks 获取连接的Webhook列表
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var webhooks []models.Webhook
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).Order("id").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list webhooks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   webhooks,
+	})
+}
+
+// CreateWebhook 创建Webhook，响应中返回签名密钥
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	webhook := models.Webhook{
+		ConnectionID: connection.ID,
+		Enabled:      true,
+		CreatedBy:    c.GetUint("user_id"),
+	}
+	req.apply(&webhook)
+	if !h.saveWebhook(c, &webhook) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Webhook created successfully",
+		"data":    WebhookResponse{Webhook: webhook, Secret: webhook.Secret},
+	})
+}
+
+// GetWebhook 获取Webhook详情
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   webhook,
+	})
+}
+
+// UpdateWebhook 更新Webhook，rotate_secret=true时在响应中返回新的签名密钥
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.apply(webhook)
+	if !h.saveWebhook(c, webhook) {
+		return
+	}
+
+	response := WebhookResponse{Webhook: *webhook}
+	if req.Secret == "" && req.RotateSecret {
+		response.Secret = webhook.Secret
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Webhook updated successfully",
+		"data":    response,
+	})
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete webhook",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// TestWebhook 立即发送一次webhook.test事件并返回投递结果，未启用的Webhook也可以测试
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.Test(c.Request.Context(), webhook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to send test delivery",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if delivery.Status != models.WebhookDeliverySuccess {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "Test delivery failed",
+			"error":   delivery.Error,
+			"data":    delivery,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Test delivery succeeded",
+		"data":    delivery,
+	})
+}
+
+// ListDeliveries 获取Webhook的投递记录，不包含请求体
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	query := database.GetDB().Omit("payload").Where("webhook_id = ?", webhook.ID).Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list webhook deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   deliveries,
+	})
+}
+
+// GetDelivery 获取投递记录详情，包含请求体和最近一次响应的状态码
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	delivery, ok := h.getDelivery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   delivery,
+	})
+}
+
+// Redeliver 以相同的请求体重新投递，返回新的投递记录
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	delivery, ok := h.getDelivery(c)
+	if !ok {
+		return
+	}
+
+	redelivery, err := h.webhookService.Redeliver(delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to queue redelivery",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "Redelivery queued",
+		"data":    redelivery,
+	})
+}
+
+// saveWebhook 校验并保存Webhook，然后更新Watch
+func (h *WebhookHandler) saveWebhook(c *gin.Context, webhook *models.Webhook) bool {
+	if err := h.webhookService.ValidateWebhook(webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid webhook",
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	if err := database.GetDB().Save(webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save webhook",
+		})
+		return false
+	}
+	h.webhookService.Reload(webhook)
+	return true
+}
+
+// getConnection 解析路径中的连接
+func (h *WebhookHandler) getConnection(c *gin.Context) (*models.Connection, bool) {
+	connectionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid connection_id",
+		})
+		return nil, false
+	}
+
+	var connection models.Connection
+	if err := database.GetDB().First(&connection, uint(connectionID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Connection not found",
+		})
+		return nil, false
+	}
+	return &connection, true
+}
+
+// getWebhook 解析路径中的Webhook，Webhook必须属于该连接
+func (h *WebhookHandler) getWebhook(c *gin.Context) (*models.Webhook, bool) {
+	connection, ok := h.getConnection(c)
+	if !ok {
+		return nil, false
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("webhook_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid webhook_id",
+		})
+		return nil, false
+	}
+
+	var webhook models.Webhook
+	if err := database.GetDB().Where("connection_id = ?", connection.ID).First(&webhook, uint(webhookID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Webhook not found",
+		})
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// getDelivery 解析路径中的投递记录，记录必须属于该Webhook
+func (h *WebhookHandler) getDelivery(c *gin.Context) (*models.WebhookDelivery, bool) {
+	webhook, ok := h.getWebhook(c)
+	if !ok {
+		return nil, false
+	}
+
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid delivery_id",
+		})
+		return nil, false
+	}
+
+	var delivery models.WebhookDelivery
+	if err := database.GetDB().Where("webhook_id = ?", webhook.ID).First(&delivery, uint(deliveryID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Webhook delivery not found",
+		})
+		return nil, false
+	}
+	return &delivery, true
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,16 +10,37 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 
 	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
 )
 
+// 认证方式
+const (
+	AuthTypeJWT      = "jwt"
+	AuthTypeAPIToken = "api_token"
+)
+
+// TokenPurposeMFA 两步登录中间令牌的用途标识
+const TokenPurposeMFA = "mfa"
+
 // Claims JWT声明结构
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID           uint   `json:"user_id"`
+	Username         string `json:"username"`
+	Role             string `json:"role"`
+	Purpose          string `json:"purpose,omitempty"`            // 非空时不能用于访问API
+	MFASetupRequired bool   `json:"mfa_setup_required,omitempty"` // 策略要求先完成MFA绑定
 	jwt.RegisteredClaims
 }
 
+// mfaSetupAllowedPaths 未完成MFA绑定时允许访问的路由
+var mfaSetupAllowedPaths = map[string]bool{
+	"/api/v1/auth/profile":    true,
+	"/api/v1/auth/logout":     true,
+	"/api/v1/auth/mfa/enroll": true,
+	"/api/v1/auth/mfa/verify": true,
+}
+
 // JWTAuth JWT认证中间件
 func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -43,6 +65,12 @@ func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// API令牌
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			authenticateAPIToken(c, tokenString)
+			return
+		}
+
 		// 解析JWT令牌
 		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 			return []byte(cfg.Server.JWTKey), nil
@@ -57,11 +85,13 @@ func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Purpose == "" {
 			// 将用户信息存储到上下文中
 			c.Set("user_id", claims.UserID)
 			c.Set("username", claims.Username)
 			c.Set("role", claims.Role)
+			c.Set("auth_type", AuthTypeJWT)
+			c.Set("mfa_setup_required", claims.MFASetupRequired)
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -74,6 +104,168 @@ func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
+// authenticateAPIToken 校验API令牌并设置用户上下文
+func authenticateAPIToken(c *gin.Context, tokenString string) {
+	var apiToken models.APIToken
+	if err := database.GetDB().Where("token_hash = ?", models.HashAPIToken(tokenString)).First(&apiToken).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		c.Abort()
+		return
+	}
+
+	if apiToken.IsExpired() {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Token has expired",
+		})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().Where("id = ? AND is_active = ?", apiToken.UserID, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		c.Abort()
+		return
+	}
+
+	// 记录最后使用时间，每分钟最多写一次
+	now := time.Now()
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > time.Minute || apiToken.LastUsedIP != c.ClientIP() {
+		database.GetDB().Model(&apiToken).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_type", AuthTypeAPIToken)
+	c.Set("api_token", &apiToken)
+	c.Next()
+}
+
+// RequireTokenScope API令牌权限范围中间件
+// 读请求需要read，写请求需要write；限制了连接的令牌只能访问对应连接下的路由
+func RequireTokenScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiToken, ok := currentAPIToken(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		required := models.ScopeWrite
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = models.ScopeRead
+		}
+		if !apiToken.HasScope(required) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "Token scope does not allow this operation",
+			})
+			c.Abort()
+			return
+		}
+
+		if allowed := apiToken.ConnectionIDList(); len(allowed) > 0 && !tokenAllowsRoute(c, allowed) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "Token is not allowed to access this connection",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope 要求API令牌具备指定权限范围，JWT会话不受影响
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiToken, ok := currentAPIToken(c); ok && !apiToken.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "Token scope does not allow this operation",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession 要求交互式登录会话，拒绝API令牌
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := currentAPIToken(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "This operation is not available with API tokens",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentAPIToken 获取当前请求使用的API令牌
+func currentAPIToken(c *gin.Context) (*models.APIToken, bool) {
+	value, exists := c.Get("api_token")
+	if !exists {
+		return nil, false
+	}
+	apiToken, ok := value.(*models.APIToken)
+	return apiToken, ok
+}
+
+// tokenAllowsRoute 判断受连接限制的令牌能否访问当前路由
+func tokenAllowsRoute(c *gin.Context, allowed []uint) bool {
+	// 连接列表只读，允许访问
+	if c.FullPath() == "/api/v1/connections" && c.Request.Method == http.MethodGet {
+		return true
+	}
+	if !strings.HasPrefix(c.FullPath(), "/api/v1/connections/:id") {
+		return false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return false
+	}
+	for _, allowedID := range allowed {
+		if allowedID == uint(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnforceMFASetup 策略要求MFA但用户尚未绑定时，只允许访问绑定相关路由
+func EnforceMFASetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("mfa_setup_required") && !mfaSetupAllowedPaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":             "error",
+				"message":            "MFA enrollment is required",
+				"mfa_setup_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // RequireRole 角色验证中间件
 func RequireRole(requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -103,17 +295,56 @@ func RequireRole(requiredRole string) gin.HandlerFunc {
 
 // GenerateToken 生成JWT令牌
 func GenerateToken(userID uint, username, role string, cfg *config.Config) (string, error) {
-	claims := Claims{
+	return signToken(Claims{
 		UserID:   userID,
 		Username: username,
 		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24小时过期
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "etcd-admin",
-			Subject:   username,
-		},
+	}, 24*time.Hour, cfg) // 24小时过期
+}
+
+// GenerateMFASetupToken 生成只能用于完成MFA绑定的JWT令牌
+func GenerateMFASetupToken(userID uint, username, role string, cfg *config.Config) (string, error) {
+	return signToken(Claims{
+		UserID:           userID,
+		Username:         username,
+		Role:             role,
+		MFASetupRequired: true,
+	}, time.Hour, cfg)
+}
+
+// GenerateMFAToken 生成两步登录的中间令牌
+func GenerateMFAToken(userID uint, username string, cfg *config.Config) (string, error) {
+	return signToken(Claims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  TokenPurposeMFA,
+	}, 5*time.Minute, cfg)
+}
+
+// ParseMFAToken 解析两步登录的中间令牌，返回用户ID
+func ParseMFAToken(tokenString string, cfg *config.Config) (uint, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.Server.JWTKey), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.Purpose != TokenPurposeMFA {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+	return claims.UserID, nil
+}
+
+// signToken 填充标准声明并签名
+func signToken(claims Claims, ttl time.Duration, cfg *config.Config) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
+		Issuer:    "etcd-admin",
+		Subject:   claims.Username,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
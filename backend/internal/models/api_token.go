@@ -0,0 +1,104 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix API令牌前缀，用于与JWT区分
+const APITokenPrefix = "eta_"
+
+// API令牌权限范围
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// scopeLevels 权限范围等级，高等级包含低等级
+var scopeLevels = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// APIToken 用户个人访问令牌
+type APIToken struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	UserID        uint           `json:"user_id" gorm:"not null;index"`
+	Name          string         `json:"name" gorm:"not null;size:100"`
+	TokenPrefix   string         `json:"token_prefix" gorm:"not null;size:16"` // 明文前几位，便于识别
+	TokenHash     string         `json:"-" gorm:"not null;size:64;uniqueIndex"`
+	Scopes        string         `json:"scopes" gorm:"not null;size:100"` // 逗号分隔
+	ConnectionIDs string         `json:"connection_ids" gorm:"size:255"`  // 逗号分隔，为空表示不限制
+	ExpiresAt     *time.Time     `json:"expires_at"`
+	LastUsedAt    *time.Time     `json:"last_used_at"`
+	LastUsedIP    string         `json:"last_used_ip" gorm:"size:64"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TableName 指定表名
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// HashAPIToken 计算令牌哈希
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsValidScope 判断权限范围是否合法
+func IsValidScope(scope string) bool {
+	_, ok := scopeLevels[scope]
+	return ok
+}
+
+// ScopeList 返回权限范围列表
+func (t *APIToken) ScopeList() []string {
+	return splitList(t.Scopes)
+}
+
+// HasScope 判断令牌是否具备指定权限范围
+func (t *APIToken) HasScope(required string) bool {
+	for _, scope := range t.ScopeList() {
+		if scopeLevels[scope] >= scopeLevels[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionIDList 返回限制的连接ID列表
+func (t *APIToken) ConnectionIDList() []uint {
+	var ids []uint
+	for _, item := range splitList(t.ConnectionIDs) {
+		if id, err := strconv.ParseUint(item, 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// IsExpired 判断令牌是否已过期
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// splitList 拆分逗号分隔的字符串
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
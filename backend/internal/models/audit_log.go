@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// 审计动作
+const (
+	AuditLoginSuccess = "login.success"
+	AuditLoginFailed  = "login.failed"
+	AuditLoginBlocked = "login.blocked"
+	AuditUserUnlocked = "user.unlocked"
+)
+
+// AuditLog 审计日志
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	Username  string    `json:"username" gorm:"size:50"`
+	Action    string    `json:"action" gorm:"not null;size:50;index"`
+	Target    string    `json:"target" gorm:"size:255"`
+	IP        string    `json:"ip" gorm:"size:64"`
+	Detail    string    `json:"detail" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 备份类型
+const (
+	BackupTypeExport   = "export"   // 按格式导出键值
+	BackupTypeSnapshot = "snapshot" // etcd完整快照（Maintenance.Snapshot）
+)
+
+// 备份执行状态
+const (
+	BackupRunRunning = "running"
+	BackupRunSuccess = "success"
+	BackupRunFailed  = "failed"
+)
+
+// BackupJob 连接的定时备份任务
+type BackupJob struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	ConnectionID  uint           `json:"connection_id" gorm:"not null;index"`
+	Name          string         `json:"name" gorm:"not null;size:100"`
+	Schedule      string         `json:"schedule" gorm:"not null;size:100"` // cron表达式，如 "0 3 * * *" 或 "@daily"
+	Type          string         `json:"type" gorm:"not null;size:20;default:'export'"`
+	Prefix        string         `json:"prefix" gorm:"size:255"`
+	StorageID     uint           `json:"storage_id" gorm:"default:0"` // 存储位置，0为内置本地存储（BACKUP_DIR）
+	Format        string         `json:"format" gorm:"size:20"`
+	Gzip          bool           `json:"gzip"`
+	Encrypt       bool           `json:"encrypt"` // 使用 BACKUP_AGE_RECIPIENTS 加密
+	Enabled       bool           `json:"enabled"`
+	KeepLast      int            `json:"keep_last" gorm:"default:0"`       // 保留最近N份，0表示不按数量保留
+	KeepDailyDays int            `json:"keep_daily_days" gorm:"default:0"` // 保留最近X天每天最后一份，0表示不按天保留
+	CreatedBy     uint           `json:"created_by"`
+	LastRunAt     *time.Time     `json:"last_run_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TableName 指定表名
+func (BackupJob) TableName() string {
+	return "backup_jobs"
+}
+
+// BackupRun 备份任务的执行记录，成功的记录对应一个备份文件
+// 直接导出到存储的备份JobID为0
+type BackupRun struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	JobID        uint       `json:"job_id" gorm:"not null;index"`
+	ConnectionID uint       `json:"connection_id" gorm:"not null;index"`
+	Status       string     `json:"status" gorm:"not null;size:20"`
+	Trigger      string     `json:"trigger" gorm:"size:20"` // schedule、manual 或 export
+	StorageID    uint       `json:"storage_id" gorm:"default:0"`
+	FileName     string     `json:"file_name" gorm:"size:255"`
+	FilePath     string     `json:"file_path" gorm:"size:500"` // 存储中的对象键
+	Checksum     string     `json:"checksum" gorm:"size:64"`   // 文件内容的sha256
+	Size         int64      `json:"size"`
+	KeyCount     int64      `json:"key_count"`
+	Revision     int64      `json:"revision"`
+	Error        string     `json:"error,omitempty" gorm:"type:text"`
+	Pruned       bool       `json:"pruned" gorm:"default:false"` // 文件已按保留策略或手动删除
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// TableName 指定表名
+func (BackupRun) TableName() string {
+	return "backup_runs"
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/pkg/secrets"
+)
+
+// 基线来源
+const (
+	BaselineSourceSnapshot = "snapshot" // 从集群当前状态捕获
+	BaselineSourceBackup   = "backup"   // 从备份文件加载
+)
+
+// 漂移检查结果
+const (
+	DriftInSync  = "in_sync"
+	DriftDrifted = "drifted"
+	DriftError   = "error"
+)
+
+// Baseline 前缀的期望状态，期望的键值保存在kv_items中，按cron表达式定期与集群比较
+type Baseline struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	ConnectionID  uint       `json:"connection_id" gorm:"not null;index"`
+	Name          string     `json:"name" gorm:"not null;size:100"`
+	Prefix        string     `json:"prefix" gorm:"size:255"`
+	Source        string     `json:"source" gorm:"not null;size:20"`
+	KeyCount      int64      `json:"key_count"`
+	Schedule      string     `json:"schedule" gorm:"size:100"` // cron表达式，为空时只能手动检查
+	Enabled       bool       `json:"enabled"`
+	CapturedAt    time.Time  `json:"captured_at"` // 期望状态的捕获或加载时间
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	LastStatus    string     `json:"last_status,omitempty" gorm:"size:20"`
+	CreatedBy     uint       `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Baseline) TableName() string {
+	return "baselines"
+}
+
+// DriftReport 一次漂移检查的结果
+type DriftReport struct {
+	ID              uint          `json:"id" gorm:"primarykey"`
+	BaselineID      uint          `json:"baseline_id" gorm:"not null;index"`
+	Status          string        `json:"status" gorm:"not null;size:20"`
+	MissingCount    int           `json:"missing_count"`
+	UnexpectedCount int           `json:"unexpected_count"`
+	ChangedCount    int           `json:"changed_count"`
+	Missing         []string      `json:"missing,omitempty" gorm:"serializer:json;type:mediumtext"`    // 基线中有但集群中没有的键
+	Unexpected      []string      `json:"unexpected,omitempty" gorm:"serializer:json;type:mediumtext"` // 集群中有但基线中没有的键
+	Changed         []DriftChange `json:"changed,omitempty" gorm:"serializer:json;type:mediumtext"`    // 期望值和实际值加密存储
+	Error           string        `json:"error,omitempty" gorm:"type:text"`
+	CheckedAt       time.Time     `json:"checked_at"`
+}
+
+// DriftChange 值与基线不同的键
+type DriftChange struct {
+	Key      string `json:"key"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// TableName 指定表名
+func (DriftReport) TableName() string {
+	return "drift_reports"
+}
+
+// BeforeSave GORM钩子 - 保存前加密变更的键值
+func (r *DriftReport) BeforeSave(tx *gorm.DB) error {
+	for i := range r.Changed {
+		change := &r.Changed[i]
+		var err error
+		if change.Expected, err = secrets.Encrypt(change.Expected); err != nil {
+			return err
+		}
+		if change.Actual, err = secrets.Encrypt(change.Actual); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterSave GORM钩子 - 保存后还原为明文供后续使用
+func (r *DriftReport) AfterSave(tx *gorm.DB) error {
+	return r.decryptChanges()
+}
+
+// AfterFind GORM钩子 - 查询后解密变更的键值
+func (r *DriftReport) AfterFind(tx *gorm.DB) error {
+	return r.decryptChanges()
+}
+
+// decryptChanges 解密变更的期望值和实际值
+func (r *DriftReport) decryptChanges() error {
+	for i := range r.Changed {
+		change := &r.Changed[i]
+		var err error
+		if change.Expected, err = secrets.Decrypt(change.Expected); err != nil {
+			return err
+		}
+		if change.Actual, err = secrets.Decrypt(change.Actual); err != nil {
+			return err
+		}
+	}
+	return nil
+}
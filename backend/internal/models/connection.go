@@ -4,31 +4,101 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+
+	"etcd-admin-backend/pkg/secrets"
 )
 
 // Connection 表示etcd连接配置
 type Connection struct {
-	ID          uint           `json:"id" gorm:"primarykey"`
-	Name        string         `json:"name" gorm:"not null;size:100;uniqueIndex"`
-	Endpoints   string         `json:"endpoints" gorm:"not null;type:text"` // JSON数组字符串，如["localhost:2379"]
-	Username    string         `json:"username" gorm:"size:100"`
-	Password    string         `json:"password" gorm:"size:255"`
-	TLSEnabled  bool           `json:"tls_enabled" gorm:"default:false"`
-	CertFile    string         `json:"cert_file" gorm:"size:255"`
-	KeyFile     string         `json:"key_file" gorm:"size:255"`
-	CAFile      string         `json:"ca_file" gorm:"size:255"`
-	Description string         `json:"description" gorm:"type:text"`
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	IsReadOnly  bool           `json:"is_readonly" gorm:"column:is_readonly;default:false"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint           `json:"id" gorm:"primarykey"`
+	Name           string         `json:"name" gorm:"not null;size:100;uniqueIndex"`
+	Endpoints      string         `json:"endpoints" gorm:"not null;type:text"` // JSON数组字符串，如["localhost:2379"]
+	Username       string         `json:"username" gorm:"size:100"`
+	Password       string         `json:"-" gorm:"type:text"` // 加密存储，接口只写
+	TLSEnabled     bool           `json:"tls_enabled" gorm:"default:false"`
+	CertFile       string         `json:"cert_file" gorm:"size:255"`
+	KeyFile        string         `json:"key_file" gorm:"size:255"`
+	CAFile         string         `json:"ca_file" gorm:"size:255"`
+	TLSCACert      string         `json:"tls_ca_cert" gorm:"column:tls_ca_cert;type:text"` // 内联PEM
+	TLSCert        string         `json:"tls_cert" gorm:"column:tls_cert;type:text"`
+	TLSKey         string         `json:"-" gorm:"column:tls_key;type:text"` // 加密存储，接口只写
+	Description    string         `json:"description" gorm:"type:text"`
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	IsReadOnly     bool           `json:"is_readonly" gorm:"column:is_readonly;default:false"`
+	IsProduction   bool           `json:"is_production" gorm:"column:is_production;default:false"`
+	DialTimeout    int            `json:"dial_timeout" gorm:"default:5"`     // 建立连接超时（秒）
+	RequestTimeout int            `json:"request_timeout" gorm:"default:10"` // 单次请求超时（秒）
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// 关联关系
 	KVItems []KVItem `json:"kv_items,omitempty" gorm:"foreignKey:ConnectionID"`
+
+	// 凭据是否已设置，代替返回凭据本身
+	HasPassword bool `json:"has_password" gorm:"-"`
+	HasTLSKey   bool `json:"has_tls_key" gorm:"-"`
 }
 
 // TableName 指定表名
 func (Connection) TableName() string {
 	return "connections"
 }
+
+// 未设置超时时使用的默认值
+const (
+	DefaultDialTimeout    = 5 * time.Second
+	DefaultRequestTimeout = 10 * time.Second
+)
+
+// DialTimeoutDuration 建立连接超时
+func (c *Connection) DialTimeoutDuration() time.Duration {
+	if c.DialTimeout <= 0 {
+		return DefaultDialTimeout
+	}
+	return time.Duration(c.DialTimeout) * time.Second
+}
+
+// RequestTimeoutDuration 单次请求超时
+func (c *Connection) RequestTimeoutDuration() time.Duration {
+	if c.RequestTimeout <= 0 {
+		return DefaultRequestTimeout
+	}
+	return time.Duration(c.RequestTimeout) * time.Second
+}
+
+// BeforeSave GORM钩子 - 保存前加密凭据
+func (c *Connection) BeforeSave(tx *gorm.DB) error {
+	var err error
+	if c.Password, err = secrets.Encrypt(c.Password); err != nil {
+		return err
+	}
+	if c.TLSKey, err = secrets.Encrypt(c.TLSKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AfterSave GORM钩子 - 保存后还原为明文供后续使用
+func (c *Connection) AfterSave(tx *gorm.DB) error {
+	return c.decryptSecrets()
+}
+
+// AfterFind GORM钩子 - 查询后解密凭据
+func (c *Connection) AfterFind(tx *gorm.DB) error {
+	return c.decryptSecrets()
+}
+
+// decryptSecrets 解密凭据并更新是否已设置的标记
+func (c *Connection) decryptSecrets() error {
+	var err error
+	if c.Password, err = secrets.Decrypt(c.Password); err != nil {
+		return err
+	}
+	if c.TLSKey, err = secrets.Decrypt(c.TLSKey); err != nil {
+		return err
+	}
+	c.HasPassword = c.Password != ""
+	c.HasTLSKey = c.TLSKey != ""
+	return nil
+}
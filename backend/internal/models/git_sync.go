@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Git同步模式
+const (
+	GitSyncModeApply  = "apply"  // 将仓库中的差异写入etcd
+	GitSyncModeReport = "report" // 只记录差异
+)
+
+// Git同步方向
+const (
+	GitSyncPull = "pull" // 仓库 -> etcd
+	GitSyncPush = "push" // etcd -> 仓库
+)
+
+// Git同步执行状态
+const (
+	GitSyncRunSuccess = "success"
+	GitSyncRunFailed  = "failed"
+)
+
+// GitSync 将连接的前缀绑定到git仓库中的目录，目录中的YAML/JSON文件映射为键值
+type GitSync struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	ConnectionID uint       `json:"connection_id" gorm:"not null;index"`
+	Name         string     `json:"name" gorm:"not null;size:100"`
+	Prefix       string     `json:"prefix" gorm:"size:255"`
+	RepoURL      string     `json:"repo_url" gorm:"not null;size:500"` // 本地路径或git远程地址
+	Branch       string     `json:"branch" gorm:"not null;size:100"`
+	Path         string     `json:"path" gorm:"size:255"`           // 仓库中的目录，为空时为仓库根目录
+	Format       string     `json:"format" gorm:"not null;size:20"` // 推送时新建文件的格式，yaml或json
+	Mode         string     `json:"mode" gorm:"not null;size:20"`   // apply 或 report
+	Prune        bool       `json:"prune"`                          // 删除前缀下仓库中不存在的键
+	Schedule     string     `json:"schedule" gorm:"size:100"`       // cron表达式，为空时只能手动同步
+	Enabled      bool       `json:"enabled"`
+	LastCommit   string     `json:"last_commit,omitempty" gorm:"size:40"` // 最近一次写入etcd的提交
+	LastSyncAt   *time.Time `json:"last_sync_at"`
+	LastStatus   string     `json:"last_status,omitempty" gorm:"size:20"`
+	CreatedBy    uint       `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (GitSync) TableName() string {
+	return "git_syncs"
+}
+
+// GitSyncRun 一次拉取或推送的记录
+type GitSyncRun struct {
+	ID          uint            `json:"id" gorm:"primarykey"`
+	SyncID      uint            `json:"sync_id" gorm:"not null;index"`
+	Direction   string          `json:"direction" gorm:"not null;size:10"`
+	Trigger     string          `json:"trigger" gorm:"size:20"` // schedule 或 manual
+	DryRun      bool            `json:"dry_run"`
+	Status      string          `json:"status" gorm:"not null;size:20"`
+	Commit      string          `json:"commit,omitempty" gorm:"size:40"` // 拉取时为读取的提交，推送时为新提交
+	Added       int             `json:"added"`
+	Changed     int             `json:"changed"`
+	Deleted     int             `json:"deleted"`
+	Unchanged   int             `json:"unchanged"`
+	Changes     []GitSyncChange `json:"changes,omitempty" gorm:"serializer:json;type:mediumtext"`
+	Error       string          `json:"error,omitempty" gorm:"type:text"`
+	TriggeredBy uint            `json:"triggered_by"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// GitSyncChange 同步中新增、修改或删除的键
+type GitSyncChange struct {
+	Key    string `json:"key"`
+	Action string `json:"action"` // add、change 或 delete
+}
+
+// TableName 指定表名
+func (GitSyncRun) TableName() string {
+	return "git_sync_runs"
+}
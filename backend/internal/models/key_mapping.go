@@ -0,0 +1,51 @@
+package models
+
+import "encoding/json"
+
+// 键名改写规则类型
+const (
+	RewriteLiteral = "literal" // 替换所有出现的子串
+	RewriteRegex   = "regex"   // 正则替换，To中可用$1、${name}引用分组
+)
+
+// 值转换规则类型
+const (
+	ValueTransformJSONSet = "json_set" // 设置JSON值中指定路径的字段
+	ValueTransformReplace = "replace"  // 替换所有出现的子串
+	ValueTransformRegex   = "regex"    // 正则替换
+)
+
+// KeyMapping 键名映射：先按源前缀和glob过滤，再将源前缀替换为目标前缀，最后依次应用改写规则
+// 改写规则和值转换中可以使用 {{name}} 引用Variables中的变量，如环境名
+type KeyMapping struct {
+	SourcePrefix string            `json:"source_prefix"` // 只处理该前缀下的键
+	TargetPrefix string            `json:"target_prefix"` // 替换源前缀，源前缀为空时加在键前
+	Include      []string          `json:"include"`       // 匹配原始键的glob，为空时包含全部
+	Exclude      []string          `json:"exclude"`       // 匹配原始键的glob，优先于include
+	Rewrites     []KeyRewrite      `json:"rewrites"`      // 按顺序应用
+	Variables    map[string]string `json:"variables,omitempty"`
+	Values       []ValueTransform  `json:"values,omitempty"` // 按顺序应用的值转换
+}
+
+// KeyRewrite 键名改写规则
+type KeyRewrite struct {
+	Type string `json:"type,omitempty"` // literal（默认）或 regex
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ValueTransform 值转换规则
+type ValueTransform struct {
+	Type  string          `json:"type"`
+	Match string          `json:"match,omitempty"` // 只转换匹配该glob的原始键，为空时转换全部
+	Path  string          `json:"path,omitempty"`  // json_set: JSON Pointer，如 /db/host
+	Value json.RawMessage `json:"value,omitempty"` // json_set: 设置的JSON值
+	From  string          `json:"from,omitempty"`  // replace: 子串；regex: 正则表达式
+	To    string          `json:"to,omitempty"`
+}
+
+// IsZero 是否未配置任何映射
+func (m KeyMapping) IsZero() bool {
+	return m.SourcePrefix == "" && m.TargetPrefix == "" &&
+		len(m.Include) == 0 && len(m.Exclude) == 0 && len(m.Rewrites) == 0 && len(m.Values) == 0
+}
@@ -2,12 +2,13 @@ package models
 
 import "time"
 
-// KVItem 表示键值条目
+// KVItem 表示键值条目，用于保存漂移检测基线中的期望状态
 type KVItem struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	ConnectionID uint      `json:"connection_id" gorm:"not null;index"`
-	Key          string    `json:"key" gorm:"not null;size:255"`
-	Value        string    `json:"value" gorm:"type:text"` // 存储JSON字符串
+	BaselineID   *uint     `json:"baseline_id" gorm:"index"`
+	Key          string    `json:"key" gorm:"not null;size:1024"`
+	Value        string    `json:"value" gorm:"type:mediumtext"` // 存储JSON字符串
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// LoginAttempt 登录失败计数，Key形如 "user:alice" 或 "ip:10.0.0.1"
+type LoginAttempt struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Key           string     `json:"key" gorm:"not null;size:150;uniqueIndex"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// 镜像状态
+const (
+	MirrorRunning = "running" // 同步中
+	MirrorPaused  = "paused"  // 暂停，恢复时从已应用的revision继续
+	MirrorStopped = "stopped" // 停止，恢复时重新全量同步
+)
+
+// Mirror 连接间的单向持续镜像，将源前缀下的变更同步到目标前缀
+type Mirror struct {
+	ID                 uint       `json:"id" gorm:"primarykey"`
+	Name               string     `json:"name" gorm:"not null;size:100"`
+	SourceConnectionID uint       `json:"source_connection_id" gorm:"not null;index"`
+	TargetConnectionID uint       `json:"target_connection_id" gorm:"not null;index"`
+	SourcePrefix       string     `json:"source_prefix" gorm:"size:255"`
+	TargetPrefix       string     `json:"target_prefix" gorm:"size:255"`
+	Status             string     `json:"status" gorm:"not null;size:20"`
+	Revision           int64      `json:"revision"` // 已应用到目标的源revision，0表示需要全量同步
+	LastError          string     `json:"last_error,omitempty" gorm:"type:text"`
+	LastSyncedAt       *time.Time `json:"last_synced_at"` // 最近一次全量同步完成的时间
+	CreatedBy          uint       `json:"created_by"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Mirror) TableName() string {
+	return "mirrors"
+}
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Pipeline 环境晋级流水线，按顺序排列的环境，配置逐级晋级到下一个环境
+type Pipeline struct {
+	ID           uint                  `json:"id" gorm:"primarykey"`
+	Name         string                `json:"name" gorm:"uniqueIndex;not null;size:100"`
+	Description  string                `json:"description" gorm:"size:255"`
+	Environments []PipelineEnvironment `json:"environments" gorm:"serializer:json;type:text"` // 按晋级顺序排列，如 dev、staging、prod
+	Ignore       []string              `json:"ignore" gorm:"serializer:json;type:text"`       // 匹配相对键的glob，各环境预期不同的键不参与晋级
+	CreatedBy    uint                  `json:"created_by"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+// PipelineEnvironment 流水线中的环境：连接以及该环境的配置所在的前缀
+type PipelineEnvironment struct {
+	Name         string `json:"name"`
+	ConnectionID uint   `json:"connection_id"`
+	Prefix       string `json:"prefix"`
+}
+
+// TableName 指定表名
+func (Pipeline) TableName() string {
+	return "pipelines"
+}
+
+// Environment 按名称查找环境，返回环境及其在流水线中的位置
+func (p *Pipeline) Environment(name string) (*PipelineEnvironment, int) {
+	for i := range p.Environments {
+		if p.Environments[i].Name == name {
+			return &p.Environments[i], i
+		}
+	}
+	return nil, -1
+}
+
+// 晋级状态
+const (
+	PromotionPending   = "pending"   // 还有待应用的变更
+	PromotionApplied   = "applied"   // 所有变更都已处理
+	PromotionDiscarded = "discarded" // 已放弃，剩余变更不再应用
+)
+
+// 晋级变更的处理状态
+const (
+	PromotionItemPending  = "pending"
+	PromotionItemApplied  = "applied"
+	PromotionItemConflict = "conflict" // 目标在晋级创建之后被修改，未应用
+	PromotionItemRejected = "rejected" // 放弃晋级时未应用的变更
+)
+
+// Promotion 从一个环境晋级到下一个环境的待应用变更集
+type Promotion struct {
+	ID                 uint            `json:"id" gorm:"primarykey"`
+	PipelineID         uint            `json:"pipeline_id" gorm:"not null;index"`
+	FromEnvironment    string          `json:"from_environment" gorm:"not null;size:100"`
+	ToEnvironment      string          `json:"to_environment" gorm:"not null;size:100"`
+	SourceConnectionID uint            `json:"source_connection_id" gorm:"not null"`
+	TargetConnectionID uint            `json:"target_connection_id" gorm:"not null"`
+	SourcePrefix       string          `json:"source_prefix" gorm:"size:255"`
+	TargetPrefix       string          `json:"target_prefix" gorm:"size:255"`
+	SourceRevision     int64           `json:"source_revision"`
+	TargetRevision     int64           `json:"target_revision"`
+	Status             string          `json:"status" gorm:"not null;size:20;index"`
+	CreatedBy          uint            `json:"created_by"`
+	AppliedBy          uint            `json:"applied_by,omitempty"` // 最近一次应用变更的用户
+	AppliedAt          *time.Time      `json:"applied_at"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+	Items              []PromotionItem `json:"items,omitempty" gorm:"foreignKey:PromotionID"`
+}
+
+// TableName 指定表名
+func (Promotion) TableName() string {
+	return "promotions"
+}
+
+// PromotionItem 晋级中单个键的变更，键为去掉环境前缀后的相对键
+type PromotionItem struct {
+	ID                uint   `json:"id" gorm:"primarykey"`
+	PromotionID       uint   `json:"promotion_id" gorm:"not null;index"`
+	Key               string `json:"key" gorm:"not null;size:1024"`
+	Action            string `json:"action" gorm:"not null;size:20"` // add、change、delete
+	SourceValue       string `json:"source_value,omitempty" gorm:"type:mediumblob"`
+	TargetValue       string `json:"target_value,omitempty" gorm:"type:mediumblob"` // 创建晋级时目标中的值
+	TargetModRevision int64  `json:"target_mod_revision"`                           // 创建晋级时目标键的mod_revision，不存在时为0
+	Status            string `json:"status" gorm:"not null;size:20"`
+}
+
+// TableName 指定表名
+func (PromotionItem) TableName() string {
+	return "promotion_items"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/pkg/secrets"
+)
+
+// 备份存储类型
+const (
+	StorageTypeLocal = "local" // 本地目录
+	StorageTypeS3    = "s3"    // S3兼容的对象存储（AWS S3、MinIO等）
+)
+
+// StorageLocation 命名的备份存储位置
+// ID为0表示内置的本地存储（BACKUP_DIR），不保存在数据库中
+type StorageLocation struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	Name        string         `json:"name" gorm:"not null;size:100;uniqueIndex"`
+	Type        string         `json:"type" gorm:"not null;size:20"`
+	Description string         `json:"description" gorm:"type:text"`
+	Path        string         `json:"path" gorm:"size:500"`     // local: 备份目录
+	Endpoint    string         `json:"endpoint" gorm:"size:255"` // s3: 服务地址，如 s3.amazonaws.com、minio:9000
+	Region      string         `json:"region" gorm:"size:50"`
+	Bucket      string         `json:"bucket" gorm:"size:100"`
+	Prefix      string         `json:"prefix" gorm:"size:255"` // s3: 对象键前缀
+	AccessKey   string         `json:"access_key" gorm:"size:255"`
+	SecretKey   string         `json:"-" gorm:"type:text"` // 加密存储，接口只写
+	UseSSL      bool           `json:"use_ssl" gorm:"column:use_ssl"`
+	PathStyle   bool           `json:"path_style"` // 使用路径风格访问bucket，MinIO等通常需要开启
+	CreatedBy   uint           `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	HasSecretKey bool `json:"has_secret_key" gorm:"-"`
+}
+
+// TableName 指定表名
+func (StorageLocation) TableName() string {
+	return "storage_locations"
+}
+
+// BeforeSave GORM钩子 - 保存前加密密钥
+func (l *StorageLocation) BeforeSave(tx *gorm.DB) error {
+	var err error
+	l.SecretKey, err = secrets.Encrypt(l.SecretKey)
+	return err
+}
+
+// AfterSave GORM钩子 - 保存后还原为明文供后续使用
+func (l *StorageLocation) AfterSave(tx *gorm.DB) error {
+	return l.decryptSecrets()
+}
+
+// AfterFind GORM钩子 - 查询后解密密钥
+func (l *StorageLocation) AfterFind(tx *gorm.DB) error {
+	return l.decryptSecrets()
+}
+
+// decryptSecrets 解密密钥并更新是否已设置的标记
+func (l *StorageLocation) decryptSecrets() error {
+	var err error
+	if l.SecretKey, err = secrets.Decrypt(l.SecretKey); err != nil {
+		return err
+	}
+	l.HasSecretKey = l.SecretKey != ""
+	return nil
+}
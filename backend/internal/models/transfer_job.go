@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// 传输任务状态
+const (
+	TransferJobPending   = "pending"
+	TransferJobRunning   = "running"
+	TransferJobCompleted = "completed"
+	TransferJobFailed    = "failed"
+	TransferJobCancelled = "cancelled"
+)
+
+// 冲突策略：目标中已存在且值不同的键的处理方式
+const (
+	ConflictSkip      = "skip"               // 保留目标值
+	ConflictOverwrite = "overwrite"          // 使用源值覆盖
+	ConflictNewer     = "overwrite_if_newer" // 源比目标新时覆盖
+	ConflictMerge     = "merge"              // 深度合并JSON对象，字段冲突时以源为准
+	ConflictFail      = "fail"               // 停止传输
+)
+
+// TransferJob 后台执行的连接间KV传输任务
+type TransferJob struct {
+	ID                 uint       `json:"id" gorm:"primarykey"`
+	SourceConnectionID uint       `json:"source_connection_id" gorm:"not null;index"`
+	TargetConnectionID uint       `json:"target_connection_id" gorm:"not null;index"`
+	Status             string     `json:"status" gorm:"not null;size:20;index"`
+	Prefix             string     `json:"prefix" gorm:"size:255"`
+	Keys               []string   `json:"keys,omitempty" gorm:"serializer:json;type:text"` // 指定的键，为空时传输前缀下的全部键
+	Overwrite          bool       `json:"overwrite"`
+	ConflictPolicy     string     `json:"conflict_policy" gorm:"size:30"`
+	TimestampField     string     `json:"timestamp_field,omitempty" gorm:"size:255"` // overwrite_if_newer比较的时间字段（JSON Pointer），源和目标为不同连接时必须设置，同一连接内为空时比较mod_revision
+	Mapping            KeyMapping `json:"mapping" gorm:"serializer:json;type:text"`
+	Revision           int64      `json:"revision"` // 读取源数据的revision
+	Total              int64      `json:"total"`    // 源中待处理的键数
+	Processed          int64      `json:"processed"`
+	SuccessCount       int64      `json:"success_count"`
+	MergedCount        int64      `json:"merged_count"`    // 合并写入的键，包含在success_count中
+	SkippedCount       int64      `json:"skipped_count"`   // 目标已存在且按策略保留目标值
+	UnchangedCount     int64      `json:"unchanged_count"` // 目标值相同，未写入
+	FilteredCount      int64      `json:"filtered_count"`  // 被映射规则过滤
+	MissingCount       int64      `json:"missing_count"`   // 指定的键在源中不存在
+	Error              string     `json:"error,omitempty" gorm:"type:text"`
+	CreatedBy          uint       `json:"created_by"`
+	StartedAt          *time.Time `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at"`
+	RolledBackAt       *time.Time `json:"rolled_back_at"` // 最近一次回滚的时间
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (TransferJob) TableName() string {
+	return "transfer_jobs"
+}
+
+// Policy 任务的冲突策略，未设置时按overwrite决定
+func (j *TransferJob) Policy() string {
+	if j.ConflictPolicy != "" {
+		return j.ConflictPolicy
+	}
+	if j.Overwrite {
+		return ConflictOverwrite
+	}
+	return ConflictSkip
+}
+
+// Finished 任务是否已结束
+func (j *TransferJob) Finished() bool {
+	return j.Status == TransferJobCompleted || j.Status == TransferJobFailed || j.Status == TransferJobCancelled
+}
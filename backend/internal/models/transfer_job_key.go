@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// TransferJobKey 传输任务中每个键的处理结果
+type TransferJobKey struct {
+	ID        uint   `json:"id" gorm:"primarykey"`
+	JobID     uint   `json:"job_id" gorm:"not null;index:idx_transfer_job_keys_job_decision"`
+	Key       string `json:"key" gorm:"not null;size:1024"`
+	SourceKey string `json:"source_key,omitempty" gorm:"size:1024"` // 配置了键名映射时为源中的原始键
+	Decision  string `json:"decision" gorm:"not null;size:20;index:idx_transfer_job_keys_job_decision"`
+	// 写入的键记录目标中原来的值，用于回滚
+	PreviousExists  bool      `json:"previous_exists"`
+	PreviousValue   []byte    `json:"-" gorm:"type:mediumblob"`
+	WrittenRevision int64     `json:"written_revision"` // 写入后的mod_revision，0表示未写入
+	RolledBack      bool      `json:"rolled_back"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (TransferJobKey) TableName() string {
+	return "transfer_job_keys"
+}
@@ -5,6 +5,8 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+
+	"etcd-admin-backend/pkg/secrets"
 )
 
 // User 用户模型
@@ -19,6 +21,17 @@ type User struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 外部身份来源
+	AuthProvider string `json:"auth_provider" gorm:"not null;default:'local';size:20;index:idx_users_external"`
+	ExternalID   string `json:"-" gorm:"size:255;index:idx_users_external"`
+	AvatarURL    string `json:"avatar_url,omitempty" gorm:"size:255"`
+
+	// TOTP两步验证
+	MFAEnabled       bool   `json:"mfa_enabled" gorm:"column:mfa_enabled;default:false"`
+	MFASecret        string `json:"-" gorm:"column:mfa_secret;type:text"` // TOTP密钥，加密存储
+	MFALastStep      int64  `json:"-" gorm:"column:mfa_last_step;default:0"`
+	MFARecoveryCodes string `json:"-" gorm:"column:mfa_recovery_codes;type:text"` // 恢复码哈希的JSON数组
 }
 
 // TableName 指定表名
@@ -46,8 +59,40 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return u.HashPassword()
 }
 
+// BeforeSave GORM钩子 - 保存前加密TOTP密钥
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	var err error
+	u.MFASecret, err = secrets.Encrypt(u.MFASecret)
+	return err
+}
+
+// AfterSave GORM钩子 - 保存后还原为明文供后续使用
+func (u *User) AfterSave(tx *gorm.DB) error {
+	return u.decryptMFASecret()
+}
+
+// AfterFind GORM钩子 - 查询后解密TOTP密钥
+func (u *User) AfterFind(tx *gorm.DB) error {
+	return u.decryptMFASecret()
+}
+
+// decryptMFASecret 解密TOTP密钥
+func (u *User) decryptMFASecret() error {
+	var err error
+	u.MFASecret, err = secrets.Decrypt(u.MFASecret)
+	return err
+}
+
 // UserRole 用户角色常量
 const (
 	RoleAdmin = "admin"
 	RoleUser  = "user"
 )
+
+// AuthProvider 身份来源常量
+const (
+	AuthProviderLocal  = "local"
+	AuthProviderOIDC   = "oidc"
+	AuthProviderGitHub = "github"
+	AuthProviderLDAP   = "ldap"
+)
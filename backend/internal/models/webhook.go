@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/pkg/secrets"
+)
+
+// Webhook投递状态
+const (
+	WebhookDeliveryPending = "pending" // 等待投递或重试
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed" // 达到最多投递次数
+)
+
+// Webhook 连接的出站通知，键变更和管理操作事件以JSON POST到URL
+type Webhook struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	ConnectionID   uint       `json:"connection_id" gorm:"not null;index"`
+	Name           string     `json:"name" gorm:"not null;size:100"`
+	URL            string     `json:"url" gorm:"not null;size:500"`
+	Secret         string     `json:"-" gorm:"type:text"` // HMAC签名密钥，加密存储
+	Prefix         string     `json:"prefix" gorm:"size:255"`
+	Events         []string   `json:"events" gorm:"serializer:json;type:text"` // 订阅的事件，支持通配符，为空时订阅全部
+	IncludeValues  bool       `json:"include_values"`                          // key.changed事件中包含键的值
+	Enabled        bool       `json:"enabled"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at"`
+	LastStatus     string     `json:"last_status,omitempty" gorm:"size:20"`
+	CreatedBy      uint       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// BeforeSave GORM钩子 - 保存前加密密钥
+func (w *Webhook) BeforeSave(tx *gorm.DB) error {
+	var err error
+	w.Secret, err = secrets.Encrypt(w.Secret)
+	return err
+}
+
+// AfterSave GORM钩子 - 保存后还原为明文供后续使用
+func (w *Webhook) AfterSave(tx *gorm.DB) error {
+	return w.decryptSecret()
+}
+
+// AfterFind GORM钩子 - 查询后解密密钥
+func (w *Webhook) AfterFind(tx *gorm.DB) error {
+	return w.decryptSecret()
+}
+
+// decryptSecret 解密签名密钥
+func (w *Webhook) decryptSecret() error {
+	var err error
+	w.Secret, err = secrets.Decrypt(w.Secret)
+	return err
+}
+
+// WebhookDelivery 一个事件到Webhook的投递记录，失败时按退避时间重试
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"not null;size:32"`
+	Event          string     `json:"event" gorm:"not null;size:50"`
+	Payload        string     `json:"payload,omitempty" gorm:"type:mediumtext"` // 请求体，重试时原样发送
+	Status         string     `json:"status" gorm:"not null;size:20;index"`
+	Test           bool       `json:"test"` // 测试投递，失败不重试
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status"`
+	Error          string     `json:"error,omitempty" gorm:"type:text"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
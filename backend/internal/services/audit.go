@@ -0,0 +1,23 @@
+package services
+
+import (
+	"log"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// AuditService 审计日志服务
+type AuditService struct{}
+
+// NewAuditService 创建审计日志服务
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// Record 写入审计日志，失败时只记录日志不影响业务
+func (s *AuditService) Record(entry *models.AuditLog) {
+	if err := database.GetDB().Create(entry).Error; err != nil {
+		log.Printf("Failed to write audit log %s: %v", entry.Action, err)
+	}
+}
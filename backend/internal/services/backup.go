@@ -0,0 +1,505 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"etcd-admin-backend/internal/models"
+)
+
+// DefaultExportPageSize 默认每页读取的键数
+const DefaultExportPageSize = 1000
+
+// 导入时每个事务写入的键数
+const (
+	DefaultImportChunkSize = 100
+	MaxImportChunkSize     = MaxTxnOps
+)
+
+var (
+	// ErrUnsupportedFormat 不支持的备份格式
+	ErrUnsupportedFormat = errors.New("unsupported backup format")
+	// ErrImportConflict 计算差异之后键已被修改
+	ErrImportConflict = errors.New("keys changed since the import diff was computed")
+)
+
+// BackupService 备份导入导出服务
+type BackupService struct {
+	etcdService *EtcdService
+	crypto      *BackupCrypto
+}
+
+// NewBackupService 创建备份服务
+func NewBackupService(etcdService *EtcdService, crypto *BackupCrypto) *BackupService {
+	return &BackupService{
+		etcdService: etcdService,
+		crypto:      crypto,
+	}
+}
+
+// Crypto 备份加密与签名
+func (s *BackupService) Crypto() *BackupCrypto {
+	return s.crypto
+}
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	Prefix   string
+	Format   string
+	PageSize int64
+}
+
+// ExportResult 导出结果
+type ExportResult struct {
+	Revision int64 `json:"revision"`
+	Count    int64 `json:"count"`
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	Format     string            // 为空时自动识别
+	Overwrite  bool              // 是否覆盖已存在的key
+	Passphrase string            // 口令加密的备份需要提供
+	DryRun     bool              // 只计算差异，不写入
+	Prune      bool              // 全量同步：删除Prefix下备份中不存在的键
+	Prefix     string            // 全量同步的范围
+	Revision   int64             // 按该revision（通常为预览返回的revision）计算差异，之后被修改的键导入时冲突
+	ChunkSize  int               // 每个事务写入的键数
+	ShowValues bool              // 差异中包含新旧值
+	Mapping    models.KeyMapping // 导入到其他前缀或只导入部分键
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Format       string           `json:"format"`
+	DryRun       bool             `json:"dry_run"`
+	Revision     int64            `json:"revision"` // 计算差异时读取的revision
+	Added        int              `json:"added"`
+	Changed      int              `json:"changed"`
+	Unchanged    int              `json:"unchanged"`
+	Deleted      int              `json:"deleted"`
+	Filtered     int              `json:"filtered"`      // 被映射规则过滤掉的键数
+	SuccessCount int              `json:"success_count"` // 已写入的键数（新增、覆盖和删除）
+	SkippedCount int              `json:"skipped_count"` // 已存在且未开启覆盖的键数
+	ErrorCount   int              `json:"error_count"`
+	Errors       []string         `json:"errors,omitempty"`
+	Items        []ImportDiffItem `json:"items,omitempty"` // 预览或配置了键名映射时返回
+	SealInfo
+}
+
+// 导入时每个键的处理方式
+const (
+	ImportActionAdd       = "add"       // 新增
+	ImportActionChange    = "change"    // 覆盖已有的值
+	ImportActionUnchanged = "unchanged" // 值相同，不写入
+	ImportActionSkip      = "skip"      // 已存在且未开启覆盖
+	ImportActionDelete    = "delete"    // 全量同步时删除备份中不存在的键
+	ImportActionMerge     = "merge"     // 传输时按merge策略合并后写入
+	ImportActionConflict  = "conflict"  // 传输时按fail策略停止
+)
+
+// ImportDiffItem 单个键的导入差异
+type ImportDiffItem struct {
+	Key         string  `json:"key"`
+	SourceKey   string  `json:"source_key,omitempty"` // 配置了键名映射时为备份中的原始键
+	Action      string  `json:"action"`
+	ModRevision int64   `json:"mod_revision"` // 计算差异时的mod_revision，键不存在时为0
+	OldValue    *string `json:"old_value,omitempty"`
+	NewValue    *string `json:"new_value,omitempty"`
+
+	record *BackupRecord
+}
+
+// Export 在固定revision上分页读取并流式写出，内存占用与键空间大小无关
+// 第一页读取成功前不会向w写入任何数据，调用方可据此返回错误响应
+func (s *BackupService) Export(ctx context.Context, conn *models.Connection, w io.Writer, opts ExportOptions) (*ExportResult, error) {
+	if opts.Format == "" {
+		opts.Format = ExportFormatJSON
+	}
+	if !IsValidExportFormat(opts.Format) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, opts.Format)
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultExportPageSize
+	}
+
+	// 无损格式需要记录租约剩余时间
+	var leases *leaseTTLCache
+	if opts.Format != ExportFormatJSON && opts.Format != ExportFormatYAML {
+		client, release, err := s.etcdService.Acquire(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		leases = &leaseTTLCache{client: client, conn: conn, ttls: make(map[int64]int64)}
+	}
+
+	bw := bufio.NewWriter(w)
+	writer := newBackupWriter(opts.Format, bw)
+	result := &ExportResult{}
+	started := false
+
+	begin := func(revision int64) error {
+		started = true
+		return writer.Begin(backupMeta{
+			ConnectionName: conn.Name,
+			ConnectionID:   conn.ID,
+			ExportTime:     time.Now(),
+			Revision:       revision,
+		})
+	}
+
+	revision, err := s.etcdService.StreamKV(ctx, conn, opts.Prefix, opts.PageSize, func(revision int64, kv *mvccpb.KeyValue) error {
+		if !started {
+			if err := begin(revision); err != nil {
+				return err
+			}
+		}
+
+		record := &BackupRecord{
+			Key:            string(kv.Key),
+			Value:          kv.Value,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+			Lease:          kv.Lease,
+		}
+		if kv.Lease != 0 && leases != nil {
+			ttl, err := leases.ttl(ctx, kv.Lease)
+			if err != nil {
+				return err
+			}
+			record.LeaseTTL = ttl
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		result.Count++
+		return nil
+	})
+	result.Revision = revision
+	if err != nil {
+		// 缓冲中未写出的数据直接丢弃，已写出的部分由调用方中止响应
+		return result, err
+	}
+
+	if !started {
+		if err := begin(revision); err != nil {
+			return result, err
+		}
+	}
+	if err := writer.End(); err != nil {
+		return result, err
+	}
+	return result, bw.Flush()
+}
+
+// ReadBackup 校验并解密备份后逐条读取记录，不写入etcd，返回识别出的格式
+func (s *BackupService) ReadBackup(r io.Reader, passphrase, format string, fn func(record *BackupRecord) error) (string, error) {
+	payload, _, cleanup, err := s.crypto.Open(r, passphrase)
+	defer cleanup()
+	if err != nil {
+		return "", err
+	}
+	return readBackup(payload, &ImportOptions{Format: format}, fn)
+}
+
+// Import 读取备份写入etcd，format为空时自动识别格式
+// 签名的备份在校验通过后才会写入，加密的备份先解密
+// 先在同一revision上与现有数据比较得到每个键的处理方式，再按块在事务中写入，
+// 每个键以读取到的mod_revision为条件，期间被修改时返回ErrImportConflict
+// 带租约的键会按原租约分组，以导出时的剩余时间重新申请租约
+func (s *BackupService) Import(ctx context.Context, conn *models.Connection, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	payload, info, cleanup, err := s.crypto.Open(r, opts.Passphrase)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	if opts.ChunkSize <= 0 || opts.ChunkSize > MaxImportChunkSize {
+		opts.ChunkSize = DefaultImportChunkSize
+	}
+	mapper, err := NewKeyMapper(opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	client, release, err := s.etcdService.Acquire(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result := &ImportResult{DryRun: opts.DryRun, SealInfo: *info}
+
+	// 先读取整个备份，同一个键出现多次时以最后一次为准
+	// records以映射后的目标键为索引，sources记录目标键对应的原始键
+	records := make(map[string]*BackupRecord)
+	var sources map[string]string
+	if mapper != nil {
+		sources = make(map[string]string)
+	}
+	format, err := readBackup(payload, &opts, func(record *BackupRecord) error {
+		if err := ctx.Err(); err != nil {
+			return classifyError(err)
+		}
+
+		target, ok := mapper.Map(record.Key)
+		if !ok {
+			result.Filtered++
+			return nil
+		}
+		if sources != nil {
+			if target == "" {
+				return fmt.Errorf("%w: key %s maps to an empty key", ErrInvalidKeyMapping, record.Key)
+			}
+			if source, exists := sources[target]; exists && source != record.Key {
+				return fmt.Errorf("%w: %s and %s both map to %s", ErrInvalidKeyMapping, source, record.Key, target)
+			}
+			sources[target] = record.Key
+		}
+
+		copied := *record
+		copied.Key = target
+		copied.Value = mapper.MapValue(record.Key, record.Value)
+		records[target] = &copied
+		return nil
+	})
+	result.Format = format
+	if err != nil {
+		return result, err
+	}
+
+	items, revision, err := importDiff(ctx, s.etcdService, conn, records, sources, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Revision = revision
+
+	writes := make([]ImportDiffItem, 0, len(items))
+	for _, item := range items {
+		switch item.Action {
+		case ImportActionAdd:
+			result.Added++
+		case ImportActionChange:
+			result.Changed++
+		case ImportActionUnchanged:
+			result.Unchanged++
+		case ImportActionSkip:
+			result.SkippedCount++
+		case ImportActionDelete:
+			result.Deleted++
+		}
+		if item.Action == ImportActionAdd || item.Action == ImportActionChange || item.Action == ImportActionDelete {
+			writes = append(writes, item)
+		}
+	}
+	// 配置了映射时无论是否预览都返回原始键到目标键的对应关系
+	if opts.DryRun || mapper != nil {
+		result.Items = items
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	leases := make(map[int64]clientv3.LeaseID) // 原租约ID -> 新租约ID
+	for start := 0; start < len(writes); start += opts.ChunkSize {
+		if err := ctx.Err(); err != nil {
+			return result, classifyError(err)
+		}
+
+		chunk := writes[start:min(start+opts.ChunkSize, len(writes))]
+		reqCtx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
+		_, err := applyImportChunk(reqCtx, client, leases, chunk)
+		cancel()
+		if err != nil {
+			// 已提交的块不会回滚
+			result.ErrorCount++
+			result.Errors = append(result.Errors, err.Error())
+			return result, err
+		}
+		result.SuccessCount += len(chunk)
+	}
+	return result, nil
+}
+
+// importDiff 在同一revision上读取现有数据，计算每个键的处理方式，结果按键排序
+// sources为目标键到原始键的对应关系，未配置键名映射时为nil
+func importDiff(ctx context.Context, etcdService *EtcdService, conn *models.Connection, records map[string]*BackupRecord, sources map[string]string, opts ImportOptions) ([]ImportDiffItem, int64, error) {
+	current := make(map[string]*mvccpb.KeyValue, len(records))
+	revision := opts.Revision
+
+	// 全量同步需要范围内的所有键
+	if opts.Prune {
+		rev, err := etcdService.StreamKVAt(ctx, conn, opts.Prefix, revision, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+			current[string(kv.Key)] = kv
+			return nil
+		})
+		if err != nil {
+			return nil, 0, importReadError(err, revision)
+		}
+		revision = rev
+	}
+
+	// 其余的键在同一revision上分批读取
+	var pending []string
+	for key := range records {
+		if !opts.Prune || !strings.HasPrefix(key, opts.Prefix) {
+			pending = append(pending, key)
+		}
+	}
+	sort.Strings(pending)
+	rev, err := etcdService.GetKeysAt(ctx, conn, pending, revision, func(kv *mvccpb.KeyValue) error {
+		current[string(kv.Key)] = kv
+		return nil
+	})
+	if err != nil {
+		return nil, 0, importReadError(err, revision)
+	}
+	revision = rev
+
+	items := make([]ImportDiffItem, 0, len(records))
+	for key, record := range records {
+		item := ImportDiffItem{Key: key, SourceKey: sources[key], record: record}
+		kv, exists := current[key]
+		switch {
+		case !exists:
+			item.Action = ImportActionAdd
+		case bytes.Equal(kv.Value, record.Value) && (kv.Lease != 0) == (record.LeaseTTL > 0):
+			item.Action = ImportActionUnchanged
+		case opts.Overwrite:
+			item.Action = ImportActionChange
+		default:
+			item.Action = ImportActionSkip
+		}
+		if exists {
+			item.ModRevision = kv.ModRevision
+		}
+		if opts.ShowValues {
+			value := string(record.Value)
+			item.NewValue = &value
+			if exists {
+				old := string(kv.Value)
+				item.OldValue = &old
+			}
+		}
+		items = append(items, item)
+	}
+
+	if opts.Prune {
+		for key, kv := range current {
+			if _, ok := records[key]; ok || !strings.HasPrefix(key, opts.Prefix) {
+				continue
+			}
+			item := ImportDiffItem{Key: key, Action: ImportActionDelete, ModRevision: kv.ModRevision}
+			if opts.ShowValues {
+				old := string(kv.Value)
+				item.OldValue = &old
+			}
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+	return items, revision, nil
+}
+
+// importReadError 指定的revision已被压缩时无法再确认预览之后的修改，视为冲突
+func importReadError(err error, revision int64) error {
+	if errors.Is(err, rpctypes.ErrCompacted) {
+		return fmt.Errorf("%w: revision %d has been compacted", ErrImportConflict, revision)
+	}
+	return err
+}
+
+// applyImportChunk 在一个事务中写入一块键，任一键的mod_revision与差异计算时不同则整块不写入
+// 成功时返回事务的revision，即写入的键的mod_revision
+func applyImportChunk(ctx context.Context, client *clientv3.Client, leases map[int64]clientv3.LeaseID, chunk []ImportDiffItem) (int64, error) {
+	cmps := make([]clientv3.Cmp, 0, len(chunk))
+	ops := make([]clientv3.Op, 0, len(chunk))
+	for _, item := range chunk {
+		// 不存在的键mod_revision为0
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(item.Key), "=", item.ModRevision))
+		if item.Action == ImportActionDelete {
+			ops = append(ops, clientv3.OpDelete(item.Key))
+			continue
+		}
+
+		var putOpts []clientv3.OpOption
+		if item.record.LeaseTTL > 0 {
+			leaseID, err := importLease(ctx, client, leases, item.record)
+			if err != nil {
+				return 0, fmt.Errorf("failed to grant lease for key %s: %w", item.Key, classifyError(err))
+			}
+			putOpts = append(putOpts, clientv3.WithLease(leaseID))
+		}
+		ops = append(ops, clientv3.OpPut(item.Key, string(item.record.Value), putOpts...))
+	}
+
+	resp, err := client.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to write keys %s..%s: %w", chunk[0].Key, chunk[len(chunk)-1].Key, classifyError(err))
+	}
+	if !resp.Succeeded {
+		return 0, fmt.Errorf("%w: %s..%s", ErrImportConflict, chunk[0].Key, chunk[len(chunk)-1].Key)
+	}
+	return resp.Header.Revision, nil
+}
+
+// importLease 为导入的键申请租约，同一原租约的键共享一个新租约
+func importLease(ctx context.Context, client *clientv3.Client, leases map[int64]clientv3.LeaseID, record *BackupRecord) (clientv3.LeaseID, error) {
+	if record.Lease != 0 {
+		if leaseID, ok := leases[record.Lease]; ok {
+			return leaseID, nil
+		}
+	}
+
+	resp, err := client.Grant(ctx, record.LeaseTTL)
+	if err != nil {
+		return 0, err
+	}
+	if record.Lease != 0 {
+		leases[record.Lease] = resp.ID
+	}
+	return resp.ID, nil
+}
+
+// leaseTTLCache 导出时查询租约剩余时间，每个租约只查询一次
+type leaseTTLCache struct {
+	client *clientv3.Client
+	conn   *models.Connection
+	ttls   map[int64]int64
+}
+
+func (c *leaseTTLCache) ttl(ctx context.Context, lease int64) (int64, error) {
+	if ttl, ok := c.ttls[lease]; ok {
+		return ttl, nil
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.conn.RequestTimeoutDuration())
+	defer cancel()
+
+	resp, err := c.client.TimeToLive(reqCtx, clientv3.LeaseID(lease))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get lease ttl: %w", classifyError(err))
+	}
+	ttl := resp.TTL
+	if ttl < 0 {
+		ttl = 0 // 租约已过期
+	}
+	c.ttls[lease] = ttl
+	return ttl, nil
+}
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"etcd-admin-backend/internal/config"
+)
+
+var (
+	// ErrInvalidSealOptions 加密或签名选项错误
+	ErrInvalidSealOptions = errors.New("invalid encryption or signing options")
+	// ErrNoSigningKey 未配置签名密钥
+	ErrNoSigningKey = errors.New("backup signing key is not configured")
+	// ErrSignatureRequired 备份未签名
+	ErrSignatureRequired = errors.New("backup signature is required")
+	// ErrSignatureInvalid 签名校验失败，文件已被修改或不完整
+	ErrSignatureInvalid = errors.New("backup signature is invalid")
+	// ErrUntrustedSigner 签名密钥不受信任
+	ErrUntrustedSigner = errors.New("backup is signed by an untrusted key")
+	// ErrBackupDecrypt 解密失败
+	ErrBackupDecrypt = errors.New("failed to decrypt backup")
+)
+
+// 签名文件格式：signedMagic + 备份内容（可能已加密）+ 定长的签名尾部
+// 签名内容为 signatureContext + sha512(备份内容)
+const (
+	signedMagic      = "ETCD-ADMIN-SIGNED-BACKUP/v1\n"
+	signatureContext = "etcd-admin-backup-v1\n"
+	trailerPrefix    = "\n-----SIGNATURE "
+	trailerSuffix    = "-----\n"
+	ageMagic         = "age-encryption.org/v1\n"
+)
+
+// trailerLen 签名尾部长度：公钥和签名均为base64编码
+var trailerLen = len(trailerPrefix) + base64.StdEncoding.EncodedLen(ed25519.PublicKeySize) + 1 +
+	base64.StdEncoding.EncodedLen(ed25519.SignatureSize) + len(trailerSuffix)
+
+// SealOptions 导出时的加密与签名选项
+type SealOptions struct {
+	Passphrase        string   // 使用口令加密，不能与接收者同时使用
+	Recipients        []string // age X25519公钥（age1...）
+	DefaultRecipients bool     // 使用 BACKUP_AGE_RECIPIENTS 配置的接收者
+	Sign              bool
+}
+
+// SealInfo 导入时识别到的加密与签名信息
+type SealInfo struct {
+	Encrypted   bool   `json:"encrypted"`
+	Signed      bool   `json:"signed"`
+	SignerKeyID string `json:"signer_key_id,omitempty"`
+}
+
+// BackupCrypto 备份文件的加密（age）与签名（Ed25519）
+type BackupCrypto struct {
+	signingKey        ed25519.PrivateKey
+	trusted           map[string]ed25519.PublicKey // key_id -> 公钥，包含本实例的公钥
+	requireSignature  bool
+	defaultRecipients []age.Recipient
+	identities        []age.Identity
+}
+
+// NewBackupCrypto 根据配置加载签名密钥、受信任公钥和age密钥
+func NewBackupCrypto(cfg config.BackupConfig) (*BackupCrypto, error) {
+	c := &BackupCrypto{
+		trusted:          make(map[string]ed25519.PublicKey),
+		requireSignature: cfg.RequireSignature,
+	}
+
+	seed, err := loadSigningSeed(cfg.SigningKey, cfg.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		c.signingKey = ed25519.NewKeyFromSeed(seed)
+		public := c.signingKey.Public().(ed25519.PublicKey)
+		c.trusted[signingKeyID(public)] = public
+	}
+
+	for _, encoded := range cfg.TrustedKeys {
+		public, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid trusted signing key: %s", encoded)
+		}
+		c.trusted[signingKeyID(public)] = public
+	}
+	if c.requireSignature && len(c.trusted) == 0 {
+		return nil, errors.New("BACKUP_REQUIRE_SIGNATURE needs a signing key or trusted keys")
+	}
+
+	if c.defaultRecipients, err = parseRecipients(cfg.AgeRecipients); err != nil {
+		return nil, err
+	}
+
+	if cfg.AgeIdentityFile != "" {
+		file, err := os.Open(cfg.AgeIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age identity file: %w", err)
+		}
+		defer file.Close()
+		if c.identities, err = age.ParseIdentities(file); err != nil {
+			return nil, fmt.Errorf("invalid age identity file: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// loadSigningSeed 读取base64编码的32字节Ed25519种子
+func loadSigningSeed(encoded, path string) ([]byte, error) {
+	if encoded == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key file: %w", err)
+		}
+		encoded = strings.TrimSpace(string(content))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("signing key must be base64 encoded: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return seed, nil
+}
+
+// parseRecipients 解析age X25519公钥
+func parseRecipients(values []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %s: %w", value, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// signingKeyID 公钥的短标识
+func signingKeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CanSign 是否配置了签名密钥
+func (c *BackupCrypto) CanSign() bool {
+	return c.signingKey != nil
+}
+
+// PublicKey 返回本实例签名公钥（base64）及其标识，未配置时返回空
+func (c *BackupCrypto) PublicKey() (string, string) {
+	if c.signingKey == nil {
+		return "", ""
+	}
+	public := c.signingKey.Public().(ed25519.PublicKey)
+	return base64.StdEncoding.EncodeToString(public), signingKeyID(public)
+}
+
+// FileSuffix 加密和签名后追加的文件扩展名
+func (c *BackupCrypto) FileSuffix(opts SealOptions) string {
+	suffix := ""
+	if opts.Passphrase != "" || len(opts.Recipients) > 0 || opts.DefaultRecipients {
+		suffix += ".age"
+	}
+	if opts.Sign {
+		suffix += ".signed"
+	}
+	return suffix
+}
+
+// ValidateSealOptions 校验加密与签名选项
+func (c *BackupCrypto) ValidateSealOptions(opts SealOptions) error {
+	_, err := c.recipients(opts)
+	return err
+}
+
+// recipients 根据选项确定加密接收者
+func (c *BackupCrypto) recipients(opts SealOptions) ([]age.Recipient, error) {
+	recipients, err := parseRecipients(opts.Recipients)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSealOptions, err)
+	}
+	if opts.DefaultRecipients {
+		if len(c.defaultRecipients) == 0 {
+			return nil, fmt.Errorf("%w: BACKUP_AGE_RECIPIENTS is not configured", ErrInvalidSealOptions)
+		}
+		recipients = append(recipients, c.defaultRecipients...)
+	}
+	if opts.Passphrase != "" {
+		if len(recipients) > 0 {
+			return nil, fmt.Errorf("%w: passphrase cannot be combined with recipients", ErrInvalidSealOptions)
+		}
+		recipient, err := age.NewScryptRecipient(opts.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSealOptions, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if opts.Sign && c.signingKey == nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSealOptions, ErrNoSigningKey)
+	}
+	return recipients, nil
+}
+
+// Seal 返回加密并签名后写入w的Writer，关闭时写出签名
+// 首次写入前不会向w写入任何数据
+func (c *BackupCrypto) Seal(w io.Writer, opts SealOptions) (io.WriteCloser, error) {
+	recipients, err := c.recipients(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &sealWriter{dst: w, recipients: recipients}
+	if opts.Sign {
+		sw.signingKey = c.signingKey
+	}
+	return sw, nil
+}
+
+// sealWriter 首次写入时才写出签名头和age头
+type sealWriter struct {
+	dst        io.Writer
+	recipients []age.Recipient
+	signingKey ed25519.PrivateKey
+
+	started bool
+	payload io.Writer
+	enc     io.WriteCloser
+	hash    hash.Hash
+}
+
+func (w *sealWriter) start() error {
+	w.started = true
+	w.payload = w.dst
+	if w.signingKey != nil {
+		if _, err := io.WriteString(w.dst, signedMagic); err != nil {
+			return err
+		}
+		w.hash = sha512.New()
+		w.payload = io.MultiWriter(w.dst, w.hash)
+	}
+	if len(w.recipients) > 0 {
+		enc, err := age.Encrypt(w.payload, w.recipients...)
+		if err != nil {
+			return err
+		}
+		w.enc = enc
+		w.payload = enc
+	}
+	return nil
+}
+
+func (w *sealWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return w.payload.Write(p)
+}
+
+func (w *sealWriter) Close() error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			return err
+		}
+	}
+	if w.signingKey == nil {
+		return nil
+	}
+
+	signature := ed25519.Sign(w.signingKey, signedMessage(w.hash.Sum(nil)))
+	_, err := io.WriteString(w.dst, trailerPrefix+
+		base64.StdEncoding.EncodeToString(w.signingKey.Public().(ed25519.PublicKey))+" "+
+		base64.StdEncoding.EncodeToString(signature)+
+		trailerSuffix)
+	return err
+}
+
+// signedMessage 签名的内容
+func signedMessage(digest []byte) []byte {
+	return append([]byte(signatureContext), digest...)
+}
+
+// Open 校验签名并解密，返回备份内容；签名文件会先完整写入临时文件并校验后才返回
+// 返回的cleanup用于删除临时文件，任何情况下都需要调用
+func (c *BackupCrypto) Open(r io.Reader, passphrase string) (io.Reader, *SealInfo, func(), error) {
+	info := &SealInfo{}
+	cleanup := func() {}
+
+	br := bufio.NewReader(r)
+	var payload io.Reader = br
+	if head, _ := br.Peek(len(signedMagic)); string(head) == signedMagic {
+		file, section, keyID, err := c.verify(br)
+		if file != nil {
+			cleanup = func() {
+				file.Close()
+				os.Remove(file.Name())
+			}
+		}
+		if err != nil {
+			return nil, nil, cleanup, err
+		}
+		payload = section
+		info.Signed = true
+		info.SignerKeyID = keyID
+	} else if c.requireSignature {
+		return nil, nil, cleanup, ErrSignatureRequired
+	}
+
+	pr := bufio.NewReader(payload)
+	payload = pr
+	if head, _ := pr.Peek(len(armor.Header)); string(head) == armor.Header {
+		pr = bufio.NewReader(armor.NewReader(pr))
+		payload = pr
+	}
+	if head, _ := pr.Peek(len(ageMagic)); string(head) == ageMagic {
+		identities := append([]age.Identity{}, c.identities...)
+		if passphrase != "" {
+			identity, err := age.NewScryptIdentity(passphrase)
+			if err != nil {
+				return nil, nil, cleanup, err
+			}
+			identities = append(identities, identity)
+		}
+		if len(identities) == 0 {
+			return nil, nil, cleanup, fmt.Errorf("%w: passphrase is required", ErrBackupDecrypt)
+		}
+
+		decrypted, err := age.Decrypt(pr, identities...)
+		if err != nil {
+			return nil, nil, cleanup, fmt.Errorf("%w: %v", ErrBackupDecrypt, err)
+		}
+		payload = decrypted
+		info.Encrypted = true
+	}
+	return payload, info, cleanup, nil
+}
+
+// verify 将签名文件写入临时文件并校验签名，返回签名覆盖的内容
+func (c *BackupCrypto) verify(r io.Reader) (*os.File, *io.SectionReader, string, error) {
+	file, err := os.CreateTemp("", "etcd-import-*")
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	size, err := io.Copy(file, r)
+	if err != nil {
+		return file, nil, "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	payloadLen := size - int64(len(signedMagic)) - int64(trailerLen)
+	if payloadLen < 0 {
+		return file, nil, "", ErrSignatureInvalid
+	}
+
+	trailer := make([]byte, trailerLen)
+	if _, err := file.ReadAt(trailer, size-int64(trailerLen)); err != nil {
+		return file, nil, "", err
+	}
+	if !bytes.HasPrefix(trailer, []byte(trailerPrefix)) || !bytes.HasSuffix(trailer, []byte(trailerSuffix)) {
+		return file, nil, "", ErrSignatureInvalid
+	}
+	fields := strings.Fields(string(trailer[len(trailerPrefix) : len(trailer)-len(trailerSuffix)]))
+	if len(fields) != 2 {
+		return file, nil, "", ErrSignatureInvalid
+	}
+	public, err1 := base64.StdEncoding.DecodeString(fields[0])
+	signature, err2 := base64.StdEncoding.DecodeString(fields[1])
+	if err1 != nil || err2 != nil || len(public) != ed25519.PublicKeySize {
+		return file, nil, "", ErrSignatureInvalid
+	}
+
+	// key_id只是公钥的短标识，不同的公钥可能有相同的key_id，必须与受信任的公钥完全一致，并以受信任的公钥校验
+	keyID := signingKeyID(public)
+	trusted, ok := c.trusted[keyID]
+	if !ok || !bytes.Equal(trusted, public) {
+		return file, nil, keyID, fmt.Errorf("%w: %s", ErrUntrustedSigner, keyID)
+	}
+
+	section := io.NewSectionReader(file, int64(len(signedMagic)), payloadLen)
+	digest := sha512.New()
+	if _, err := io.Copy(digest, section); err != nil {
+		return file, nil, keyID, err
+	}
+	if !ed25519.Verify(trusted, signedMessage(digest.Sum(nil)), signature) {
+		return file, nil, keyID, ErrSignatureInvalid
+	}
+
+	section = io.NewSectionReader(file, int64(len(signedMagic)), payloadLen)
+	return file, section, keyID, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+
+	"etcd-admin-backend/internal/config"
+)
+
+// newTestSigningCrypto 创建使用随机签名密钥的BackupCrypto，返回其公钥
+func newTestSigningCrypto(t *testing.T, trusted ...string) (*BackupCrypto, ed25519.PublicKey) {
+	t.Helper()
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		t.Fatal(err)
+	}
+	crypto, err := NewBackupCrypto(config.BackupConfig{
+		SigningKey:  base64.StdEncoding.EncodeToString(seed),
+		TrustedKeys: trusted,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto, ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+}
+
+func sealTestBackup(t *testing.T, crypto *BackupCrypto, payload []byte, opts SealOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := crypto.Seal(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openTestBackup(crypto *BackupCrypto, data []byte, passphrase string) ([]byte, *SealInfo, error) {
+	r, info, cleanup, err := crypto.Open(bytes.NewReader(data), passphrase)
+	defer cleanup()
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := io.ReadAll(r)
+	return payload, info, err
+}
+
+func TestBackupCryptoSignedRoundTrip(t *testing.T) {
+	signer, public := newTestSigningCrypto(t)
+	payload := []byte(`{"key":"/app/a","value":"1"}`)
+
+	for _, opts := range []SealOptions{
+		{Sign: true},
+		{Sign: true, Passphrase: "correct horse"},
+	} {
+		data := sealTestBackup(t, signer, payload, opts)
+		got, info, err := openTestBackup(signer, data, opts.Passphrase)
+		if err != nil {
+			t.Fatalf("Open(%+v): %v", opts, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("Open(%+v) payload = %q", opts, got)
+		}
+		if !info.Signed || info.SignerKeyID != signingKeyID(public) || info.Encrypted != (opts.Passphrase != "") {
+			t.Errorf("Open(%+v) info = %+v", opts, info)
+		}
+	}
+
+	// 其他实例配置了该公钥后接受其签名
+	verifier, _ := newTestSigningCrypto(t, base64.StdEncoding.EncodeToString(public))
+	if _, _, err := openTestBackup(verifier, sealTestBackup(t, signer, payload, SealOptions{Sign: true}), ""); err != nil {
+		t.Errorf("trusted verifier: %v", err)
+	}
+}
+
+func TestBackupCryptoRejectsBadSignatures(t *testing.T) {
+	signer, public := newTestSigningCrypto(t)
+	payload := []byte("backup payload")
+	data := sealTestBackup(t, signer, payload, SealOptions{Sign: true})
+
+	t.Run("untrusted signer", func(t *testing.T) {
+		other, _ := newTestSigningCrypto(t)
+		if _, _, err := openTestBackup(other, data, ""); !errors.Is(err, ErrUntrustedSigner) {
+			t.Errorf("err = %v, want ErrUntrustedSigner", err)
+		}
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		tampered := bytes.Replace(data, payload, []byte("backup PAYLOAD"), 1)
+		if _, _, err := openTestBackup(signer, tampered, ""); !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("err = %v, want ErrSignatureInvalid", err)
+		}
+	})
+
+	t.Run("key id collision", func(t *testing.T) {
+		// 受信任的公钥与文件中的公钥key_id相同但内容不同时，不能接受文件中公钥的签名
+		verifier, trustedPublic := newTestSigningCrypto(t)
+		verifier.trusted = map[string]ed25519.PublicKey{signingKeyID(public): trustedPublic}
+		if _, _, err := openTestBackup(verifier, data, ""); !errors.Is(err, ErrUntrustedSigner) {
+			t.Errorf("err = %v, want ErrUntrustedSigner", err)
+		}
+	})
+
+	t.Run("signature required", func(t *testing.T) {
+		verifier, err := NewBackupCrypto(config.BackupConfig{
+			TrustedKeys:      []string{base64.StdEncoding.EncodeToString(public)},
+			RequireSignature: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := openTestBackup(verifier, payload, ""); !errors.Is(err, ErrSignatureRequired) {
+			t.Errorf("err = %v, want ErrSignatureRequired", err)
+		}
+	})
+}
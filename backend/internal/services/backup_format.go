@@ -0,0 +1,555 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 导出格式
+const (
+	ExportFormatJSON    = "json"    // 单个JSON文档，兼容原有备份结构
+	ExportFormatNDJSON  = "ndjson"  // 每行一个键值
+	ExportFormatEtcdctl = "etcdctl" // 与 etcdctl get -w json 相同的结构，base64编码，保留revision和租约，无损
+	ExportFormatYAML    = "yaml"    // 键值映射
+	ExportFormatTarGz   = "tar.gz"  // 每个键为归档中的一个文件
+)
+
+// tar归档中记录原始键和租约的PAX扩展字段
+const (
+	paxKeyRecord      = "ETCDADMIN.key"
+	paxLeaseTTLRecord = "ETCDADMIN.lease_ttl"
+)
+
+// BackupRecord 备份中的单个键值
+type BackupRecord struct {
+	Key            string
+	Value          []byte
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+	Lease          int64 // 导出时的租约ID，仅用于导入时分组
+	LeaseTTL       int64 // 导出时租约剩余秒数，0表示无租约
+}
+
+// backupMeta 备份文件头信息
+type backupMeta struct {
+	ConnectionName string
+	ConnectionID   uint
+	ExportTime     time.Time
+	Revision       int64
+}
+
+// backupWriter 按格式写出备份
+type backupWriter interface {
+	Begin(meta backupMeta) error
+	Write(record *BackupRecord) error
+	End() error
+}
+
+// IsValidExportFormat 判断导出格式是否支持
+func IsValidExportFormat(format string) bool {
+	switch format {
+	case ExportFormatJSON, ExportFormatNDJSON, ExportFormatEtcdctl, ExportFormatYAML, ExportFormatTarGz:
+		return true
+	}
+	return false
+}
+
+// ExportFileType 返回导出文件的扩展名和Content-Type
+func ExportFileType(format string) (string, string) {
+	switch format {
+	case ExportFormatNDJSON:
+		return "ndjson", "application/x-ndjson"
+	case ExportFormatEtcdctl:
+		return "etcdctl.json", "application/json"
+	case ExportFormatYAML:
+		return "yaml", "application/yaml"
+	case ExportFormatTarGz:
+		return "tar.gz", "application/gzip"
+	default:
+		return "json", "application/json"
+	}
+}
+
+// newBackupWriter 创建指定格式的写出器
+func newBackupWriter(format string, w *bufio.Writer) backupWriter {
+	switch format {
+	case ExportFormatNDJSON:
+		return &ndjsonBackupWriter{w: w}
+	case ExportFormatEtcdctl:
+		return &etcdctlBackupWriter{w: w}
+	case ExportFormatYAML:
+		return &yamlBackupWriter{w: w}
+	case ExportFormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarBackupWriter{gz: gz, tw: tar.NewWriter(gz)}
+	default:
+		return &jsonBackupWriter{w: w}
+	}
+}
+
+// jsonBackupWriter 单个JSON文档，值为合法JSON时原样写出，否则作为字符串
+type jsonBackupWriter struct {
+	w     *bufio.Writer
+	count int64
+}
+
+// jsonBackupHeader JSON格式的文件头，data字段随后逐个写入
+type jsonBackupHeader struct {
+	ConnectionName string    `json:"connection_name"`
+	ConnectionID   uint      `json:"connection_id"`
+	ExportTime     time.Time `json:"export_time"`
+	Revision       int64     `json:"revision"`
+}
+
+func (b *jsonBackupWriter) Begin(meta backupMeta) error {
+	header, err := json.Marshal(jsonBackupHeader(meta))
+	if err != nil {
+		return err
+	}
+	// 去掉结尾的 } 后追加 data 对象
+	if _, err := b.w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	_, err = b.w.WriteString(`,"data":{`)
+	return err
+}
+
+func (b *jsonBackupWriter) Write(record *BackupRecord) error {
+	key, err := json.Marshal(record.Key)
+	if err != nil {
+		return err
+	}
+	value := record.Value
+	if !json.Valid(value) {
+		if value, err = json.Marshal(string(record.Value)); err != nil {
+			return err
+		}
+	}
+	if b.count > 0 {
+		if err := b.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	b.count++
+	if _, err := b.w.Write(key); err != nil {
+		return err
+	}
+	if err := b.w.WriteByte(':'); err != nil {
+		return err
+	}
+	_, err = b.w.Write(value)
+	return err
+}
+
+func (b *jsonBackupWriter) End() error {
+	_, err := b.w.WriteString("}}\n")
+	return err
+}
+
+// ndjsonBackupWriter 每行一个 {"key","value"}
+type ndjsonBackupWriter struct {
+	w *bufio.Writer
+}
+
+// ndjsonRecord NDJSON格式的单行记录
+type ndjsonRecord struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	LeaseTTL int64  `json:"lease_ttl,omitempty"`
+}
+
+func (b *ndjsonBackupWriter) Begin(meta backupMeta) error {
+	return nil
+}
+
+func (b *ndjsonBackupWriter) Write(record *BackupRecord) error {
+	line, err := json.Marshal(ndjsonRecord{Key: record.Key, Value: string(record.Value), LeaseTTL: record.LeaseTTL})
+	if err != nil {
+		return err
+	}
+	if _, err := b.w.Write(line); err != nil {
+		return err
+	}
+	return b.w.WriteByte('\n')
+}
+
+func (b *ndjsonBackupWriter) End() error {
+	return nil
+}
+
+// etcdctlBackupWriter 与 etcdctl get --prefix -w json 的输出结构一致，额外记录lease_ttl
+type etcdctlBackupWriter struct {
+	w     *bufio.Writer
+	count int64
+}
+
+// etcdctlKV etcdctl JSON输出中的键值，键和值为base64
+type etcdctlKV struct {
+	Key            []byte `json:"key"`
+	CreateRevision int64  `json:"create_revision,omitempty"`
+	ModRevision    int64  `json:"mod_revision,omitempty"`
+	Version        int64  `json:"version,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+	Lease          int64  `json:"lease,omitempty"`
+	LeaseTTL       int64  `json:"lease_ttl,omitempty"`
+}
+
+// etcdctlBackup etcdctl JSON输出，导入时使用
+type etcdctlBackup struct {
+	Header struct {
+		Revision int64 `json:"revision"`
+	} `json:"header"`
+	Kvs []etcdctlKV `json:"kvs"`
+}
+
+func (b *etcdctlBackupWriter) Begin(meta backupMeta) error {
+	_, err := fmt.Fprintf(b.w, `{"header":{"revision":%d},"kvs":[`, meta.Revision)
+	return err
+}
+
+func (b *etcdctlBackupWriter) Write(record *BackupRecord) error {
+	line, err := json.Marshal(etcdctlKV{
+		Key:            []byte(record.Key),
+		CreateRevision: record.CreateRevision,
+		ModRevision:    record.ModRevision,
+		Version:        record.Version,
+		Value:          record.Value,
+		Lease:          record.Lease,
+		LeaseTTL:       record.LeaseTTL,
+	})
+	if err != nil {
+		return err
+	}
+	if b.count > 0 {
+		if err := b.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	b.count++
+	_, err = b.w.Write(line)
+	return err
+}
+
+func (b *etcdctlBackupWriter) End() error {
+	_, err := fmt.Fprintf(b.w, `],"count":%d}`+"\n", b.count)
+	return err
+}
+
+// yamlBackupWriter 顶层为键到值的映射，值始终为字符串
+type yamlBackupWriter struct {
+	w *bufio.Writer
+}
+
+func (b *yamlBackupWriter) Begin(meta backupMeta) error {
+	_, err := fmt.Fprintf(b.w, "# etcd backup of %q (connection %d), revision %d, exported at %s\n",
+		meta.ConnectionName, meta.ConnectionID, meta.Revision, meta.ExportTime.Format(time.RFC3339))
+	return err
+}
+
+func (b *yamlBackupWriter) Write(record *BackupRecord) error {
+	// 每次编码一个单键映射，连续写出即为同一个映射
+	entry, err := yaml.Marshal(map[string]string{record.Key: string(record.Value)})
+	if err != nil {
+		return err
+	}
+	_, err = b.w.Write(entry)
+	return err
+}
+
+func (b *yamlBackupWriter) End() error {
+	return nil
+}
+
+// tarBackupWriter 每个键写为一个文件，原始键保存在PAX扩展字段中
+type tarBackupWriter struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func (b *tarBackupWriter) Begin(meta backupMeta) error {
+	b.modTime = meta.ExportTime
+	return nil
+}
+
+func (b *tarBackupWriter) Write(record *BackupRecord) error {
+	header := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       tarPath(record.Key),
+		Mode:       0o644,
+		Size:       int64(len(record.Value)),
+		ModTime:    b.modTime,
+		PAXRecords: make(map[string]string),
+		Format:     tar.FormatPAX,
+	}
+	// 路径无法还原出原始键时才记录原始键
+	if "/"+header.Name != record.Key {
+		header.PAXRecords[paxKeyRecord] = record.Key
+	}
+	if record.LeaseTTL > 0 {
+		header.PAXRecords[paxLeaseTTLRecord] = strconv.FormatInt(record.LeaseTTL, 10)
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(record.Value)
+	return err
+}
+
+func (b *tarBackupWriter) End() error {
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+// tarPath 将键转换为归档中的相对路径，如 /app/config -> app/config
+func tarPath(key string) string {
+	name := path.Clean("/" + key)
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || name == "." {
+		name = "_"
+	}
+	return name
+}
+
+// readBackup 读取备份，opts.Format为空时自动识别，返回实际格式
+// json格式中的overwrite字段会合并到opts（兼容原有导入请求体）
+func readBackup(r io.Reader, opts *ImportOptions, fn func(record *BackupRecord) error) (string, error) {
+	br := bufio.NewReader(r)
+	format := opts.Format
+
+	// gzip压缩的输入先解压
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+
+		if format == ExportFormatTarGz || (format == "" && isTarHeader(br)) {
+			return ExportFormatTarGz, readTarBackup(br, fn)
+		}
+	}
+
+	if format == "" {
+		detected, err := detectFormat(br)
+		if err != nil {
+			return "", err
+		}
+		format = detected
+	}
+
+	var err error
+	switch format {
+	case ExportFormatJSON:
+		err = readJSONBackup(br, opts, fn)
+	case ExportFormatNDJSON:
+		err = readNDJSONBackup(br, fn)
+	case ExportFormatEtcdctl:
+		err = readEtcdctlBackup(br, fn)
+	case ExportFormatYAML:
+		err = readYAMLBackup(br, fn)
+	case ExportFormatTarGz:
+		err = fmt.Errorf("%w: tar.gz input must be gzip compressed tar", ErrUnsupportedFormat)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	return format, err
+}
+
+// isTarHeader 判断解压后的内容是否为tar归档，空归档只有全零的结束块
+func isTarHeader(br *bufio.Reader) bool {
+	header, _ := br.Peek(512)
+	if len(header) < 512 {
+		return false
+	}
+	if string(header[257:262]) == "ustar" {
+		return true
+	}
+	return bytes.Count(header, []byte{0}) == len(header)
+}
+
+// detectFormat 根据内容识别格式：JSON对象看字段，其余按YAML处理
+func detectFormat(br *bufio.Reader) (string, error) {
+	// 跳过开头的空白
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: empty input", ErrUnsupportedFormat)
+		}
+		if err != nil {
+			return "", err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		br.ReadByte()
+	}
+
+	if b, _ := br.Peek(1); b[0] != '{' {
+		return ExportFormatYAML, nil
+	}
+
+	// 在第一行（最多64KB）中查找特征字段
+	head, _ := br.Peek(64 * 1024)
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	}
+	switch {
+	case bytes.Contains(head, []byte(`"kvs"`)) || bytes.Contains(head, []byte(`"header"`)):
+		return ExportFormatEtcdctl, nil
+	case bytes.Contains(head, []byte(`"data"`)):
+		return ExportFormatJSON, nil
+	case bytes.Contains(head, []byte(`"key"`)):
+		return ExportFormatNDJSON, nil
+	}
+	return ExportFormatJSON, nil
+}
+
+// readJSONBackup 读取json格式，字符串值去掉引号，其它JSON值原样保存
+func readJSONBackup(r io.Reader, opts *ImportOptions, fn func(record *BackupRecord) error) error {
+	var doc struct {
+		Data      map[string]json.RawMessage `json:"data"`
+		Overwrite bool                       `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("invalid json backup: %w", err)
+	}
+	if doc.Overwrite {
+		opts.Overwrite = true
+	}
+
+	for key, raw := range doc.Data {
+		value := []byte(raw)
+		if len(raw) > 0 && raw[0] == '"' {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return fmt.Errorf("invalid value of key %s: %w", key, err)
+			}
+			value = []byte(s)
+		}
+		if err := fn(&BackupRecord{Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNDJSONBackup 逐行读取NDJSON
+func readNDJSONBackup(r io.Reader, fn func(record *BackupRecord) error) error {
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record ndjsonRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid ndjson record %d: %w", line, err)
+		}
+		if err := fn(&BackupRecord{Key: record.Key, Value: []byte(record.Value), LeaseTTL: record.LeaseTTL}); err != nil {
+			return err
+		}
+	}
+}
+
+// readEtcdctlBackup 读取etcdctl JSON输出
+func readEtcdctlBackup(r io.Reader, fn func(record *BackupRecord) error) error {
+	var doc etcdctlBackup
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("invalid etcdctl backup: %w", err)
+	}
+
+	for _, kv := range doc.Kvs {
+		if err := fn(&BackupRecord{
+			Key:            string(kv.Key),
+			Value:          kv.Value,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+			Lease:          kv.Lease,
+			LeaseTTL:       kv.LeaseTTL,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readYAMLBackup 读取键到值的YAML映射
+func readYAMLBackup(r io.Reader, fn func(record *BackupRecord) error) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("invalid yaml backup: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: yaml backup must be a mapping of keys to values", ErrUnsupportedFormat)
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		var key, value string
+		if err := mapping.Content[i].Decode(&key); err != nil {
+			return fmt.Errorf("invalid yaml key at line %d: %w", mapping.Content[i].Line, err)
+		}
+		if err := mapping.Content[i+1].Decode(&value); err != nil {
+			return fmt.Errorf("invalid yaml value of key %s: %w", key, err)
+		}
+		if err := fn(&BackupRecord{Key: key, Value: []byte(value)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTarBackup 读取tar归档，优先使用PAX字段中的原始键
+func readTarBackup(r io.Reader, fn func(record *BackupRecord) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		key, ok := header.PAXRecords[paxKeyRecord]
+		if !ok {
+			key = "/" + strings.TrimPrefix(header.Name, "./")
+		}
+		value, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+
+		record := &BackupRecord{Key: key, Value: value}
+		if ttl, ok := header.PAXRecords[paxLeaseTTLRecord]; ok {
+			record.LeaseTTL, _ = strconv.ParseInt(ttl, 10, 64)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// writeTestBackup 以指定格式写出备份
+func writeTestBackup(t *testing.T, format string, records []BackupRecord) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writer := newBackupWriter(format, w)
+	meta := backupMeta{ConnectionName: "local", ConnectionID: 1, ExportTime: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Revision: 42}
+	if err := writer.Begin(meta); err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		if err := writer.Write(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.End(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupFormatRoundTrip(t *testing.T) {
+	records := []BackupRecord{
+		{Key: "/app/plain", Value: []byte("hello world"), CreateRevision: 2, ModRevision: 5, Version: 3},
+		{Key: "/app/json", Value: []byte(`{"a":1,"b":[true,null]}`), CreateRevision: 3, ModRevision: 3, Version: 1},
+		{Key: "/app/number", Value: []byte("42"), CreateRevision: 4, ModRevision: 4, Version: 1},
+		{Key: "/app/multiline", Value: []byte("line1\nkey: value\n# not a comment\n"), CreateRevision: 6, ModRevision: 6, Version: 1},
+		{Key: "/app/empty", Value: []byte{}, CreateRevision: 7, ModRevision: 7, Version: 1},
+		{Key: "/app/unicode", Value: []byte("配置 ✓"), CreateRevision: 8, ModRevision: 8, Version: 1},
+		{Key: "/app/../outside", Value: []byte("dots in key"), CreateRevision: 9, ModRevision: 9, Version: 1},
+		{Key: "relative key", Value: []byte("no leading slash"), CreateRevision: 10, ModRevision: 10, Version: 1},
+	}
+	leased := BackupRecord{Key: "/app/leased", Value: []byte("session"), CreateRevision: 11, ModRevision: 11, Version: 1, Lease: 7, LeaseTTL: 30}
+	binary := BackupRecord{Key: "/app/binary", Value: []byte{0xff, 0x00, 0xfe}, CreateRevision: 12, ModRevision: 12, Version: 1}
+
+	tests := []struct {
+		format    string
+		leases    bool // 保留租约剩余时间
+		binary    bool // 非UTF-8的值无损
+		revisions bool // 保留revision和版本
+	}{
+		{format: ExportFormatJSON},
+		{format: ExportFormatNDJSON, leases: true},
+		{format: ExportFormatEtcdctl, leases: true, binary: true, revisions: true},
+		{format: ExportFormatYAML},
+		{format: ExportFormatTarGz, leases: true, binary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			input := append([]BackupRecord(nil), records...)
+			input = append(input, leased)
+			if tt.binary {
+				input = append(input, binary)
+			}
+			data := writeTestBackup(t, tt.format, input)
+
+			// 自动识别和指定格式读取的结果相同
+			for _, format := range []string{"", tt.format} {
+				got := make(map[string]BackupRecord)
+				opts := ImportOptions{Format: format}
+				detected, err := readBackup(bytes.NewReader(data), &opts, func(record *BackupRecord) error {
+					if _, dup := got[record.Key]; dup {
+						t.Errorf("duplicate key %q", record.Key)
+					}
+					got[record.Key] = *record
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("readBackup(format %q): %v", format, err)
+				}
+				if detected != tt.format {
+					t.Errorf("readBackup(format %q) detected %q", format, detected)
+				}
+				if len(got) != len(input) {
+					t.Errorf("read %d records, want %d", len(got), len(input))
+				}
+
+				for _, want := range input {
+					record, ok := got[want.Key]
+					if !ok {
+						t.Errorf("key %q missing", want.Key)
+						continue
+					}
+					if !bytes.Equal(record.Value, want.Value) {
+						t.Errorf("%s = %q, want %q", want.Key, record.Value, want.Value)
+					}
+					wantTTL := int64(0)
+					if tt.leases {
+						wantTTL = want.LeaseTTL
+					}
+					if record.LeaseTTL != wantTTL {
+						t.Errorf("%s lease_ttl = %d, want %d", want.Key, record.LeaseTTL, wantTTL)
+					}
+					if tt.revisions && (record.CreateRevision != want.CreateRevision || record.ModRevision != want.ModRevision ||
+						record.Version != want.Version || record.Lease != want.Lease) {
+						t.Errorf("%s = %+v, want revisions of %+v", want.Key, record, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBackupFormatEmpty(t *testing.T) {
+	for _, format := range []string{ExportFormatJSON, ExportFormatNDJSON, ExportFormatEtcdctl, ExportFormatYAML, ExportFormatTarGz} {
+		data := writeTestBackup(t, format, nil)
+		count := 0
+		opts := ImportOptions{Format: format}
+		if _, err := readBackup(bytes.NewReader(data), &opts, func(*BackupRecord) error {
+			count++
+			return nil
+		}); err != nil {
+			t.Errorf("%s: readBackup: %v", format, err)
+		}
+		if count != 0 {
+			t.Errorf("%s: read %d records from an empty backup", format, count)
+		}
+	}
+}
+
+func TestReadBackupRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"empty input", "", "   \n"},
+		{"unknown format", "xml", "<kv/>"},
+		{"yaml list", "", "- a\n- b\n"},
+		{"truncated json", ExportFormatJSON, `{"data":{"/a":`},
+		{"bad ndjson line", ExportFormatNDJSON, "{\"key\":\"/a\",\"value\":\"1\"}\nnot json\n"},
+		{"tar.gz without gzip", ExportFormatTarGz, "plain"},
+	}
+	for _, tt := range tests {
+		opts := ImportOptions{Format: tt.format}
+		_, err := readBackup(bytes.NewReader([]byte(tt.input)), &opts, func(*BackupRecord) error { return nil })
+		if err == nil {
+			t.Errorf("%s: readBackup succeeded", tt.name)
+		}
+	}
+
+	// 回调的错误原样返回
+	stop := errors.New("stop")
+	opts := ImportOptions{}
+	data := writeTestBackup(t, ExportFormatNDJSON, []BackupRecord{{Key: "/a", Value: []byte("1")}})
+	if _, err := readBackup(bytes.NewReader(data), &opts, func(*BackupRecord) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("callback error = %v, want %v", err, stop)
+	}
+}
@@ -0,0 +1,540 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrBackupJobRunning 任务正在执行
+	ErrBackupJobRunning = errors.New("backup job is already running")
+	// ErrInvalidBackupJob 任务配置错误
+	ErrInvalidBackupJob = errors.New("invalid backup job")
+)
+
+// 备份执行的触发方式
+const (
+	BackupTriggerSchedule = "schedule"
+	BackupTriggerManual   = "manual"
+	BackupTriggerExport   = "export" // 手动导出到存储，不属于任何任务
+)
+
+// unsafeFileChars 文件名中需要替换的字符
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// BackupScheduler 定时备份调度器，在进程内按cron表达式执行备份任务
+type BackupScheduler struct {
+	cfg            config.BackupConfig
+	etcdService    *EtcdService
+	backupService  *BackupService
+	storages       *BackupStorageService
+	webhookService *WebhookService
+	cron           *cron.Cron
+
+	ctx    context.Context // 调度器停止时取消进行中的备份
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	entries map[uint]cron.EntryID // job_id -> cron条目
+	running map[uint]bool         // 正在执行的任务
+}
+
+// NewBackupScheduler 创建备份调度器
+func NewBackupScheduler(cfg *config.Config, etcdService *EtcdService, backupService *BackupService, storages *BackupStorageService, webhookService *WebhookService) *BackupScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BackupScheduler{
+		cfg:            cfg.Backup,
+		etcdService:    etcdService,
+		backupService:  backupService,
+		storages:       storages,
+		webhookService: webhookService,
+		cron:           cron.New(),
+		ctx:            ctx,
+		cancel:         cancel,
+		entries:        make(map[uint]cron.EntryID),
+		running:        make(map[uint]bool),
+	}
+}
+
+// Start 加载已启用的任务并启动调度
+func (s *BackupScheduler) Start() error {
+	if err := s.migrateLegacyPaths(); err != nil {
+		log.Printf("Failed to migrate backup file paths: %v", err)
+	}
+
+	if !s.cfg.SchedulerEnabled {
+		log.Println("Backup scheduler is disabled")
+		return nil
+	}
+
+	var jobs []models.BackupJob
+	if err := database.GetDB().Where("enabled = ?", true).Find(&jobs).Error; err != nil {
+		return fmt.Errorf("failed to load backup jobs: %w", err)
+	}
+	for i := range jobs {
+		if err := s.Reload(&jobs[i]); err != nil {
+			log.Printf("Failed to schedule backup job %d: %v", jobs[i].ID, err)
+		}
+	}
+
+	s.cron.Start()
+	log.Printf("Backup scheduler started with %d jobs", len(s.entries))
+	return nil
+}
+
+// migrateLegacyPaths 早期版本记录的是备份文件的本地路径，转换为内置存储中的对象键
+func (s *BackupScheduler) migrateLegacyPaths() error {
+	dir := filepath.Clean(s.cfg.Directory) + string(filepath.Separator)
+
+	var runs []models.BackupRun
+	if err := database.GetDB().Where("storage_id = ? AND file_path LIKE ?", 0, dir+"%").Find(&runs).Error; err != nil {
+		return err
+	}
+	for _, run := range runs {
+		key := filepath.ToSlash(strings.TrimPrefix(run.FilePath, dir))
+		if err := database.GetDB().Model(&run).Update("file_path", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop 停止调度并取消进行中的备份
+func (s *BackupScheduler) Stop() {
+	<-s.cron.Stop().Done()
+	s.cancel()
+}
+
+// ValidateBackupJob 校验任务配置并补全默认值
+func (s *BackupScheduler) ValidateBackupJob(job *models.BackupJob) error {
+	crypto := s.backupService.Crypto()
+	if _, err := cron.ParseStandard(job.Schedule); err != nil {
+		return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidBackupJob, err)
+	}
+	if job.Type == "" {
+		job.Type = models.BackupTypeExport
+	}
+	switch job.Type {
+	case models.BackupTypeExport:
+		if job.Format == "" {
+			job.Format = ExportFormatEtcdctl
+		}
+		if !IsValidExportFormat(job.Format) {
+			return fmt.Errorf("%w: %s", ErrUnsupportedFormat, job.Format)
+		}
+	case models.BackupTypeSnapshot:
+		// 快照总是包含全部数据
+		job.Prefix = ""
+		job.Format = ""
+	default:
+		return fmt.Errorf("%w: unknown type %s", ErrInvalidBackupJob, job.Type)
+	}
+	if job.Encrypt && len(crypto.defaultRecipients) == 0 {
+		return fmt.Errorf("%w: BACKUP_AGE_RECIPIENTS is not configured", ErrInvalidBackupJob)
+	}
+	if job.KeepLast < 0 || job.KeepDailyDays < 0 {
+		return fmt.Errorf("%w: retention values must not be negative", ErrInvalidBackupJob)
+	}
+	return nil
+}
+
+// Reload 任务创建或修改后更新调度，未启用的任务会被移除
+func (s *BackupScheduler) Reload(job *models.BackupJob) error {
+	s.Remove(job.ID)
+	if !job.Enabled || !s.cfg.SchedulerEnabled {
+		return nil
+	}
+
+	jobID := job.ID
+	entryID, err := s.cron.AddFunc(job.Schedule, func() {
+		if _, err := s.run(jobID, BackupTriggerSchedule); err != nil && !errors.Is(err, ErrBackupJobRunning) {
+			log.Printf("Scheduled backup job %d failed to start: %v", jobID, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidBackupJob, err)
+	}
+
+	s.mu.Lock()
+	s.entries[job.ID] = entryID
+	s.mu.Unlock()
+	return nil
+}
+
+// Remove 从调度中移除任务
+func (s *BackupScheduler) Remove(jobID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entryID, exists := s.entries[jobID]; exists {
+		s.cron.Remove(entryID)
+		delete(s.entries, jobID)
+	}
+}
+
+// NextRun 返回任务下次执行时间，未调度时返回nil
+func (s *BackupScheduler) NextRun(jobID uint) *time.Time {
+	s.mu.Lock()
+	entryID, exists := s.entries[jobID]
+	s.mu.Unlock()
+	if !exists {
+		return nil
+	}
+
+	next := s.cron.Entry(entryID).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// RunNow 立即执行任务，备份在后台进行，返回执行记录
+func (s *BackupScheduler) RunNow(jobID uint) (*models.BackupRun, error) {
+	return s.run(jobID, BackupTriggerManual)
+}
+
+// run 创建执行记录并在后台执行备份，同一任务不会并发执行
+func (s *BackupScheduler) run(jobID uint, trigger string) (*models.BackupRun, error) {
+	s.mu.Lock()
+	if s.running[jobID] {
+		s.mu.Unlock()
+		return nil, ErrBackupJobRunning
+	}
+	s.running[jobID] = true
+	s.mu.Unlock()
+
+	release := func() {
+		s.mu.Lock()
+		delete(s.running, jobID)
+		s.mu.Unlock()
+	}
+
+	// 每次执行都读取最新的任务配置
+	var job models.BackupJob
+	if err := database.GetDB().First(&job, jobID).Error; err != nil {
+		release()
+		return nil, err
+	}
+
+	run := &models.BackupRun{
+		JobID:        job.ID,
+		ConnectionID: job.ConnectionID,
+		Status:       models.BackupRunRunning,
+		Trigger:      trigger,
+		StartedAt:    time.Now(),
+	}
+	if err := database.GetDB().Create(run).Error; err != nil {
+		release()
+		return nil, err
+	}
+
+	result := *run
+	go func() {
+		defer release()
+		s.execute(&job, run)
+	}()
+	return &result, nil
+}
+
+// execute 执行备份并更新执行记录，成功后按保留策略清理旧备份
+func (s *BackupScheduler) execute(job *models.BackupJob, run *models.BackupRun) {
+	var conn models.Connection
+	err := database.GetDB().First(&conn, job.ConnectionID).Error
+	if err != nil {
+		err = fmt.Errorf("connection not found: %w", err)
+	} else {
+		err = s.writeBackup(s.ctx, &conn, job.StorageID, backupSpec{
+			Type:   job.Type,
+			Prefix: job.Prefix,
+			Format: job.Format,
+			Gzip:   job.Gzip,
+			Seal: SealOptions{
+				DefaultRecipients: job.Encrypt,
+				Sign:              s.backupService.Crypto().CanSign(),
+			},
+		}, fmt.Sprintf("connection-%d/job-%d", conn.ID, job.ID), run)
+	}
+
+	now := time.Now()
+	s.finishRun(run, err)
+	if err != nil {
+		log.Printf("Backup job %d failed: %v", job.ID, err)
+	}
+	if err := database.GetDB().Model(job).Update("last_run_at", now).Error; err != nil {
+		log.Printf("Failed to update backup job %d: %v", job.ID, err)
+	}
+
+	if run.Status == models.BackupRunSuccess {
+		if err := s.applyRetention(job); err != nil {
+			log.Printf("Failed to apply retention for backup job %d: %v", job.ID, err)
+		}
+	}
+}
+
+// StoreExport 导出键值并保存到存储，同步执行，返回执行记录
+func (s *BackupScheduler) StoreExport(ctx context.Context, conn *models.Connection, storageID uint, prefix, format string, useGzip bool, seal SealOptions) (*models.BackupRun, error) {
+	if _, err := s.storages.Get(storageID); err != nil {
+		return nil, err
+	}
+	if err := s.backupService.Crypto().ValidateSealOptions(seal); err != nil {
+		return nil, err
+	}
+
+	run := &models.BackupRun{
+		ConnectionID: conn.ID,
+		Status:       models.BackupRunRunning,
+		Trigger:      BackupTriggerExport,
+		StartedAt:    time.Now(),
+	}
+	if err := database.GetDB().Create(run).Error; err != nil {
+		return nil, err
+	}
+
+	err := s.writeBackup(ctx, conn, storageID, backupSpec{
+		Type:   models.BackupTypeExport,
+		Prefix: prefix,
+		Format: format,
+		Gzip:   useGzip,
+		Seal:   seal,
+	}, fmt.Sprintf("connection-%d/exports", conn.ID), run)
+	s.finishRun(run, err)
+	return run, err
+}
+
+// finishRun 记录执行结果并通知连接的Webhook
+func (s *BackupScheduler) finishRun(run *models.BackupRun, err error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	if err != nil {
+		run.Status = models.BackupRunFailed
+		run.Error = err.Error()
+	} else {
+		run.Status = models.BackupRunSuccess
+	}
+	if err := database.GetDB().Save(run).Error; err != nil {
+		log.Printf("Failed to save backup run %d: %v", run.ID, err)
+	}
+
+	event := WebhookEventBackupCompleted
+	if run.Status == models.BackupRunFailed {
+		event = WebhookEventBackupFailed
+	}
+	s.webhookService.Emit(run.ConnectionID, event, "", run)
+}
+
+// backupSpec 一次备份的内容
+type backupSpec struct {
+	Type   string
+	Prefix string
+	Format string
+	Gzip   bool
+	Seal   SealOptions
+}
+
+// writeBackup 将备份写入临时文件并计算校验和，完成后上传到存储的dir目录下
+func (s *BackupScheduler) writeBackup(ctx context.Context, conn *models.Connection, storageID uint, spec backupSpec, dir string, run *models.BackupRun) error {
+	storage, err := s.storages.Get(storageID)
+	if err != nil {
+		return err
+	}
+	run.StorageID = storageID
+
+	ext := "db"
+	if spec.Type == models.BackupTypeExport {
+		ext, _ = ExportFileType(spec.Format)
+	}
+	useGzip := spec.Gzip && spec.Format != ExportFormatTarGz
+	if useGzip {
+		ext += ".gz"
+	}
+	ext += s.backupService.Crypto().FileSuffix(spec.Seal)
+	run.FileName = fmt.Sprintf("%s-%s.%s",
+		unsafeFileChars.ReplaceAllString(conn.Name, "-"),
+		run.StartedAt.Format("20060102-150405"),
+		ext)
+	key := path.Join(dir, run.FileName)
+
+	// 先写入本地临时文件，上传时大小和校验和已知
+	file, err := os.CreateTemp("", "etcd-backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hash)}
+	sealed, err := s.backupService.Crypto().Seal(counter, spec.Seal)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = sealed
+	var gz *gzip.Writer
+	if useGzip {
+		gz = gzip.NewWriter(sealed)
+		w = gz
+	}
+
+	if spec.Type == models.BackupTypeSnapshot {
+		err = s.writeSnapshot(ctx, conn, w)
+	} else {
+		var result *ExportResult
+		result, err = s.backupService.Export(ctx, conn, w, ExportOptions{
+			Prefix: spec.Prefix,
+			Format: spec.Format,
+		})
+		if result != nil {
+			run.KeyCount = result.Count
+			run.Revision = result.Revision
+		}
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = sealed.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if err := storage.Put(ctx, key, file, counter.n, checksum); err != nil {
+		return err
+	}
+
+	run.FilePath = key
+	run.Size = counter.n
+	run.Checksum = checksum
+	return nil
+}
+
+// writeSnapshot 写出etcd快照
+func (s *BackupScheduler) writeSnapshot(ctx context.Context, conn *models.Connection, w io.Writer) error {
+	reader, err := s.etcdService.Snapshot(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", classifyError(err))
+	}
+	return nil
+}
+
+// applyRetention 按保留策略删除过期的备份文件，执行记录保留并标记为已清理
+func (s *BackupScheduler) applyRetention(job *models.BackupJob) error {
+	var runs []models.BackupRun
+	if err := database.GetDB().
+		Where("job_id = ? AND status = ? AND pruned = ?", job.ID, models.BackupRunSuccess, false).
+		Order("started_at DESC").
+		Find(&runs).Error; err != nil {
+		return err
+	}
+
+	for _, run := range expiredBackupRuns(runs, job.KeepLast, job.KeepDailyDays, time.Now()) {
+		if err := s.DeleteBackup(s.ctx, &run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenBackup 读取备份文件
+func (s *BackupScheduler) OpenBackup(ctx context.Context, run *models.BackupRun) (io.ReadCloser, error) {
+	storage, err := s.storages.Get(run.StorageID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(ctx, run.FilePath)
+}
+
+// DeleteBackup 删除备份文件并标记执行记录
+func (s *BackupScheduler) DeleteBackup(ctx context.Context, run *models.BackupRun) error {
+	if run.FilePath != "" {
+		storage, err := s.storages.Get(run.StorageID)
+		if err != nil {
+			return err
+		}
+		if err := storage.Delete(ctx, run.FilePath); err != nil {
+			return fmt.Errorf("failed to delete backup file: %w", err)
+		}
+	}
+	run.Pruned = true
+	return database.GetDB().Model(run).Update("pruned", true).Error
+}
+
+// expiredBackupRuns 计算超出保留策略的备份，runs需按时间倒序
+// 保留最近keepLast份，以及最近keepDailyDays天内每天最新的一份；两者都为0时全部保留
+func expiredBackupRuns(runs []models.BackupRun, keepLast, keepDailyDays int, now time.Time) []models.BackupRun {
+	if keepLast <= 0 && keepDailyDays <= 0 {
+		return nil
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	keep := make(map[uint]bool)
+	for i := 0; i < keepLast && i < len(runs); i++ {
+		keep[runs[i].ID] = true
+	}
+	if keepDailyDays > 0 {
+		cutoff := now.AddDate(0, 0, -keepDailyDays)
+		days := make(map[string]bool)
+		for _, run := range runs {
+			if run.StartedAt.Before(cutoff) {
+				continue
+			}
+			day := run.StartedAt.Local().Format("2006-01-02")
+			if !days[day] {
+				days[day] = true
+				keep[run.ID] = true
+			}
+		}
+	}
+
+	var expired []models.BackupRun
+	for _, run := range runs {
+		if !keep[run.ID] {
+			expired = append(expired, run)
+		}
+	}
+	return expired
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/models"
+)
+
+func TestExpiredBackupRuns(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 5, day, hour, 0, 0, 0, time.Local)
+	}
+	// 故意打乱顺序，按开始时间排序后判断
+	runs := []models.BackupRun{
+		{ID: 4, StartedAt: at(9, 10)},
+		{ID: 1, StartedAt: at(10, 10)},
+		{ID: 6, StartedAt: at(1, 10)},
+		{ID: 3, StartedAt: at(9, 20)},
+		{ID: 2, StartedAt: at(10, 8)},
+		{ID: 5, StartedAt: at(8, 10)},
+	}
+
+	tests := []struct {
+		name          string
+		keepLast      int
+		keepDailyDays int
+		want          []uint
+	}{
+		{name: "no retention configured", want: nil},
+		{name: "keep last", keepLast: 2, want: []uint{3, 4, 5, 6}},
+		{name: "keep last larger than history", keepLast: 10, want: nil},
+		// 截止时间为5月8日12:00，5月8日10:00的备份已过期
+		{name: "newest run per day", keepDailyDays: 2, want: []uint{2, 4, 5, 6}},
+		{name: "daily window covers older days", keepDailyDays: 30, want: []uint{2, 4}},
+		{name: "keep last and daily combined", keepLast: 3, keepDailyDays: 2, want: []uint{4, 5, 6}},
+		{name: "keep last beyond daily window", keepLast: 5, keepDailyDays: 1, want: []uint{6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]models.BackupRun(nil), runs...)
+			var got []uint
+			for _, run := range expiredBackupRuns(input, tt.keepLast, tt.keepDailyDays, now) {
+				got = append(got, run.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
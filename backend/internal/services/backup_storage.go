@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrStorageNotFound 存储位置不存在
+	ErrStorageNotFound = errors.New("storage location not found")
+	// ErrChecksumMismatch 写入的数据与校验和不一致
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+	// ErrInvalidStorageKey 非法的对象键
+	ErrInvalidStorageKey = errors.New("invalid storage key")
+)
+
+// DefaultStorageName 内置本地存储（BACKUP_DIR）的名称
+const DefaultStorageName = "default"
+
+// maxSinglePutSize 单次PUT上传的最大对象，超过时分片上传且不带整体校验和
+const maxSinglePutSize = 5 << 30
+
+// StoredObject 存储中的备份文件
+type StoredObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+}
+
+// BackupStorage 备份存储接口，key为使用"/"分隔的相对路径
+type BackupStorage interface {
+	// Put 写入对象，checksum为内容的sha256十六进制值，存储端校验不一致时返回ErrChecksumMismatch
+	Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error
+	// Open 读取对象
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 列出前缀下的对象
+	List(ctx context.Context, prefix string) ([]StoredObject, error)
+	// Check 检查存储是否可用
+	Check(ctx context.Context) error
+}
+
+// BackupStorageService 按存储位置ID获取备份存储
+type BackupStorageService struct {
+	defaultStorage BackupStorage
+}
+
+// NewBackupStorageService 创建备份存储服务
+func NewBackupStorageService(cfg *config.Config) *BackupStorageService {
+	return &BackupStorageService{
+		defaultStorage: &localStorage{dir: cfg.Backup.Directory},
+	}
+}
+
+// Get 获取存储，id为0时返回内置的本地存储
+func (s *BackupStorageService) Get(id uint) (BackupStorage, error) {
+	if id == 0 {
+		return s.defaultStorage, nil
+	}
+
+	var location models.StorageLocation
+	if err := database.GetDB().First(&location, id).Error; err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrStorageNotFound, id)
+	}
+	return NewBackupStorage(&location)
+}
+
+// NewBackupStorage 根据存储位置配置创建存储
+func NewBackupStorage(location *models.StorageLocation) (BackupStorage, error) {
+	switch location.Type {
+	case models.StorageTypeLocal:
+		if location.Path == "" {
+			return nil, errors.New("path is required for local storage")
+		}
+		return &localStorage{dir: location.Path}, nil
+	case models.StorageTypeS3:
+		return newS3Storage(location)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", location.Type)
+	}
+}
+
+// localStorage 本地目录存储
+type localStorage struct {
+	dir string
+}
+
+// path 将key解析为目录内的文件路径，拒绝越出目录的key
+func (l *localStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean[1:] != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("%w: %s", ErrInvalidStorageKey, key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean[1:])), nil
+}
+
+func (l *localStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), ".backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath) // 重命名成功后删除会失败，可忽略
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if written != size || hex.EncodeToString(hash.Sum(nil)) != checksum {
+		return ErrChecksumMismatch
+	}
+
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to save backup file: %w", err)
+	}
+	return nil
+}
+
+func (l *localStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+func (l *localStorage) Delete(ctx context.Context, key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *localStorage) List(ctx context.Context, prefix string) ([]StoredObject, error) {
+	objects := []StoredObject{}
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == l.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".backup-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, StoredObject{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+func (l *localStorage) Check(ctx context.Context) error {
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		return fmt.Errorf("backup directory is not writable: %w", err)
+	}
+	return nil
+}
+
+// s3Storage S3兼容的对象存储
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Storage(location *models.StorageLocation) (*s3Storage, error) {
+	if location.Endpoint == "" || location.Bucket == "" {
+		return nil, errors.New("endpoint and bucket are required for s3 storage")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if location.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(location.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(location.AccessKey, location.SecretKey, ""),
+		Secure:       location.UseSSL,
+		Region:       location.Region,
+		BucketLookup: lookup,
+		// 校验和通过trailing header发送，流式上传时无需预先计算
+		TrailingHeaders: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	prefix := strings.Trim(location.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Storage{client: client, bucket: location.Bucket, prefix: prefix}, nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	sum, err := hex.DecodeString(checksum)
+	if err != nil {
+		return fmt.Errorf("invalid checksum: %w", err)
+	}
+	opts := minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: map[string]string{"sha256": checksum},
+	}
+	if size <= maxSinglePutSize {
+		// 上传时附带sha256，由存储端校验内容
+		opts.Checksum = minio.ChecksumSHA256
+		opts.DisableMultipart = true
+	}
+
+	info, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, opts)
+	if err != nil {
+		if resp := minio.ToErrorResponse(err); resp.Code == "BadDigest" || resp.Code == "XAmzContentChecksumMismatch" {
+			return fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+		}
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+	if opts.Checksum.IsSet() && info.ChecksumSHA256 != base64.StdEncoding.EncodeToString(sum) {
+		s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject延迟到首次读取才发送请求，这里提前确认对象存在
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]StoredObject, error) {
+	objects := []StoredObject{}
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, StoredObject{
+			Key:          strings.TrimPrefix(info.Key, s.prefix),
+			Size:         info.Size,
+			LastModified: info.LastModified,
+			ETag:         info.ETag,
+		})
+	}
+	return objects, nil
+}
+
+func (s *s3Storage) Check(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to access bucket: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+const (
+	testS3Bucket    = "etcd-backups"
+	testS3AccessKey = "test-access"
+	testS3SecretKey = "test-secret"
+)
+
+// testS3Object 对象存储中的对象
+type testS3Object struct {
+	data         []byte
+	lastModified time.Time
+}
+
+// testS3Server 路径风格的S3桩服务，实现备份存储用到的PUT、GET、HEAD、DELETE和ListObjectsV2
+// 支持aws-chunked流式上传，按trailer中的x-amz-checksum-sha256校验内容
+type testS3Server struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]testS3Object
+	corrupt bool // 模拟传输损坏，收到的内容与客户端计算的校验和不一致
+}
+
+func newTestS3Server(t *testing.T) *testS3Server {
+	s := &testS3Server{t: t, objects: make(map[string]testS3Object)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Endpoint 服务地址（不含协议）
+func (s *testS3Server) Endpoint() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+// Location 指向桩服务的存储位置
+func (s *testS3Server) Location(prefix string) *models.StorageLocation {
+	return &models.StorageLocation{
+		Name:      "s3",
+		Type:      models.StorageTypeS3,
+		Endpoint:  s.Endpoint(),
+		Region:    "us-east-1",
+		Bucket:    testS3Bucket,
+		Prefix:    prefix,
+		AccessKey: testS3AccessKey,
+		SecretKey: testS3SecretKey,
+		PathStyle: true,
+	}
+}
+
+// Keys 返回已保存的对象键
+func (s *testS3Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Object 返回对象内容
+func (s *testS3Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, exists := s.objects[key]
+	return object.data, exists
+}
+
+func (s *testS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+testS3AccessKey+"/") {
+		s.error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testS3Bucket {
+		s.error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		s.list(w, r)
+	case key != "" && r.Method == http.MethodPut:
+		s.put(w, r, key)
+	case key != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.mu.Lock()
+		object, exists := s.objects[key]
+		s.mu.Unlock()
+		if !exists {
+			s.error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", testS3ETag(object.data))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, key, object.lastModified, bytes.NewReader(object.data))
+	case key != "" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.t.Errorf("unexpected s3 request: %s %s", r.Method, r.URL)
+		s.error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *testS3Server) put(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.error(w, r, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	data, trailers := body, map[string]string{}
+	if r.Header.Get("X-Amz-Decoded-Content-Length") != "" {
+		if data, trailers, err = decodeAWSChunked(body); err != nil {
+			s.t.Errorf("invalid aws-chunked body: %v", err)
+			s.error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	corrupt := s.corrupt
+	s.mu.Unlock()
+	if corrupt && len(data) > 0 {
+		data = append([]byte{}, data...)
+		data[0] ^= 0xff
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	expected := trailers["x-amz-checksum-sha256"]
+	if expected == "" {
+		expected = r.Header.Get("X-Amz-Checksum-Sha256")
+	}
+	if expected != "" && expected != checksum {
+		s.error(w, r, http.StatusBadRequest, "XAmzContentChecksumMismatch")
+		return
+	}
+
+	s.mu.Lock()
+	s.objects[key] = testS3Object{data: data, lastModified: time.Now().UTC().Truncate(time.Second)}
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", testS3ETag(data))
+	w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *testS3Server) list(w http.ResponseWriter, r *http.Request) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: testS3Bucket, Prefix: r.URL.Query().Get("prefix"), MaxKeys: 1000}
+
+	for _, key := range s.Keys() {
+		if !strings.HasPrefix(key, result.Prefix) {
+			continue
+		}
+		s.mu.Lock()
+		object := s.objects[key]
+		s.mu.Unlock()
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.lastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         testS3ETag(object.data),
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (s *testS3Server) error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	xml.NewEncoder(w).Encode(struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: code, Message: code, Resource: r.URL.Path})
+}
+
+func testS3ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// decodeAWSChunked 解析带签名的aws-chunked请求体，返回内容和trailer
+func decodeAWSChunked(body []byte) ([]byte, map[string]string, error) {
+	reader := bufio.NewReader(bytes.NewReader(body))
+	var data []byte
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimRight(header, "\r\n"), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	trailers := map[string]string{}
+	for _, line := range strings.Split(string(rest), "\n") {
+		if name, value, found := strings.Cut(strings.TrimRight(line, "\r"), ":"); found {
+			trailers[name] = value
+		}
+	}
+	return data, trailers, nil
+}
+
+func putTestBackup(t *testing.T, storage BackupStorage, key string, data []byte) {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	if err := storage.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:])); err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+}
+
+func TestS3StoragePutOpenList(t *testing.T) {
+	server := newTestS3Server(t)
+	storage, err := NewBackupStorage(server.Location("/backups/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := storage.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	first := []byte("first backup")
+	second := bytes.Repeat([]byte("etcd"), 64<<10) // 多个aws-chunked分块
+	putTestBackup(t, storage, "connection-1/job-1/a.json", first)
+	putTestBackup(t, storage, "connection-1/job-1/b.json", second)
+	putTestBackup(t, storage, "connection-2/exports/c.json", []byte("other"))
+
+	// 对象键带有存储位置的前缀
+	want := []string{"backups/connection-1/job-1/a.json", "backups/connection-1/job-1/b.json", "backups/connection-2/exports/c.json"}
+	if keys := server.Keys(); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("stored keys = %v, want %v", keys, want)
+	}
+	if data, _ := server.Object("backups/connection-1/job-1/b.json"); !bytes.Equal(data, second) {
+		t.Fatalf("stored object has %d bytes, want %d", len(data), len(second))
+	}
+
+	reader, err := storage.Open(ctx, "connection-1/job-1/a.json")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, first) {
+		t.Fatalf("Open returned %q, %v", data, err)
+	}
+	if _, err := storage.Open(ctx, "connection-1/job-1/missing.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Open missing object error = %v, want os.ErrNotExist", err)
+	}
+
+	objects, err := storage.List(ctx, "connection-1/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("List returned %d objects, want 2: %+v", len(objects), objects)
+	}
+	if objects[0].Key != "connection-1/job-1/a.json" || objects[0].Size != int64(len(first)) {
+		t.Errorf("objects[0] = %+v", objects[0])
+	}
+	if objects[1].Key != "connection-1/job-1/b.json" || objects[1].Size != int64(len(second)) {
+		t.Errorf("objects[1] = %+v", objects[1])
+	}
+	if objects[0].LastModified.IsZero() || objects[0].ETag == "" {
+		t.Errorf("objects[0] is missing metadata: %+v", objects[0])
+	}
+
+	if err := storage.Delete(ctx, "connection-1/job-1/a.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, exists := server.Object("backups/connection-1/job-1/a.json"); exists {
+		t.Fatal("object still exists after Delete")
+	}
+}
+
+func TestS3StorageCheckMissingBucket(t *testing.T) {
+	server := newTestS3Server(t)
+	location := server.Location("")
+	location.Bucket = "missing"
+	storage, err := NewBackupStorage(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Check(context.Background()); err == nil {
+		t.Fatal("Check succeeded for a missing bucket")
+	}
+}
+
+func TestS3StoragePutChecksumMismatch(t *testing.T) {
+	server := newTestS3Server(t)
+	storage, err := NewBackupStorage(server.Location(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	data := []byte("backup data")
+
+	// 调用方给出的校验和与内容不一致，上传的对象会被删除
+	wrong := sha256.Sum256([]byte("other data"))
+	err = storage.Put(ctx, "a.json", bytes.NewReader(data), int64(len(data)), hex.EncodeToString(wrong[:]))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Put with wrong checksum error = %v, want ErrChecksumMismatch", err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("objects left after checksum mismatch: %v", keys)
+	}
+
+	// 传输中内容损坏，由存储端校验拒绝
+	server.mu.Lock()
+	server.corrupt = true
+	server.mu.Unlock()
+	sum := sha256.Sum256(data)
+	err = storage.Put(ctx, "b.json", bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Put with corrupted upload error = %v, want ErrChecksumMismatch", err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("objects left after corrupted upload: %v", keys)
+	}
+}
+
+func TestBackupRetentionS3(t *testing.T) {
+	newTestDB(t)
+	server := newTestS3Server(t)
+
+	location := server.Location("etcd")
+	if err := database.GetDB().Create(location).Error; err != nil {
+		t.Fatal(err)
+	}
+	storages := NewBackupStorageService(&config.Config{Backup: config.BackupConfig{Directory: t.TempDir()}})
+	storage, err := storages.Get(location.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &models.BackupJob{ConnectionID: 1, Name: "nightly", Schedule: "@daily", StorageID: location.ID, KeepLast: 2}
+	if err := database.GetDB().Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 四份成功的备份和一份失败的执行记录，按时间从旧到新
+	started := time.Now().Add(-4 * time.Hour)
+	var runs []models.BackupRun
+	for i := 0; i < 4; i++ {
+		key := "connection-1/job-" + strconv.Itoa(int(job.ID)) + "/backup-" + strconv.Itoa(i) + ".json"
+		putTestBackup(t, storage, key, []byte("backup "+strconv.Itoa(i)))
+		runs = append(runs, models.BackupRun{
+			JobID:        job.ID,
+			ConnectionID: 1,
+			Status:       models.BackupRunSuccess,
+			StorageID:    location.ID,
+			FilePath:     key,
+			StartedAt:    started.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	runs = append(runs, models.BackupRun{JobID: job.ID, ConnectionID: 1, Status: models.BackupRunFailed, StorageID: location.ID, StartedAt: time.Now()})
+	if err := database.GetDB().Create(&runs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := &BackupScheduler{storages: storages, ctx: context.Background()}
+	if err := scheduler.applyRetention(job); err != nil {
+		t.Fatalf("applyRetention: %v", err)
+	}
+
+	want := []string{"etcd/connection-1/job-1/backup-2.json", "etcd/connection-1/job-1/backup-3.json"}
+	if keys := server.Keys(); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("objects after retention = %v, want %v", keys, want)
+	}
+
+	var pruned []models.BackupRun
+	if err := database.GetDB().Where("pruned = ?", true).Order("started_at").Find(&pruned).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].ID != runs[0].ID || pruned[1].ID != runs[1].ID {
+		t.Fatalf("pruned runs = %+v, want the two oldest", pruned)
+	}
+
+	// 再次执行不会删除保留的备份
+	if err := scheduler.applyRetention(job); err != nil {
+		t.Fatalf("applyRetention: %v", err)
+	}
+	if keys := server.Keys(); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("objects after second retention = %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"etcd-admin-backend/internal/models"
+)
+
+var (
+	// ErrInvalidConflictPolicy 冲突策略无效
+	ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+	// ErrTransferConflict 冲突策略为fail时目标中已存在值不同的键
+	ErrTransferConflict = errors.New("target key already exists with a different value")
+)
+
+// ConflictPolicy 目标键已存在且值不同时的处理策略
+type ConflictPolicy struct {
+	Policy         string
+	TimestampField string // overwrite_if_newer比较值中该JSON Pointer处的时间，为空时比较mod_revision
+	SameConnection bool   // 源和目标为同一连接，mod_revision可以直接比较
+}
+
+// Validate 校验冲突策略
+func (p ConflictPolicy) Validate() error {
+	switch p.Policy {
+	case models.ConflictSkip, models.ConflictOverwrite, models.ConflictMerge, models.ConflictFail:
+	case models.ConflictNewer:
+		if p.TimestampField != "" && !strings.HasPrefix(p.TimestampField, "/") {
+			return fmt.Errorf("%w: timestamp_field must be a JSON pointer such as /updated_at", ErrInvalidConflictPolicy)
+		}
+		// 不同集群的revision相互独立，无法比较新旧
+		if p.TimestampField == "" && !p.SameConnection {
+			return fmt.Errorf("%w: timestamp_field is required for overwrite_if_newer between different connections", ErrInvalidConflictPolicy)
+		}
+	default:
+		return fmt.Errorf("%w: unknown policy %q", ErrInvalidConflictPolicy, p.Policy)
+	}
+	return nil
+}
+
+// resolveConflicts 按策略处理差异中目标已存在且值不同的键
+// items需要以Overwrite和ShowValues计算，此类键的action为change；record.ModRevision为源的mod_revision
+func resolveConflicts(items []ImportDiffItem, policy ConflictPolicy) {
+	for i := range items {
+		item := &items[i]
+		if item.Action != ImportActionChange {
+			continue
+		}
+
+		switch policy.Policy {
+		case models.ConflictSkip:
+			item.Action = ImportActionSkip
+		case models.ConflictFail:
+			item.Action = ImportActionConflict
+		case models.ConflictNewer:
+			if !sourceIsNewer(item, policy) {
+				item.Action = ImportActionSkip
+			}
+		case models.ConflictMerge:
+			mergeItem(item)
+		}
+	}
+}
+
+// sourceIsNewer 比较源和目标的新旧：指定了时间字段时比较值中的时间，否则在同一连接内比较mod_revision
+// 源中缺少时间字段时视为不更新，只有目标缺少时视为更新；不同连接且未指定时间字段时不覆盖
+func sourceIsNewer(item *ImportDiffItem, policy ConflictPolicy) bool {
+	if policy.TimestampField == "" {
+		return policy.SameConnection && item.record.ModRevision > item.ModRevision
+	}
+
+	sourceTime, ok := valueTimestamp(item.record.Value, policy.TimestampField)
+	if !ok {
+		return false
+	}
+	targetTime, ok := valueTimestamp([]byte(*item.OldValue), policy.TimestampField)
+	if !ok {
+		return true
+	}
+	return sourceTime.After(targetTime)
+}
+
+// valueTimestamp 读取JSON值中指定路径的时间，支持RFC 3339字符串和Unix时间戳（秒或毫秒）
+func valueTimestamp(value []byte, pointer string) (time.Time, bool) {
+	var doc interface{}
+	if decodeJSONValue(value, &doc) != nil {
+		return time.Time{}, false
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return time.Time{}, false
+		}
+		if doc, ok = object[token]; !ok {
+			return time.Time{}, false
+		}
+	}
+
+	var number string
+	switch v := doc.(type) {
+	case json.Number:
+		number = v.String()
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		number = v
+	default:
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// 超过公元5000年的秒数按毫秒处理
+	if seconds > 1e11 {
+		seconds /= 1000
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// mergeItem 将源值深度合并到目标值，两者不都是JSON对象时以源值覆盖
+func mergeItem(item *ImportDiffItem) {
+	var oldDoc, newDoc interface{}
+	if decodeJSONValue([]byte(*item.OldValue), &oldDoc) != nil || decodeJSONValue(item.record.Value, &newDoc) != nil {
+		return
+	}
+	oldObject, ok := oldDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+	newObject, ok := newDoc.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	merged := mergeJSON(oldObject, newObject)
+	if reflect.DeepEqual(merged, oldDoc) {
+		item.Action = ImportActionUnchanged
+		return
+	}
+	value, err := json.Marshal(merged)
+	if err != nil {
+		return
+	}
+
+	record := *item.record
+	record.Value = value
+	item.record = &record
+	newValue := string(value)
+	item.NewValue = &newValue
+	item.Action = ImportActionMerge
+}
+
+// mergeJSON 递归合并对象，两侧都是对象的字段继续合并，其余字段以src为准，数组整体替换
+func mergeJSON(dst, src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst)+len(src))
+	for key, value := range dst {
+		result[key] = value
+	}
+	for key, value := range src {
+		srcObject, srcIsObject := value.(map[string]interface{})
+		dstObject, dstIsObject := result[key].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			result[key] = mergeJSON(dstObject, srcObject)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/models"
+)
+
+func TestValueTimestamp(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		pointer string
+		want    time.Time
+		ok      bool
+	}{
+		{"rfc3339", `{"updated_at":"2024-05-01T12:00:00Z"}`, "/updated_at", want, true},
+		{"rfc3339 with offset", `{"updated_at":"2024-05-01T14:00:00+02:00"}`, "/updated_at", want, true},
+		{"rfc3339 with fraction", `{"updated_at":"2024-05-01T12:00:00.5Z"}`, "/updated_at", want.Add(500 * time.Millisecond), true},
+		{"unix seconds", `{"ts":1714564800}`, "/ts", want, true},
+		{"unix milliseconds", `{"ts":1714564800000}`, "/ts", want, true},
+		{"unix seconds as string", `{"ts":"1714564800"}`, "/ts", want, true},
+		{"nested field", `{"meta":{"updated_at":"2024-05-01T12:00:00Z"}}`, "/meta/updated_at", want, true},
+		{"escaped pointer", `{"a/b":{"~t":1714564800}}`, "/a~1b/~0t", want, true},
+		{"missing field", `{"other":1}`, "/updated_at", time.Time{}, false},
+		{"missing parent", `{"meta":1}`, "/meta/updated_at", time.Time{}, false},
+		{"bad format", `{"updated_at":"yesterday"}`, "/updated_at", time.Time{}, false},
+		{"date without time", `{"updated_at":"2024-05-01"}`, "/updated_at", time.Time{}, false},
+		{"boolean", `{"updated_at":true}`, "/updated_at", time.Time{}, false},
+		{"null", `{"updated_at":null}`, "/updated_at", time.Time{}, false},
+		{"not json", `updated_at=2024-05-01T12:00:00Z`, "/updated_at", time.Time{}, false},
+		{"not an object", `["2024-05-01T12:00:00Z"]`, "/0", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := valueTimestamp([]byte(tt.value), tt.pointer)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("valueTimestamp(%s, %s) = %v, %v, want %v, %v", tt.value, tt.pointer, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst, src string
+		want     string
+	}{
+		{"disjoint fields", `{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{"source wins on conflict", `{"a":1,"b":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{"nested objects merged", `{"db":{"host":"a","port":1}}`, `{"db":{"port":2,"user":"u"}}`, `{"db":{"host":"a","port":2,"user":"u"}}`},
+		{"arrays replaced", `{"hosts":["a","b"]}`, `{"hosts":["c"]}`, `{"hosts":["c"]}`},
+		{"object replaces scalar", `{"a":1}`, `{"a":{"b":1}}`, `{"a":{"b":1}}`},
+		{"scalar replaces object", `{"a":{"b":1}}`, `{"a":null}`, `{"a":null}`},
+		{"empty source", `{"a":1}`, `{}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst, src, want map[string]interface{}
+			for _, v := range []struct {
+				data string
+				out  *map[string]interface{}
+			}{{tt.dst, &dst}, {tt.src, &src}, {tt.want, &want}} {
+				if err := json.Unmarshal([]byte(v.data), v.out); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dstBefore, _ := json.Marshal(dst)
+
+			got := mergeJSON(dst, src)
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("mergeJSON = %s, want %s", gotJSON, tt.want)
+			}
+			// 不修改目标对象
+			if dstAfter, _ := json.Marshal(dst); string(dstAfter) != string(dstBefore) {
+				t.Errorf("dst modified: %s -> %s", dstBefore, dstAfter)
+			}
+		})
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	const field = "/updated_at"
+	older := `{"v":1,"updated_at":"2024-01-01T00:00:00Z"}`
+	newer := `{"v":2,"updated_at":"2024-06-01T00:00:00Z"}`
+	tests := []struct {
+		name       string
+		policy     ConflictPolicy
+		source     string
+		sourceRev  int64
+		target     string
+		targetRev  int64
+		wantAction string
+		wantValue  string // merge后写入的值
+	}{
+		{"skip", ConflictPolicy{Policy: models.ConflictSkip}, newer, 1, older, 1, ImportActionSkip, ""},
+		{"overwrite", ConflictPolicy{Policy: models.ConflictOverwrite}, older, 1, newer, 1, ImportActionChange, ""},
+		{"fail", ConflictPolicy{Policy: models.ConflictFail}, newer, 1, older, 1, ImportActionConflict, ""},
+		{"newer timestamp overwrites", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, newer, 1, older, 9, ImportActionChange, ""},
+		{"older timestamp skipped", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, older, 9, newer, 1, ImportActionSkip, ""},
+		{"equal timestamp skipped", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, older, 1, `{"updated_at":"2024-01-01T00:00:00Z"}`, 1, ImportActionSkip, ""},
+		{"source missing timestamp skipped", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, `{"v":3}`, 9, older, 1, ImportActionSkip, ""},
+		{"target missing timestamp overwritten", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, older, 1, `{"v":3}`, 9, ImportActionChange, ""},
+		{"bad target timestamp overwritten", ConflictPolicy{Policy: models.ConflictNewer, TimestampField: field}, older, 1, `{"updated_at":"soon"}`, 9, ImportActionChange, ""},
+		{"newer revision on same connection", ConflictPolicy{Policy: models.ConflictNewer, SameConnection: true}, older, 9, newer, 1, ImportActionChange, ""},
+		{"older revision on same connection", ConflictPolicy{Policy: models.ConflictNewer, SameConnection: true}, newer, 1, older, 9, ImportActionSkip, ""},
+		{"revisions across connections never overwrite", ConflictPolicy{Policy: models.ConflictNewer}, newer, 9, older, 1, ImportActionSkip, ""},
+		{"merge objects", ConflictPolicy{Policy: models.ConflictMerge}, `{"b":{"c":2}}`, 1, `{"a":1,"b":{"c":1,"d":1}}`, 1, ImportActionMerge, `{"a":1,"b":{"c":2,"d":1}}`},
+		{"merge without new fields is unchanged", ConflictPolicy{Policy: models.ConflictMerge}, `{"a":1}`, 1, `{"a":1,"b":2}`, 1, ImportActionUnchanged, ""},
+		{"merge non-objects overwrites", ConflictPolicy{Policy: models.ConflictMerge}, `[1]`, 1, `{"a":1}`, 1, ImportActionChange, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldValue := tt.target
+			items := []ImportDiffItem{
+				{Key: "/k", Action: ImportActionChange, ModRevision: tt.targetRev, OldValue: &oldValue,
+					record: &BackupRecord{Key: "/k", Value: []byte(tt.source), ModRevision: tt.sourceRev}},
+				{Key: "/new", Action: ImportActionAdd, record: &BackupRecord{Key: "/new", Value: []byte("x")}},
+			}
+			resolveConflicts(items, tt.policy)
+			if items[0].Action != tt.wantAction {
+				t.Errorf("action = %s, want %s", items[0].Action, tt.wantAction)
+			}
+			if tt.wantValue != "" && string(items[0].record.Value) != tt.wantValue {
+				t.Errorf("merged value = %s, want %s", items[0].record.Value, tt.wantValue)
+			}
+			// 只处理值不同的已有键
+			if items[1].Action != ImportActionAdd {
+				t.Errorf("new key action = %s, want add", items[1].Action)
+			}
+		})
+	}
+}
+
+func TestConflictPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy ConflictPolicy
+		valid  bool
+	}{
+		{ConflictPolicy{Policy: models.ConflictSkip}, true},
+		{ConflictPolicy{Policy: models.ConflictNewer, TimestampField: "/updated_at"}, true},
+		{ConflictPolicy{Policy: models.ConflictNewer, SameConnection: true}, true},
+		{ConflictPolicy{Policy: models.ConflictNewer}, false},
+		{ConflictPolicy{Policy: models.ConflictNewer, TimestampField: "updated_at"}, false},
+		{ConflictPolicy{Policy: "newest"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Validate()
+		if tt.valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidConflictPolicy)) {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.policy, err, tt.valid)
+		}
+	}
+}
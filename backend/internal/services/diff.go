@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"etcd-admin-backend/internal/models"
+)
+
+// ErrInvalidDiffOptions 比较参数无效
+var ErrInvalidDiffOptions = errors.New("invalid diff options")
+
+// maxLineDiffCells 逐行比较的最大计算量（两侧行数之积），超过时不生成文本差异
+const maxLineDiffCells = 1 << 20
+
+// DiffSide 比较的一方：连接、前缀以及可选的历史revision
+type DiffSide struct {
+	Connection *models.Connection
+	Prefix     string
+	Revision   int64 // 为0时读取最新数据
+}
+
+// KVDiff 两侧键值的比较结果，键为去掉各自前缀后的相对键
+// 值的差异以目标为旧值、源为新值，即把源应用到目标时的变化
+type KVDiff struct {
+	SourceRevision int64     `json:"source_revision"`
+	TargetRevision int64     `json:"target_revision"`
+	OnlyInSource   []string  `json:"only_in_source"`
+	OnlyInTarget   []string  `json:"only_in_target"`
+	Changed        []KeyDiff `json:"changed"`
+	UnchangedCount int       `json:"unchanged_count"`
+	IgnoredCount   int       `json:"ignored_count"`
+}
+
+// KeyDiff 单个键的值差异，两侧都是JSON时给出JSON差异，否则给出逐行的文本差异
+type KeyDiff struct {
+	Key               string       `json:"key"`
+	SourceValue       string       `json:"source_value"`
+	TargetValue       string       `json:"target_value"`
+	SourceModRevision int64        `json:"source_mod_revision"`
+	TargetModRevision int64        `json:"target_mod_revision"`
+	JSONDiff          []JSONChange `json:"json_diff,omitempty"`
+	TextDiff          string       `json:"text_diff,omitempty"`
+}
+
+// JSONChange JSON值的单处变化，Path为JSON Pointer（RFC 6901）
+type JSONChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"` // add、remove、replace
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffService 比较两个连接（或同一连接的不同前缀、不同revision）的键值
+type DiffService struct {
+	etcdService *EtcdService
+}
+
+// NewDiffService 创建比较服务
+func NewDiffService(etcdService *EtcdService) *DiffService {
+	return &DiffService{
+		etcdService: etcdService,
+	}
+}
+
+// Compare 比较两侧前缀下的键值，ignore为匹配相对键的glob，匹配的键不参与比较
+func (s *DiffService) Compare(ctx context.Context, source, target DiffSide, ignore []string) (*KVDiff, error) {
+	var patterns []*regexp.Regexp
+	for _, pattern := range ignore {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDiffOptions, err)
+		}
+		patterns = append(patterns, re)
+	}
+	ignored := func(key string) bool {
+		for _, re := range patterns {
+			if re.MatchString(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	result := &KVDiff{
+		OnlyInSource: []string{},
+		OnlyInTarget: []string{},
+		Changed:      []KeyDiff{},
+	}
+
+	// 先读取源，再流式读取目标逐个比较
+	sourceKVs := make(map[string]*mvccpb.KeyValue)
+	revision, err := s.etcdService.StreamKVAt(ctx, source.Connection, source.Prefix, source.Revision, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+		key := strings.TrimPrefix(string(kv.Key), source.Prefix)
+		if ignored(key) {
+			result.IgnoredCount++
+			return nil
+		}
+		sourceKVs[key] = kv
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	result.SourceRevision = revision
+
+	revision, err = s.etcdService.StreamKVAt(ctx, target.Connection, target.Prefix, target.Revision, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+		key := strings.TrimPrefix(string(kv.Key), target.Prefix)
+		if ignored(key) {
+			result.IgnoredCount++
+			return nil
+		}
+		sourceKV, ok := sourceKVs[key]
+		if !ok {
+			result.OnlyInTarget = append(result.OnlyInTarget, key)
+			return nil
+		}
+		delete(sourceKVs, key)
+
+		if bytes.Equal(sourceKV.Value, kv.Value) {
+			result.UnchangedCount++
+			return nil
+		}
+		result.Changed = append(result.Changed, diffValues(key, sourceKV, kv))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	result.TargetRevision = revision
+
+	for key := range sourceKVs {
+		result.OnlyInSource = append(result.OnlyInSource, key)
+	}
+	sort.Strings(result.OnlyInSource)
+	return result, nil
+}
+
+// diffValues 生成单个键的值差异
+func diffValues(key string, source, target *mvccpb.KeyValue) KeyDiff {
+	diff := KeyDiff{
+		Key:               key,
+		SourceValue:       string(source.Value),
+		TargetValue:       string(target.Value),
+		SourceModRevision: source.ModRevision,
+		TargetModRevision: target.ModRevision,
+	}
+
+	var oldValue, newValue interface{}
+	if json.Unmarshal(target.Value, &oldValue) == nil && json.Unmarshal(source.Value, &newValue) == nil {
+		// 两侧都是JSON字符串时比较字符串内容
+		oldString, oldIsString := oldValue.(string)
+		newString, newIsString := newValue.(string)
+		if oldIsString && newIsString {
+			diff.TextDiff = diffLines(oldString, newString)
+			return diff
+		}
+
+		diff.JSONDiff = diffJSON("", oldValue, newValue, nil)
+		if len(diff.JSONDiff) > 0 {
+			return diff
+		}
+		// 语义相同但格式不同时退回文本差异
+	}
+	if utf8.Valid(source.Value) && utf8.Valid(target.Value) {
+		diff.TextDiff = diffLines(diff.TargetValue, diff.SourceValue)
+	}
+	return diff
+}
+
+// diffJSON 递归比较两个JSON值，对象按字段、数组按下标比较
+func diffJSON(path string, oldValue, newValue interface{}, changes []JSONChange) []JSONChange {
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		newTyped, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(oldTyped)+len(newTyped))
+		for key := range oldTyped {
+			keys = append(keys, key)
+		}
+		for key := range newTyped {
+			if _, exists := oldTyped[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "/" + escapeJSONPointer(key)
+			oldChild, inOld := oldTyped[key]
+			newChild, inNew := newTyped[key]
+			switch {
+			case !inOld:
+				changes = append(changes, JSONChange{Path: childPath, Op: "add", New: newChild})
+			case !inNew:
+				changes = append(changes, JSONChange{Path: childPath, Op: "remove", Old: oldChild})
+			default:
+				changes = diffJSON(childPath, oldChild, newChild, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		newTyped, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(oldTyped), len(newTyped)); i++ {
+			childPath := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(oldTyped):
+				changes = append(changes, JSONChange{Path: childPath, Op: "add", New: newTyped[i]})
+			case i >= len(newTyped):
+				changes = append(changes, JSONChange{Path: childPath, Op: "remove", Old: oldTyped[i]})
+			default:
+				changes = diffJSON(childPath, oldTyped[i], newTyped[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, JSONChange{Path: path, Op: "replace", Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+// escapeJSONPointer 按RFC 6901转义路径中的"~"和"/"
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// diffLines 基于最长公共子序列的逐行差异，"-"为旧值中的行，"+"为新值中的行
+func diffLines(oldText, newText string) string {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+	if len(a)*len(b) > maxLineDiffCells {
+		return ""
+	}
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
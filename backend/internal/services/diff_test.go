@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestDiffCompare(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	putTestKeys(t, client, map[string]string{
+		"/dev/same":          "1",
+		"/dev/changed":       `{"rps":100}`,
+		"/dev/only-dev":      "x",
+		"/dev/local/path":    "/home/dev",
+		"/prod/same":         "1",
+		"/prod/changed":      `{"rps":50}`,
+		"/prod/only-prod":    "y",
+		"/prod/local/path":   "/srv",
+		"/production/prefix": "not under /prod/",
+	})
+	conn := newTestConnection(t, "local")
+	service := NewDiffService(newTestEtcdService(t))
+
+	diff, err := service.Compare(context.Background(),
+		DiffSide{Connection: conn, Prefix: "/dev/"},
+		DiffSide{Connection: conn, Prefix: "/prod/"},
+		[]string{"local/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"only in source", diff.OnlyInSource, []string{"only-dev"}},
+		{"only in target", diff.OnlyInTarget, []string{"only-prod"}},
+		{"unchanged", diff.UnchangedCount, 1},
+		{"ignored on both sides", diff.IgnoredCount, 2},
+		{"changed", len(diff.Changed), 1},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if len(diff.Changed) == 1 {
+		changed := diff.Changed[0]
+		if changed.Key != "changed" || changed.SourceValue != `{"rps":100}` || changed.TargetValue != `{"rps":50}` || changed.TargetModRevision == 0 {
+			t.Errorf("changed = %+v", changed)
+		}
+	}
+	if diff.SourceRevision == 0 || diff.TargetRevision == 0 {
+		t.Errorf("revisions = %d, %d", diff.SourceRevision, diff.TargetRevision)
+	}
+
+	// 历史revision上的比较
+	if _, err := client.Put(context.Background(), "/dev/same", "2"); err != nil {
+		t.Fatal(err)
+	}
+	historic, err := service.Compare(context.Background(),
+		DiffSide{Connection: conn, Prefix: "/dev/", Revision: diff.SourceRevision},
+		DiffSide{Connection: conn, Prefix: "/prod/"},
+		[]string{"local/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if historic.UnchangedCount != 1 || len(historic.Changed) != 1 {
+		t.Errorf("diff at revision %d = %+v", diff.SourceRevision, historic)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		target   string
+		wantJSON []JSONChange
+		wantText string
+	}{
+		{
+			name:   "json object fields",
+			source: `{"a":1,"b":{"c":"new"},"d":true}`,
+			target: `{"a":1,"b":{"c":"old"},"e":null}`,
+			wantJSON: []JSONChange{
+				{Path: "/b/c", Op: "replace", Old: "old", New: "new"},
+				{Path: "/d", Op: "add", New: true},
+				{Path: "/e", Op: "remove"},
+			},
+		},
+		{
+			name:   "json arrays by index",
+			source: `[1,2,3]`,
+			target: `[1,5]`,
+			wantJSON: []JSONChange{
+				{Path: "/1", Op: "replace", Old: float64(5), New: float64(2)},
+				{Path: "/2", Op: "add", New: float64(3)},
+			},
+		},
+		{
+			name:   "escaped json pointer",
+			source: `{"a/b":{"~c":2}}`,
+			target: `{"a/b":{"~c":1}}`,
+			wantJSON: []JSONChange{
+				{Path: "/a~1b/~0c", Op: "replace", Old: float64(1), New: float64(2)},
+			},
+		},
+		{
+			name:   "json type change",
+			source: `{"a":[1]}`,
+			target: `{"a":{"b":1}}`,
+			wantJSON: []JSONChange{
+				{Path: "/a", Op: "replace", Old: map[string]interface{}{"b": float64(1)}, New: []interface{}{float64(1)}},
+			},
+		},
+		{
+			name:     "json strings compared as text",
+			source:   `"line1\nline2"`,
+			target:   `"line1\nold"`,
+			wantText: " line1\n-old\n+line2\n",
+		},
+		{
+			name:     "plain text",
+			source:   "host=db\nport=5432",
+			target:   "host=db\nport=3306",
+			wantText: " host=db\n-port=3306\n+port=5432\n",
+		},
+		{
+			name:     "same json formatted differently",
+			source:   `{"a": 1}`,
+			target:   `{"a":1}`,
+			wantText: "-{\"a\":1}\n+{\"a\": 1}\n",
+		},
+		{
+			name:   "binary values",
+			source: "\xff\x00",
+			target: "\xfe\x00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffValues("key", &mvccpb.KeyValue{Value: []byte(tt.source), ModRevision: 2}, &mvccpb.KeyValue{Value: []byte(tt.target), ModRevision: 1})
+			if !jsonChangesEqual(diff.JSONDiff, tt.wantJSON) {
+				t.Errorf("json diff = %+v, want %+v", diff.JSONDiff, tt.wantJSON)
+			}
+			if diff.TextDiff != tt.wantText {
+				t.Errorf("text diff = %q, want %q", diff.TextDiff, tt.wantText)
+			}
+		})
+	}
+}
+
+// jsonChangesEqual 按JSON编码比较差异
+func jsonChangesEqual(got, want []JSONChange) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		gotJSON, _ := json.Marshal(got[i])
+		wantJSON, _ := json.Marshal(want[i])
+		if string(gotJSON) != string(wantJSON) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrInvalidBaseline 基线配置无效
+	ErrInvalidBaseline = errors.New("invalid baseline")
+	// ErrDriftCheckRunning 基线正在检查
+	ErrDriftCheckRunning = errors.New("drift check is already running")
+)
+
+// driftReportRetention 每个基线保留的检查报告数量
+const driftReportRetention = 100
+
+// DriftService 漂移检测：保存前缀的期望状态，并按cron表达式定期与集群比较
+type DriftService struct {
+	etcdService   *EtcdService
+	backupService *BackupService
+	cron          *cron.Cron
+
+	mu      sync.Mutex
+	entries map[uint]cron.EntryID // baseline_id -> cron条目
+	running map[uint]bool         // 正在检查的基线
+}
+
+// NewDriftService 创建漂移检测服务
+func NewDriftService(etcdService *EtcdService, backupService *BackupService) *DriftService {
+	return &DriftService{
+		etcdService:   etcdService,
+		backupService: backupService,
+		cron:          cron.New(),
+		entries:       make(map[uint]cron.EntryID),
+		running:       make(map[uint]bool),
+	}
+}
+
+// Start 加载已启用的基线并启动调度
+func (s *DriftService) Start() error {
+	var baselines []models.Baseline
+	if err := database.GetDB().Where("enabled = ?", true).Find(&baselines).Error; err != nil {
+		return fmt.Errorf("failed to load baselines: %w", err)
+	}
+	for i := range baselines {
+		if err := s.Reload(&baselines[i]); err != nil {
+			log.Printf("Failed to schedule drift check of baseline %d: %v", baselines[i].ID, err)
+		}
+	}
+
+	s.cron.Start()
+	return nil
+}
+
+// Stop 停止调度
+func (s *DriftService) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// ValidateBaseline 校验基线配置
+func (s *DriftService) ValidateBaseline(baseline *models.Baseline) error {
+	if baseline.Schedule != "" {
+		if _, err := cron.ParseStandard(baseline.Schedule); err != nil {
+			return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidBaseline, err)
+		}
+	}
+	return nil
+}
+
+// Reload 基线创建或修改后更新调度，未启用或没有设置schedule的基线会被移除
+func (s *DriftService) Reload(baseline *models.Baseline) error {
+	s.Remove(baseline.ID)
+	if !baseline.Enabled || baseline.Schedule == "" {
+		return nil
+	}
+
+	baselineID := baseline.ID
+	entryID, err := s.cron.AddFunc(baseline.Schedule, func() {
+		if _, err := s.Check(context.Background(), baselineID); err != nil && !errors.Is(err, ErrDriftCheckRunning) {
+			log.Printf("Drift check of baseline %d failed: %v", baselineID, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidBaseline, err)
+	}
+
+	s.mu.Lock()
+	s.entries[baseline.ID] = entryID
+	s.mu.Unlock()
+	return nil
+}
+
+// Remove 从调度中移除基线
+func (s *DriftService) Remove(baselineID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entryID, exists := s.entries[baselineID]; exists {
+		s.cron.Remove(entryID)
+		delete(s.entries, baselineID)
+	}
+}
+
+// NextCheck 返回基线下次检查的时间，未调度时返回nil
+func (s *DriftService) NextCheck(baselineID uint) *time.Time {
+	s.mu.Lock()
+	entryID, exists := s.entries[baselineID]
+	s.mu.Unlock()
+	if !exists {
+		return nil
+	}
+
+	next := s.cron.Entry(entryID).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// Capture 以集群中前缀下的当前键值作为基线的期望状态，baseline为新建时一并保存
+func (s *DriftService) Capture(ctx context.Context, conn *models.Connection, baseline *models.Baseline) error {
+	kvs, err := s.etcdService.GetAllKV(ctx, conn, baseline.Prefix)
+	if err != nil {
+		return err
+	}
+	baseline.Source = models.BaselineSourceSnapshot
+	return s.saveItems(baseline, kvs)
+}
+
+// LoadBackup 以备份文件中前缀下的键值作为基线的期望状态，baseline为新建时一并保存
+func (s *DriftService) LoadBackup(r io.Reader, passphrase, format string, baseline *models.Baseline) error {
+	kvs := make(map[string]string)
+	_, err := s.backupService.ReadBackup(r, passphrase, format, func(record *BackupRecord) error {
+		if strings.HasPrefix(record.Key, baseline.Prefix) {
+			kvs[record.Key] = string(record.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	baseline.Source = models.BaselineSourceBackup
+	return s.saveItems(baseline, kvs)
+}
+
+// saveItems 在一个事务中保存基线并替换其期望的键值
+func (s *DriftService) saveItems(baseline *models.Baseline, kvs map[string]string) error {
+	items := make([]models.KVItem, 0, len(kvs))
+	for key, value := range kvs {
+		items = append(items, models.KVItem{
+			ConnectionID: baseline.ConnectionID,
+			Key:          key,
+			Value:        value,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+
+	baseline.KeyCount = int64(len(items))
+	baseline.CapturedAt = time.Now()
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(baseline).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("baseline_id = ?", baseline.ID).Delete(&models.KVItem{}).Error; err != nil {
+			return err
+		}
+		// 新建的基线保存后才有ID
+		baselineID := baseline.ID
+		for i := range items {
+			items[i].BaselineID = &baselineID
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(items, DefaultImportChunkSize).Error
+	})
+}
+
+// Delete 删除基线及其期望状态和检查报告
+func (s *DriftService) Delete(baseline *models.Baseline) error {
+	s.Remove(baseline.ID)
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("baseline_id = ?", baseline.ID).Delete(&models.KVItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("baseline_id = ?", baseline.ID).Delete(&models.DriftReport{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(baseline).Error
+	})
+}
+
+// Check 比较集群与基线并保存检查报告，读取集群失败时保存状态为error的报告
+func (s *DriftService) Check(ctx context.Context, baselineID uint) (*models.DriftReport, error) {
+	s.mu.Lock()
+	if s.running[baselineID] {
+		s.mu.Unlock()
+		return nil, ErrDriftCheckRunning
+	}
+	s.running[baselineID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, baselineID)
+		s.mu.Unlock()
+	}()
+
+	var baseline models.Baseline
+	if err := database.GetDB().First(&baseline, baselineID).Error; err != nil {
+		return nil, err
+	}
+
+	report := &models.DriftReport{BaselineID: baseline.ID, CheckedAt: time.Now()}
+	if err := s.compare(ctx, &baseline, report); err != nil {
+		report.Status = models.DriftError
+		report.Error = err.Error()
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(report).Error; err != nil {
+			return err
+		}
+		// 只保留最近的报告
+		var expired []uint
+		if err := tx.Model(&models.DriftReport{}).Where("baseline_id = ?", baseline.ID).
+			Order("id DESC").Offset(driftReportRetention).Limit(1).Pluck("id", &expired).Error; err != nil {
+			return err
+		}
+		if len(expired) > 0 {
+			if err := tx.Where("baseline_id = ? AND id <= ?", baseline.ID, expired[0]).
+				Delete(&models.DriftReport{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&baseline).Updates(map[string]interface{}{
+			"last_checked_at": report.CheckedAt,
+			"last_status":     report.Status,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// compare 读取集群中前缀下的键值并与基线逐个比较
+func (s *DriftService) compare(ctx context.Context, baseline *models.Baseline, report *models.DriftReport) error {
+	var conn models.Connection
+	if err := database.GetDB().First(&conn, baseline.ConnectionID).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+	live, err := s.etcdService.GetAllKV(ctx, &conn, baseline.Prefix)
+	if err != nil {
+		return err
+	}
+
+	report.Missing = []string{}
+	report.Unexpected = []string{}
+	report.Changed = []models.DriftChange{}
+	var batch []models.KVItem
+	err = database.GetDB().Where("baseline_id = ?", baseline.ID).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, item := range batch {
+				actual, exists := live[item.Key]
+				switch {
+				case !exists:
+					report.Missing = append(report.Missing, item.Key)
+				case actual != item.Value:
+					report.Changed = append(report.Changed, models.DriftChange{Key: item.Key, Expected: item.Value, Actual: actual})
+				}
+				delete(live, item.Key)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+	for key := range live {
+		report.Unexpected = append(report.Unexpected, key)
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unexpected)
+	sort.Slice(report.Changed, func(i, j int) bool {
+		return report.Changed[i].Key < report.Changed[j].Key
+	})
+	report.MissingCount = len(report.Missing)
+	report.UnexpectedCount = len(report.Unexpected)
+	report.ChangedCount = len(report.Changed)
+	report.Status = models.DriftInSync
+	if report.MissingCount+report.UnexpectedCount+report.ChangedCount > 0 {
+		report.Status = models.DriftDrifted
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+	"etcd-admin-backend/pkg/secrets"
+)
+
+func TestDriftCheck(t *testing.T) {
+	newTestDB(t)
+	newTestKeyring(t)
+	client := newTestEtcd(t)
+	ctx := context.Background()
+	putTestKeys(t, client, map[string]string{
+		"/app/same":    "1",
+		"/app/changed": "password=old",
+		"/app/removed": "x",
+	})
+	conn := newTestConnection(t, "local")
+	service := NewDriftService(newTestEtcdService(t), nil)
+
+	baseline := &models.Baseline{ConnectionID: conn.ID, Name: "app", Prefix: "/app/"}
+	if err := service.Capture(ctx, conn, baseline); err != nil {
+		t.Fatal(err)
+	}
+
+	// 基线的期望键值关联到基线
+	var unlinked int64
+	if err := database.GetDB().Model(&models.KVItem{}).Where("baseline_id IS NULL").Count(&unlinked).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unlinked != 0 {
+		t.Errorf("%d kv_items without baseline_id", unlinked)
+	}
+
+	putTestKeys(t, client, map[string]string{
+		"/app/changed": "password=new",
+		"/app/added":   "y",
+	})
+	if _, err := client.Delete(ctx, "/app/removed"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := service.Check(ctx, baseline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanged := []models.DriftChange{{Key: "/app/changed", Expected: "password=old", Actual: "password=new"}}
+	if report.Status != models.DriftDrifted || !reflect.DeepEqual(report.Missing, []string{"/app/removed"}) ||
+		!reflect.DeepEqual(report.Unexpected, []string{"/app/added"}) || !reflect.DeepEqual(report.Changed, wantChanged) {
+		t.Errorf("report = %+v", report)
+	}
+
+	// 报告中的键值加密存储，读取时解密
+	var stored string
+	if err := database.GetDB().Table("drift_reports").Select("changed").Where("id = ?", report.ID).Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	var raw []models.DriftChange
+	if err := json.Unmarshal([]byte(stored), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 1 || !secrets.IsEncrypted(raw[0].Expected) || !secrets.IsEncrypted(raw[0].Actual) || strings.Contains(stored, "password=") {
+		t.Errorf("stored changes = %s, want encrypted values", stored)
+	}
+	var loaded models.DriftReport
+	if err := database.GetDB().First(&loaded, report.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Changed, wantChanged) {
+		t.Errorf("loaded changes = %+v, want %+v", loaded.Changed, wantChanged)
+	}
+
+	// 删除基线时删除其期望键值
+	if err := service.Delete(baseline); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	if err := database.GetDB().Model(&models.KVItem{}).Count(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("%d kv_items left after delete", remaining)
+	}
+}
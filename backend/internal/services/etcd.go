@@ -2,44 +2,191 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 
+	"etcd-admin-backend/internal/config"
 	"etcd-admin-backend/internal/models"
 )
 
-// EtcdService etcd客户端服务
+// MaxTxnOps 单个事务的最大操作数，与etcd的默认限制（--max-txn-ops）一致
+const MaxTxnOps = 128
+
+// ErrClientRetired 长时间持有的客户端已被移出连接池，需要重新获取
+var ErrClientRetired = errors.New("etcd client was retired from the pool")
+
+// EtcdService etcd客户端服务，按连接维护客户端池
 type EtcdService struct {
-	clients map[uint]*clientv3.Client // connection_id -> client
+	mu      sync.Mutex
+	clients map[uint]*pooledClient // connection_id -> client
+	dialing map[uint]*dialCall     // 正在创建中的客户端，同一连接只创建一次
+
+	idleTimeout         time.Duration
+	healthCheckInterval time.Duration
+}
+
+// pooledClient 池中的客户端
+type pooledClient struct {
+	client   *clientv3.Client
+	hash     string // 创建时的连接配置哈希，配置变更后失效
+	lastUsed time.Time
+	refs     int           // 正在使用的调用方数量
+	retired  bool          // 已从池中移除，最后一个调用方释放后关闭
+	done     chan struct{} // 移出连接池时关闭
 }
 
-// NewEtcdService 创建etcd服务实例
-func NewEtcdService() *EtcdService {
-	return &EtcdService{
-		clients: make(map[uint]*clientv3.Client),
+// dialCall 进行中的客户端创建，并发请求等待同一结果
+type dialCall struct {
+	hash string
+	done chan struct{}
+	err  error
+}
+
+// NewEtcdService 创建etcd服务实例并启动后台维护
+func NewEtcdService(cfg *config.Config) *EtcdService {
+	s := &EtcdService{
+		clients:             make(map[uint]*pooledClient),
+		dialing:             make(map[uint]*dialCall),
+		idleTimeout:         cfg.Etcd.ClientIdleTimeout,
+		healthCheckInterval: cfg.Etcd.HealthCheckInterval,
 	}
+	if s.healthCheckInterval > 0 {
+		go s.maintain()
+	}
+	return s
 }
 
-// GetClient 获取或创建etcd客户端
-func (s *EtcdService) GetClient(conn *models.Connection) (*clientv3.Client, error) {
-	// 检查是否已存在客户端
-	if client, exists := s.clients[conn.ID]; exists {
-		return client, nil
+// Acquire 获取或创建etcd客户端，连接配置变更后自动重建
+// 调用方使用完毕后必须调用返回的release；客户端被移出连接池（空闲、健康检查失败或配置变更）后，
+// 在最后一个调用方释放时才关闭，Watch等长时间使用的调用方不会被中断
+func (s *EtcdService) Acquire(ctx context.Context, conn *models.Connection) (*clientv3.Client, func(), error) {
+	if conn.ID == 0 {
+		return nil, nil, fmt.Errorf("connection must be saved before use")
+	}
+	hash := connectionHash(conn)
+
+	s.mu.Lock()
+	if pooled, exists := s.clients[conn.ID]; exists {
+		if pooled.hash == hash {
+			pooled.refs++
+			pooled.lastUsed = time.Now()
+			s.mu.Unlock()
+			return pooled.client, s.releaseFunc(pooled), nil
+		}
+		// 配置已变更，丢弃旧客户端
+		s.retireLocked(conn.ID, pooled)
+	}
+	if call, exists := s.dialing[conn.ID]; exists && call.hash == hash {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			if call.err != nil {
+				return nil, nil, call.err
+			}
+			// 创建完成后从池中获取
+			return s.Acquire(ctx, conn)
+		case <-ctx.Done():
+			return nil, nil, classifyError(ctx.Err())
+		}
 	}
+	call := &dialCall{hash: hash, done: make(chan struct{})}
+	s.dialing[conn.ID] = call
+	s.mu.Unlock()
 
-	// 解析endpoints
-	var endpoints []string
-	if err := json.Unmarshal([]byte(conn.Endpoints), &endpoints); err != nil {
-		// 如果不是JSON格式，尝试按逗号分割
-		endpoints = strings.Split(conn.Endpoints, ",")
-		for i, endpoint := range endpoints {
-			endpoints[i] = strings.TrimSpace(endpoint)
+	client, err := newClient(conn)
+	call.err = err
+
+	s.mu.Lock()
+	if s.dialing[conn.ID] == call {
+		delete(s.dialing, conn.ID)
+	}
+	var pooled *pooledClient
+	if err == nil {
+		if old, exists := s.clients[conn.ID]; exists {
+			s.retireLocked(conn.ID, old)
+		}
+		pooled = &pooledClient{client: client, hash: hash, lastUsed: time.Now(), refs: 1, done: make(chan struct{})}
+		s.clients[conn.ID] = pooled
+	}
+	s.mu.Unlock()
+	close(call.done)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, s.releaseFunc(pooled), nil
+}
+
+// Retired 返回客户端移出连接池时关闭的channel，Watch等长时间持有客户端的调用方据此换用新的客户端
+func (s *EtcdService) Retired(client *clientv3.Client) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pooled := range s.clients {
+		if pooled.client == client {
+			return pooled.done
 		}
 	}
+	// 已不在连接池中
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// releaseFunc 返回释放客户端的函数，重复调用无效
+func (s *EtcdService) releaseFunc(pooled *pooledClient) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			pooled.refs--
+			pooled.lastUsed = time.Now()
+			closeNow := pooled.retired && pooled.refs == 0
+			s.mu.Unlock()
+
+			if closeNow {
+				pooled.client.Close()
+			}
+		})
+	}
+}
+
+// retireLocked 将客户端移出连接池，没有调用方使用时立即关闭，调用时必须持有s.mu
+func (s *EtcdService) retireLocked(id uint, pooled *pooledClient) {
+	if current, exists := s.clients[id]; exists && current == pooled {
+		delete(s.clients, id)
+	}
+	if pooled.retired {
+		return
+	}
+	pooled.retired = true
+	close(pooled.done)
+	if pooled.refs == 0 {
+		go pooled.client.Close()
+	}
+}
+
+// newClient 创建客户端并确认可以连通
+func newClient(conn *models.Connection) (*clientv3.Client, error) {
+	endpoints := parseEndpoints(conn.Endpoints)
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints configured")
+	}
 
 	// 處理localhost地址，在Docker容器中使用extra_hosts配置
 	// Docker的extra_hosts已經將localhost映射到正確的主機地址
@@ -48,7 +195,7 @@ func (s *EtcdService) GetClient(conn *models.Connection) (*clientv3.Client, erro
 	// 创建etcd客户端配置
 	config := clientv3.Config{
 		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
+		DialTimeout: conn.DialTimeoutDuration(),
 	}
 
 	// 如果有用户名和密码，设置认证
@@ -57,56 +204,158 @@ func (s *EtcdService) GetClient(conn *models.Connection) (*clientv3.Client, erro
 		config.Password = conn.Password
 	}
 
+	// 配置TLS
+	if conn.TLSEnabled {
+		tlsConfig, err := buildTLSConfig(conn)
+		if err != nil {
+			return nil, err
+		}
+		config.TLS = tlsConfig
+	}
+
 	// 创建客户端
 	client, err := clientv3.New(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create etcd client: %w", err)
+		return nil, fmt.Errorf("failed to create etcd client: %w", classifyDialError(err))
 	}
 
-	// 测试连接
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	// 测试连接，创建过程被多个请求共享，不使用单个请求的上下文
+	ctx, cancel := context.WithTimeout(context.Background(), conn.DialTimeoutDuration())
 	defer cancel()
 
 	_, err = client.Status(ctx, endpoints[0])
 	if err != nil {
 		client.Close()
-		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+		return nil, fmt.Errorf("failed to connect to etcd: %w", classifyDialError(err))
 	}
 
-	// 缓存客户端
-	s.clients[conn.ID] = client
 	return client, nil
 }
 
-// CloseClient 关闭特定连接的客户端
+// CloseClient 将特定连接的客户端移出连接池，正在使用的客户端在释放后关闭
 func (s *EtcdService) CloseClient(connectionID uint) {
-	if client, exists := s.clients[connectionID]; exists {
-		client.Close()
-		delete(s.clients, connectionID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pooled, exists := s.clients[connectionID]; exists {
+		s.retireLocked(connectionID, pooled)
 	}
 }
 
-// CloseAll 关闭所有客户端
+// CloseAll 将所有客户端移出连接池，正在使用的客户端在释放后关闭
 func (s *EtcdService) CloseAll() {
-	for id, client := range s.clients {
-		client.Close()
-		delete(s.clients, id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, pooled := range s.clients {
+		s.retireLocked(id, pooled)
 	}
 }
 
+// maintain 定期回收空闲客户端和健康检查失败的客户端，正在使用的客户端不会因空闲被回收
+func (s *EtcdService) maintain() {
+	ticker := time.NewTicker(s.healthCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		snapshot := make(map[uint]*pooledClient, len(s.clients))
+		for id, pooled := range s.clients {
+			snapshot[id] = pooled
+		}
+		s.mu.Unlock()
+
+		for id, pooled := range snapshot {
+			s.mu.Lock()
+			idle := s.idleTimeout > 0 && pooled.refs == 0 && time.Since(pooled.lastUsed) > s.idleTimeout
+			s.mu.Unlock()
+
+			if idle {
+				s.evict(id, pooled, "idle")
+				continue
+			}
+			if err := probe(pooled.client); err != nil {
+				s.evict(id, pooled, err.Error())
+			}
+		}
+	}
+}
+
+// evict 将客户端移出连接池，之后的调用方会创建新的客户端；期间已被替换的客户端不受影响
+func (s *EtcdService) evict(id uint, pooled *pooledClient, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, exists := s.clients[id]; !exists || current != pooled {
+		return
+	}
+	if pooled.refs > 0 {
+		log.Printf("Retiring etcd client for connection %d (%d in use): %s", id, pooled.refs, reason)
+	} else {
+		log.Printf("Closing etcd client for connection %d: %s", id, reason)
+	}
+	s.retireLocked(id, pooled)
+}
+
+// probe 检查客户端是否可用，任一endpoint响应即视为健康
+func probe(client *clientv3.Client) error {
+	var lastErr error
+	for _, endpoint := range client.Endpoints() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := client.Status(ctx, endpoint)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("health check failed: %w", lastErr)
+}
+
+// connectionHash 计算影响客户端的连接配置哈希
+func connectionHash(conn *models.Connection) string {
+	h := sha256.New()
+	for _, field := range []string{
+		conn.Endpoints, conn.Username, conn.Password,
+		strconv.FormatBool(conn.TLSEnabled), conn.DialTimeoutDuration().String(),
+		conn.CAFile, conn.CertFile, conn.KeyFile,
+		conn.TLSCACert, conn.TLSCert, conn.TLSKey,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseEndpoints 解析endpoints，支持JSON数组或逗号分隔
+func parseEndpoints(raw string) []string {
+	var endpoints []string
+	if err := json.Unmarshal([]byte(raw), &endpoints); err != nil {
+		// 如果不是JSON格式，尝试按逗号分割
+		endpoints = nil
+		for _, endpoint := range strings.Split(raw, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	return endpoints
+}
+
 // ListKeys 列出所有keys
-func (s *EtcdService) ListKeys(conn *models.Connection, prefix string) ([]string, error) {
-	client, err := s.GetClient(conn)
+func (s *EtcdService) ListKeys(ctx context.Context, conn *models.Connection, prefix string) ([]string, error) {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
 
 	resp, err := client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
-		return nil, fmt.Errorf("failed to list keys: %w", err)
+		return nil, fmt.Errorf("failed to list keys: %w", classifyError(err))
 	}
 
 	keys := make([]string, len(resp.Kvs))
@@ -118,76 +367,80 @@ func (s *EtcdService) ListKeys(conn *models.Connection, prefix string) ([]string
 }
 
 // GetValue 获取键值
-func (s *EtcdService) GetValue(conn *models.Connection, key string) (string, error) {
-	client, err := s.GetClient(conn)
+func (s *EtcdService) GetValue(ctx context.Context, conn *models.Connection, key string) (string, error) {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
 		return "", err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
 
 	resp, err := client.Get(ctx, key)
 	if err != nil {
-		return "", fmt.Errorf("failed to get value: %w", err)
+		return "", fmt.Errorf("failed to get value: %w", classifyError(err))
 	}
 
 	if len(resp.Kvs) == 0 {
-		return "", fmt.Errorf("key not found: %s", key)
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 	}
 
 	return string(resp.Kvs[0].Value), nil
 }
 
 // SetValue 设置键值
-func (s *EtcdService) SetValue(conn *models.Connection, key, value string) error {
-	client, err := s.GetClient(conn)
+func (s *EtcdService) SetValue(ctx context.Context, conn *models.Connection, key, value string) error {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
 
 	_, err = client.Put(ctx, key, value)
 	if err != nil {
-		return fmt.Errorf("failed to set value: %w", err)
+		return fmt.Errorf("failed to set value: %w", classifyError(err))
 	}
 
 	return nil
 }
 
 // DeleteKey 删除键
-func (s *EtcdService) DeleteKey(conn *models.Connection, key string) error {
-	client, err := s.GetClient(conn)
+func (s *EtcdService) DeleteKey(ctx context.Context, conn *models.Connection, key string) error {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
 
 	_, err = client.Delete(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to delete key: %w", err)
+		return fmt.Errorf("failed to delete key: %w", classifyError(err))
 	}
 
 	return nil
 }
 
 // GetAllKV 获取所有键值对
-func (s *EtcdService) GetAllKV(conn *models.Connection, prefix string) (map[string]string, error) {
-	client, err := s.GetClient(conn)
+func (s *EtcdService) GetAllKV(ctx context.Context, conn *models.Connection, prefix string) (map[string]string, error) {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
 
 	resp, err := client.Get(ctx, prefix, clientv3.WithPrefix())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all KV: %w", err)
+		return nil, fmt.Errorf("failed to get all KV: %w", classifyError(err))
 	}
 
 	result := make(map[string]string)
@@ -198,29 +451,216 @@ func (s *EtcdService) GetAllKV(conn *models.Connection, prefix string) (map[stri
 	return result, nil
 }
 
-// TestConnection 测试连接
-func (s *EtcdService) TestConnection(conn *models.Connection) error {
-	client, err := s.GetClient(conn)
+// StreamKV 按页遍历前缀下的键值，所有分页读取同一revision，保证一致的快照视图
+// 每页单独计算请求超时，返回读取时的revision
+func (s *EtcdService) StreamKV(ctx context.Context, conn *models.Connection, prefix string, pageSize int64, fn func(revision int64, kv *mvccpb.KeyValue) error) (int64, error) {
+	return s.StreamKVAt(ctx, conn, prefix, 0, pageSize, fn)
+}
+
+// StreamKVAt 与StreamKV相同，但读取指定revision的历史数据，revision为0时读取最新数据
+func (s *EtcdService) StreamKVAt(ctx context.Context, conn *models.Connection, prefix string, revision int64, pageSize int64, fn func(revision int64, kv *mvccpb.KeyValue) error) (int64, error) {
+	client, release, err := s.Acquire(ctx, conn)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer release()
+
+	// 空前缀表示全部键，"\x00" 作为起始键配合范围结束 "\x00" 表示读取所有键
+	key := prefix
+	if key == "" {
+		key = "\x00"
+	}
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+
+	for {
+		opts := []clientv3.OpOption{
+			clientv3.WithRange(rangeEnd),
+			clientv3.WithLimit(pageSize),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+		}
+		if revision > 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+
+		pageCtx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
+		resp, err := client.Get(pageCtx, key, opts...)
+		cancel()
+		if err != nil {
+			return revision, fmt.Errorf("failed to read keys: %w", classifyError(err))
+		}
+		if revision == 0 {
+			revision = resp.Header.Revision
+		}
+
+		for _, kv := range resp.Kvs {
+			if err := fn(revision, kv); err != nil {
+				return revision, err
+			}
+		}
+
+		if !resp.More || len(resp.Kvs) == 0 {
+			return revision, nil
+		}
+		// 下一页从最后一个键之后开始
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// CountKeys 统计前缀下的键数，返回统计时的revision
+func (s *EtcdService) CountKeys(ctx context.Context, conn *models.Connection, prefix string) (int64, int64, error) {
+	client, release, err := s.Acquire(ctx, conn)
+	if err != nil {
+		return 0, 0, err
 	}
+	defer release()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	key := prefix
+	if key == "" {
+		key = "\x00"
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
 	defer cancel()
+	resp, err := client.Get(reqCtx, key, clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count keys: %w", classifyError(err))
+	}
+	return resp.Count, resp.Header.Revision, nil
+}
 
-	// 解析endpoints获取第一个进行测试
-	var endpoints []string
-	if err := json.Unmarshal([]byte(conn.Endpoints), &endpoints); err != nil {
-		endpoints = strings.Split(conn.Endpoints, ",")
-		for i, endpoint := range endpoints {
-			endpoints[i] = strings.TrimSpace(endpoint)
+// GetKeysAt 在同一revision上分批读取指定的键，不存在的键跳过，revision为0时使用第一批读取的revision
+// 每批不超过MaxTxnOps个键，在一个只读事务中读取
+func (s *EtcdService) GetKeysAt(ctx context.Context, conn *models.Connection, keys []string, revision int64, fn func(kv *mvccpb.KeyValue) error) (int64, error) {
+	if len(keys) == 0 {
+		return revision, nil
+	}
+	client, release, err := s.Acquire(ctx, conn)
+	if err != nil {
+		return revision, err
+	}
+	defer release()
+
+	for start := 0; start < len(keys); start += MaxTxnOps {
+		var getOpts []clientv3.OpOption
+		if revision > 0 {
+			getOpts = append(getOpts, clientv3.WithRev(revision))
+		}
+		batch := keys[start:min(start+MaxTxnOps, len(keys))]
+		ops := make([]clientv3.Op, 0, len(batch))
+		for _, key := range batch {
+			ops = append(ops, clientv3.OpGet(key, getOpts...))
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
+		resp, err := client.Txn(reqCtx).Then(ops...).Commit()
+		cancel()
+		if err != nil {
+			return revision, fmt.Errorf("failed to read keys: %w", classifyError(err))
+		}
+		if revision == 0 {
+			revision = resp.Header.Revision
+		}
+		for _, op := range resp.Responses {
+			for _, kv := range op.GetResponseRange().Kvs {
+				if err := fn(kv); err != nil {
+					return revision, err
+				}
+			}
 		}
 	}
+	return revision, nil
+}
 
+// Snapshot 获取所连接成员的完整数据快照，调用方负责关闭
+func (s *EtcdService) Snapshot(ctx context.Context, conn *models.Connection) (io.ReadCloser, error) {
+	client, release, err := s.Acquire(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := client.Snapshot(ctx)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to start snapshot: %w", classifyError(err))
+	}
+	return &snapshotReader{ReadCloser: reader, release: release}, nil
+}
+
+// snapshotReader 快照读取器，关闭时释放客户端
+type snapshotReader struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close 关闭快照并释放客户端
+func (r *snapshotReader) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
+
+// TestConnection 测试连接，未保存的连接使用临时客户端，不进入连接池
+func (s *EtcdService) TestConnection(ctx context.Context, conn *models.Connection) error {
+	if conn.ID == 0 {
+		client, err := newClient(conn)
+		if err != nil {
+			return err
+		}
+		return client.Close()
+	}
+
+	client, release, err := s.Acquire(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
+	defer cancel()
+
+	// 解析endpoints获取第一个进行测试
+	endpoints := parseEndpoints(conn.Endpoints)
 	if len(endpoints) == 0 {
 		return fmt.Errorf("no endpoints configured")
 	}
 
-	_, err = client.Status(ctx, endpoints[0])
-	return err
+	if _, err := client.Status(ctx, endpoints[0]); err != nil {
+		return fmt.Errorf("failed to get status: %w", classifyError(err))
+	}
+	return nil
+}
+
+// buildTLSConfig 根据连接配置构建TLS配置，内联PEM优先于文件路径
+func buildTLSConfig(conn *models.Connection) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	caPEM := []byte(conn.TLSCACert)
+	if len(caPEM) == 0 && conn.CAFile != "" {
+		var err error
+		if caPEM, err = os.ReadFile(conn.CAFile); err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("invalid CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case conn.TLSCert != "" && conn.TLSKey != "":
+		cert, err := tls.X509KeyPair([]byte(conn.TLSCert), []byte(conn.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case conn.CertFile != "" && conn.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(conn.CertFile, conn.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrKeyNotFound 键不存在
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrEtcdTimeout 请求etcd超时
+	ErrEtcdTimeout = errors.New("etcd request timed out")
+	// ErrEtcdPermissionDenied etcd认证失败或无权限
+	ErrEtcdPermissionDenied = errors.New("etcd permission denied")
+	// ErrEtcdUnavailable etcd集群不可用
+	ErrEtcdUnavailable = errors.New("etcd unavailable")
+)
+
+// classifyError 将etcd客户端错误归类为上述错误类型，保留原始错误
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrEtcdTimeout, err)
+	}
+
+	switch rpctypes.Error(err) {
+	case rpctypes.ErrPermissionDenied, rpctypes.ErrAuthFailed, rpctypes.ErrInvalidAuthToken,
+		rpctypes.ErrInvalidAuthMgmt, rpctypes.ErrUserEmpty, rpctypes.ErrAuthOldRevision:
+		return fmt.Errorf("%w: %w", ErrEtcdPermissionDenied, err)
+	case rpctypes.ErrTimeout, rpctypes.ErrTimeoutDueToLeaderFail,
+		rpctypes.ErrTimeoutDueToConnectionLost, rpctypes.ErrTimeoutWaitAppliedIndex:
+		return fmt.Errorf("%w: %w", ErrEtcdTimeout, err)
+	case rpctypes.ErrNoLeader:
+		return fmt.Errorf("%w: %w", ErrEtcdUnavailable, err)
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Canceled:
+			return fmt.Errorf("%w: %w", context.Canceled, err)
+		case codes.DeadlineExceeded:
+			return fmt.Errorf("%w: %w", ErrEtcdTimeout, err)
+		case codes.PermissionDenied, codes.Unauthenticated:
+			return fmt.Errorf("%w: %w", ErrEtcdPermissionDenied, err)
+		case codes.Unavailable:
+			return fmt.Errorf("%w: %w", ErrEtcdUnavailable, err)
+		}
+	}
+	return err
+}
+
+// classifyDialError 建立连接失败时，除认证错误外均视为不可用
+func classifyDialError(err error) error {
+	if classified := classifyError(err); errors.Is(classified, ErrEtcdPermissionDenied) {
+		return classified
+	}
+	return fmt.Errorf("%w: %w", ErrEtcdUnavailable, err)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// testEtcd 测试共用的进程内etcd，第一次使用时启动，所有测试结束后关闭
+var testEtcd struct {
+	once     sync.Once
+	dir      string
+	server   *embed.Etcd
+	endpoint string
+	err      error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testEtcd.server != nil {
+		testEtcd.server.Close()
+	}
+	if testEtcd.dir != "" {
+		os.RemoveAll(testEtcd.dir)
+	}
+	os.Exit(code)
+}
+
+// freeTestPort 返回本机一个空闲的端口
+func freeTestPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func startTestEtcd() error {
+	dir, err := os.MkdirTemp("", "etcd-admin-test-*")
+	if err != nil {
+		return err
+	}
+	testEtcd.dir = dir
+
+	clientPort, err := freeTestPort()
+	if err != nil {
+		return err
+	}
+	peerPort, err := freeTestPort()
+	if err != nil {
+		return err
+	}
+	clientURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", clientPort))
+	peerURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", peerPort))
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.ListenClientUrls = []url.URL{*clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{*clientURL}
+	cfg.ListenPeerUrls = []url.URL{*peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.Name + "=" + peerURL.String()
+	// 关闭时的监听错误会以error级别输出
+	cfg.LogLevel = "panic"
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return err
+	}
+	testEtcd.server = server
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		return fmt.Errorf("embedded etcd did not become ready")
+	}
+	testEtcd.endpoint = clientURL.Host
+	return nil
+}
+
+// newTestEtcd 返回进程内etcd的客户端，并清空其中的所有键
+func newTestEtcd(t *testing.T) *clientv3.Client {
+	t.Helper()
+	testEtcd.once.Do(func() {
+		if testEtcd.err = startTestEtcd(); testEtcd.err != nil {
+			log.Printf("Failed to start embedded etcd: %v", testEtcd.err)
+		}
+	})
+	if testEtcd.err != nil {
+		t.Fatalf("embedded etcd: %v", testEtcd.err)
+	}
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{testEtcd.endpoint}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.Delete(context.Background(), "", clientv3.WithPrefix()); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newTestConnection 保存一个指向进程内etcd的连接，需先调用newTestDB和newTestEtcd
+func newTestConnection(t *testing.T, name string) *models.Connection {
+	t.Helper()
+	if testEtcd.endpoint == "" {
+		t.Fatal("newTestEtcd must be called before newTestConnection")
+	}
+	conn := &models.Connection{Name: name, Endpoints: fmt.Sprintf(`["%s"]`, testEtcd.endpoint), IsActive: true}
+	if err := database.GetDB().Create(conn).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// newTestEtcdService 创建不做后台维护的EtcdService，测试结束时关闭所有客户端
+func newTestEtcdService(t *testing.T) *EtcdService {
+	service := NewEtcdService(&config.Config{})
+	t.Cleanup(service.CloseAll)
+	return service
+}
+
+// putTestKeys 写入键值
+func putTestKeys(t *testing.T, client *clientv3.Client, kvs map[string]string) {
+	t.Helper()
+	for key, value := range kvs {
+		if _, err := client.Put(context.Background(), key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// getTestKeys 读取前缀下的所有键值
+func getTestKeys(t *testing.T, client *clientv3.Client, prefix string) map[string]string {
+	t.Helper()
+	resp, err := client.Get(context.Background(), prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	return kvs
+}
@@ -0,0 +1,596 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrInvalidGitSync Git同步配置无效
+	ErrInvalidGitSync = errors.New("invalid git sync")
+	// ErrGitSyncRunning 同步正在执行
+	ErrGitSyncRunning = errors.New("git sync is already running")
+	// ErrGitSyncReadOnly 连接为只读，不能写入仓库中的差异
+	ErrGitSyncReadOnly = errors.New("connection is read-only")
+	// ErrGitCommand git命令执行失败
+	ErrGitCommand = errors.New("git command failed")
+	// ErrGitSyncSymlink 同步目录的路径中有符号链接，可能指向仓库副本之外
+	ErrGitSyncSymlink = errors.New("symbolic links are not allowed in the sync path")
+)
+
+// 同步的触发方式
+const (
+	GitSyncTriggerSchedule = "schedule"
+	GitSyncTriggerManual   = "manual"
+)
+
+// gitAllowedProtocols 允许的git传输协议，禁止ext等可执行命令的协议；
+// 读写服务器本地仓库的file协议只在开启GIT_SYNC_ALLOW_LOCAL时允许
+const gitAllowedProtocols = "git:http:https:ssh"
+
+// gitAllowedSchemes repo_url允许的URL scheme
+var gitAllowedSchemes = map[string]bool{
+	"ssh":     true,
+	"git+ssh": true,
+	"ssh+git": true,
+	"git":     true,
+	"http":    true,
+	"https":   true,
+}
+
+// GitSyncService 将前缀与git仓库中的目录同步：拉取时把仓库中的差异写入etcd，推送时把前缀导出为提交
+// 每个同步配置在工作目录中有一个仓库副本，同一配置的拉取和推送不会并发执行
+type GitSyncService struct {
+	cfg            config.GitSyncConfig
+	etcdService    *EtcdService
+	webhookService *WebhookService
+	cron           *cron.Cron
+
+	mu      sync.Mutex
+	entries map[uint]cron.EntryID // sync_id -> cron条目
+	running map[uint]bool         // 正在执行的同步
+}
+
+// NewGitSyncService 创建Git同步服务
+func NewGitSyncService(cfg *config.Config, etcdService *EtcdService, webhookService *WebhookService) *GitSyncService {
+	return &GitSyncService{
+		cfg:            cfg.GitSync,
+		etcdService:    etcdService,
+		webhookService: webhookService,
+		cron:           cron.New(),
+		entries:        make(map[uint]cron.EntryID),
+		running:        make(map[uint]bool),
+	}
+}
+
+// Start 加载已启用的同步配置并启动调度
+func (s *GitSyncService) Start() error {
+	var syncs []models.GitSync
+	if err := database.GetDB().Where("enabled = ?", true).Find(&syncs).Error; err != nil {
+		return fmt.Errorf("failed to load git syncs: %w", err)
+	}
+	for i := range syncs {
+		if err := s.Reload(&syncs[i]); err != nil {
+			log.Printf("Failed to schedule git sync %d: %v", syncs[i].ID, err)
+		}
+	}
+
+	s.cron.Start()
+	return nil
+}
+
+// Stop 停止调度
+func (s *GitSyncService) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// ValidateGitSync 校验并补全同步配置
+func (s *GitSyncService) ValidateGitSync(gs *models.GitSync) error {
+	gs.RepoURL = strings.TrimSpace(gs.RepoURL)
+	if gs.RepoURL == "" || strings.HasPrefix(gs.RepoURL, "-") {
+		return fmt.Errorf("%w: invalid repo_url", ErrInvalidGitSync)
+	}
+	if err := s.checkRepoURL(gs.RepoURL); err != nil {
+		return err
+	}
+
+	if gs.Branch == "" {
+		gs.Branch = "main"
+	}
+	if strings.HasPrefix(gs.Branch, "-") || strings.ContainsAny(gs.Branch, " ~^:?*[\\") || strings.Contains(gs.Branch, "..") {
+		return fmt.Errorf("%w: invalid branch", ErrInvalidGitSync)
+	}
+
+	gs.Path = strings.Trim(gs.Path, "/")
+	if gs.Path != "" {
+		if path.Clean(gs.Path) != gs.Path || gs.Path == ".." || strings.HasPrefix(gs.Path, "../") || strings.HasPrefix(gs.Path, ".git") {
+			return fmt.Errorf("%w: invalid path", ErrInvalidGitSync)
+		}
+	}
+
+	if gs.Format == "" {
+		gs.Format = ExportFormatYAML
+	}
+	if gs.Format != ExportFormatYAML && gs.Format != ExportFormatJSON {
+		return fmt.Errorf("%w: format must be yaml or json", ErrInvalidGitSync)
+	}
+	if gs.Mode == "" {
+		gs.Mode = models.GitSyncModeApply
+	}
+	if gs.Mode != models.GitSyncModeApply && gs.Mode != models.GitSyncModeReport {
+		return fmt.Errorf("%w: mode must be apply or report", ErrInvalidGitSync)
+	}
+
+	if gs.Schedule != "" {
+		if _, err := cron.ParseStandard(gs.Schedule); err != nil {
+			return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidGitSync, err)
+		}
+	}
+	return nil
+}
+
+// Reload 同步配置创建或修改后更新调度，未启用或没有设置schedule的配置会被移除
+func (s *GitSyncService) Reload(gs *models.GitSync) error {
+	s.Remove(gs.ID)
+	if !gs.Enabled || gs.Schedule == "" {
+		return nil
+	}
+
+	syncID := gs.ID
+	entryID, err := s.cron.AddFunc(gs.Schedule, func() {
+		if _, err := s.Pull(context.Background(), syncID, false, GitSyncTriggerSchedule, 0); err != nil && !errors.Is(err, ErrGitSyncRunning) {
+			log.Printf("Git sync %d failed: %v", syncID, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidGitSync, err)
+	}
+
+	s.mu.Lock()
+	s.entries[gs.ID] = entryID
+	s.mu.Unlock()
+	return nil
+}
+
+// Remove 从调度中移除同步配置
+func (s *GitSyncService) Remove(syncID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entryID, exists := s.entries[syncID]; exists {
+		s.cron.Remove(entryID)
+		delete(s.entries, syncID)
+	}
+}
+
+// NextSync 返回下次同步的时间，未调度时返回nil
+func (s *GitSyncService) NextSync(syncID uint) *time.Time {
+	s.mu.Lock()
+	entryID, exists := s.entries[syncID]
+	s.mu.Unlock()
+	if !exists {
+		return nil
+	}
+
+	next := s.cron.Entry(entryID).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// Delete 删除同步配置、执行记录和仓库副本
+func (s *GitSyncService) Delete(gs *models.GitSync) error {
+	s.Remove(gs.ID)
+	if !s.acquire(gs.ID) {
+		return ErrGitSyncRunning
+	}
+	defer s.release(gs.ID)
+
+	if err := database.GetDB().Where("sync_id = ?", gs.ID).Delete(&models.GitSyncRun{}).Error; err != nil {
+		return err
+	}
+	if err := database.GetDB().Delete(gs).Error; err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.workdir(gs.ID)); err != nil {
+		log.Printf("Failed to remove git sync workdir %d: %v", gs.ID, err)
+	}
+	return nil
+}
+
+// Pull 拉取仓库并计算与etcd的差异，apply模式且不是预览时写入etcd并记录应用的提交
+// 每块键在一个事务中写入，以计算差异时的mod_revision为条件
+func (s *GitSyncService) Pull(ctx context.Context, syncID uint, dryRun bool, trigger string, userID uint) (*models.GitSyncRun, error) {
+	if !s.acquire(syncID) {
+		return nil, ErrGitSyncRunning
+	}
+	defer s.release(syncID)
+
+	var gs models.GitSync
+	if err := database.GetDB().First(&gs, syncID).Error; err != nil {
+		return nil, err
+	}
+	if gs.Mode == models.GitSyncModeReport {
+		dryRun = true
+	}
+
+	run := &models.GitSyncRun{
+		SyncID:      gs.ID,
+		Direction:   models.GitSyncPull,
+		Trigger:     trigger,
+		DryRun:      dryRun,
+		TriggeredBy: userID,
+		StartedAt:   time.Now(),
+	}
+	err := s.pull(ctx, &gs, run)
+	return s.finishRun(&gs, run, err)
+}
+
+// pull 执行拉取
+func (s *GitSyncService) pull(ctx context.Context, gs *models.GitSync, run *models.GitSyncRun) error {
+	var conn models.Connection
+	if err := database.GetDB().First(&conn, gs.ConnectionID).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+	if !run.DryRun && conn.IsReadOnly {
+		return ErrGitSyncReadOnly
+	}
+
+	dir, commit, err := s.checkout(ctx, gs, false)
+	if err != nil {
+		return err
+	}
+	run.Commit = commit
+
+	tree, err := readGitSyncTree(dir, gs.Path)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]*BackupRecord, len(tree.owner))
+	for relKey, file := range tree.owner {
+		key := gs.Prefix + relKey
+		records[key] = &BackupRecord{Key: key, Value: []byte(file.values[strings.TrimPrefix(relKey, file.dir)])}
+	}
+
+	items, _, err := importDiff(ctx, s.etcdService, &conn, records, nil, ImportOptions{
+		Overwrite: true,
+		Prune:     gs.Prune,
+		Prefix:    gs.Prefix,
+	})
+	if err != nil {
+		return err
+	}
+
+	writes := make([]ImportDiffItem, 0, len(items))
+	for _, item := range items {
+		switch item.Action {
+		case ImportActionAdd:
+			run.Added++
+		case ImportActionChange:
+			run.Changed++
+		case ImportActionDelete:
+			run.Deleted++
+		case ImportActionUnchanged:
+			run.Unchanged++
+			continue
+		}
+		writes = append(writes, item)
+		run.Changes = append(run.Changes, models.GitSyncChange{Key: item.Key, Action: item.Action})
+	}
+	if run.DryRun || len(writes) == 0 {
+		return nil
+	}
+
+	client, release, err := s.etcdService.Acquire(ctx, &conn)
+	if err != nil {
+		return err
+	}
+	defer release()
+	for start := 0; start < len(writes); start += DefaultImportChunkSize {
+		chunk := writes[start:min(start+DefaultImportChunkSize, len(writes))]
+		reqCtx, cancel := context.WithTimeout(ctx, conn.RequestTimeoutDuration())
+		_, err := applyImportChunk(reqCtx, client, nil, chunk)
+		cancel()
+		if err != nil {
+			// 已提交的块不会回滚
+			return err
+		}
+	}
+	return nil
+}
+
+// Push 将前缀下的当前键值写入仓库目录并提交推送，没有变化时不创建提交
+func (s *GitSyncService) Push(ctx context.Context, syncID uint, message string, userID uint) (*models.GitSyncRun, error) {
+	if !s.acquire(syncID) {
+		return nil, ErrGitSyncRunning
+	}
+	defer s.release(syncID)
+
+	var gs models.GitSync
+	if err := database.GetDB().First(&gs, syncID).Error; err != nil {
+		return nil, err
+	}
+
+	run := &models.GitSyncRun{
+		SyncID:      gs.ID,
+		Direction:   models.GitSyncPush,
+		Trigger:     GitSyncTriggerManual,
+		TriggeredBy: userID,
+		StartedAt:   time.Now(),
+	}
+	err := s.push(ctx, &gs, message, run)
+	return s.finishRun(&gs, run, err)
+}
+
+// push 执行推送
+func (s *GitSyncService) push(ctx context.Context, gs *models.GitSync, message string, run *models.GitSyncRun) error {
+	var conn models.Connection
+	if err := database.GetDB().First(&conn, gs.ConnectionID).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+	kvs, err := s.etcdService.GetAllKV(ctx, &conn, gs.Prefix)
+	if err != nil {
+		return err
+	}
+	relKVs := make(map[string]string, len(kvs))
+	for key, value := range kvs {
+		relKVs[strings.TrimPrefix(key, gs.Prefix)] = value
+	}
+
+	dir, commit, err := s.checkout(ctx, gs, true)
+	if err != nil {
+		return err
+	}
+	run.Commit = commit
+
+	tree, err := readGitSyncTree(dir, gs.Path)
+	if err != nil {
+		return err
+	}
+	for _, change := range tree.apply(relKVs, gs.Format) {
+		switch change.Action {
+		case ImportActionAdd:
+			run.Added++
+		case ImportActionChange:
+			run.Changed++
+		case ImportActionDelete:
+			run.Deleted++
+		}
+		run.Changes = append(run.Changes, models.GitSyncChange{Key: gs.Prefix + change.Key, Action: change.Action})
+	}
+	run.Unchanged = len(relKVs) - run.Added - run.Changed
+	if len(run.Changes) == 0 {
+		return nil
+	}
+	if err := tree.write(); err != nil {
+		return err
+	}
+
+	pathspec := gs.Path
+	if pathspec == "" {
+		pathspec = "."
+	}
+	if _, err := s.git(ctx, dir, "add", "-A", "--", pathspec); err != nil {
+		return err
+	}
+	// 文件内容与仓库相同时（如只改变了格式）不提交
+	if _, err := s.git(ctx, dir, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Export %s from %s", gs.Prefix, conn.Name)
+	}
+	if _, err := s.git(ctx, dir, "-c", "user.name="+s.cfg.AuthorName, "-c", "user.email="+s.cfg.AuthorEmail,
+		"commit", "-q", "-m", message); err != nil {
+		return err
+	}
+	if _, err := s.git(ctx, dir, "push", "-q", "origin", "HEAD:refs/heads/"+gs.Branch); err != nil {
+		return err
+	}
+	commit, err = s.git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	run.Commit = commit
+	return nil
+}
+
+// checkRepoURL 检查仓库地址的传输方式，本地路径和file://只在开启GIT_SYNC_ALLOW_LOCAL时允许
+func (s *GitSyncService) checkRepoURL(repoURL string) error {
+	scheme := gitRepoScheme(repoURL)
+	if gitAllowedSchemes[scheme] || (scheme == "file" && s.cfg.AllowLocal) {
+		return nil
+	}
+	return fmt.Errorf("%w: repo_url must be an ssh, git or http(s) remote, local paths require GIT_SYNC_ALLOW_LOCAL", ErrInvalidGitSync)
+}
+
+// checkout 更新仓库副本到远程分支的最新提交，丢弃本地的修改，返回副本目录和提交
+// 远程分支不存在时，推送会从空分支开始，拉取返回错误
+func (s *GitSyncService) checkout(ctx context.Context, gs *models.GitSync, forPush bool) (string, string, error) {
+	// 保存后关闭了GIT_SYNC_ALLOW_LOCAL的配置不再访问本地仓库
+	if err := s.checkRepoURL(gs.RepoURL); err != nil {
+		return "", "", err
+	}
+
+	dir := s.workdir(gs.ID)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", "", err
+		}
+		if _, err := s.git(ctx, dir, "init", "-q"); err != nil {
+			return "", "", err
+		}
+		if _, err := s.git(ctx, dir, "remote", "add", "origin", gs.RepoURL); err != nil {
+			return "", "", err
+		}
+	} else if _, err := s.git(ctx, dir, "remote", "set-url", "origin", gs.RepoURL); err != nil {
+		return "", "", err
+	}
+
+	heads, err := s.git(ctx, dir, "ls-remote", "--heads", "origin", "refs/heads/"+gs.Branch)
+	if err != nil {
+		return "", "", err
+	}
+	if heads == "" {
+		if !forPush {
+			return "", "", fmt.Errorf("%w: branch %s not found in repository", ErrGitCommand, gs.Branch)
+		}
+		if _, err := s.git(ctx, dir, "symbolic-ref", "HEAD", "refs/heads/etcd-admin-"+gs.Branch); err != nil {
+			return "", "", err
+		}
+		if _, err := s.git(ctx, dir, "rm", "-rfq", "--cached", "--ignore-unmatch", "."); err != nil {
+			return "", "", err
+		}
+		if _, err := s.git(ctx, dir, "clean", "-qfdx"); err != nil {
+			return "", "", err
+		}
+		return dir, "", nil
+	}
+
+	if _, err := s.git(ctx, dir, "fetch", "-q", "origin", "refs/heads/"+gs.Branch); err != nil {
+		return "", "", err
+	}
+	if _, err := s.git(ctx, dir, "checkout", "-q", "-f", "-B", "etcd-admin-"+gs.Branch, "FETCH_HEAD"); err != nil {
+		return "", "", err
+	}
+	if _, err := s.git(ctx, dir, "clean", "-qfdx"); err != nil {
+		return "", "", err
+	}
+	commit, err := s.git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return dir, commit, nil
+}
+
+// gitRepoScheme 按git的规则判断仓库地址使用的传输方式：URL返回scheme，scp形式（user@host:path）返回ssh，
+// <transport>::<address>返回transport，其余视为本地路径返回file
+func gitRepoScheme(repoURL string) string {
+	if i := strings.Index(repoURL, "://"); i > 0 && !strings.Contains(repoURL[:i], "/") {
+		return strings.ToLower(repoURL[:i])
+	}
+	i := strings.Index(repoURL, ":")
+	if i <= 0 || strings.Contains(repoURL[:i], "/") {
+		return "file"
+	}
+	if strings.HasPrefix(repoURL[i:], "::") {
+		return strings.ToLower(repoURL[:i])
+	}
+	return "ssh"
+}
+
+// git 在目录中执行git命令，返回去掉首尾空白的标准输出
+func (s *GitSyncService) git(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	protocols := gitAllowedProtocols
+	if s.cfg.AllowLocal {
+		protocols += ":file"
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL="+protocols,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%w: git %s timed out", ErrGitCommand, args[0])
+		}
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%w: git %s: %s", ErrGitCommand, args[0], message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// workdir 同步配置的仓库副本目录
+func (s *GitSyncService) workdir(syncID uint) string {
+	return filepath.Join(s.cfg.Directory, fmt.Sprintf("sync-%d", syncID))
+}
+
+// finishRun 保存执行记录并更新同步配置的状态，拉取并写入etcd成功时记录应用的提交
+func (s *GitSyncService) finishRun(gs *models.GitSync, run *models.GitSyncRun, err error) (*models.GitSyncRun, error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.GitSyncRunSuccess
+	if err != nil {
+		run.Status = models.GitSyncRunFailed
+		run.Error = err.Error()
+	}
+	if dbErr := database.GetDB().Create(run).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	updates := map[string]interface{}{
+		"last_sync_at": now,
+		"last_status":  run.Status,
+	}
+	if err == nil && run.Direction == models.GitSyncPull && !run.DryRun {
+		updates["last_commit"] = run.Commit
+	}
+	if dbErr := database.GetDB().Model(gs).Updates(updates).Error; dbErr != nil {
+		log.Printf("Failed to update git sync %d: %v", gs.ID, dbErr)
+	}
+
+	// 预览不修改etcd和仓库，不发送事件
+	if !run.DryRun {
+		event := WebhookEventGitSyncFailed
+		switch {
+		case err != nil:
+		case run.Direction == models.GitSyncPull:
+			event = WebhookEventGitSyncPulled
+		default:
+			event = WebhookEventGitSyncPushed
+		}
+		s.webhookService.Emit(gs.ConnectionID, event, "", map[string]interface{}{
+			"sync_id": gs.ID,
+			"name":    gs.Name,
+			"prefix":  gs.Prefix,
+			"run":     run,
+		})
+	}
+	return run, err
+}
+
+// acquire 标记同步正在执行，已在执行时返回false
+func (s *GitSyncService) acquire(syncID uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[syncID] {
+		return false
+	}
+	s.running[syncID] = true
+	return true
+}
+
+// release 清除执行标记
+func (s *GitSyncService) release(syncID uint) {
+	s.mu.Lock()
+	delete(s.running, syncID)
+	s.mu.Unlock()
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"etcd-admin-backend/internal/models"
+)
+
+// gitSyncDefaultFile 推送时新键写入的文件名（不含扩展名）
+const gitSyncDefaultFile = "config"
+
+// gitSyncFile 仓库目录中的一个YAML/JSON文件，顶层为键到值的映射
+// 文件所在的目录作为键的前缀，如 services/api.yaml 中的 timeout 对应 services/timeout
+type gitSyncFile struct {
+	name    string            // 相对于同步目录的路径，以/分隔
+	dir     string            // 键的前缀，根目录为空，否则以/结尾
+	format  string            // yaml 或 json
+	keys    []string          // 文件中的键，保持原有顺序
+	values  map[string]string // 键 -> 值
+	yamlDoc *yaml.Node        // YAML文件的文档，推送时原地修改以保留注释
+	raw     map[string][]byte // JSON文件中值的原始内容，未修改的值原样写回
+	dirty   bool
+}
+
+// gitSyncTree 同步目录中的所有文件
+type gitSyncTree struct {
+	base  string // 仓库副本目录
+	path  string // 同步目录相对于仓库副本的路径，以/分隔
+	root  string
+	files []*gitSyncFile
+	owner map[string]*gitSyncFile // 相对键 -> 所在文件
+}
+
+// gitSyncFileFormat 根据扩展名识别文件格式，不支持的文件返回空
+func gitSyncFileFormat(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return ExportFormatYAML
+	case ".json":
+		return ExportFormatJSON
+	}
+	return ""
+}
+
+// checkGitSyncPath 逐级检查仓库副本中的相对路径，任一级为符号链接时返回ErrGitSyncSymlink
+// 仓库内容不可信，符号链接可能让读写落到仓库副本之外；不存在的部分之后会被创建为普通目录
+func checkGitSyncPath(base, rel string) error {
+	p := base
+	for _, segment := range strings.Split(rel, "/") {
+		if segment == "" {
+			continue
+		}
+		p = filepath.Join(p, segment)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrGitSyncSymlink, filepath.ToSlash(strings.TrimPrefix(p, base+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
+
+// readGitSyncTree 读取仓库副本base中同步目录rel下的YAML/JSON文件，跳过以.开头的文件和目录以及符号链接
+// 同一个键出现在多个文件中时返回错误；目录不存在时视为空
+func readGitSyncTree(base, rel string) (*gitSyncTree, error) {
+	if err := checkGitSyncPath(base, rel); err != nil {
+		return nil, err
+	}
+	root := filepath.Join(base, filepath.FromSlash(rel))
+	tree := &gitSyncTree{base: base, path: rel, root: root, owner: make(map[string]*gitSyncFile)}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		format := gitSyncFileFormat(d.Name())
+		if format == "" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		file, err := readGitSyncFile(p, filepath.ToSlash(rel), format)
+		if err != nil {
+			return err
+		}
+		for _, key := range file.keys {
+			relKey := file.dir + key
+			if other, exists := tree.owner[relKey]; exists {
+				return fmt.Errorf("key %s is defined in both %s and %s", relKey, other.name, file.name)
+			}
+			tree.owner[relKey] = file
+		}
+		tree.files = append(tree.files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// readGitSyncFile 读取一个文件
+func readGitSyncFile(p, name, format string) (*gitSyncFile, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &gitSyncFile{
+		name:   name,
+		format: format,
+		values: make(map[string]string),
+	}
+	if dir := path.Dir(name); dir != "." {
+		file.dir = dir + "/"
+	}
+
+	if format == ExportFormatJSON {
+		err = file.parseJSON(data)
+	} else {
+		err = file.parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file %s: %w", format, name, err)
+	}
+	return file, nil
+}
+
+// parseYAML 解析顶层映射，标量值保存其文本，映射和列表转换为JSON
+func (f *gitSyncFile) parseYAML(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("top level must be a mapping of keys to values")
+	}
+	f.yamlDoc = &doc
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i].Value
+		value, err := yamlNodeValue(mapping.Content[i+1])
+		if err != nil {
+			return fmt.Errorf("invalid value of key %s: %w", key, err)
+		}
+		if _, exists := f.values[key]; exists {
+			return fmt.Errorf("duplicate key %s", key)
+		}
+		f.keys = append(f.keys, key)
+		f.values[key] = value
+	}
+	return nil
+}
+
+// parseJSON 解析顶层对象，字符串值去掉引号，其它值压缩后保存
+func (f *gitSyncFile) parseJSON(data []byte) error {
+	f.raw = make(map[string][]byte)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return fmt.Errorf("top level must be an object of keys to values")
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("invalid value of key %s: %w", key, err)
+		}
+		value, err := jsonFileValue(raw)
+		if err != nil {
+			return fmt.Errorf("invalid value of key %s: %w", key, err)
+		}
+		if _, exists := f.values[key]; exists {
+			return fmt.Errorf("duplicate key %s", key)
+		}
+		f.keys = append(f.keys, key)
+		f.values[key] = value
+		f.raw[key] = raw
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// jsonFileValue JSON文件中的值对应的键值
+func jsonFileValue(raw []byte) (string, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// yamlNodeValue YAML节点对应的键值：标量为原文本（null为空），映射和列表转换为JSON并保持键的顺序
+func yamlNodeValue(node *yaml.Node) (string, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+		return node.Value, nil
+	}
+	var buf bytes.Buffer
+	if err := writeYAMLNodeJSON(&buf, node); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeYAMLNodeJSON 将YAML节点写为压缩的JSON
+func writeYAMLNodeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeYAMLNodeJSON(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(jsonString(node.Content[i].Value))
+			buf.WriteByte(':')
+			if err := writeYAMLNodeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeYAMLNodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int", "!!float", "!!bool", "!!null":
+			var v interface{}
+			if err := node.Decode(&v); err != nil {
+				return err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+		default:
+			buf.WriteString(jsonString(node.Value))
+		}
+	default:
+		return fmt.Errorf("unsupported yaml node at line %d", node.Line)
+	}
+	return nil
+}
+
+// jsonString 编码JSON字符串，不转义HTML字符
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// isCompactJSON 值为压缩的JSON对象或数组
+func isCompactJSON(value string) bool {
+	if value == "" || (value[0] != '{' && value[0] != '[') || !json.Valid([]byte(value)) {
+		return false
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(value)); err != nil {
+		return false
+	}
+	return buf.String() == value
+}
+
+// yamlValueNode 值对应的YAML节点，压缩的JSON对象或数组写为YAML结构，读回后不变时才使用，其余写为标量
+func yamlValueNode(value string) *yaml.Node {
+	if isCompactJSON(value) {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err == nil && len(doc.Content) == 1 {
+			node := doc.Content[0]
+			clearYAMLStyle(node)
+			if decoded, err := yamlNodeValue(node); err == nil && decoded == value {
+				return node
+			}
+		}
+	}
+	// 读取时使用标量的原文本，只有会被解析为null的值需要写为字符串
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if node.ShortTag() == "!!null" {
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+// clearYAMLStyle 去掉从JSON解析得到的流式风格，写为块风格
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// jsonRawValue 值在JSON文件中的写法，合法且压缩的JSON（字符串除外）原样写出，否则作为字符串
+func jsonRawValue(value string) []byte {
+	if value != "" && value[0] != '"' && json.Valid([]byte(value)) {
+		var buf bytes.Buffer
+		if json.Compact(&buf, []byte(value)) == nil && buf.String() == value {
+			return []byte(value)
+		}
+	}
+	return []byte(jsonString(value))
+}
+
+// set 设置键的值，键不存在时追加到文件末尾
+func (f *gitSyncFile) set(key, value string) {
+	if current, exists := f.values[key]; exists && current == value {
+		return
+	}
+	f.dirty = true
+	_, exists := f.values[key]
+	f.values[key] = value
+	if f.raw != nil {
+		delete(f.raw, key)
+	}
+
+	if f.format != ExportFormatYAML {
+		if !exists {
+			f.keys = append(f.keys, key)
+		}
+		return
+	}
+	if f.yamlDoc == nil {
+		f.yamlDoc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	mapping := f.yamlDoc.Content[0]
+	if exists {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == key {
+				node := yamlValueNode(value)
+				node.HeadComment = mapping.Content[i+1].HeadComment
+				node.LineComment = mapping.Content[i+1].LineComment
+				mapping.Content[i+1] = node
+				return
+			}
+		}
+	}
+	f.keys = append(f.keys, key)
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		yamlValueNode(value))
+}
+
+// remove 删除键
+func (f *gitSyncFile) remove(key string) {
+	if _, exists := f.values[key]; !exists {
+		return
+	}
+	f.dirty = true
+	delete(f.values, key)
+	for i, k := range f.keys {
+		if k == key {
+			f.keys = append(f.keys[:i], f.keys[i+1:]...)
+			break
+		}
+	}
+	if f.yamlDoc != nil {
+		mapping := f.yamlDoc.Content[0]
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == key {
+				mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+				break
+			}
+		}
+	}
+}
+
+// encode 编码文件内容
+func (f *gitSyncFile) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if f.format == ExportFormatYAML {
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(f.yamlDoc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteString("{\n")
+	for i, key := range f.keys {
+		raw, exists := f.raw[key]
+		if !exists {
+			raw = jsonRawValue(f.values[key])
+		}
+		buf.WriteString("  ")
+		buf.WriteString(jsonString(key))
+		buf.WriteString(": ")
+		if err := json.Indent(&buf, raw, "  ", "  "); err != nil {
+			return nil, err
+		}
+		if i < len(f.keys)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// apply 使同步目录中的键与kvs（相对键 -> 值）一致，返回新增、修改和删除的键
+// 已有的键保留在原文件中，新键写入其目录下的默认文件，不能作为目录的键写入根目录的默认文件
+func (t *gitSyncTree) apply(kvs map[string]string, format string) []models.GitSyncChange {
+	var changes []models.GitSyncChange
+	for relKey, file := range t.owner {
+		key := strings.TrimPrefix(relKey, file.dir)
+		value, exists := kvs[relKey]
+		switch {
+		case !exists:
+			file.remove(key)
+			changes = append(changes, models.GitSyncChange{Key: relKey, Action: ImportActionDelete})
+		case value != file.values[key]:
+			file.set(key, value)
+			changes = append(changes, models.GitSyncChange{Key: relKey, Action: ImportActionChange})
+		}
+	}
+
+	added := make([]string, 0)
+	for relKey := range kvs {
+		if _, exists := t.owner[relKey]; !exists {
+			added = append(added, relKey)
+		}
+	}
+	sort.Strings(added)
+
+	files := make(map[string]*gitSyncFile, len(t.files))
+	for _, file := range t.files {
+		files[file.name] = file
+	}
+	for _, relKey := range added {
+		dir, key := gitSyncKeyDir(relKey)
+		name := dir + gitSyncDefaultFile + "." + format
+		file, exists := files[name]
+		if !exists {
+			file = &gitSyncFile{name: name, dir: dir, format: format, values: make(map[string]string)}
+			if format == ExportFormatJSON {
+				file.raw = make(map[string][]byte)
+			}
+			files[name] = file
+			t.files = append(t.files, file)
+		}
+		file.set(key, kvs[relKey])
+		t.owner[relKey] = file
+		changes = append(changes, models.GitSyncChange{Key: relKey, Action: ImportActionAdd})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// gitSyncKeyDir 拆分相对键为目录和文件中的键，目录部分不能安全地作为路径时不拆分
+func gitSyncKeyDir(relKey string) (string, string) {
+	i := strings.LastIndex(relKey, "/")
+	if i <= 0 {
+		return "", relKey
+	}
+	dir := relKey[:i]
+	if path.Clean(dir) != dir || strings.HasPrefix(dir, "/") {
+		return "", relKey
+	}
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", relKey
+		}
+	}
+	return dir + "/", relKey[i+1:]
+}
+
+// write 写出修改过的文件，没有键的文件被删除；路径中有符号链接时返回ErrGitSyncSymlink
+func (t *gitSyncTree) write() error {
+	for _, file := range t.files {
+		if !file.dirty {
+			continue
+		}
+		if err := checkGitSyncPath(t.base, path.Join(t.path, file.name)); err != nil {
+			return err
+		}
+		p := filepath.Join(t.root, filepath.FromSlash(file.name))
+		if len(file.keys) == 0 {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := file.encode()
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
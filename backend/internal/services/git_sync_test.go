@@ -0,0 +1,483 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// testGitRepo 临时的bare仓库和一个用于提交、检查内容的克隆
+type testGitRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=tester", "-c", "user.email=tester@example.com", "-c", "protocol.file.allow=always"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func newTestGitRepo(t *testing.T) *testGitRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	repo := &testGitRepo{t: t, bare: filepath.Join(dir, "remote.git"), work: filepath.Join(dir, "work")}
+	runTestGit(t, dir, "init", "-q", "--bare", "-b", "main", repo.bare)
+	runTestGit(t, dir, "init", "-q", "-b", "main", repo.work)
+	runTestGit(t, repo.work, "remote", "add", "origin", repo.bare)
+	return repo
+}
+
+// commit 在main分支上写入文件（内容为空时删除）并推送，返回新提交
+func (r *testGitRepo) commit(files map[string]string, message string) string {
+	r.t.Helper()
+	r.sync()
+	for name, content := range files {
+		p := filepath.Join(r.work, filepath.FromSlash(name))
+		if content == "" {
+			os.Remove(p)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	runTestGit(r.t, r.work, "add", "-A")
+	runTestGit(r.t, r.work, "commit", "-q", "-m", message)
+	runTestGit(r.t, r.work, "push", "-q", "origin", "HEAD:main")
+	return r.head()
+}
+
+// symlink 在main分支上提交指向target的符号链接并推送
+func (r *testGitRepo) symlink(name, target, message string) {
+	r.t.Helper()
+	r.sync()
+	p := filepath.Join(r.work, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.RemoveAll(p); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.Symlink(target, p); err != nil {
+		r.t.Fatal(err)
+	}
+	runTestGit(r.t, r.work, "add", "-A")
+	runTestGit(r.t, r.work, "commit", "-q", "-m", message)
+	runTestGit(r.t, r.work, "push", "-q", "origin", "HEAD:main")
+}
+
+// sync 将克隆更新到远程main分支
+func (r *testGitRepo) sync() {
+	r.t.Helper()
+	if runTestGit(r.t, r.work, "ls-remote", "--heads", "origin", "main") == "" {
+		return
+	}
+	runTestGit(r.t, r.work, "fetch", "-q", "origin", "main")
+	runTestGit(r.t, r.work, "reset", "-q", "--hard", "FETCH_HEAD")
+}
+
+// head 远程main分支的最新提交
+func (r *testGitRepo) head() string {
+	r.t.Helper()
+	return runTestGit(r.t, r.bare, "rev-parse", "main")
+}
+
+// file 远程main分支上文件的内容，不存在时返回空
+func (r *testGitRepo) file(name string) string {
+	r.t.Helper()
+	r.sync()
+	data, err := os.ReadFile(filepath.Join(r.work, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return ""
+	} else if err != nil {
+		r.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func newTestGitSyncService(t *testing.T, allowLocal bool) *GitSyncService {
+	return NewGitSyncService(&config.Config{GitSync: config.GitSyncConfig{
+		Directory:   t.TempDir(),
+		Timeout:     30 * time.Second,
+		AuthorName:  "etcd-admin",
+		AuthorEmail: "etcd-admin@example.com",
+		AllowLocal:  allowLocal,
+	}}, newTestEtcdService(t), newTestWebhookService(t, true))
+}
+
+// newTestGitSync 保存前缀/app/与仓库config目录的同步配置
+func newTestGitSync(t *testing.T, service *GitSyncService, conn *models.Connection, repo *testGitRepo) *models.GitSync {
+	t.Helper()
+	gs := &models.GitSync{
+		ConnectionID: conn.ID,
+		Name:         "app",
+		Prefix:       "/app/",
+		RepoURL:      repo.bare,
+		Path:         "config",
+		Prune:        true,
+	}
+	if err := service.ValidateGitSync(gs); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.GetDB().Create(gs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
+
+func TestGitSyncValidateRepoURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		allowLocal bool
+		valid      bool
+	}{
+		{"https://example.com/config.git", false, true},
+		{"ssh://git@example.com/config.git", false, true},
+		{"git@example.com:team/config.git", false, true},
+		{"git://example.com/config.git", false, true},
+		{"/srv/git/config.git", false, false},
+		{"./config", false, false},
+		{"file:///srv/git/config.git", false, false},
+		{"ext::sh -c touch% /tmp/pwned", false, false},
+		{"-uhelp", false, false},
+		{"/srv/git/config.git", true, true},
+		{"file:///srv/git/config.git", true, true},
+		{"ext::sh -c touch% /tmp/pwned", true, false},
+		{"fd::17", true, false},
+	}
+	for _, tt := range tests {
+		service := NewGitSyncService(&config.Config{GitSync: config.GitSyncConfig{AllowLocal: tt.allowLocal}}, nil, nil)
+		err := service.ValidateGitSync(&models.GitSync{RepoURL: tt.url})
+		if tt.valid && err != nil {
+			t.Errorf("ValidateGitSync(%q, allowLocal=%v) = %v, want nil", tt.url, tt.allowLocal, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidGitSync) {
+			t.Errorf("ValidateGitSync(%q, allowLocal=%v) = %v, want ErrInvalidGitSync", tt.url, tt.allowLocal, err)
+		}
+	}
+}
+
+func TestGitSyncLocalRepoRequiresOptIn(t *testing.T) {
+	newTestDB(t)
+	repo := newTestGitRepo(t)
+	repo.commit(map[string]string{"config/app.yaml": "timeout: 5\n"}, "initial")
+	newTestEtcd(t)
+	conn := newTestConnection(t, "local")
+	gs := newTestGitSync(t, newTestGitSyncService(t, true), conn, repo)
+
+	// 保存后关闭GIT_SYNC_ALLOW_LOCAL，已有的配置不再访问本地仓库
+	service := newTestGitSyncService(t, false)
+	run, err := service.Pull(context.Background(), gs.ID, false, GitSyncTriggerManual, 0)
+	if !errors.Is(err, ErrInvalidGitSync) {
+		t.Fatalf("Pull error = %v, want ErrInvalidGitSync", err)
+	}
+	if run.Status != models.GitSyncRunFailed {
+		t.Errorf("run status = %s, want failed", run.Status)
+	}
+}
+
+func TestGitSyncPull(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	repo := newTestGitRepo(t)
+	commit := repo.commit(map[string]string{
+		"config/app.yaml":         "# application settings\ntimeout: 5\nname: api\nlimits:\n  rps: 100\n  burst: 20\n",
+		"config/services/db.json": `{"host": "db", "port": 5432}`,
+		"config/.hidden.yaml":     "ignored: true\n",
+		"README.md":               "not synced\n",
+	}, "initial")
+	putTestKeys(t, client, map[string]string{
+		"/app/timeout": "3",
+		"/app/stale":   "x",
+		"/other/key":   "keep",
+	})
+
+	conn := newTestConnection(t, "local")
+	service := newTestGitSyncService(t, true)
+	gs := newTestGitSync(t, service, conn, repo)
+	ctx := context.Background()
+
+	// 预览不写入etcd，也不记录应用的提交
+	run, err := service.Pull(ctx, gs.ID, true, GitSyncTriggerManual, 0)
+	if err != nil {
+		t.Fatalf("Pull dry run: %v", err)
+	}
+	if run.Commit != commit || run.Added != 4 || run.Changed != 1 || run.Deleted != 1 || run.Unchanged != 0 {
+		t.Fatalf("dry run = %+v", run)
+	}
+	if value := getTestKeys(t, client, "/app/timeout")["/app/timeout"]; value != "3" {
+		t.Fatalf("dry run wrote /app/timeout = %q", value)
+	}
+
+	run, err = service.Pull(ctx, gs.ID, false, GitSyncTriggerManual, 0)
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	want := map[string]string{
+		"/app/timeout":       "5",
+		"/app/name":          "api",
+		"/app/limits":        `{"rps":100,"burst":20}`,
+		"/app/services/host": "db",
+		"/app/services/port": "5432",
+		"/other/key":         "keep",
+	}
+	if got := getTestKeys(t, client, "/"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys after pull = %v, want %v", got, want)
+	}
+	if err := database.GetDB().First(gs, gs.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if gs.LastCommit != commit || gs.LastStatus != models.GitSyncRunSuccess {
+		t.Errorf("git sync last_commit = %q, last_status = %q, want %q success", gs.LastCommit, gs.LastStatus, commit)
+	}
+
+	run, err = service.Pull(ctx, gs.ID, false, GitSyncTriggerManual, 0)
+	if err != nil {
+		t.Fatalf("second Pull: %v", err)
+	}
+	if run.Added+run.Changed+run.Deleted != 0 || run.Unchanged != 5 {
+		t.Errorf("second pull = %+v, want 5 unchanged keys", run)
+	}
+}
+
+func TestGitSyncPush(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	repo := newTestGitRepo(t)
+	initial := repo.commit(map[string]string{
+		"config/app.yaml": "# application settings\ntimeout: 3 # seconds\nold: x\n",
+		"README.md":       "docs\n",
+	}, "initial")
+	putTestKeys(t, client, map[string]string{
+		"/app/timeout":       "5",
+		"/app/limits":        `{"rps":100}`,
+		"/app/services/host": "db",
+	})
+
+	conn := newTestConnection(t, "local")
+	service := newTestGitSyncService(t, true)
+	gs := newTestGitSync(t, service, conn, repo)
+	ctx := context.Background()
+	webhook := &models.Webhook{ConnectionID: conn.ID, Name: "sync", URL: "https://hooks.example.com", Events: []string{"gitsync.*"}, Enabled: true}
+	if err := database.GetDB().Create(webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := service.Push(ctx, gs.ID, "export app", 0)
+	if err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if run.Added != 2 || run.Changed != 1 || run.Deleted != 1 {
+		t.Fatalf("push = %+v", run)
+	}
+	var deliveries []models.WebhookDelivery
+	if err := database.GetDB().Where("webhook_id = ?", webhook.ID).Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event != WebhookEventGitSyncPushed {
+		t.Errorf("deliveries = %+v, want one %s", deliveries, WebhookEventGitSyncPushed)
+	}
+	if run.Commit == "" || run.Commit != repo.head() {
+		t.Fatalf("push commit = %q, remote head = %q", run.Commit, repo.head())
+	}
+	if parent := runTestGit(t, repo.bare, "rev-parse", "main~1"); parent != initial {
+		t.Errorf("push commit parent = %s, want %s", parent, initial)
+	}
+	if author := runTestGit(t, repo.bare, "log", "-1", "--format=%an <%ae> %s", "main"); author != "etcd-admin <etcd-admin@example.com> export app" {
+		t.Errorf("push commit = %q", author)
+	}
+
+	// 已有的键在原文件中修改并保留注释，新键写入所在目录的config.yaml
+	if got := repo.file("config/app.yaml"); got != "# application settings\ntimeout: 5 # seconds\n" {
+		t.Errorf("config/app.yaml = %q", got)
+	}
+	if got := repo.file("config/config.yaml"); got != "limits:\n  rps: 100\n" {
+		t.Errorf("config/config.yaml = %q", got)
+	}
+	if got := repo.file("config/services/config.yaml"); got != "host: db\n" {
+		t.Errorf("config/services/config.yaml = %q", got)
+	}
+	if got := repo.file("README.md"); got != "docs\n" {
+		t.Errorf("README.md = %q", got)
+	}
+
+	// 没有变化时不创建提交
+	head := repo.head()
+	run, err = service.Push(ctx, gs.ID, "", 0)
+	if err != nil {
+		t.Fatalf("second Push: %v", err)
+	}
+	if len(run.Changes) != 0 || run.Unchanged != 3 || repo.head() != head {
+		t.Errorf("second push = %+v, head %s -> %s", run, head, repo.head())
+	}
+}
+
+func TestGitSyncPushOnDivergedRemote(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	repo := newTestGitRepo(t)
+	repo.commit(map[string]string{"config/app.yaml": "timeout: 3\n"}, "initial")
+	putTestKeys(t, client, map[string]string{"/app/timeout": "5"})
+
+	conn := newTestConnection(t, "local")
+	service := newTestGitSyncService(t, true)
+	gs := newTestGitSync(t, service, conn, repo)
+	ctx := context.Background()
+
+	if _, err := service.Push(ctx, gs.ID, "", 0); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// 仓库副本之后远程有了其它提交，推送基于远程的最新提交而不是覆盖它
+	other := repo.commit(map[string]string{
+		"config/app.yaml": "timeout: 5\nretries: 2\n",
+		"docs/notes.md":   "notes\n",
+	}, "edit in repository")
+	putTestKeys(t, client, map[string]string{"/app/timeout": "7", "/app/retries": "2"})
+
+	run, err := service.Push(ctx, gs.ID, "", 0)
+	if err != nil {
+		t.Fatalf("Push after remote change: %v", err)
+	}
+	if run.Changed != 1 || run.Added != 0 || run.Deleted != 0 {
+		t.Fatalf("push = %+v, want only timeout changed", run)
+	}
+	if parent := runTestGit(t, repo.bare, "rev-parse", "main~1"); parent != other {
+		t.Errorf("push commit parent = %s, want the remote commit %s", parent, other)
+	}
+	if got := repo.file("config/app.yaml"); got != "timeout: 7\nretries: 2\n" {
+		t.Errorf("config/app.yaml = %q", got)
+	}
+	if got := repo.file("docs/notes.md"); got != "notes\n" {
+		t.Errorf("docs/notes.md = %q", got)
+	}
+}
+
+func TestGitSyncPullConflict(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	repo := newTestGitRepo(t)
+	conn := newTestConnection(t, "local")
+	service := newTestGitSyncService(t, true)
+	gs := newTestGitSync(t, service, conn, repo)
+	ctx := context.Background()
+
+	t.Run("key defined in two files", func(t *testing.T) {
+		putTestKeys(t, client, map[string]string{"/app/timeout": "3"})
+		repo.commit(map[string]string{
+			"config/a.yaml": "timeout: 5\n",
+			"config/b.json": `{"timeout": 6}`,
+		}, "duplicate key")
+
+		run, err := service.Pull(ctx, gs.ID, false, GitSyncTriggerManual, 0)
+		if err == nil || !strings.Contains(err.Error(), "timeout is defined in both") {
+			t.Fatalf("Pull error = %v, want duplicate key error", err)
+		}
+		if run.Status != models.GitSyncRunFailed {
+			t.Errorf("run status = %s, want failed", run.Status)
+		}
+		if got := getTestKeys(t, client, "/app/"); !reflect.DeepEqual(got, map[string]string{"/app/timeout": "3"}) {
+			t.Errorf("keys after failed pull = %v", got)
+		}
+	})
+
+	t.Run("key changed after diff", func(t *testing.T) {
+		putTestKeys(t, client, map[string]string{"/app/timeout": "3"})
+		records := map[string]*BackupRecord{"/app/timeout": {Key: "/app/timeout", Value: []byte("5")}}
+		items, _, err := importDiff(ctx, service.etcdService, conn, records, nil, ImportOptions{Overwrite: true, Prefix: "/app/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 拉取的写入以计算差异时的mod_revision为条件，期间被修改的键不会被覆盖
+		putTestKeys(t, client, map[string]string{"/app/timeout": "4"})
+		if _, err := applyImportChunk(ctx, client, nil, items); !errors.Is(err, ErrImportConflict) {
+			t.Fatalf("applyImportChunk error = %v, want ErrImportConflict", err)
+		}
+		if value := getTestKeys(t, client, "/app/timeout")["/app/timeout"]; value != "4" {
+			t.Errorf("/app/timeout = %q, want the concurrent write 4", value)
+		}
+	})
+}
+
+func TestGitSyncRejectsSymlinks(t *testing.T) {
+	tests := []struct {
+		name string
+		link string // 提交为符号链接的路径
+	}{
+		{"sync path", "config"},
+		{"directory inside sync path", "config/services"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			client := newTestEtcd(t)
+			repo := newTestGitRepo(t)
+			repo.commit(map[string]string{"config/app.yaml": "timeout: 3\n"}, "initial")
+			// 符号链接指向仓库副本之外的目录
+			outside := t.TempDir()
+			if err := os.WriteFile(filepath.Join(outside, "app.yaml"), []byte("secret: value\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			repo.symlink(tt.link, outside, "add symlink")
+			putTestKeys(t, client, map[string]string{"/app/timeout": "5", "/app/services/host": "db"})
+
+			conn := newTestConnection(t, "local")
+			service := newTestGitSyncService(t, true)
+			gs := newTestGitSync(t, service, conn, repo)
+			ctx := context.Background()
+
+			head := repo.head()
+			if _, err := service.Push(ctx, gs.ID, "", 0); !errors.Is(err, ErrGitSyncSymlink) {
+				t.Fatalf("Push error = %v, want ErrGitSyncSymlink", err)
+			}
+			entries, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "app.yaml" {
+				t.Errorf("push wrote outside the repository: %v", entries)
+			}
+			if data, _ := os.ReadFile(filepath.Join(outside, "app.yaml")); string(data) != "secret: value\n" {
+				t.Errorf("push modified a file outside the repository: %q", data)
+			}
+			if repo.head() != head {
+				t.Error("push created a commit")
+			}
+
+			if tt.link == "config" {
+				if _, err := service.Pull(ctx, gs.ID, false, GitSyncTriggerManual, 0); !errors.Is(err, ErrGitSyncSymlink) {
+					t.Fatalf("Pull error = %v, want ErrGitSyncSymlink", err)
+				}
+				if _, exists := getTestKeys(t, client, "/app/")["/app/secret"]; exists {
+					t.Error("pull read a file outside the repository")
+				}
+			}
+		})
+	}
+}
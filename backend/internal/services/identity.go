@@ -0,0 +1,187 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrIdentityNotAllowed 外部身份不允许登录（域名、组织限制或账户已禁用）
+	ErrIdentityNotAllowed = errors.New("identity is not allowed to sign in")
+	// ErrIdentityConflict 外部身份的邮箱已被其他账户使用，且提供方未开启自动关联
+	ErrIdentityConflict = errors.New("an existing account already uses this email")
+)
+
+// ExternalIdentity 外部身份信息（OIDC、GitHub、LDAP）
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	AvatarURL     string
+	Groups        []string // OIDC组、GitHub org/team 或 LDAP组
+	Orgs          []string
+}
+
+// ProvisionOptions 外部身份首次登录时的处理方式，由管理员按提供方配置
+type ProvisionOptions struct {
+	AutoCreate bool // 没有对应账户时自动创建
+	AutoLink   bool // 允许以已验证邮箱登录邮箱相同的现有账户
+}
+
+// ProvisionExternalUser 返回外部身份对应的本地用户，每次登录同步头像和映射的角色（role非空时）
+// 开启自动关联时，已验证邮箱相同且未关联其他外部身份的现有账户在首次登录时关联该身份，之后按外部ID查找；
+// 邮箱被占用且未开启自动关联（或该账户已关联其他身份）时返回ErrIdentityConflict
+func ProvisionExternalUser(identity *ExternalIdentity, role string, opts ProvisionOptions) (*models.User, error) {
+	db := database.GetDB()
+
+	// 按外部ID查找已关联的用户
+	var user models.User
+	err := db.Where("auth_provider = ? AND external_id = ?", identity.Provider, identity.Subject).First(&user).Error
+	if err == nil {
+		return syncExternalUser(db, &user, identity, role)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 邮箱已被其他账户使用
+	if identity.Email != "" {
+		err = db.Where("email = ?", identity.Email).First(&user).Error
+		if err == nil {
+			// 每个账户只关联一个外部身份，已关联其他身份的账户不会被改为关联当前身份
+			if !opts.AutoLink || !identity.EmailVerified || user.ExternalID != "" {
+				return nil, ErrIdentityConflict
+			}
+			user.AuthProvider = identity.Provider
+			user.ExternalID = identity.Subject
+			return syncExternalUser(db, &user, identity, role)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if !opts.AutoCreate {
+		return nil, ErrIdentityNotAllowed
+	}
+	username, err := uniqueUsername(db, identity.Username)
+	if err != nil {
+		return nil, err
+	}
+	email := identity.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@%s.invalid", identity.Subject, identity.Provider)
+	}
+	user = models.User{
+		Username:     username,
+		Email:        email,
+		Password:     randomHex(32), // 第三方账户不使用本地密码
+		Role:         models.RoleUser,
+		IsActive:     true,
+		AuthProvider: identity.Provider,
+		ExternalID:   identity.Subject,
+		AvatarURL:    identity.AvatarURL,
+	}
+	if role != "" {
+		user.Role = role
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &user, nil
+}
+
+// syncExternalUser 更新已关联用户的头像和角色并保存
+func syncExternalUser(db *gorm.DB, user *models.User, identity *ExternalIdentity, role string) (*models.User, error) {
+	if !user.IsActive {
+		return nil, ErrIdentityNotAllowed
+	}
+	if identity.AvatarURL != "" {
+		user.AvatarURL = identity.AvatarURL
+	}
+	if role != "" {
+		user.Role = role
+	}
+	if err := db.Save(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
+// mapRole 按组映射角色，未配置映射时返回空字符串（不修改用户的角色）
+// 配置了映射但没有命中的组时返回普通用户，从映射的组中移除的用户在下次登录时降级
+func mapRole(mapping map[string]string, groups []string) string {
+	if len(mapping) == 0 {
+		return ""
+	}
+	role := models.RoleUser
+	matched := false
+	for _, group := range groups {
+		for key, mapped := range mapping {
+			if !strings.EqualFold(key, group) {
+				continue
+			}
+			// 管理员角色优先
+			if mapped == models.RoleAdmin || !matched {
+				role = mapped
+				matched = true
+			}
+		}
+	}
+	return role
+}
+
+// uniqueUsername 生成不重复的用户名
+func uniqueUsername(db *gorm.DB, base string) (string, error) {
+	base = strings.ToLower(strings.TrimSpace(base))
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = "user-" + base
+	}
+
+	candidate := base
+	for i := 1; i < 100; i++ {
+		var count int64
+		if err := db.Model(&models.User{}).Unscoped().Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+	return base + "-" + randomHex(4), nil
+}
+
+// containsFold 判断values中是否有任一值在list中（忽略大小写）
+func containsFold(list []string, values ...string) bool {
+	for _, item := range list {
+		for _, value := range values {
+			if strings.EqualFold(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// randomHex 生成随机十六进制字符串
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"etcd-admin-backend/internal/models"
+)
+
+// ErrInvalidKeyMapping 键名映射配置无效或映射结果冲突
+var ErrInvalidKeyMapping = errors.New("invalid key mapping")
+
+// templateVariablePattern 匹配改写规则和值转换中的 {{name}} 变量引用
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// KeyMapper 编译后的键名映射，nil表示不做映射
+type KeyMapper struct {
+	mapping  models.KeyMapping
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	rewrites []keyRewriter
+	values   []valueTransformer
+}
+
+// keyRewriter 编译后的键名改写规则，变量已展开
+type keyRewriter struct {
+	from string
+	re   *regexp.Regexp // regex规则
+	to   string
+}
+
+// valueTransformer 编译后的值转换规则，变量已展开
+type valueTransformer struct {
+	kind  string
+	match *regexp.Regexp
+	path  []string // json_set的路径，已按RFC 6901解码
+	value interface{}
+	from  string
+	re    *regexp.Regexp
+	to    string
+}
+
+// NewKeyMapper 校验并编译键名映射，未配置映射时返回nil
+func NewKeyMapper(mapping models.KeyMapping) (*KeyMapper, error) {
+	if mapping.IsZero() {
+		return nil, nil
+	}
+
+	mapper := &KeyMapper{mapping: mapping}
+	for _, pattern := range mapping.Include {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeyMapping, err)
+		}
+		mapper.include = append(mapper.include, re)
+	}
+	for _, pattern := range mapping.Exclude {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeyMapping, err)
+		}
+		mapper.exclude = append(mapper.exclude, re)
+	}
+	for i, rewrite := range mapping.Rewrites {
+		rewriter, err := compileRewrite(rewrite, mapping.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rewrite %d: %v", ErrInvalidKeyMapping, i+1, err)
+		}
+		mapper.rewrites = append(mapper.rewrites, rewriter)
+	}
+	for i, transform := range mapping.Values {
+		transformer, err := compileValueTransform(transform, mapping.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value transform %d: %v", ErrInvalidKeyMapping, i+1, err)
+		}
+		mapper.values = append(mapper.values, transformer)
+	}
+	return mapper, nil
+}
+
+// compileRewrite 校验键名改写规则并展开变量
+func compileRewrite(rewrite models.KeyRewrite, variables map[string]string) (keyRewriter, error) {
+	if rewrite.From == "" {
+		return keyRewriter{}, errors.New("rewrite rule requires from")
+	}
+	switch rewrite.Type {
+	case "", models.RewriteLiteral:
+		to, err := expandVariables(rewrite.To, variables, literalVariable)
+		if err != nil {
+			return keyRewriter{}, err
+		}
+		return keyRewriter{from: rewrite.From, to: to}, nil
+	case models.RewriteRegex:
+		re, err := regexp.Compile(rewrite.From)
+		if err != nil {
+			return keyRewriter{}, err
+		}
+		// 变量值中的"$"不能被当作分组引用
+		to, err := expandVariables(rewrite.To, variables, func(value string) string {
+			return strings.ReplaceAll(value, "$", "$$")
+		})
+		if err != nil {
+			return keyRewriter{}, err
+		}
+		return keyRewriter{re: re, to: to}, nil
+	default:
+		return keyRewriter{}, fmt.Errorf("unknown rewrite type %q", rewrite.Type)
+	}
+}
+
+// compileValueTransform 校验值转换规则并展开变量
+func compileValueTransform(transform models.ValueTransform, variables map[string]string) (valueTransformer, error) {
+	transformer := valueTransformer{kind: transform.Type}
+	if transform.Match != "" {
+		re, err := compileGlob(transform.Match)
+		if err != nil {
+			return transformer, err
+		}
+		transformer.match = re
+	}
+
+	var err error
+	switch transform.Type {
+	case models.ValueTransformJSONSet:
+		if transform.Path == "" || transform.Path[0] != '/' {
+			return transformer, errors.New("json_set requires a JSON pointer path such as /field")
+		}
+		for _, token := range strings.Split(transform.Path[1:], "/") {
+			transformer.path = append(transformer.path, strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~"))
+		}
+		if len(transform.Value) == 0 {
+			return transformer, errors.New("json_set requires value")
+		}
+		// 变量值按JSON字符串转义，可以放在JSON字符串内使用
+		raw, err := expandVariables(string(transform.Value), variables, func(value string) string {
+			quoted, _ := json.Marshal(value)
+			return string(quoted[1 : len(quoted)-1])
+		})
+		if err != nil {
+			return transformer, err
+		}
+		if err := decodeJSONValue([]byte(raw), &transformer.value); err != nil {
+			return transformer, fmt.Errorf("invalid json_set value: %v", err)
+		}
+	case models.ValueTransformReplace:
+		if transform.From == "" {
+			return transformer, errors.New("replace requires from")
+		}
+		transformer.from = transform.From
+		transformer.to, err = expandVariables(transform.To, variables, literalVariable)
+	case models.ValueTransformRegex:
+		if transformer.re, err = regexp.Compile(transform.From); err != nil {
+			return transformer, err
+		}
+		transformer.to, err = expandVariables(transform.To, variables, func(value string) string {
+			return strings.ReplaceAll(value, "$", "$$")
+		})
+	default:
+		return transformer, fmt.Errorf("unknown value transform type %q", transform.Type)
+	}
+	return transformer, err
+}
+
+// literalVariable 原样插入变量值
+func literalVariable(value string) string {
+	return value
+}
+
+// expandVariables 展开 {{name}} 变量引用，引用未定义的变量时返回错误
+func expandVariables(s string, variables map[string]string, escape func(string) string) (string, error) {
+	var missing string
+	result := templateVariablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := templateVariablePattern.FindStringSubmatch(ref)[1]
+		value, ok := variables[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return ref
+		}
+		return escape(value)
+	})
+	if missing != "" {
+		return "", fmt.Errorf("undefined variable %q", missing)
+	}
+	return result, nil
+}
+
+// Map 返回映射后的键，被过滤掉时ok为false
+func (m *KeyMapper) Map(key string) (string, bool) {
+	if m == nil {
+		return key, true
+	}
+	if !strings.HasPrefix(key, m.mapping.SourcePrefix) {
+		return "", false
+	}
+	for _, re := range m.exclude {
+		if re.MatchString(key) {
+			return "", false
+		}
+	}
+	if len(m.include) > 0 {
+		included := false
+		for _, re := range m.include {
+			if re.MatchString(key) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "", false
+		}
+	}
+
+	target := m.mapping.TargetPrefix + key[len(m.mapping.SourcePrefix):]
+	for _, rewrite := range m.rewrites {
+		if rewrite.re != nil {
+			target = rewrite.re.ReplaceAllString(target, rewrite.to)
+		} else {
+			target = strings.ReplaceAll(target, rewrite.from, rewrite.to)
+		}
+	}
+	return target, true
+}
+
+// TransformsValues 是否配置了值转换
+func (m *KeyMapper) TransformsValues() bool {
+	return m != nil && len(m.values) > 0
+}
+
+// MapValue 按顺序对源键的值应用值转换，json_set只作用于JSON对象值，其他值保持不变
+func (m *KeyMapper) MapValue(key string, value []byte) []byte {
+	if m == nil {
+		return value
+	}
+	for _, transformer := range m.values {
+		if transformer.match != nil && !transformer.match.MatchString(key) {
+			continue
+		}
+		switch transformer.kind {
+		case models.ValueTransformJSONSet:
+			var doc interface{}
+			if decodeJSONValue(value, &doc) != nil {
+				continue
+			}
+			if object, ok := doc.(map[string]interface{}); ok && setJSONPath(object, transformer.path, transformer.value) {
+				if encoded, err := json.Marshal(object); err == nil {
+					value = encoded
+				}
+			}
+		case models.ValueTransformReplace:
+			value = bytes.ReplaceAll(value, []byte(transformer.from), []byte(transformer.to))
+		case models.ValueTransformRegex:
+			value = transformer.re.ReplaceAll(value, []byte(transformer.to))
+		}
+	}
+	return value
+}
+
+// setJSONPath 设置对象中路径对应的字段，缺少的中间对象会被创建，路径经过非对象值时返回false
+// 数组元素可以通过下标修改，但不会扩展数组
+func setJSONPath(object map[string]interface{}, path []string, value interface{}) bool {
+	var current interface{} = object
+	for i, token := range path {
+		last := i == len(path)-1
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if last {
+				node[token] = value
+				return true
+			}
+			child, ok := node[token]
+			if !ok || child == nil {
+				child = map[string]interface{}{}
+				node[token] = child
+			}
+			current = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return false
+			}
+			if last {
+				node[index] = value
+				return true
+			}
+			current = node[index]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// decodeJSONValue 解析JSON值，数字保留原始精度
+func decodeJSONValue(data []byte, v *interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// compileGlob 将glob转换为正则：** 匹配任意字符，* 匹配除"/"外的任意字符，? 匹配除"/"外的单个字符
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("empty glob pattern")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"etcd-admin-backend/internal/models"
+)
+
+func TestKeyMapperMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping models.KeyMapping
+		key     string
+		want    string
+		ok      bool
+	}{
+		{
+			name:    "prefix replaced",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/"},
+			key:     "/dev/app/timeout",
+			want:    "/prod/app/timeout",
+			ok:      true,
+		},
+		{
+			name:    "outside source prefix",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/"},
+			key:     "/staging/app/timeout",
+			ok:      false,
+		},
+		{
+			name:    "target prefix added when source prefix is empty",
+			mapping: models.KeyMapping{TargetPrefix: "/backup"},
+			key:     "/app/timeout",
+			want:    "/backup/app/timeout",
+			ok:      true,
+		},
+		{
+			name:    "source prefix stripped",
+			mapping: models.KeyMapping{SourcePrefix: "/dev"},
+			key:     "/dev/app",
+			want:    "/app",
+			ok:      true,
+		},
+		{
+			name:    "include matches",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Include: []string{"/dev/app/*"}},
+			key:     "/dev/app/timeout",
+			want:    "/prod/app/timeout",
+			ok:      true,
+		},
+		{
+			name:    "include single star does not cross slashes",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Include: []string{"/dev/app/*"}},
+			key:     "/dev/app/db/host",
+			ok:      false,
+		},
+		{
+			name:    "include double star crosses slashes",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Include: []string{"/dev/app/**"}},
+			key:     "/dev/app/db/host",
+			want:    "/prod/app/db/host",
+			ok:      true,
+		},
+		{
+			name:    "not included",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", Include: []string{"/dev/app/**", "/dev/web/**"}},
+			key:     "/dev/worker/threads",
+			ok:      false,
+		},
+		{
+			name:    "any include pattern matches",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Include: []string{"/dev/app/**", "/dev/web/**"}},
+			key:     "/dev/web/port",
+			want:    "/prod/web/port",
+			ok:      true,
+		},
+		{
+			name:    "excluded",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Exclude: []string{"**/secret*"}},
+			key:     "/dev/app/secret_key",
+			ok:      false,
+		},
+		{
+			name:    "exclude takes priority over include",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Include: []string{"/dev/app/**"}, Exclude: []string{"/dev/app/local/**"}},
+			key:     "/dev/app/local/path",
+			ok:      false,
+		},
+		{
+			name:    "question mark matches one character",
+			mapping: models.KeyMapping{Include: []string{"/app/v?"}},
+			key:     "/app/v2",
+			want:    "/app/v2",
+			ok:      true,
+		},
+		{
+			name:    "glob metacharacters are literal",
+			mapping: models.KeyMapping{Include: []string{"/app/a.b"}},
+			key:     "/app/axb",
+			ok:      false,
+		},
+		{
+			name: "literal rewrite after prefix replacement",
+			mapping: models.KeyMapping{SourcePrefix: "/dev/", TargetPrefix: "/prod/", Rewrites: []models.KeyRewrite{
+				{From: "/dev-", To: "/prod-"},
+			}},
+			key:  "/dev/app/dev-db/host",
+			want: "/prod/app/prod-db/host",
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper, err := NewKeyMapper(tt.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := mapper.Map(tt.key)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Map(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKeyMapperZeroMapping(t *testing.T) {
+	mapper, err := NewKeyMapper(models.KeyMapping{})
+	if err != nil || mapper != nil {
+		t.Fatalf("NewKeyMapper(zero) = %v, %v, want nil", mapper, err)
+	}
+	// nil映射原样返回
+	if got, ok := mapper.Map("/any/key"); !ok || got != "/any/key" {
+		t.Errorf("nil Map = %q, %v", got, ok)
+	}
+}
+
+func TestKeyMapperInvalidGlob(t *testing.T) {
+	for _, mapping := range []models.KeyMapping{
+		{Include: []string{""}},
+		{Exclude: []string{""}},
+	} {
+		if _, err := NewKeyMapper(mapping); !errors.Is(err, ErrInvalidKeyMapping) {
+			t.Errorf("NewKeyMapper(%+v) = %v, want ErrInvalidKeyMapping", mapping, err)
+		}
+	}
+}
+
+func TestKeyMapperRewrites(t *testing.T) {
+	variables := map[string]string{"env": "prod", "region": "eu$1"}
+	tests := []struct {
+		name     string
+		rewrites []models.KeyRewrite
+		key      string
+		want     string
+	}{
+		{
+			name:     "regex with groups",
+			rewrites: []models.KeyRewrite{{Type: models.RewriteRegex, From: `^/(\w+)/dev/`, To: "/$1/prod/"}},
+			key:      "/app/dev/timeout",
+			want:     "/app/prod/timeout",
+		},
+		{
+			name:     "literal with variable",
+			rewrites: []models.KeyRewrite{{From: "/dev/", To: "/{{env}}/"}},
+			key:      "/app/dev/timeout",
+			want:     "/app/prod/timeout",
+		},
+		{
+			name:     "regex variable value is not a group reference",
+			rewrites: []models.KeyRewrite{{Type: models.RewriteRegex, From: `/(dev)/`, To: "/{{ region }}/"}},
+			key:      "/app/dev/timeout",
+			want:     "/app/eu$1/timeout",
+		},
+		{
+			name: "rules applied in order",
+			rewrites: []models.KeyRewrite{
+				{From: "dev", To: "staging"},
+				{From: "staging", To: "prod"},
+			},
+			key:  "/dev/app",
+			want: "/prod/app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper, err := NewKeyMapper(models.KeyMapping{Rewrites: tt.rewrites, Variables: variables})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := mapper.Map(tt.key); !ok || got != tt.want {
+				t.Errorf("Map(%q) = %q, %v, want %q", tt.key, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyMapperMapValue(t *testing.T) {
+	variables := map[string]string{"host": `db"prod`}
+	tests := []struct {
+		name      string
+		transform models.ValueTransform
+		key       string
+		value     string
+		want      string
+	}{
+		{
+			name:      "json_set existing field",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/db/port", Value: json.RawMessage(`5432`)},
+			value:     `{"db":{"host":"a","port":3306}}`,
+			want:      `{"db":{"host":"a","port":5432}}`,
+		},
+		{
+			name:      "json_set creates intermediate objects",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/db/pool/size", Value: json.RawMessage(`10`)},
+			value:     `{"name":"app"}`,
+			want:      `{"db":{"pool":{"size":10}},"name":"app"}`,
+		},
+		{
+			name:      "json_set variable escaped inside a string",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/host", Value: json.RawMessage(`"{{host}}"`)},
+			value:     `{"host":"localhost"}`,
+			want:      `{"host":"db\"prod"}`,
+		},
+		{
+			name:      "json_set array index",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/hosts/1", Value: json.RawMessage(`"b"`)},
+			value:     `{"hosts":["a","x"]}`,
+			want:      `{"hosts":["a","b"]}`,
+		},
+		{
+			name:      "json_set does not extend arrays",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/hosts/5", Value: json.RawMessage(`"b"`)},
+			value:     `{"hosts":["a"]}`,
+			want:      `{"hosts":["a"]}`,
+		},
+		{
+			name:      "json_set keeps number precision",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/b", Value: json.RawMessage(`1`)},
+			value:     `{"a":12345678901234567890}`,
+			want:      `{"a":12345678901234567890,"b":1}`,
+		},
+		{
+			name:      "json_set ignores non-object values",
+			transform: models.ValueTransform{Type: models.ValueTransformJSONSet, Path: "/a", Value: json.RawMessage(`1`)},
+			value:     `plain text`,
+			want:      `plain text`,
+		},
+		{
+			name:      "replace",
+			transform: models.ValueTransform{Type: models.ValueTransformReplace, From: "dev.internal", To: "prod.internal"},
+			value:     "db.dev.internal,cache.dev.internal",
+			want:      "db.prod.internal,cache.prod.internal",
+		},
+		{
+			name:      "regex",
+			transform: models.ValueTransform{Type: models.ValueTransformRegex, From: `port=(\d+)`, To: "port=1$1"},
+			value:     "host=db port=5432",
+			want:      "host=db port=15432",
+		},
+		{
+			name:      "match limits the transform to some keys",
+			transform: models.ValueTransform{Type: models.ValueTransformReplace, Match: "/app/db/*", From: "dev", To: "prod"},
+			key:       "/app/cache/host",
+			value:     "dev",
+			want:      "dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper, err := NewKeyMapper(models.KeyMapping{Values: []models.ValueTransform{tt.transform}, Variables: variables})
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := tt.key
+			if key == "" {
+				key = "/app/key"
+			}
+			if got := string(mapper.MapValue(key, []byte(tt.value))); got != tt.want {
+				t.Errorf("MapValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyMapperInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping models.KeyMapping
+	}{
+		{"rewrite without from", models.KeyMapping{Rewrites: []models.KeyRewrite{{To: "/x"}}}},
+		{"unknown rewrite type", models.KeyMapping{Rewrites: []models.KeyRewrite{{Type: "glob", From: "a"}}}},
+		{"invalid regex", models.KeyMapping{Rewrites: []models.KeyRewrite{{Type: models.RewriteRegex, From: "("}}}},
+		{"undefined variable", models.KeyMapping{Rewrites: []models.KeyRewrite{{From: "a", To: "{{missing}}"}}}},
+		{"json_set without pointer", models.KeyMapping{Values: []models.ValueTransform{{Type: models.ValueTransformJSONSet, Path: "db", Value: json.RawMessage(`1`)}}}},
+		{"json_set without value", models.KeyMapping{Values: []models.ValueTransform{{Type: models.ValueTransformJSONSet, Path: "/db"}}}},
+		{"json_set invalid value", models.KeyMapping{Values: []models.ValueTransform{{Type: models.ValueTransformJSONSet, Path: "/db", Value: json.RawMessage(`{`)}}}},
+		{"unknown value transform", models.KeyMapping{Values: []models.ValueTransform{{Type: "upper"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewKeyMapper(tt.mapping); !errors.Is(err, ErrInvalidKeyMapping) {
+			t.Errorf("%s: NewKeyMapper = %v, want ErrInvalidKeyMapping", tt.name, err)
+		}
+	}
+}
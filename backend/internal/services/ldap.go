@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+)
+
+// ErrLDAPInvalidCredentials 用户不存在或密码错误
+var ErrLDAPInvalidCredentials = errors.New("invalid ldap credentials")
+
+// LDAPService LDAP / Active Directory 认证服务
+type LDAPService struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAPService 创建LDAP认证服务
+func NewLDAPService(cfg *config.Config) *LDAPService {
+	return &LDAPService{cfg: cfg.LDAP}
+}
+
+// Enabled 是否启用LDAP认证
+func (s *LDAPService) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+// Login 校验目录账户并返回关联的本地用户，首次登录时按配置自动创建
+func (s *LDAPService) Login(username, password string) (*models.User, error) {
+	identity, err := s.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProvisionExternalUser(identity, mapRole(s.cfg.RoleMapping, identity.Groups), ProvisionOptions{
+		AutoCreate: s.cfg.AutoProvision,
+		AutoLink:   s.cfg.AutoLink,
+	})
+}
+
+// Authenticate 使用服务账户查找用户DN，再以用户身份绑定校验密码
+func (s *LDAPService) Authenticate(username, password string) (*ExternalIdentity, error) {
+	// 空密码会被视为匿名绑定，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := s.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	attributes := []string{"dn", s.cfg.UsernameAttribute, s.cfg.EmailAttribute, "memberOf"}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		s.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(s.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(s.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search failed: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind failed: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider:      models.AuthProviderLDAP,
+		Subject:       strings.ToLower(entry.DN),
+		Username:      entry.GetAttributeValue(s.cfg.UsernameAttribute),
+		Email:         strings.ToLower(entry.GetAttributeValue(s.cfg.EmailAttribute)),
+		EmailVerified: true, // 目录中的邮箱由管理员维护
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+
+	groups, err := s.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+	identity.Groups = groups
+
+	return identity, nil
+}
+
+// dial 建立连接，按配置使用LDAPS或StartTLS
+func (s *LDAPService) dial() (*ldap.Conn, error) {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(s.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap server: %w", err)
+	}
+	conn.SetTimeout(s.cfg.Timeout)
+
+	if s.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService 以服务账户绑定，未配置时使用匿名搜索
+func (s *LDAPService) bindService(conn *ldap.Conn) error {
+	if s.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(s.cfg.BindDN, s.cfg.BindPassword); err != nil {
+		return fmt.Errorf("ldap service account bind failed: %w", err)
+	}
+	return nil
+}
+
+// groups 获取用户所属组名
+func (s *LDAPService) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	// 未配置组搜索时使用memberOf属性
+	if s.cfg.GroupBaseDN == "" {
+		var groups []string
+		for _, groupDN := range entry.GetAttributeValues("memberOf") {
+			groups = append(groups, groupName(groupDN, s.cfg.GroupNameAttribute))
+		}
+		return groups, nil
+	}
+
+	// 搜索组时需要重新以服务账户绑定
+	if err := s.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		s.cfg.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(s.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(s.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)),
+		[]string{s.cfg.GroupNameAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search failed: %w", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		groups = append(groups, group.GetAttributeValue(s.cfg.GroupNameAttribute))
+	}
+	return groups, nil
+}
+
+// tlsConfig 构建TLS配置
+func (s *LDAPService) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: s.cfg.InsecureSkipVerify,
+	}
+
+	if s.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(s.cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ldap ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("invalid ldap ca file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// StartTLS需要ServerName进行证书校验
+	if parsed, err := url.Parse(s.cfg.URL); err == nil {
+		tlsConfig.ServerName = parsed.Hostname()
+	}
+	return tlsConfig, nil
+}
+
+// groupName 从组DN中取出名称属性，如 cn=admins,ou=groups -> admins
+func groupName(groupDN, attribute string) string {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return groupDN
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, attribute) {
+			return attr.Value
+		}
+	}
+	return groupDN
+}
@@ -0,0 +1,502 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+const (
+	testLDAPServiceDN       = "cn=svc,dc=example,dc=com"
+	testLDAPServicePassword = "svc-secret"
+)
+
+// testLDAPEntry 目录条目
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer 进程内的LDAP服务器，支持简单绑定、按过滤器搜索和解绑
+// 只有以服务账户绑定的连接可以搜索，用户绑定后需要重新绑定服务账户
+type testLDAPServer struct {
+	t        *testing.T
+	listener net.Listener
+	entries  []testLDAPEntry
+
+	mu    sync.Mutex
+	binds []string // 成功绑定的DN
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{
+		t:        t,
+		listener: listener,
+		entries: []testLDAPEntry{
+			{dn: testLDAPServiceDN, password: testLDAPServicePassword, attrs: map[string][]string{"cn": {"svc"}}},
+			{
+				dn:       "uid=alice,ou=people,dc=example,dc=com",
+				password: "alice-secret",
+				attrs: map[string][]string{
+					"uid":      {"alice"},
+					"mail":     {"Alice@Example.com"},
+					"memberOf": {"cn=etcd-admins,ou=groups,dc=example,dc=com"},
+				},
+			},
+			{
+				dn:       "uid=bob,ou=people,dc=example,dc=com",
+				password: "bob-secret",
+				attrs: map[string][]string{
+					"uid":      {"bob"},
+					"mail":     {"bob@example.com"},
+					"memberOf": {"cn=developers,ou=groups,dc=example,dc=com"},
+				},
+			},
+			{
+				dn: "cn=etcd-admins,ou=groups,dc=example,dc=com",
+				attrs: map[string][]string{
+					"cn":     {"etcd-admins"},
+					"member": {"uid=alice,ou=people,dc=example,dc=com"},
+				},
+			},
+			{
+				dn: "cn=developers,ou=groups,dc=example,dc=com",
+				attrs: map[string][]string{
+					"cn":     {"developers"},
+					"member": {"uid=alice,ou=people,dc=example,dc=com", "uid=bob,ou=people,dc=example,dc=com"},
+				},
+			},
+		},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+// URL 服务器地址
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// boundDNs 成功绑定过的DN
+func (s *testLDAPServer) boundDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *testLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			s.mu.Lock()
+			if entry := s.find(name); entry != nil && password != "" && entry.password == password {
+				code = ldap.LDAPResultSuccess
+				bound = entry.dn
+				s.binds = append(s.binds, entry.dn)
+			}
+			s.mu.Unlock()
+			s.write(conn, ldapResult(messageID, ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if bound != testLDAPServiceDN {
+				s.write(conn, ldapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			base := strings.ToLower(op.Children[0].Data.String())
+			var attributes []string
+			for _, attr := range op.Children[7].Children {
+				attributes = append(attributes, attr.Data.String())
+			}
+			var results []*ber.Packet
+			s.mu.Lock()
+			for i := range s.entries {
+				entry := &s.entries[i]
+				if strings.HasSuffix(strings.ToLower(entry.dn), base) && entry.matches(op.Children[6]) {
+					results = append(results, entry.packet(messageID, attributes))
+				}
+			}
+			s.mu.Unlock()
+			for _, result := range results {
+				s.write(conn, result)
+			}
+			s.write(conn, ldapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		default:
+			s.t.Errorf("unexpected ldap operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+// setAttr 修改条目的属性，如调整用户所属的组
+func (s *testLDAPServer) setAttr(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.find(dn)
+	if entry == nil {
+		s.t.Fatalf("no ldap entry %s", dn)
+	}
+	entry.attrs[name] = values
+}
+
+// find 按DN查找条目，调用方需持有s.mu
+func (s *testLDAPServer) find(dn string) *testLDAPEntry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].dn, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *testLDAPServer) write(conn net.Conn, packet *ber.Packet) {
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		s.t.Logf("ldap write failed: %v", err)
+	}
+}
+
+// matches 条目是否符合过滤器，支持与、或、非、相等和存在
+func (e *testLDAPEntry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if e.matches(child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !e.matches(filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		for _, value := range e.values(filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(e.values(filter.Data.String())) > 0
+	}
+	return false
+}
+
+func (e *testLDAPEntry) values(attribute string) []string {
+	for name, values := range e.attrs {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// packet 编码为SearchResultEntry，只包含请求的属性
+func (e *testLDAPEntry) packet(messageID int64, attributes []string) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range attributes {
+		values := e.values(name)
+		if len(values) == 0 {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	entry.AppendChild(attrs)
+	return ldapMessage(messageID, entry)
+}
+
+// ldapResult 编码只包含结果码的响应
+func ldapResult(messageID int64, application ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(messageID, result)
+}
+
+func ldapMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+// newTestDB 在临时目录中创建sqlite数据库
+func newTestDB(t *testing.T) {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")}}
+	if err := database.InitDatabase(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestLDAPService(server *testLDAPServer, configure func(cfg *config.LDAPConfig)) *LDAPService {
+	cfg := &config.Config{LDAP: config.LDAPConfig{
+		Enabled:            true,
+		URL:                server.URL(),
+		BindDN:             testLDAPServiceDN,
+		BindPassword:       testLDAPServicePassword,
+		BaseDN:             "ou=people,dc=example,dc=com",
+		UserFilter:         "(uid=%s)",
+		UsernameAttribute:  "uid",
+		EmailAttribute:     "mail",
+		GroupNameAttribute: "cn",
+		GroupFilter:        "(member=%s)",
+		AutoProvision:      true,
+		Timeout:            5 * time.Second,
+	}}
+	if configure != nil {
+		configure(&cfg.LDAP)
+	}
+	return NewLDAPService(cfg)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, nil)
+
+	identity, err := service.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ExternalIdentity{
+		Provider:      models.AuthProviderLDAP,
+		Subject:       "uid=alice,ou=people,dc=example,dc=com",
+		Username:      "alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Groups:        []string{"etcd-admins"},
+	}
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+	if binds := server.boundDNs(); !reflect.DeepEqual(binds, []string{testLDAPServiceDN, "uid=alice,ou=people,dc=example,dc=com"}) {
+		t.Errorf("binds = %v, want the service account followed by the user", binds)
+	}
+}
+
+func TestLDAPAuthenticateRejectsInvalidCredentials(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, nil)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "wrong password", username: "alice", password: "wrong"},
+		{name: "unknown user", username: "carol", password: "carol-secret"},
+		{name: "empty password", username: "alice", password: ""},
+		{name: "filter injection", username: "*", password: "alice-secret"},
+		{name: "filter injection with parentheses", username: "alice)(uid=*", password: "alice-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Authenticate(tt.username, tt.password); !errors.Is(err, ErrLDAPInvalidCredentials) {
+				t.Errorf("err = %v, want ErrLDAPInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticateGroupSearch(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, func(cfg *config.LDAPConfig) {
+		cfg.GroupBaseDN = "ou=groups,dc=example,dc=com"
+	})
+
+	// 组搜索需要在用户绑定后重新以服务账户绑定
+	identity, err := service.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"etcd-admins", "developers"}; !reflect.DeepEqual(identity.Groups, want) {
+		t.Errorf("groups = %v, want %v", identity.Groups, want)
+	}
+}
+
+func TestLDAPLoginRoleMapping(t *testing.T) {
+	newTestDB(t)
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, func(cfg *config.LDAPConfig) {
+		cfg.RoleMapping = map[string]string{"etcd-admins": models.RoleAdmin}
+	})
+
+	alice, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Role != models.RoleAdmin || alice.AuthProvider != models.AuthProviderLDAP || alice.Username != "alice" {
+		t.Errorf("alice = role %q provider %q username %q, want an admin provisioned from ldap", alice.Role, alice.AuthProvider, alice.Username)
+	}
+
+	// 未映射的组使用默认角色
+	bob, err := service.Login("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Role != models.RoleUser {
+		t.Errorf("bob role = %q, want %q", bob.Role, models.RoleUser)
+	}
+
+	// 再次登录使用已关联的账户
+	again, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != alice.ID {
+		t.Errorf("second login returned user %d, want %d", again.ID, alice.ID)
+	}
+
+	// 从映射的组中移除后，下次登录降级为普通用户
+	server.setAttr("uid=alice,ou=people,dc=example,dc=com", "memberOf", "cn=developers,ou=groups,dc=example,dc=com")
+	demoted, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored models.User
+	if err := database.GetDB().First(&stored, alice.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if demoted.ID != alice.ID || stored.Role != models.RoleUser {
+		t.Errorf("after leaving etcd-admins: user %d role %q, want user %d with role %q", demoted.ID, stored.Role, alice.ID, models.RoleUser)
+	}
+
+	// 重新加入后再次提升
+	server.setAttr("uid=alice,ou=people,dc=example,dc=com", "memberOf", "cn=etcd-admins,ou=groups,dc=example,dc=com")
+	promoted, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Role != models.RoleAdmin {
+		t.Errorf("role after rejoining etcd-admins = %q, want %q", promoted.Role, models.RoleAdmin)
+	}
+}
+
+func TestLDAPLoginWithoutRoleMappingKeepsRole(t *testing.T) {
+	newTestDB(t)
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, nil)
+
+	alice, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未配置映射时由管理员手动设置的角色不被覆盖
+	if err := database.GetDB().Model(alice).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	again, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Role != models.RoleAdmin {
+		t.Errorf("role = %q, want the manually assigned %q", again.Role, models.RoleAdmin)
+	}
+}
+
+func TestLDAPLoginWithoutAutoProvision(t *testing.T) {
+	newTestDB(t)
+	server := newTestLDAPServer(t)
+	service := newTestLDAPService(server, func(cfg *config.LDAPConfig) {
+		cfg.AutoProvision = false
+	})
+
+	if _, err := service.Login("alice", "alice-secret"); !errors.Is(err, ErrIdentityNotAllowed) {
+		t.Errorf("err = %v, want ErrIdentityNotAllowed", err)
+	}
+}
+
+func TestLDAPLoginDoesNotTakeOverLocalAccount(t *testing.T) {
+	newTestDB(t)
+	server := newTestLDAPServer(t)
+	local := models.User{Username: "alice", Email: "alice@example.com", Password: "password123", Role: models.RoleUser, IsActive: true}
+	if err := database.GetDB().Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestLDAPService(server, func(cfg *config.LDAPConfig) {
+		cfg.RoleMapping = map[string]string{"etcd-admins": models.RoleAdmin}
+	})
+	if _, err := service.Login("alice", "alice-secret"); !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("err = %v, want ErrIdentityConflict", err)
+	}
+
+	// 开启自动关联后现有账户关联目录身份，角色按映射同步
+	service = newTestLDAPService(server, func(cfg *config.LDAPConfig) {
+		cfg.AutoLink = true
+		cfg.RoleMapping = map[string]string{"etcd-admins": models.RoleAdmin}
+	})
+	user, err := service.Login("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("signed in as user %d, want the existing user %d", user.ID, local.ID)
+	}
+	var stored models.User
+	if err := database.GetDB().First(&stored, local.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.AuthProvider != models.AuthProviderLDAP || stored.ExternalID != "uid=alice,ou=people,dc=example,dc=com" || stored.Role != models.RoleAdmin {
+		t.Errorf("linked account = provider %q external_id %q role %q", stored.AuthProvider, stored.ExternalID, stored.Role)
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// LoginGuard 登录失败计数与锁定
+type LoginGuard struct {
+	cfg config.LoginConfig
+}
+
+// NewLoginGuard 创建登录保护服务
+func NewLoginGuard(cfg *config.Config) *LoginGuard {
+	return &LoginGuard{cfg: cfg.Login}
+}
+
+// Check 检查用户名和IP是否处于锁定或退避期，返回需要等待的时间
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+	var attempts []models.LoginAttempt
+	if err := database.GetDB().Where("`key` IN ?", []string{userAttemptKey(username), ipAttemptKey(ip)}).
+		Find(&attempts).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	now := time.Now()
+	for _, attempt := range attempts {
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			if remaining := attempt.LockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure 记录一次失败，返回用户名是否因此被锁定
+func (g *LoginGuard) RecordFailure(username, ip string) (bool, error) {
+	locked, err := g.recordFailure(userAttemptKey(username), g.cfg.MaxUserFailures)
+	if err != nil {
+		return false, err
+	}
+	if _, err := g.recordFailure(ipAttemptKey(ip), g.cfg.MaxIPFailures); err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+// RecordSuccess 登录成功后清除用户名的失败计数
+// IP计数不清除，避免攻击者用自己的账户重置计数
+func (g *LoginGuard) RecordSuccess(username string) error {
+	return g.clear(userAttemptKey(username))
+}
+
+// UnlockUser 管理员解除用户名锁定
+func (g *LoginGuard) UnlockUser(username string) error {
+	return g.clear(userAttemptKey(username))
+}
+
+// UnlockIP 管理员解除IP锁定
+func (g *LoginGuard) UnlockIP(ip string) error {
+	return g.clear(ipAttemptKey(ip))
+}
+
+// recordFailure 递增失败计数并计算下一次允许尝试的时间
+// 计数在数据库中原子递增，更新持有行锁直到事务结束，锁定判断基于本次递增后的值，
+// 并发的失败请求不会丢失计数，也只有一个请求会触发锁定
+func (g *LoginGuard) recordFailure(key string, maxFailures int) (bool, error) {
+	locked := false
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		// 超过统计窗口重新计数
+		if err := tx.Model(&models.LoginAttempt{}).Where("`key` = ?", key).UpdateColumns(map[string]interface{}{
+			"failures": gorm.Expr("CASE WHEN last_failure_at IS NOT NULL AND last_failure_at < ? THEN 1 ELSE failures + 1 END",
+				now.Add(-g.cfg.FailureWindow)),
+			"last_failure_at": now,
+			"updated_at":      now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var attempt models.LoginAttempt
+		if err := tx.Where("`key` = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+
+		// 指数退避，达到上限后锁定
+		delay := g.cfg.LockoutDuration
+		if attempt.Failures < maxFailures {
+			backoff := float64(g.cfg.BackoffBase) * math.Pow(2, float64(attempt.Failures-1))
+			if backoff < float64(delay) {
+				delay = time.Duration(backoff)
+			}
+		} else {
+			locked = attempt.Failures == maxFailures
+		}
+		return tx.Model(&models.LoginAttempt{}).Where("`key` = ?", key).
+			UpdateColumn("locked_until", now.Add(delay)).Error
+	})
+	return locked, err
+}
+
+// clear 删除计数记录
+func (g *LoginGuard) clear(key string) error {
+	return database.GetDB().Where("`key` = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+func TestLoginGuardConcurrentFailures(t *testing.T) {
+	// 并发写入时等待SQLite的写锁，而不是立即返回database is locked
+	path := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000"
+	if err := database.InitDatabase(&config.Config{Database: config.DatabaseConfig{Type: "sqlite", Path: path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	const maxFailures = 5
+	const requests = 20
+	guard := NewLoginGuard(&config.Config{Login: config.LoginConfig{
+		MaxUserFailures: maxFailures,
+		MaxIPFailures:   100,
+		BackoffBase:     time.Second,
+		LockoutDuration: time.Hour,
+		FailureWindow:   time.Hour,
+	}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	lockedCount := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locked, err := guard.RecordFailure("alice", "10.0.0.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if locked {
+				mu.Lock()
+				lockedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 每次失败都被计数，只有达到上限的那一次报告锁定
+	var attempts []models.LoginAttempt
+	if err := database.GetDB().Order("`key`").Find(&attempts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].Failures != requests || attempts[1].Failures != requests {
+		t.Errorf("attempts = %+v, want %d failures per key", attempts, requests)
+	}
+	if lockedCount != 1 {
+		t.Errorf("locked reported %d times, want 1", lockedCount)
+	}
+
+	wait, err := guard.Check("alice", "10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 59*time.Minute {
+		t.Errorf("wait = %v, want lockout", wait)
+	}
+
+	// 超过统计窗口后重新计数
+	old := time.Now().Add(-2 * time.Hour)
+	if err := database.GetDB().Model(&models.LoginAttempt{}).Where("`key` = ?", userAttemptKey("alice")).
+		UpdateColumn("last_failure_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guard.RecordFailure("alice", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	var attempt models.LoginAttempt
+	if err := database.GetDB().Where("`key` = ?", userAttemptKey("alice")).First(&attempt).Error; err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 1 {
+		t.Errorf("failures after window = %d, want 1", attempt.Failures)
+	}
+}
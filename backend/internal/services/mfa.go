@@ -0,0 +1,324 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+	"etcd-admin-backend/pkg/secrets"
+)
+
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	recoveryCodeCount = 10
+
+	// MFA策略在settings表中的键
+	settingMFARequireAdmin           = "mfa.require_admin"
+	settingMFARequireProductionWrite = "mfa.require_production_write"
+)
+
+var (
+	// ErrMFAInvalidCode 验证码无效
+	ErrMFAInvalidCode = errors.New("invalid verification code")
+	// ErrMFANotEnrolled 用户尚未开始绑定
+	ErrMFANotEnrolled = errors.New("mfa enrollment has not been started")
+	// ErrMFARequired 策略要求启用MFA，不能关闭
+	ErrMFARequired = errors.New("mfa is required by policy")
+)
+
+// MFAPolicy 管理员配置的MFA策略
+type MFAPolicy struct {
+	RequireAdmin           bool `json:"require_admin"`            // 管理员必须启用MFA
+	RequireProductionWrite bool `json:"require_production_write"` // 可写入生产连接的用户必须启用MFA
+}
+
+// MFAEnrollment MFA绑定信息
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // 可直接生成二维码
+}
+
+// MFAService TOTP两步验证服务
+type MFAService struct {
+	issuer string
+}
+
+// NewMFAService 创建MFA服务
+func NewMFAService() *MFAService {
+	return &MFAService{issuer: "etcd-admin"}
+}
+
+// GetPolicy 读取MFA策略
+func (s *MFAService) GetPolicy() (*MFAPolicy, error) {
+	requireAdmin, err := models.GetSetting(database.GetDB(), settingMFARequireAdmin)
+	if err != nil {
+		return nil, err
+	}
+	requireProduction, err := models.GetSetting(database.GetDB(), settingMFARequireProductionWrite)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAPolicy{
+		RequireAdmin:           requireAdmin == "true",
+		RequireProductionWrite: requireProduction == "true",
+	}, nil
+}
+
+// SavePolicy 保存MFA策略
+func (s *MFAService) SavePolicy(policy *MFAPolicy) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.SetSetting(tx, settingMFARequireAdmin, fmt.Sprintf("%t", policy.RequireAdmin)); err != nil {
+			return err
+		}
+		return models.SetSetting(tx, settingMFARequireProductionWrite, fmt.Sprintf("%t", policy.RequireProductionWrite))
+	})
+}
+
+// IsRequired 判断策略是否要求该用户启用MFA
+func (s *MFAService) IsRequired(user *models.User) (bool, error) {
+	policy, err := s.GetPolicy()
+	if err != nil {
+		return false, err
+	}
+
+	if policy.RequireAdmin && user.Role == models.RoleAdmin {
+		return true, nil
+	}
+
+	if policy.RequireProductionWrite {
+		// 所有用户都可写入非只读连接，存在可写的生产连接即要求MFA
+		var count int64
+		if err := database.GetDB().Model(&models.Connection{}).
+			Where("is_production = ? AND is_readonly = ?", true, false).
+			Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Enroll 为用户生成新的TOTP密钥，验证通过前不生效
+func (s *MFAService) Enroll(user *models.User) (*MFAEnrollment, error) {
+	secretBytes := make([]byte, 20)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secretBytes)
+
+	// UpdateColumns不经过模型钩子，需自行加密
+	encrypted, err := secrets.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt mfa secret: %w", err)
+	}
+	if err := database.GetDB().Model(user).UpdateColumns(map[string]interface{}{
+		"mfa_secret":  encrypted,
+		"mfa_enabled": false,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save mfa secret: %w", err)
+	}
+	user.MFASecret = secret
+
+	label := url.PathEscape(s.issuer + ":" + user.Username)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// Activate 校验首个验证码并启用MFA，返回恢复码
+func (s *MFAService) Activate(user *models.User, code string) ([]string, error) {
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := validateTOTP(user.MFASecret, code, time.Now(), user.MFALastStep)
+	if !ok {
+		return nil, ErrMFAInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := database.GetDB().Model(user).Where("mfa_last_step < ?", step).UpdateColumns(map[string]interface{}{
+		"mfa_enabled":        true,
+		"mfa_last_step":      step,
+		"mfa_recovery_codes": hashes,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", result.Error)
+	}
+	// 并发请求已使用了该验证码
+	if result.RowsAffected == 0 {
+		return nil, ErrMFAInvalidCode
+	}
+	return codes, nil
+}
+
+// Verify 校验登录时提交的验证码或恢复码，恢复码使用后失效
+func (s *MFAService) Verify(user *models.User, code, recoveryCode string) error {
+	if !user.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+
+	if recoveryCode != "" {
+		return s.consumeRecoveryCode(user, recoveryCode)
+	}
+
+	step, ok := validateTOTP(user.MFASecret, code, time.Now(), user.MFALastStep)
+	if !ok {
+		return ErrMFAInvalidCode
+	}
+	// 记录已使用的时间步，防止验证码重放；条件更新保证同一验证码只能被一个请求使用
+	result := database.GetDB().Model(user).Where("mfa_last_step < ?", step).UpdateColumn("mfa_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAInvalidCode
+	}
+	return nil
+}
+
+// Disable 关闭用户的MFA，force为true时跳过策略检查（管理员重置）
+func (s *MFAService) Disable(user *models.User, force bool) error {
+	if !force {
+		required, err := s.IsRequired(user)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrMFARequired
+		}
+	}
+
+	return database.GetDB().Model(user).UpdateColumns(map[string]interface{}{
+		"mfa_enabled":        false,
+		"mfa_secret":         "",
+		"mfa_last_step":      0,
+		"mfa_recovery_codes": "",
+	}).Error
+}
+
+// consumeRecoveryCode 校验并作废恢复码
+func (s *MFAService) consumeRecoveryCode(user *models.User, recoveryCode string) error {
+	var hashes []string
+	if user.MFARecoveryCodes != "" {
+		if err := json.Unmarshal([]byte(user.MFARecoveryCodes), &hashes); err != nil {
+			return fmt.Errorf("invalid stored recovery codes: %w", err)
+		}
+	}
+
+	hash := hashRecoveryCode(recoveryCode)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+			continue
+		}
+		remaining, _ := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+		// 恢复码列表在读取后被修改时说明并发请求已使用了恢复码
+		result := database.GetDB().Model(user).Where("mfa_recovery_codes = ?", user.MFARecoveryCodes).
+			UpdateColumn("mfa_recovery_codes", string(remaining))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMFAInvalidCode
+		}
+		return nil
+	}
+	return ErrMFAInvalidCode
+}
+
+// generateRecoveryCodes 生成恢复码及其哈希（JSON数组）
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		raw := hex.EncodeToString(buf)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	encoded, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(encoded), nil
+}
+
+// hashRecoveryCode 计算恢复码哈希
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// validateTOTP 校验TOTP验证码，允许前后一个时间步的偏差，返回匹配的时间步
+func validateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode 按RFC 6238计算指定时间步的验证码
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+	"etcd-admin-backend/pkg/secrets"
+)
+
+// newTestKeyring 设置测试用的全局密钥环
+func newTestKeyring(t *testing.T) {
+	t.Helper()
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	keyring, err := secrets.LoadKeyring(config.EncryptionConfig{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets.SetDefault(keyring)
+	t.Cleanup(func() { secrets.SetDefault(nil) })
+}
+
+// testTOTPCode 计算当前时间偏移offset个时间步的验证码
+func testTOTPCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+// loadTestUser 重新读取用户，模拟并发请求各自持有的副本
+func loadTestUser(t *testing.T, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := database.GetDB().First(&user, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestMFASecretEncrypted(t *testing.T) {
+	newTestDB(t)
+	newTestKeyring(t)
+	service := NewMFAService()
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "password123", Role: models.RoleUser, IsActive: true}
+	if err := database.GetDB().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	enrollment, err := service.Enroll(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := database.GetDB().Table("users").Select("mfa_secret").Where("id = ?", user.ID).Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsEncrypted(stored) || strings.Contains(stored, enrollment.Secret) {
+		t.Errorf("stored mfa_secret = %q, want ciphertext", stored)
+	}
+	if got := loadTestUser(t, user.ID).MFASecret; got != enrollment.Secret {
+		t.Errorf("loaded mfa_secret = %q, want %q", got, enrollment.Secret)
+	}
+
+	// 保存用户时密钥保持加密
+	reloaded := loadTestUser(t, user.ID)
+	reloaded.Email = "alice@example.org"
+	if err := database.GetDB().Save(reloaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.GetDB().Table("users").Select("mfa_secret").Where("id = ?", user.ID).Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsEncrypted(stored) || reloaded.MFASecret != enrollment.Secret {
+		t.Errorf("after save: stored %q, in memory %q", stored, reloaded.MFASecret)
+	}
+}
+
+func TestMFAVerifySingleUse(t *testing.T) {
+	newTestDB(t)
+	service := NewMFAService()
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "password123", Role: models.RoleUser, IsActive: true}
+	if err := database.GetDB().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := service.Enroll(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := service.Activate(loadTestUser(t, user.ID), testTOTPCode(t, enrollment.Secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个请求在任一请求记录时间步之前读取了用户
+	first, second := loadTestUser(t, user.ID), loadTestUser(t, user.ID)
+	code := testTOTPCode(t, enrollment.Secret, 1)
+	if err := service.Verify(first, code, ""); err != nil {
+		t.Fatalf("first Verify: %v", err)
+	}
+	if err := service.Verify(second, code, ""); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("concurrent Verify with the same code = %v, want ErrMFAInvalidCode", err)
+	}
+	if err := service.Verify(loadTestUser(t, user.ID), code, ""); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("replayed Verify = %v, want ErrMFAInvalidCode", err)
+	}
+
+	// 恢复码同样只能使用一次
+	first, second = loadTestUser(t, user.ID), loadTestUser(t, user.ID)
+	if err := service.Verify(first, "", codes[0]); err != nil {
+		t.Fatalf("first recovery code: %v", err)
+	}
+	if err := service.Verify(second, "", codes[0]); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("concurrent recovery code = %v, want ErrMFAInvalidCode", err)
+	}
+	if err := service.Verify(loadTestUser(t, user.ID), "", codes[1]); err != nil {
+		t.Errorf("unused recovery code: %v", err)
+	}
+}
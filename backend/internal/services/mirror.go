@@ -0,0 +1,624 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrInvalidMirror 镜像配置错误
+	ErrInvalidMirror = errors.New("invalid mirror")
+	// ErrMirrorNotRunning 镜像未在运行
+	ErrMirrorNotRunning = errors.New("mirror is not running")
+)
+
+// 镜像运行阶段
+const (
+	MirrorPhaseSyncing  = "syncing"  // 全量同步
+	MirrorPhaseWatching = "watching" // 跟随源的变更
+	MirrorPhaseRetrying = "retrying" // 出错后等待重试
+)
+
+const (
+	// mirrorSaveInterval 保存已应用revision的最小间隔，重启后最多重放这段时间内的事件
+	mirrorSaveInterval = time.Second
+	// mirrorProgressInterval 请求Watch进度通知的间隔，源前缀没有变更时已应用的revision也能跟上源
+	mirrorProgressInterval = 5 * time.Second
+	// 出错后重试的等待时间，每次翻倍
+	mirrorMinBackoff = time.Second
+	mirrorMaxBackoff = time.Minute
+)
+
+// MirrorState 镜像的运行状态，只保存在内存中
+type MirrorState struct {
+	Phase           string     `json:"phase"`
+	AppliedRevision int64      `json:"applied_revision"`
+	EventsApplied   int64      `json:"events_applied"` // 本次启动后应用的事件数
+	LastAppliedAt   *time.Time `json:"last_applied_at"`
+	LastError       string     `json:"last_error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+}
+
+// mirrorRunner 运行中的镜像
+type mirrorRunner struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	state   MirrorState
+	failing bool // 已发送mirror.failed，恢复同步时发送mirror.recovered
+}
+
+// MirrorService 在后台运行连接间的单向镜像：先全量同步，再通过Watch跟随源的变更
+// 已应用的revision保存在数据库中，重启后从该revision继续
+type MirrorService struct {
+	etcdService    *EtcdService
+	webhookService *WebhookService
+
+	mu      sync.Mutex
+	runners map[uint]*mirrorRunner // mirror_id -> 运行中的镜像
+}
+
+// NewMirrorService 创建镜像服务
+func NewMirrorService(etcdService *EtcdService, webhookService *WebhookService) *MirrorService {
+	return &MirrorService{
+		etcdService:    etcdService,
+		webhookService: webhookService,
+		runners:        make(map[uint]*mirrorRunner),
+	}
+}
+
+// Start 启动所有运行状态的镜像
+func (s *MirrorService) Start() error {
+	var mirrors []models.Mirror
+	if err := database.GetDB().Where("status = ?", models.MirrorRunning).Find(&mirrors).Error; err != nil {
+		return fmt.Errorf("failed to load mirrors: %w", err)
+	}
+	for i := range mirrors {
+		s.start(&mirrors[i])
+	}
+	log.Printf("Mirror service started with %d mirrors", len(mirrors))
+	return nil
+}
+
+// Stop 停止所有镜像，保留其状态以便重启后继续
+func (s *MirrorService) Stop() {
+	s.mu.Lock()
+	ids := make([]uint, 0, len(s.runners))
+	for id := range s.runners {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		s.halt(id)
+	}
+}
+
+// ValidateMirror 校验镜像配置，同一连接上源前缀和目标前缀不能相互包含，否则写入会再次触发同步
+func (s *MirrorService) ValidateMirror(mirror *models.Mirror) error {
+	if mirror.SourceConnectionID == mirror.TargetConnectionID &&
+		(strings.HasPrefix(mirror.SourcePrefix, mirror.TargetPrefix) || strings.HasPrefix(mirror.TargetPrefix, mirror.SourcePrefix)) {
+		return fmt.Errorf("%w: source and target prefixes overlap on the same connection", ErrInvalidMirror)
+	}
+	return nil
+}
+
+// Create 保存镜像并开始同步
+func (s *MirrorService) Create(mirror *models.Mirror) error {
+	if err := s.ValidateMirror(mirror); err != nil {
+		return err
+	}
+	mirror.Status = models.MirrorRunning
+	mirror.Revision = 0
+	if err := database.GetDB().Create(mirror).Error; err != nil {
+		return err
+	}
+	s.emit(mirror, WebhookEventMirrorStatusChanged, "")
+	s.start(mirror)
+	return nil
+}
+
+// Pause 暂停镜像，恢复时从已应用的revision继续
+func (s *MirrorService) Pause(mirror *models.Mirror) error {
+	if mirror.Status != models.MirrorRunning {
+		return ErrMirrorNotRunning
+	}
+	s.halt(mirror.ID)
+	return s.setStatus(mirror, models.MirrorPaused)
+}
+
+// Resume 恢复暂停或停止的镜像，停止过的镜像会重新全量同步
+func (s *MirrorService) Resume(mirror *models.Mirror) error {
+	if mirror.Status == models.MirrorRunning {
+		return nil
+	}
+	if err := s.setStatus(mirror, models.MirrorRunning); err != nil {
+		return err
+	}
+	s.start(mirror)
+	return nil
+}
+
+// StopMirror 停止镜像并清除已应用的revision
+func (s *MirrorService) StopMirror(mirror *models.Mirror) error {
+	s.halt(mirror.ID)
+	mirror.Revision = 0
+	if err := database.GetDB().Model(mirror).Update("revision", 0).Error; err != nil {
+		return err
+	}
+	return s.setStatus(mirror, models.MirrorStopped)
+}
+
+// Delete 停止并删除镜像，目标中已同步的键保留
+func (s *MirrorService) Delete(mirror *models.Mirror) error {
+	s.halt(mirror.ID)
+	if err := database.GetDB().Delete(mirror).Error; err != nil {
+		return err
+	}
+	deleted := *mirror
+	deleted.Status = "deleted"
+	s.emit(&deleted, WebhookEventMirrorStatusChanged, "")
+	return nil
+}
+
+// State 获取运行状态，未运行时返回nil
+func (s *MirrorService) State(mirrorID uint) *MirrorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runner, ok := s.runners[mirrorID]
+	if !ok {
+		return nil
+	}
+	state := runner.state
+	return &state
+}
+
+// SourceRevision 获取源集群当前的revision，与已应用的revision之差即为同步延迟
+func (s *MirrorService) SourceRevision(ctx context.Context, mirror *models.Mirror) (int64, error) {
+	var source models.Connection
+	if err := database.GetDB().First(&source, mirror.SourceConnectionID).Error; err != nil {
+		return 0, fmt.Errorf("source connection not found: %w", err)
+	}
+	client, release, err := s.etcdService.Acquire(ctx, &source)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	reqCtx, cancel := context.WithTimeout(ctx, source.RequestTimeoutDuration())
+	defer cancel()
+	resp, err := client.Get(reqCtx, "\x00", clientv3.WithCountOnly())
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	return resp.Header.Revision, nil
+}
+
+// setStatus 更新镜像状态
+func (s *MirrorService) setStatus(mirror *models.Mirror, status string) error {
+	mirror.Status = status
+	if err := database.GetDB().Model(mirror).Update("status", status).Error; err != nil {
+		return err
+	}
+	s.emit(mirror, WebhookEventMirrorStatusChanged, "")
+	return nil
+}
+
+// emit 向目标连接的Webhook发送镜像事件
+func (s *MirrorService) emit(mirror *models.Mirror, event, lastError string) {
+	data := map[string]interface{}{
+		"mirror_id":            mirror.ID,
+		"name":                 mirror.Name,
+		"status":               mirror.Status,
+		"source_connection_id": mirror.SourceConnectionID,
+		"source_prefix":        mirror.SourcePrefix,
+		"target_prefix":        mirror.TargetPrefix,
+		"revision":             mirror.Revision,
+	}
+	if lastError != "" {
+		data["error"] = lastError
+	}
+	s.webhookService.Emit(mirror.TargetConnectionID, event, "", data)
+}
+
+// start 在后台运行镜像，已在运行时忽略
+func (s *MirrorService) start(mirror *models.Mirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.runners[mirror.ID]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &mirrorRunner{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		state: MirrorState{
+			AppliedRevision: mirror.Revision,
+			StartedAt:       time.Now(),
+		},
+	}
+	s.runners[mirror.ID] = runner
+
+	m := *mirror
+	go s.run(ctx, &m, runner)
+}
+
+// halt 停止运行中的镜像并等待退出
+func (s *MirrorService) halt(mirrorID uint) {
+	s.mu.Lock()
+	runner, ok := s.runners[mirrorID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	runner.cancel()
+	<-runner.done
+}
+
+// run 运行镜像直到被停止，出错时按指数退避重试
+func (s *MirrorService) run(ctx context.Context, mirror *models.Mirror, runner *mirrorRunner) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.runners, mirror.ID)
+		s.mu.Unlock()
+		close(runner.done)
+	}()
+
+	backoff := mirrorMinBackoff
+	for {
+		startedAt := time.Now()
+		err := s.mirror(ctx, mirror, runner)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrClientRetired) {
+			// 连接配置变更或客户端被回收，立即用新的客户端继续
+			backoff = mirrorMinBackoff
+			continue
+		}
+
+		log.Printf("Mirror %d failed: %v", mirror.ID, err)
+		failing := false
+		s.update(runner, func(state *MirrorState) {
+			state.Phase = MirrorPhaseRetrying
+			state.LastError = err.Error()
+			failing, runner.failing = runner.failing, true
+		})
+		database.GetDB().Model(mirror).Update("last_error", err.Error())
+		if !failing {
+			s.emit(mirror, WebhookEventMirrorFailed, err.Error())
+		}
+
+		// 运行了较长时间后才出错时从最短的等待时间开始
+		if time.Since(startedAt) > mirrorMaxBackoff {
+			backoff = mirrorMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, mirrorMaxBackoff)
+	}
+}
+
+// mirror 需要时先全量同步，然后从已应用的revision之后开始Watch源前缀并写入目标
+func (s *MirrorService) mirror(ctx context.Context, mirror *models.Mirror, runner *mirrorRunner) error {
+	var source, target models.Connection
+	if err := database.GetDB().First(&source, mirror.SourceConnectionID).Error; err != nil {
+		return fmt.Errorf("source connection not found: %w", err)
+	}
+	if err := database.GetDB().First(&target, mirror.TargetConnectionID).Error; err != nil {
+		return fmt.Errorf("target connection not found: %w", err)
+	}
+
+	if mirror.Revision == 0 {
+		s.update(runner, func(state *MirrorState) {
+			state.Phase = MirrorPhaseSyncing
+		})
+		revision, err := s.initialSync(ctx, mirror, &source, &target)
+		if err != nil {
+			return fmt.Errorf("initial sync failed: %w", err)
+		}
+		now := time.Now()
+		mirror.Revision = revision
+		mirror.LastSyncedAt = &now
+		if err := database.GetDB().Model(mirror).Updates(map[string]interface{}{
+			"revision":       revision,
+			"last_synced_at": now,
+			"last_error":     "",
+		}).Error; err != nil {
+			return err
+		}
+		s.update(runner, func(state *MirrorState) {
+			state.AppliedRevision = revision
+			state.LastError = ""
+		})
+	}
+
+	sourceClient, releaseSource, err := s.etcdService.Acquire(ctx, &source)
+	if err != nil {
+		return err
+	}
+	defer releaseSource()
+	targetClient, releaseTarget, err := s.etcdService.Acquire(ctx, &target)
+	if err != nil {
+		return err
+	}
+	defer releaseTarget()
+
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	watch := sourceClient.Watch(watchCtx, mirror.SourcePrefix,
+		clientv3.WithPrefix(), clientv3.WithRev(mirror.Revision+1), clientv3.WithProgressNotify())
+	s.update(runner, func(state *MirrorState) {
+		state.Phase = MirrorPhaseWatching
+	})
+	// 连接配置变更或健康检查失败后客户端被移出连接池，结束Watch并用新的客户端重新开始
+	sourceRetired := s.etcdService.Retired(sourceClient)
+	targetRetired := s.etcdService.Retired(targetClient)
+	retired := func() bool {
+		select {
+		case <-sourceRetired:
+			return true
+		case <-targetRetired:
+			return true
+		default:
+			return false
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(mirrorProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-sourceRetired:
+				cancel()
+				return
+			case <-targetRetired:
+				cancel()
+				return
+			case <-ticker.C:
+				sourceClient.RequestProgress(watchCtx)
+			}
+		}
+	}()
+
+	saved := mirror.Revision
+	lastSave := time.Now()
+	save := func() error {
+		if mirror.Revision == saved {
+			return nil
+		}
+		if err := database.GetDB().Model(mirror).Updates(map[string]interface{}{
+			"revision":   mirror.Revision,
+			"last_error": "",
+		}).Error; err != nil {
+			return err
+		}
+		saved = mirror.Revision
+		lastSave = time.Now()
+		return nil
+	}
+	// 退出时保存最后应用的revision
+	defer save()
+
+	for resp := range watch {
+		if resp.CompactRevision != 0 {
+			// 需要的历史已被压缩，下次重试时重新全量同步
+			mirror.Revision = 0
+			saved = -1
+			return fmt.Errorf("source revision %d has been compacted, resyncing", resp.CompactRevision)
+		}
+		if err := resp.Err(); err != nil {
+			if retired() {
+				return ErrClientRetired
+			}
+			return classifyError(err)
+		}
+
+		if len(resp.Events) > 0 {
+			if err := s.applyEvents(ctx, mirror, &target, targetClient, resp.Events); err != nil {
+				return err
+			}
+			s.recovered(mirror, runner)
+			mirror.Revision = resp.Events[len(resp.Events)-1].Kv.ModRevision
+			now := time.Now()
+			s.update(runner, func(state *MirrorState) {
+				state.AppliedRevision = mirror.Revision
+				state.EventsApplied += int64(len(resp.Events))
+				state.LastAppliedAt = &now
+				state.LastError = ""
+			})
+		} else if resp.IsProgressNotify() {
+			// 进度通知表示该revision之前的事件都已送达
+			mirror.Revision = resp.Header.Revision
+			s.update(runner, func(state *MirrorState) {
+				state.AppliedRevision = mirror.Revision
+			})
+			s.recovered(mirror, runner)
+		}
+
+		if time.Since(lastSave) >= mirrorSaveInterval {
+			if err := save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if retired() {
+		return ErrClientRetired
+	}
+	return errors.New("watch channel closed")
+}
+
+// initialSync 在同一revision上逐页读取源前缀并写入目标，再删除目标前缀下源中不存在的键，返回读取的源revision
+// 每次只在内存中保留一页键值，源前缀很大时也不会一次读入全部数据
+func (s *MirrorService) initialSync(ctx context.Context, mirror *models.Mirror, source, target *models.Connection) (int64, error) {
+	client, release, err := s.etcdService.Acquire(ctx, target)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	page := make(map[string]*BackupRecord, DefaultExportPageSize)
+	flush := func() error {
+		items, _, err := importDiff(ctx, s.etcdService, target, page, nil, ImportOptions{Overwrite: true})
+		if err != nil {
+			return err
+		}
+		clear(page)
+		return s.applyInitialSync(ctx, target, client, items)
+	}
+	revision, err := s.etcdService.StreamKV(ctx, source, mirror.SourcePrefix, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+		key := mirrorTargetKey(mirror, string(kv.Key))
+		page[key] = &BackupRecord{Key: key, Value: kv.Value}
+		if len(page) >= DefaultExportPageSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	// 逐页读取目标前缀，在源的同一revision上检查对应的键是否存在
+	var stale []*mvccpb.KeyValue
+	prune := func() error {
+		keys := make([]string, 0, len(stale))
+		for _, kv := range stale {
+			keys = append(keys, mirrorSourceKey(mirror, string(kv.Key)))
+		}
+		exists := make(map[string]bool, len(keys))
+		if _, err := s.etcdService.GetKeysAt(ctx, source, keys, revision, func(kv *mvccpb.KeyValue) error {
+			exists[mirrorTargetKey(mirror, string(kv.Key))] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+		var deletes []ImportDiffItem
+		for _, kv := range stale {
+			if !exists[string(kv.Key)] {
+				deletes = append(deletes, ImportDiffItem{Key: string(kv.Key), Action: ImportActionDelete, ModRevision: kv.ModRevision})
+			}
+		}
+		stale = stale[:0]
+		return s.applyInitialSync(ctx, target, client, deletes)
+	}
+	if _, err := s.etcdService.StreamKV(ctx, target, mirror.TargetPrefix, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+		stale = append(stale, kv)
+		if len(stale) >= DefaultExportPageSize {
+			return prune()
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if err := prune(); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// applyInitialSync 分块写入全量同步中新增、修改和删除的键，以计算差异时的mod_revision为条件
+func (s *MirrorService) applyInitialSync(ctx context.Context, target *models.Connection, client *clientv3.Client, items []ImportDiffItem) error {
+	writes := make([]ImportDiffItem, 0, len(items))
+	for _, item := range items {
+		if item.Action == ImportActionAdd || item.Action == ImportActionChange || item.Action == ImportActionDelete {
+			writes = append(writes, item)
+		}
+	}
+	for start := 0; start < len(writes); start += DefaultImportChunkSize {
+		chunk := writes[start:min(start+DefaultImportChunkSize, len(writes))]
+		reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+		_, err := applyImportChunk(reqCtx, client, nil, chunk)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEvents 将Watch事件按顺序写入目标，每个事务不超过MaxTxnOps个操作
+// 同一事务中不能重复操作同一个键，遇到重复的键时提交当前事务
+func (s *MirrorService) applyEvents(ctx context.Context, mirror *models.Mirror, target *models.Connection, client *clientv3.Client, events []*clientv3.Event) error {
+	ops := make([]clientv3.Op, 0, min(len(events), MaxTxnOps))
+	keys := make(map[string]bool, cap(ops))
+	commit := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+		defer cancel()
+		if _, err := client.Txn(reqCtx).Then(ops...).Commit(); err != nil {
+			return fmt.Errorf("failed to write target: %w", classifyError(err))
+		}
+		ops = ops[:0]
+		clear(keys)
+		return nil
+	}
+
+	for _, event := range events {
+		key := mirrorTargetKey(mirror, string(event.Kv.Key))
+		if keys[key] || len(ops) >= MaxTxnOps {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+		keys[key] = true
+		if event.Type == clientv3.EventTypeDelete {
+			ops = append(ops, clientv3.OpDelete(key))
+		} else {
+			ops = append(ops, clientv3.OpPut(key, string(event.Kv.Value)))
+		}
+	}
+	return commit()
+}
+
+// recovered 出错的镜像重新应用了事件或收到进度通知后发送mirror.recovered
+func (s *MirrorService) recovered(mirror *models.Mirror, runner *mirrorRunner) {
+	failing := false
+	s.update(runner, func(state *MirrorState) {
+		failing, runner.failing = runner.failing, false
+	})
+	if failing {
+		s.emit(mirror, WebhookEventMirrorRecovered, "")
+	}
+}
+
+// update 更新运行状态
+func (s *MirrorService) update(runner *mirrorRunner, fn func(state *MirrorState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&runner.state)
+}
+
+// mirrorTargetKey 将源键的源前缀替换为目标前缀
+func mirrorTargetKey(mirror *models.Mirror, key string) string {
+	return mirror.TargetPrefix + strings.TrimPrefix(key, mirror.SourcePrefix)
+}
+
+// mirrorSourceKey 将目标键的目标前缀替换为源前缀
+func mirrorSourceKey(mirror *models.Mirror, key string) string {
+	return mirror.SourcePrefix + strings.TrimPrefix(key, mirror.TargetPrefix)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"etcd-admin-backend/internal/models"
+)
+
+// putTestKeysInBatches 以MaxTxnOps个键一个事务写入大量键
+func putTestKeysInBatches(t *testing.T, client *clientv3.Client, kvs map[string]string) {
+	t.Helper()
+	ops := make([]clientv3.Op, 0, MaxTxnOps)
+	commit := func() {
+		if _, err := client.Txn(context.Background()).Then(ops...).Commit(); err != nil {
+			t.Fatal(err)
+		}
+		ops = ops[:0]
+	}
+	for key, value := range kvs {
+		ops = append(ops, clientv3.OpPut(key, value))
+		if len(ops) == MaxTxnOps {
+			commit()
+		}
+	}
+	commit()
+}
+
+func TestMirrorInitialSync(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+
+	// 源前缀跨越多页，目标中有相同、不同和多余的键分布在各页中
+	source := make(map[string]string)
+	target := map[string]string{"/other/keep": "outside the target prefix"}
+	want := make(map[string]string)
+	for i := 0; i < 2*DefaultExportPageSize+500; i++ {
+		key := fmt.Sprintf("k%05d", i)
+		source["/src/"+key] = fmt.Sprintf("v%d", i)
+		want["/dst/"+key] = fmt.Sprintf("v%d", i)
+		switch i % 7 {
+		case 0:
+			target["/dst/"+key] = fmt.Sprintf("v%d", i)
+		case 1:
+			target["/dst/"+key] = "stale"
+		}
+		if i%5 == 0 {
+			target["/dst/"+key+"-removed"] = "not in source"
+		}
+	}
+	putTestKeysInBatches(t, client, source)
+	putTestKeysInBatches(t, client, target)
+
+	conn := newTestConnection(t, "local")
+	service := NewMirrorService(newTestEtcdService(t), nil)
+	mirror := &models.Mirror{
+		SourceConnectionID: conn.ID,
+		TargetConnectionID: conn.ID,
+		SourcePrefix:       "/src/",
+		TargetPrefix:       "/dst/",
+	}
+
+	resp, err := client.Get(context.Background(), "\x00", clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision, err := service.initialSync(context.Background(), mirror, conn, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != resp.Header.Revision {
+		t.Errorf("revision = %d, want the source revision %d", revision, resp.Header.Revision)
+	}
+
+	got := getTestKeys(t, client, "/dst/")
+	if len(got) != len(want) {
+		t.Errorf("target has %d keys, want %d", len(got), len(want))
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+	if other := getTestKeys(t, client, "/other/"); other["/other/keep"] != "outside the target prefix" {
+		t.Errorf("key outside the target prefix changed: %v", other)
+	}
+	if src := getTestKeys(t, client, "/src/"); len(src) != len(source) {
+		t.Errorf("source has %d keys, want %d", len(src), len(source))
+	}
+}
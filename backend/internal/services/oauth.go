@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v73/github"
+	"golang.org/x/oauth2"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+)
+
+var (
+	// ErrOAuthProviderDisabled 提供方未启用
+	ErrOAuthProviderDisabled = errors.New("oauth provider is not enabled")
+	// ErrOAuthInvalidState state参数无效或已过期
+	ErrOAuthInvalidState = errors.New("invalid or expired oauth state")
+)
+
+// OAuthSessionTTL 发起登录到回调的最长时间
+const OAuthSessionTTL = 10 * time.Minute
+
+// oauthSessionClaims 登录会话声明，签名后保存在发起登录的浏览器的Cookie中
+type oauthSessionClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"` // PKCE code_verifier
+	Nonce    string `json:"nonce"`    // OIDC id_token中应带回的nonce
+	jwt.RegisteredClaims
+}
+
+// OAuthService 第三方登录服务
+type OAuthService struct {
+	cfg        *config.Config
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOAuthService 创建第三方登录服务
+func NewOAuthService(cfg *config.Config) *OAuthService {
+	return &OAuthService{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Providers 返回已启用的提供方
+func (s *OAuthService) Providers() []string {
+	providers := make([]string, 0, 2)
+	if s.cfg.OAuth.OIDC.Enabled {
+		providers = append(providers, models.AuthProviderOIDC)
+	}
+	if s.cfg.OAuth.GitHub.Enabled {
+		providers = append(providers, models.AuthProviderGitHub)
+	}
+	return providers
+}
+
+// AuthCodeURL 生成授权跳转地址、state和登录会话
+// 会话包含state、PKCE verifier和nonce，调用方需要将其保存在浏览器的HttpOnly Cookie中，回调时一并提交
+func (s *OAuthService) AuthCodeURL(ctx context.Context, provider string) (string, string, string, error) {
+	oauthConfig, err := s.oauth2Config(ctx, provider)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	claims := oauthSessionClaims{
+		Provider: provider,
+		State:    randomHex(16),
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    randomHex(16),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OAuthSessionTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "etcd-admin",
+		},
+	}
+	session, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.Server.JWTKey))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(claims.Verifier)}
+	if provider == models.AuthProviderOIDC {
+		opts = append(opts, oidc.Nonce(claims.Nonce))
+	}
+	return oauthConfig.AuthCodeURL(claims.State, opts...), claims.State, session, nil
+}
+
+// Exchange 校验state与发起登录时的会话一致，用授权码和PKCE verifier换取身份信息
+func (s *OAuthService) Exchange(ctx context.Context, provider, code, state, session string) (*ExternalIdentity, error) {
+	claims, err := s.verifySession(provider, state, session)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthConfig, err := s.oauth2Config(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(claims.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	var identity *ExternalIdentity
+	switch provider {
+	case models.AuthProviderOIDC:
+		identity, err = s.oidcIdentity(ctx, oauthConfig, token, claims.Nonce)
+	case models.AuthProviderGitHub:
+		identity, err = s.githubIdentity(ctx, oauthConfig, token)
+	default:
+		return nil, ErrOAuthProviderDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkAllowed(identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// LinkUser 返回第三方身份对应的本地用户，不存在时自动创建
+func (s *OAuthService) LinkUser(identity *ExternalIdentity) (*models.User, error) {
+	var mapping map[string]string
+	opts := ProvisionOptions{AutoCreate: true}
+	switch identity.Provider {
+	case models.AuthProviderOIDC:
+		mapping = s.cfg.OAuth.OIDC.RoleMapping
+		opts.AutoLink = s.cfg.OAuth.OIDC.AutoLink
+	case models.AuthProviderGitHub:
+		mapping = s.cfg.OAuth.GitHub.RoleMapping
+		opts.AutoLink = s.cfg.OAuth.GitHub.AutoLink
+	}
+	return ProvisionExternalUser(identity, mapRole(mapping, identity.Groups), opts)
+}
+
+// oauth2Config 构建提供方的OAuth2配置
+func (s *OAuthService) oauth2Config(ctx context.Context, provider string) (*oauth2.Config, error) {
+	switch provider {
+	case models.AuthProviderOIDC:
+		cfg := s.cfg.OAuth.OIDC
+		if !cfg.Enabled {
+			return nil, ErrOAuthProviderDisabled
+		}
+		oidcProvider, err := s.oidcProvider(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+			Endpoint:     oidcProvider.Endpoint(),
+		}, nil
+	case models.AuthProviderGitHub:
+		cfg := s.cfg.OAuth.GitHub
+		if !cfg.Enabled {
+			return nil, ErrOAuthProviderDisabled
+		}
+		baseURL := strings.TrimRight(cfg.BaseURL, "/")
+		return &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{"read:user", "user:email", "read:org"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/login/oauth/authorize",
+				TokenURL: baseURL + "/login/oauth/access_token",
+			},
+		}, nil
+	}
+	return nil, ErrOAuthProviderDisabled
+}
+
+// oidcProvider 获取并缓存OIDC提供方（发现文档和签名公钥）
+func (s *OAuthService) oidcProvider(ctx context.Context) (*oidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider != nil {
+		return s.provider, nil
+	}
+
+	// 公钥会在之后的校验中按需刷新，不能使用请求的context
+	providerCtx := oidc.ClientContext(context.Background(), s.httpClient)
+	provider, err := oidc.NewProvider(providerCtx, strings.TrimRight(s.cfg.OAuth.OIDC.IssuerURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oidc provider: %w", err)
+	}
+
+	s.provider = provider
+	return s.provider, nil
+}
+
+// oidcIdentity 校验id_token的签名、issuer、audience和nonce并读取身份
+// id_token中缺少的声明（如邮箱、组）从userinfo端点补充
+func (s *OAuthService) oidcIdentity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token, nonce string) (*ExternalIdentity, error) {
+	provider, err := s.oidcProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("oidc token response is missing the id_token")
+	}
+	ctx = oidc.ClientContext(ctx, s.httpClient)
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oidc id_token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("oidc id_token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid oidc id_token claims: %w", err)
+	}
+	if provider.UserInfoEndpoint() != "" {
+		userInfo, err := provider.UserInfo(ctx, oauthConfig.TokenSource(ctx, token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch oidc userinfo: %w", err)
+		}
+		// userinfo的sub必须与id_token一致，否则不能使用其中的声明
+		if userInfo.Subject != idToken.Subject {
+			return nil, fmt.Errorf("oidc userinfo subject does not match the id_token")
+		}
+		var extra map[string]interface{}
+		if err := userInfo.Claims(&extra); err != nil {
+			return nil, fmt.Errorf("invalid oidc userinfo response: %w", err)
+		}
+		for key, value := range extra {
+			if _, exists := claims[key]; !exists {
+				claims[key] = value
+			}
+		}
+	}
+
+	identity := &ExternalIdentity{
+		Provider:  models.AuthProviderOIDC,
+		Subject:   idToken.Subject,
+		Email:     strings.ToLower(claimString(claims, "email")),
+		AvatarURL: claimString(claims, "picture"),
+		Groups:    claimStrings(claims, s.cfg.OAuth.OIDC.GroupsClaim),
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("oidc id_token is missing the sub claim")
+	}
+	if verified, ok := claims["email_verified"].(bool); ok {
+		identity.EmailVerified = verified
+	}
+
+	identity.Username = claimString(claims, "preferred_username")
+	if identity.Username == "" && identity.Email != "" {
+		identity.Username = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+
+	return identity, nil
+}
+
+// githubIdentity 通过GitHub API获取身份、组织和团队
+func (s *OAuthService) githubIdentity(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (*ExternalIdentity, error) {
+	client := github.NewClient(oauthConfig.Client(ctx, token))
+	if apiURL := s.cfg.OAuth.GitHub.APIURL; apiURL != "" && apiURL != "https://api.github.com/" {
+		var err error
+		if client, err = client.WithEnterpriseURLs(apiURL, apiURL); err != nil {
+			return nil, fmt.Errorf("invalid github api url: %w", err)
+		}
+	}
+
+	ghUser, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch github user: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider:  models.AuthProviderGitHub,
+		Subject:   fmt.Sprintf("%d", ghUser.GetID()),
+		Username:  ghUser.GetLogin(),
+		AvatarURL: ghUser.GetAvatarURL(),
+	}
+
+	emails, _, err := client.Users.ListEmails(ctx, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch github emails: %w", err)
+	}
+	for _, email := range emails {
+		if email.GetPrimary() && email.GetVerified() {
+			identity.Email = strings.ToLower(email.GetEmail())
+			identity.EmailVerified = true
+			break
+		}
+	}
+
+	orgs, _, err := client.Organizations.List(ctx, "", &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch github organizations: %w", err)
+	}
+	for _, org := range orgs {
+		identity.Orgs = append(identity.Orgs, org.GetLogin())
+	}
+
+	teams, _, err := client.Teams.ListUserTeams(ctx, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch github teams: %w", err)
+	}
+	for _, team := range teams {
+		identity.Groups = append(identity.Groups, team.GetOrganization().GetLogin()+"/"+team.GetSlug())
+	}
+
+	return identity, nil
+}
+
+// checkAllowed 检查邮箱域名和GitHub组织限制
+func (s *OAuthService) checkAllowed(identity *ExternalIdentity) error {
+	var allowedDomains []string
+	switch identity.Provider {
+	case models.AuthProviderOIDC:
+		allowedDomains = s.cfg.OAuth.OIDC.AllowedDomains
+	case models.AuthProviderGitHub:
+		allowedDomains = s.cfg.OAuth.GitHub.AllowedDomains
+		if allowedOrgs := s.cfg.OAuth.GitHub.AllowedOrgs; len(allowedOrgs) > 0 && !containsFold(allowedOrgs, identity.Orgs...) {
+			return ErrIdentityNotAllowed
+		}
+	}
+
+	if len(allowedDomains) > 0 {
+		if !identity.EmailVerified || identity.Email == "" {
+			return ErrIdentityNotAllowed
+		}
+		domain := identity.Email[strings.LastIndex(identity.Email, "@")+1:]
+		if !containsFold(allowedDomains, domain) {
+			return ErrIdentityNotAllowed
+		}
+	}
+	return nil
+}
+
+// verifySession 校验登录会话的签名和有效期，并确认回调的state与会话中的一致
+func (s *OAuthService) verifySession(provider, state, session string) (*oauthSessionClaims, error) {
+	if session == "" {
+		return nil, ErrOAuthInvalidState
+	}
+	token, err := jwt.ParseWithClaims(session, &oauthSessionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return []byte(s.cfg.Server.JWTKey), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrOAuthInvalidState
+	}
+	claims, ok := token.Claims.(*oauthSessionClaims)
+	if !ok || claims.Provider != provider || claims.State == "" ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return nil, ErrOAuthInvalidState
+	}
+	return claims, nil
+}
+
+// claimString 读取字符串类型的声明
+func claimString(claims map[string]interface{}, key string) string {
+	value, _ := claims[key].(string)
+	return value
+}
+
+// claimStrings 读取字符串数组类型的声明
+func claimStrings(claims map[string]interface{}, key string) []string {
+	var result []string
+	switch value := claims[key].(type) {
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+	case string:
+		result = append(result, value)
+	}
+	return result
+}
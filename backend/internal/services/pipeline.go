@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrInvalidPipeline 流水线配置或晋级参数无效
+	ErrInvalidPipeline = errors.New("invalid pipeline")
+	// ErrPromotionClosed 晋级已全部处理或已放弃
+	ErrPromotionClosed = errors.New("promotion is no longer pending")
+)
+
+// PromotionApplyResult 应用晋级变更的结果
+type PromotionApplyResult struct {
+	Applied   int      `json:"applied"`
+	Conflicts []string `json:"conflicts"` // 目标在晋级创建之后被修改，未应用
+	NotFound  []string `json:"not_found"` // 指定的键不在待应用的变更中
+	Status    string   `json:"status"`    // 应用后晋级的状态
+}
+
+// PipelineService 环境晋级：比较相邻环境生成待应用的变更集，再按键选择性地应用
+type PipelineService struct {
+	etcdService    *EtcdService
+	diffService    *DiffService
+	webhookService *WebhookService
+}
+
+// NewPipelineService 创建晋级服务
+func NewPipelineService(etcdService *EtcdService, webhookService *WebhookService) *PipelineService {
+	return &PipelineService{
+		etcdService:    etcdService,
+		diffService:    NewDiffService(etcdService),
+		webhookService: webhookService,
+	}
+}
+
+// ValidatePipeline 校验流水线：至少两个环境，环境名称唯一且连接存在
+func (s *PipelineService) ValidatePipeline(pipeline *models.Pipeline) error {
+	if len(pipeline.Environments) < 2 {
+		return fmt.Errorf("%w: at least two environments are required", ErrInvalidPipeline)
+	}
+	names := make(map[string]bool, len(pipeline.Environments))
+	for _, env := range pipeline.Environments {
+		if env.Name == "" {
+			return fmt.Errorf("%w: environment name is required", ErrInvalidPipeline)
+		}
+		if names[env.Name] {
+			return fmt.Errorf("%w: duplicate environment %s", ErrInvalidPipeline, env.Name)
+		}
+		names[env.Name] = true
+
+		var conn models.Connection
+		if err := database.GetDB().First(&conn, env.ConnectionID).Error; err != nil {
+			return fmt.Errorf("%w: connection %d of environment %s not found", ErrInvalidPipeline, env.ConnectionID, env.Name)
+		}
+	}
+	for _, pattern := range pipeline.Ignore {
+		if _, err := compileGlob(pattern); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPipeline, err)
+		}
+	}
+	return nil
+}
+
+// Promote 比较from环境与下一个环境，将差异保存为待应用的晋级
+// includeDeletes为true时下一个环境中多出的键作为删除变更；没有差异时返回nil
+func (s *PipelineService) Promote(ctx context.Context, pipeline *models.Pipeline, from string, includeDeletes bool, userID uint) (*models.Promotion, error) {
+	source, index := pipeline.Environment(from)
+	if source == nil {
+		return nil, fmt.Errorf("%w: environment %s not found", ErrInvalidPipeline, from)
+	}
+	if index == len(pipeline.Environments)-1 {
+		return nil, fmt.Errorf("%w: %s is the last environment", ErrInvalidPipeline, from)
+	}
+	target := &pipeline.Environments[index+1]
+
+	var sourceConn, targetConn models.Connection
+	if err := database.GetDB().First(&sourceConn, source.ConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("%w: connection of environment %s not found", ErrInvalidPipeline, source.Name)
+	}
+	if err := database.GetDB().First(&targetConn, target.ConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("%w: connection of environment %s not found", ErrInvalidPipeline, target.Name)
+	}
+
+	diff, err := s.diffService.Compare(ctx,
+		DiffSide{Connection: &sourceConn, Prefix: source.Prefix},
+		DiffSide{Connection: &targetConn, Prefix: target.Prefix},
+		pipeline.Ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.PromotionItem
+	for _, change := range diff.Changed {
+		items = append(items, models.PromotionItem{
+			Key:               change.Key,
+			Action:            ImportActionChange,
+			SourceValue:       change.SourceValue,
+			TargetValue:       change.TargetValue,
+			TargetModRevision: change.TargetModRevision,
+		})
+	}
+	// 新增和删除的键在比较时的revision上读取值
+	if _, err := s.etcdService.GetKeysAt(ctx, &sourceConn, prefixKeys(source.Prefix, diff.OnlyInSource), diff.SourceRevision, func(kv *mvccpb.KeyValue) error {
+		items = append(items, models.PromotionItem{
+			Key:         string(kv.Key)[len(source.Prefix):],
+			Action:      ImportActionAdd,
+			SourceValue: string(kv.Value),
+		})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	if includeDeletes {
+		if _, err := s.etcdService.GetKeysAt(ctx, &targetConn, prefixKeys(target.Prefix, diff.OnlyInTarget), diff.TargetRevision, func(kv *mvccpb.KeyValue) error {
+			items = append(items, models.PromotionItem{
+				Key:               string(kv.Key)[len(target.Prefix):],
+				Action:            ImportActionDelete,
+				TargetValue:       string(kv.Value),
+				TargetModRevision: kv.ModRevision,
+			})
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("target: %w", err)
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	promotion := &models.Promotion{
+		PipelineID:         pipeline.ID,
+		FromEnvironment:    source.Name,
+		ToEnvironment:      target.Name,
+		SourceConnectionID: source.ConnectionID,
+		TargetConnectionID: target.ConnectionID,
+		SourcePrefix:       source.Prefix,
+		TargetPrefix:       target.Prefix,
+		SourceRevision:     diff.SourceRevision,
+		TargetRevision:     diff.TargetRevision,
+		Status:             models.PromotionPending,
+		CreatedBy:          userID,
+	}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Items").Create(promotion).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].PromotionID = promotion.ID
+			items[i].Status = models.PromotionItemPending
+		}
+		return tx.CreateInBatches(items, DefaultImportChunkSize).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	promotion.Items = items
+	return promotion, nil
+}
+
+// Apply 应用晋级中的待应用变更，keys为相对键，为空时应用全部
+// 目标键的mod_revision与创建晋级时不同的变更标记为conflict，不会覆盖晋级之后的修改
+func (s *PipelineService) Apply(ctx context.Context, promotion *models.Promotion, keys []string, userID uint) (*PromotionApplyResult, error) {
+	if promotion.Status != models.PromotionPending {
+		return nil, ErrPromotionClosed
+	}
+
+	result, err := s.apply(ctx, promotion, keys, userID)
+	data := map[string]interface{}{
+		"promotion_id":     promotion.ID,
+		"pipeline_id":      promotion.PipelineID,
+		"from_environment": promotion.FromEnvironment,
+		"to_environment":   promotion.ToEnvironment,
+		"user_id":          userID,
+		"result":           result,
+	}
+	event := WebhookEventPromotionApplied
+	if err != nil {
+		event = WebhookEventPromotionFailed
+		data["error"] = err.Error()
+	}
+	s.webhookService.Emit(promotion.TargetConnectionID, event, "", data)
+	return result, err
+}
+
+// apply 按块应用待应用的变更并更新晋级状态
+func (s *PipelineService) apply(ctx context.Context, promotion *models.Promotion, keys []string, userID uint) (*PromotionApplyResult, error) {
+	var target models.Connection
+	if err := database.GetDB().First(&target, promotion.TargetConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("target connection not found: %w", err)
+	}
+	client, release, err := s.etcdService.Acquire(ctx, &target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := database.GetDB().Where("promotion_id = ? AND status = ?", promotion.ID, models.PromotionItemPending)
+	if len(keys) > 0 {
+		query = query.Where("`key` IN ?", keys)
+	}
+	var items []models.PromotionItem
+	if err := query.Order("`key`").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	result := &PromotionApplyResult{Conflicts: []string{}, NotFound: []string{}}
+	if len(keys) > 0 {
+		pending := make(map[string]bool, len(items))
+		for _, item := range items {
+			pending[item.Key] = true
+		}
+		for _, key := range uniqueSortedKeys(keys) {
+			if !pending[key] {
+				result.NotFound = append(result.NotFound, key)
+			}
+		}
+	}
+
+	for start := 0; start < len(items); start += DefaultImportChunkSize {
+		chunk := items[start:min(start+DefaultImportChunkSize, len(items))]
+		if err := s.applyChunk(ctx, &target, client, promotion, chunk, result); err != nil {
+			return result, err
+		}
+	}
+
+	var remaining int64
+	if err := database.GetDB().Model(&models.PromotionItem{}).
+		Where("promotion_id = ? AND status = ?", promotion.ID, models.PromotionItemPending).
+		Count(&remaining).Error; err != nil {
+		return result, err
+	}
+	now := time.Now()
+	promotion.AppliedBy = userID
+	promotion.AppliedAt = &now
+	if remaining == 0 {
+		promotion.Status = models.PromotionApplied
+	}
+	result.Status = promotion.Status
+	return result, database.GetDB().Model(promotion).
+		Select("status", "applied_by", "applied_at").
+		Updates(promotion).Error
+}
+
+// applyChunk 在一个事务中应用一批变更，事务以读取到的mod_revision为条件
+func (s *PipelineService) applyChunk(ctx context.Context, target *models.Connection, client *clientv3.Client, promotion *models.Promotion, chunk []models.PromotionItem, result *PromotionApplyResult) error {
+	fullKeys := make([]string, 0, len(chunk))
+	for _, item := range chunk {
+		fullKeys = append(fullKeys, promotion.TargetPrefix+item.Key)
+	}
+	current := make(map[string]int64, len(chunk))
+	if _, err := s.etcdService.GetKeysAt(ctx, target, fullKeys, 0, func(kv *mvccpb.KeyValue) error {
+		current[string(kv.Key)] = kv.ModRevision
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var cmps []clientv3.Cmp
+	var ops []clientv3.Op
+	var applied, conflicts []uint
+	for i, item := range chunk {
+		key := fullKeys[i]
+		if current[key] != item.TargetModRevision {
+			conflicts = append(conflicts, item.ID)
+			result.Conflicts = append(result.Conflicts, item.Key)
+			continue
+		}
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", item.TargetModRevision))
+		if item.Action == ImportActionDelete {
+			ops = append(ops, clientv3.OpDelete(key))
+		} else {
+			ops = append(ops, clientv3.OpPut(key, item.SourceValue))
+		}
+		applied = append(applied, item.ID)
+	}
+
+	if len(ops) > 0 {
+		reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+		resp, err := client.Txn(reqCtx).If(cmps...).Then(ops...).Commit()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to apply keys %s..%s: %w", chunk[0].Key, chunk[len(chunk)-1].Key, classifyError(err))
+		}
+		if !resp.Succeeded {
+			// 读取之后又被修改，本批不写入，变更保持待应用
+			return fmt.Errorf("%w: %s..%s", ErrImportConflict, chunk[0].Key, chunk[len(chunk)-1].Key)
+		}
+	}
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if len(applied) > 0 {
+			if err := tx.Model(&models.PromotionItem{}).Where("id IN ?", applied).Update("status", models.PromotionItemApplied).Error; err != nil {
+				return err
+			}
+			result.Applied += len(applied)
+		}
+		if len(conflicts) > 0 {
+			return tx.Model(&models.PromotionItem{}).Where("id IN ?", conflicts).Update("status", models.PromotionItemConflict).Error
+		}
+		return nil
+	})
+}
+
+// Discard 放弃晋级，待应用的变更标记为rejected
+func (s *PipelineService) Discard(promotion *models.Promotion) error {
+	if promotion.Status != models.PromotionPending {
+		return ErrPromotionClosed
+	}
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PromotionItem{}).
+			Where("promotion_id = ? AND status = ?", promotion.ID, models.PromotionItemPending).
+			Update("status", models.PromotionItemRejected).Error; err != nil {
+			return err
+		}
+		promotion.Status = models.PromotionDiscarded
+		return tx.Model(promotion).Update("status", promotion.Status).Error
+	})
+}
+
+// Delete 删除流水线及其晋级记录
+func (s *PipelineService) Delete(pipeline *models.Pipeline) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("promotion_id IN (?)",
+			tx.Model(&models.Promotion{}).Select("id").Where("pipeline_id = ?", pipeline.ID)).
+			Delete(&models.PromotionItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pipeline_id = ?", pipeline.ID).Delete(&models.Promotion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(pipeline).Error
+	})
+}
+
+// prefixKeys 为相对键加上前缀
+func prefixKeys(prefix string, keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, prefix+key)
+	}
+	return result
+}
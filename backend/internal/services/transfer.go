@@ -0,0 +1,557 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// ErrTransferJobNotRunning 任务不在执行中
+var ErrTransferJobNotRunning = errors.New("transfer job is not running")
+
+// transferConflictRetries 目标键在比较之后被修改时，同一批次重新比较的次数
+const transferConflictRetries = 3
+
+// 预览返回的最大条数
+const (
+	DefaultTransferPreviewLimit = 100
+	MaxTransferPreviewLimit     = 1000
+)
+
+// errPreviewLimit 预览条数已满，停止读取源数据
+var errPreviewLimit = errors.New("preview limit reached")
+
+// TransferPreview 传输预览：源键到目标键、转换后的值以及与目标当前值的比较
+type TransferPreview struct {
+	Revision  int64                 `json:"revision"` // 读取源数据的revision
+	Filtered  int                   `json:"filtered"`
+	Missing   int                   `json:"missing"`   // 指定的键在源中不存在的数量
+	Truncated bool                  `json:"truncated"` // 超过条数上限，只返回了前面的键
+	Items     []TransferPreviewItem `json:"items"`
+}
+
+// TransferPreviewItem 单个键的预览，new_value为转换后的值，source_value只在值被转换时返回
+type TransferPreviewItem struct {
+	ImportDiffItem
+	SourceValue *string `json:"source_value,omitempty"`
+}
+
+// TransferService 在后台执行连接间的KV传输任务
+// 源数据在固定revision上分页读取，目标按批次在事务中写入，进度保存在数据库中
+type TransferService struct {
+	etcdService    *EtcdService
+	webhookService *WebhookService
+
+	ctx    context.Context // 服务停止时取消进行中的任务
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // job_id -> 取消函数
+}
+
+// NewTransferService 创建传输服务
+func NewTransferService(etcdService *EtcdService, webhookService *WebhookService) *TransferService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TransferService{
+		etcdService:    etcdService,
+		webhookService: webhookService,
+		ctx:            ctx,
+		cancel:         cancel,
+		running:        make(map[uint]context.CancelFunc),
+	}
+}
+
+// Start 将上次退出时未完成的任务标记为失败
+func (s *TransferService) Start() error {
+	return database.GetDB().Model(&models.TransferJob{}).
+		Where("status IN ?", []string{models.TransferJobPending, models.TransferJobRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.TransferJobFailed,
+			"error":       "interrupted by server restart",
+			"finished_at": time.Now(),
+		}).Error
+}
+
+// Stop 取消进行中的任务
+func (s *TransferService) Stop() {
+	s.cancel()
+}
+
+// Submit 保存任务并在后台执行
+func (s *TransferService) Submit(job *models.TransferJob) error {
+	source, target, err := loadTransferConnections(job)
+	if err != nil {
+		return err
+	}
+	if _, err := transferMapper(job, source, target); err != nil {
+		return err
+	}
+	if err := jobConflictPolicy(job).Validate(); err != nil {
+		return err
+	}
+
+	job.Status = models.TransferJobPending
+	if err := database.GetDB().Create(job).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+
+	run := *job
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, run.ID)
+			s.mu.Unlock()
+			cancel()
+		}()
+		s.execute(ctx, &run)
+	}()
+	return nil
+}
+
+// Cancel 取消执行中的任务，已写入的批次不会回滚
+func (s *TransferService) Cancel(jobID uint) error {
+	s.mu.Lock()
+	cancel, ok := s.running[jobID]
+	s.mu.Unlock()
+	if !ok {
+		return ErrTransferJobNotRunning
+	}
+	cancel()
+	return nil
+}
+
+// execute 执行任务并记录结果，结束后通知目标连接的Webhook
+func (s *TransferService) execute(ctx context.Context, job *models.TransferJob) {
+	startedAt := time.Now()
+	job.Status = models.TransferJobRunning
+	job.StartedAt = &startedAt
+	s.saveProgress(job)
+
+	err := s.transfer(ctx, job)
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		job.Status = models.TransferJobCompleted
+	case ctx.Err() != nil && s.ctx.Err() == nil:
+		job.Status = models.TransferJobCancelled
+	default:
+		job.Status = models.TransferJobFailed
+		job.Error = err.Error()
+		log.Printf("Transfer job %d failed: %v", job.ID, err)
+	}
+	s.saveProgress(job)
+
+	event := WebhookEventTransferCompleted
+	switch job.Status {
+	case models.TransferJobFailed:
+		event = WebhookEventTransferFailed
+	case models.TransferJobCancelled:
+		event = WebhookEventTransferCancelled
+	}
+	s.webhookService.Emit(job.TargetConnectionID, event, "", job)
+}
+
+// saveProgress 保存任务状态和进度
+func (s *TransferService) saveProgress(job *models.TransferJob) {
+	err := database.GetDB().Model(job).
+		Select("status", "revision", "total", "processed", "success_count", "merged_count", "skipped_count",
+			"unchanged_count", "filtered_count", "missing_count", "error", "started_at", "finished_at").
+		Updates(job).Error
+	if err != nil {
+		log.Printf("Failed to update transfer job %d: %v", job.ID, err)
+	}
+}
+
+// transfer 读取源数据并按批次写入目标
+func (s *TransferService) transfer(ctx context.Context, job *models.TransferJob) error {
+	source, target, err := loadTransferConnections(job)
+	if err != nil {
+		return err
+	}
+	mapper, err := transferMapper(job, source, target)
+	if err != nil {
+		return err
+	}
+	client, release, err := s.etcdService.Acquire(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// 只有改写规则可能把不同的键映射到同一目标键，此时需要记录全部目标键
+	var seen map[string]string
+	if len(job.Mapping.Rewrites) > 0 {
+		seen = make(map[string]string)
+	}
+
+	records := make(map[string]*BackupRecord, DefaultImportChunkSize)
+	sources := make(map[string]string, DefaultImportChunkSize)
+	read := 0
+	flush := func() error {
+		if read == 0 {
+			return nil
+		}
+		if err := s.applyBatch(ctx, target, client, job, records, sources); err != nil {
+			return err
+		}
+		job.Processed += int64(read)
+		read = 0
+		clear(records)
+		clear(sources)
+		s.saveProgress(job)
+		return classifyError(ctx.Err())
+	}
+	add := func(kv *mvccpb.KeyValue) error {
+		read++
+		key := string(kv.Key)
+		targetKey, ok := mapper.Map(key)
+		switch {
+		case !ok:
+			job.FilteredCount++
+		case targetKey == "":
+			return fmt.Errorf("%w: key %s maps to an empty key", ErrInvalidKeyMapping, key)
+		default:
+			if seen != nil {
+				if other, exists := seen[targetKey]; exists {
+					return fmt.Errorf("%w: %s and %s both map to %s", ErrInvalidKeyMapping, other, key, targetKey)
+				}
+				seen[targetKey] = key
+			}
+			records[targetKey] = &BackupRecord{Key: targetKey, Value: mapper.MapValue(key, kv.Value), ModRevision: kv.ModRevision}
+			if mapper != nil {
+				sources[targetKey] = key
+			}
+		}
+		if read >= DefaultImportChunkSize {
+			return flush()
+		}
+		return nil
+	}
+
+	if len(job.Keys) > 0 {
+		job.Total = int64(len(uniqueSortedKeys(job.Keys)))
+	} else {
+		job.Total, job.Revision, err = s.etcdService.CountKeys(ctx, source, transferPrefix(job))
+		if err != nil {
+			return err
+		}
+		s.saveProgress(job)
+	}
+
+	found, err := s.readSource(ctx, source, job, func(kv *mvccpb.KeyValue) error {
+		return add(kv)
+	})
+	if len(job.Keys) > 0 {
+		job.MissingCount = job.Total - found
+	}
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// Preview 按任务配置读取源数据，返回映射和值转换的结果以及与目标的比较，不写入目标
+func (s *TransferService) Preview(ctx context.Context, job *models.TransferJob, limit int) (*TransferPreview, error) {
+	if limit <= 0 || limit > MaxTransferPreviewLimit {
+		limit = DefaultTransferPreviewLimit
+	}
+	source, target, err := loadTransferConnections(job)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := transferMapper(job, source, target)
+	if err != nil {
+		return nil, err
+	}
+	if err := jobConflictPolicy(job).Validate(); err != nil {
+		return nil, err
+	}
+
+	preview := &TransferPreview{Items: []TransferPreviewItem{}}
+	records := make(map[string]*BackupRecord)
+	sources := make(map[string]string)
+	sourceValues := make(map[string][]byte)
+	found, err := s.readSource(ctx, source, job, func(kv *mvccpb.KeyValue) error {
+		key := string(kv.Key)
+		targetKey, ok := mapper.Map(key)
+		if !ok {
+			preview.Filtered++
+			return nil
+		}
+		if targetKey == "" {
+			return fmt.Errorf("%w: key %s maps to an empty key", ErrInvalidKeyMapping, key)
+		}
+		if other, exists := sources[targetKey]; exists {
+			return fmt.Errorf("%w: %s and %s both map to %s", ErrInvalidKeyMapping, other, key, targetKey)
+		}
+		if len(records) >= limit {
+			preview.Truncated = true
+			return errPreviewLimit
+		}
+		records[targetKey] = &BackupRecord{Key: targetKey, Value: mapper.MapValue(key, kv.Value), ModRevision: kv.ModRevision}
+		sources[targetKey] = key
+		sourceValues[targetKey] = kv.Value
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPreviewLimit) {
+		return nil, err
+	}
+	if len(job.Keys) > 0 && !preview.Truncated {
+		preview.Missing = len(uniqueSortedKeys(job.Keys)) - int(found)
+	}
+
+	items, _, err := importDiff(ctx, s.etcdService, target, records, sources, ImportOptions{Overwrite: true, ShowValues: true})
+	if err != nil {
+		return nil, err
+	}
+	resolveConflicts(items, jobConflictPolicy(job))
+	for _, item := range items {
+		previewItem := TransferPreviewItem{ImportDiffItem: item}
+		if original := sourceValues[item.Key]; !bytes.Equal(original, item.record.Value) {
+			value := string(original)
+			previewItem.SourceValue = &value
+		}
+		preview.Items = append(preview.Items, previewItem)
+	}
+	preview.Revision = job.Revision
+	return preview, nil
+}
+
+// readSource 读取任务的源数据：指定了键时在同一revision上分批读取，否则在固定revision上分页读取前缀
+// 返回读取到的键数，job.Revision被设置为读取的revision
+func (s *TransferService) readSource(ctx context.Context, source *models.Connection, job *models.TransferJob, fn func(kv *mvccpb.KeyValue) error) (int64, error) {
+	found := int64(0)
+	read := func(kv *mvccpb.KeyValue) error {
+		found++
+		return fn(kv)
+	}
+
+	var err error
+	if len(job.Keys) > 0 {
+		job.Revision, err = s.etcdService.GetKeysAt(ctx, source, uniqueSortedKeys(job.Keys), 0, read)
+		return found, err
+	}
+	revision, err := s.etcdService.StreamKVAt(ctx, source, transferPrefix(job), job.Revision, DefaultExportPageSize, func(_ int64, kv *mvccpb.KeyValue) error {
+		return read(kv)
+	})
+	if revision != 0 {
+		job.Revision = revision
+	}
+	return found, err
+}
+
+// transferPrefix 任务读取的源前缀，未设置时使用映射的源前缀
+func transferPrefix(job *models.TransferJob) string {
+	if job.Prefix != "" {
+		return job.Prefix
+	}
+	return job.Mapping.SourcePrefix
+}
+
+// loadTransferConnections 获取任务的源连接和目标连接
+func loadTransferConnections(job *models.TransferJob) (*models.Connection, *models.Connection, error) {
+	var source, target models.Connection
+	if err := database.GetDB().First(&source, job.SourceConnectionID).Error; err != nil {
+		return nil, nil, fmt.Errorf("source connection not found: %w", err)
+	}
+	if err := database.GetDB().First(&target, job.TargetConnectionID).Error; err != nil {
+		return nil, nil, fmt.Errorf("target connection not found: %w", err)
+	}
+	return &source, &target, nil
+}
+
+// transferMapper 编译任务的键名映射，模板中可以使用源和目标连接的名称作为变量
+// source_connection、target_connection 未在Variables中定义时取连接名称
+func transferMapper(job *models.TransferJob, source, target *models.Connection) (*KeyMapper, error) {
+	mapping := job.Mapping
+	if len(mapping.Rewrites) > 0 || len(mapping.Values) > 0 {
+		variables := map[string]string{
+			"source_connection": source.Name,
+			"target_connection": target.Name,
+		}
+		for name, value := range mapping.Variables {
+			variables[name] = value
+		}
+		mapping.Variables = variables
+	}
+	return NewKeyMapper(mapping)
+}
+
+// applyBatch 将一批键与目标比较、按冲突策略处理后在一个事务中写入，目标键在比较之后被修改时重新比较
+// 冲突策略为fail且存在冲突时整批不写入
+func (s *TransferService) applyBatch(ctx context.Context, target *models.Connection, client *clientv3.Client, job *models.TransferJob, records map[string]*BackupRecord, sources map[string]string) error {
+	if len(sources) == 0 {
+		sources = nil
+	}
+	for attempt := 0; ; attempt++ {
+		items, _, err := importDiff(ctx, s.etcdService, target, records, sources, ImportOptions{Overwrite: true, ShowValues: true})
+		if err != nil {
+			return err
+		}
+		resolveConflicts(items, jobConflictPolicy(job))
+
+		var writes []ImportDiffItem
+		var merged, skipped, unchanged int64
+		for _, item := range items {
+			switch item.Action {
+			case ImportActionAdd, ImportActionChange:
+				writes = append(writes, item)
+			case ImportActionMerge:
+				writes = append(writes, item)
+				merged++
+			case ImportActionSkip:
+				skipped++
+			case ImportActionUnchanged:
+				unchanged++
+			case ImportActionConflict:
+				if err := s.recordKeys(job, items, 0); err != nil {
+					return err
+				}
+				return fmt.Errorf("%w: %s", ErrTransferConflict, item.Key)
+			}
+		}
+
+		var revision int64
+		if len(writes) > 0 {
+			reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+			revision, err = applyImportChunk(reqCtx, client, nil, writes)
+			cancel()
+			if errors.Is(err, ErrImportConflict) && attempt < transferConflictRetries {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		job.SuccessCount += int64(len(writes))
+		job.MergedCount += merged
+		job.SkippedCount += skipped
+		job.UnchangedCount += unchanged
+		return s.recordKeys(job, items, revision)
+	}
+}
+
+// recordKeys 保存一批键的处理结果，写入的键同时保存目标中原来的值和写入的revision用于回滚
+// 保存失败时任务失败，避免继续写入无法回滚的键
+func (s *TransferService) recordKeys(job *models.TransferJob, items []ImportDiffItem, revision int64) error {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]models.TransferJobKey, 0, len(items))
+	for _, item := range items {
+		key := models.TransferJobKey{
+			JobID:     job.ID,
+			Key:       item.Key,
+			SourceKey: item.SourceKey,
+			Decision:  item.Action,
+		}
+		switch item.Action {
+		case ImportActionAdd, ImportActionChange, ImportActionMerge:
+			key.WrittenRevision = revision
+			if item.ModRevision != 0 {
+				key.PreviousExists = true
+				key.PreviousValue = []byte(*item.OldValue)
+			}
+		}
+		keys = append(keys, key)
+	}
+	if err := database.GetDB().CreateInBatches(keys, DefaultImportChunkSize).Error; err != nil {
+		return fmt.Errorf("failed to record transferred keys: %w", err)
+	}
+	return nil
+}
+
+// CopyKey 按冲突策略将源中的单个键复制到目标键，返回处理结果
+// 冲突策略为fail且目标已存在不同的值时返回ErrTransferConflict
+func (s *TransferService) CopyKey(ctx context.Context, source, target *models.Connection, sourceKey, targetKey string, policy ConflictPolicy) (*ImportDiffItem, error) {
+	policy.SameConnection = source.ID == target.ID
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	var record *BackupRecord
+	if _, err := s.etcdService.GetKeysAt(ctx, source, []string{sourceKey}, 0, func(kv *mvccpb.KeyValue) error {
+		record = &BackupRecord{Key: targetKey, Value: kv.Value, ModRevision: kv.ModRevision}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, sourceKey)
+	}
+
+	client, release, err := s.etcdService.Acquire(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	records := map[string]*BackupRecord{targetKey: record}
+	for attempt := 0; ; attempt++ {
+		items, _, err := importDiff(ctx, s.etcdService, target, records, nil, ImportOptions{Overwrite: true, ShowValues: true})
+		if err != nil {
+			return nil, err
+		}
+		resolveConflicts(items, policy)
+		item := &items[0]
+
+		switch item.Action {
+		case ImportActionConflict:
+			return item, fmt.Errorf("%w: %s", ErrTransferConflict, targetKey)
+		case ImportActionSkip, ImportActionUnchanged:
+			return item, nil
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+		_, err = applyImportChunk(reqCtx, client, nil, items)
+		cancel()
+		if errors.Is(err, ErrImportConflict) && attempt < transferConflictRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+// jobConflictPolicy 任务的冲突策略
+func jobConflictPolicy(job *models.TransferJob) ConflictPolicy {
+	return ConflictPolicy{
+		Policy:         job.Policy(),
+		TimestampField: job.TimestampField,
+		SameConnection: job.SourceConnectionID == job.TargetConnectionID,
+	}
+}
+
+// uniqueSortedKeys 去重并排序
+func uniqueSortedKeys(keys []string) []string {
+	result := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// ErrTransferJobRunning 任务尚未结束
+var ErrTransferJobRunning = errors.New("transfer job is still running")
+
+// RollbackResult 回滚结果
+type RollbackResult struct {
+	Restored int      `json:"restored"` // 恢复为传输前的值
+	Deleted  int      `json:"deleted"`  // 传输前不存在，已删除
+	Forced   int      `json:"forced"`   // 传输之后被修改，强制回滚
+	Modified []string `json:"modified"` // 传输之后被修改，未回滚
+}
+
+// Rollback 将任务写入的键恢复为传输前的状态，每批在一个事务中执行
+// 键的mod_revision与写入时不同说明传输之后被修改过，未开启force时不回滚并在结果中返回
+// 已回滚的键不会重复处理，因此可以对被拒绝的键再次强制回滚
+func (s *TransferService) Rollback(ctx context.Context, job *models.TransferJob, force bool) (*RollbackResult, error) {
+	s.mu.Lock()
+	_, running := s.running[job.ID]
+	s.mu.Unlock()
+	if running || !job.Finished() {
+		return nil, ErrTransferJobRunning
+	}
+
+	result, err := s.rollback(ctx, job, force)
+	data := map[string]interface{}{
+		"job_id": job.ID,
+		"force":  force,
+		"result": result,
+	}
+	event := WebhookEventTransferRolledBack
+	if err != nil {
+		event = WebhookEventTransferRollbackFailed
+		data["error"] = err.Error()
+	}
+	s.webhookService.Emit(job.TargetConnectionID, event, "", data)
+	return result, err
+}
+
+// rollback 分批回滚任务写入的键并记录回滚时间
+func (s *TransferService) rollback(ctx context.Context, job *models.TransferJob, force bool) (*RollbackResult, error) {
+	var target models.Connection
+	if err := database.GetDB().First(&target, job.TargetConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("target connection not found: %w", err)
+	}
+	client, release, err := s.etcdService.Acquire(ctx, &target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result := &RollbackResult{Modified: []string{}}
+	var batch []models.TransferJobKey
+	err = database.GetDB().
+		Where("job_id = ? AND written_revision > 0 AND rolled_back = ?", job.ID, false).
+		FindInBatches(&batch, DefaultImportChunkSize, func(tx *gorm.DB, _ int) error {
+			return s.rollbackBatch(ctx, &target, client, batch, force, result)
+		}).Error
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	job.RolledBackAt = &now
+	if err := database.GetDB().Model(job).Update("rolled_back_at", now).Error; err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// rollbackBatch 回滚一批键，键在读取之后被修改时重新读取
+func (s *TransferService) rollbackBatch(ctx context.Context, target *models.Connection, client *clientv3.Client, batch []models.TransferJobKey, force bool, result *RollbackResult) error {
+	keys := make([]string, 0, len(batch))
+	for _, key := range batch {
+		keys = append(keys, key.Key)
+	}
+
+	for attempt := 0; ; attempt++ {
+		current := make(map[string]int64, len(keys))
+		if _, err := s.etcdService.GetKeysAt(ctx, target, keys, 0, func(kv *mvccpb.KeyValue) error {
+			current[string(kv.Key)] = kv.ModRevision
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		var cmps []clientv3.Cmp
+		var ops []clientv3.Op
+		var ids []uint
+		var modified []string
+		restored, deleted, forced := 0, 0, 0
+		for _, key := range batch {
+			// 被删除的键mod_revision为0，同样视为被修改
+			modRevision := current[key.Key]
+			if modRevision != key.WrittenRevision {
+				if !force {
+					modified = append(modified, key.Key)
+					continue
+				}
+				forced++
+			}
+
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key.Key), "=", modRevision))
+			if key.PreviousExists {
+				ops = append(ops, clientv3.OpPut(key.Key, string(key.PreviousValue)))
+				restored++
+			} else {
+				ops = append(ops, clientv3.OpDelete(key.Key))
+				deleted++
+			}
+			ids = append(ids, key.ID)
+		}
+
+		if len(ops) > 0 {
+			reqCtx, cancel := context.WithTimeout(ctx, target.RequestTimeoutDuration())
+			resp, err := client.Txn(reqCtx).If(cmps...).Then(ops...).Commit()
+			cancel()
+			if err != nil {
+				return fmt.Errorf("failed to roll back keys %s..%s: %w", keys[0], keys[len(keys)-1], classifyError(err))
+			}
+			if !resp.Succeeded {
+				if attempt < transferConflictRetries {
+					continue
+				}
+				return fmt.Errorf("%w: %s..%s", ErrImportConflict, keys[0], keys[len(keys)-1])
+			}
+			if err := database.GetDB().Model(&models.TransferJobKey{}).Where("id IN ?", ids).Update("rolled_back", true).Error; err != nil {
+				return err
+			}
+		}
+
+		result.Restored += restored
+		result.Deleted += deleted
+		result.Forced += forced
+		result.Modified = append(result.Modified, modified...)
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+func TestTransferRollback(t *testing.T) {
+	newTestDB(t)
+	client := newTestEtcd(t)
+	ctx := context.Background()
+	conn := newTestConnection(t, "local")
+	service := NewTransferService(newTestEtcdService(t), newTestWebhookService(t, true))
+	webhook := &models.Webhook{ConnectionID: conn.ID, Name: "rollback", URL: "https://hooks.example.com", Events: []string{"transfer.*"}, Enabled: true}
+	if err := database.GetDB().Create(webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	finished := time.Now()
+	job := &models.TransferJob{SourceConnectionID: conn.ID, TargetConnectionID: conn.ID, Status: models.TransferJobRunning}
+	if err := database.GetDB().Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟传输：记录写入前的值和写入后的mod_revision
+	write := func(key, previous, value string) {
+		t.Helper()
+		record := models.TransferJobKey{JobID: job.ID, Key: key, Decision: ImportActionAdd}
+		if previous != "" {
+			putTestKeys(t, client, map[string]string{key: previous})
+			record.PreviousExists = true
+			record.PreviousValue = []byte(previous)
+			record.Decision = ImportActionChange
+		}
+		resp, err := client.Put(ctx, key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.WrittenRevision = resp.Header.Revision
+		if err := database.GetDB().Create(&record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("/app/restored", "old", "new")
+	write("/app/added", "", "new")
+	write("/app/edited", "old", "new")
+	write("/app/removed", "old", "new")
+	// 未写入的键不参与回滚
+	if err := database.GetDB().Create(&models.TransferJobKey{JobID: job.ID, Key: "/app/skipped", Decision: ImportActionSkip}).Error; err != nil {
+		t.Fatal(err)
+	}
+	putTestKeys(t, client, map[string]string{"/app/skipped": "target value"})
+
+	// 任务结束之前不能回滚
+	if _, err := service.Rollback(ctx, job, false); !errors.Is(err, ErrTransferJobRunning) {
+		t.Fatalf("Rollback of running job = %v, want ErrTransferJobRunning", err)
+	}
+	job.Status = models.TransferJobCompleted
+	job.FinishedAt = &finished
+
+	// 传输之后被修改或删除的键不回滚
+	putTestKeys(t, client, map[string]string{"/app/edited": "edited after transfer"})
+	if _, err := client.Delete(ctx, "/app/removed"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		force    bool
+		want     RollbackResult
+		wantKeys map[string]string
+	}{
+		{
+			name: "keys changed after the transfer are kept",
+			want: RollbackResult{Restored: 1, Deleted: 1, Modified: []string{"/app/edited", "/app/removed"}},
+			wantKeys: map[string]string{
+				"/app/restored": "old",
+				"/app/edited":   "edited after transfer",
+				"/app/skipped":  "target value",
+			},
+		},
+		{
+			name:  "force rolls back the remaining keys",
+			force: true,
+			want:  RollbackResult{Restored: 2, Forced: 2, Modified: []string{}},
+			wantKeys: map[string]string{
+				"/app/restored": "old",
+				"/app/edited":   "old",
+				"/app/removed":  "old",
+				"/app/skipped":  "target value",
+			},
+		},
+		{
+			name:  "rolled back keys are not processed again",
+			force: true,
+			want:  RollbackResult{Modified: []string{}},
+			wantKeys: map[string]string{
+				"/app/restored": "old",
+				"/app/edited":   "old",
+				"/app/removed":  "old",
+				"/app/skipped":  "target value",
+			},
+		},
+	}
+	for _, tt := range tests {
+		result, err := service.Rollback(ctx, job, tt.force)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*result, tt.want) {
+			t.Errorf("%s: result = %+v, want %+v", tt.name, *result, tt.want)
+		}
+		if got := getTestKeys(t, client, "/app/"); !reflect.DeepEqual(got, tt.wantKeys) {
+			t.Errorf("%s: keys = %v, want %v", tt.name, got, tt.wantKeys)
+		}
+	}
+	if job.RolledBackAt == nil {
+		t.Error("rolled_back_at not set")
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := database.GetDB().Where("webhook_id = ?", webhook.ID).Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != len(tests) || deliveries[0].Event != WebhookEventTransferRolledBack {
+		t.Errorf("deliveries = %d, want %d %s events", len(deliveries), len(tests), WebhookEventTransferRolledBack)
+	}
+}
@@ -0,0 +1,771 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+var (
+	// ErrInvalidWebhook Webhook配置无效
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrWebhookAddressBlocked Webhook地址指向内部网络
+	ErrWebhookAddressBlocked = errors.New("webhook destination is not a public address")
+)
+
+// webhookBlockedPrefixes 除标准库能识别的回环、私有、链路本地等地址外，同样不允许投递的网段
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"),  // 运营商级NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF协议分配
+	netip.MustParsePrefix("198.18.0.0/15"),  // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),    // 保留及广播
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64，可映射到内部IPv4地址
+	netip.MustParsePrefix("64:ff9b:1::/48"), // 本地NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4，可嵌入内部IPv4地址
+}
+
+// Webhook事件
+const (
+	WebhookEventKeyChanged        = "key.changed" // Watch到前缀下的键被写入或删除
+	WebhookEventKeyDeleted        = "key.deleted" // 通过管理接口删除键
+	WebhookEventImportCompleted   = "import.completed"
+	WebhookEventImportFailed      = "import.failed"
+	WebhookEventTransferCompleted = "transfer.completed"
+	WebhookEventTransferFailed    = "transfer.failed"
+	WebhookEventTransferCancelled = "transfer.cancelled"
+	WebhookEventBackupCompleted   = "backup.completed"
+	WebhookEventBackupFailed      = "backup.failed"
+	WebhookEventTest              = "webhook.test"
+
+	WebhookEventTransferRolledBack     = "transfer.rolled_back"
+	WebhookEventTransferRollbackFailed = "transfer.rollback_failed"
+	WebhookEventPromotionApplied       = "promotion.applied"
+	WebhookEventPromotionFailed        = "promotion.failed"
+	WebhookEventGitSyncPulled          = "gitsync.pulled"
+	WebhookEventGitSyncPushed          = "gitsync.pushed"
+	WebhookEventGitSyncFailed          = "gitsync.failed"
+	WebhookEventMirrorStatusChanged    = "mirror.status_changed" // 创建、暂停、恢复、停止或删除镜像
+	WebhookEventMirrorFailed           = "mirror.failed"         // 运行中的镜像开始出错，重试期间不重复发送
+	WebhookEventMirrorRecovered        = "mirror.recovered"      // 出错的镜像恢复同步
+	WebhookEventConnectionCreated      = "connection.created"
+	WebhookEventConnectionUpdated      = "connection.updated"
+	WebhookEventConnectionDeleted      = "connection.deleted"
+)
+
+// WebhookEvents 可以订阅的事件
+var WebhookEvents = []string{
+	WebhookEventKeyChanged,
+	WebhookEventKeyDeleted,
+	WebhookEventImportCompleted,
+	WebhookEventImportFailed,
+	WebhookEventTransferCompleted,
+	WebhookEventTransferFailed,
+	WebhookEventTransferCancelled,
+	WebhookEventBackupCompleted,
+	WebhookEventBackupFailed,
+	WebhookEventTransferRolledBack,
+	WebhookEventTransferRollbackFailed,
+	WebhookEventPromotionApplied,
+	WebhookEventPromotionFailed,
+	WebhookEventGitSyncPulled,
+	WebhookEventGitSyncPushed,
+	WebhookEventGitSyncFailed,
+	WebhookEventMirrorStatusChanged,
+	WebhookEventMirrorFailed,
+	WebhookEventMirrorRecovered,
+	WebhookEventConnectionCreated,
+	WebhookEventConnectionUpdated,
+	WebhookEventConnectionDeleted,
+}
+
+const (
+	// webhookChangeBatch 一次key.changed投递中最多包含的变更数
+	webhookChangeBatch = 100
+	// webhookWorkers 同时进行的投递数
+	webhookWorkers = 8
+	// webhookPollInterval 没有待投递记录时检查数据库的最长间隔
+	webhookPollInterval = time.Minute
+	// webhookCleanupInterval 清理过期投递记录的间隔
+	webhookCleanupInterval = time.Hour
+	// webhookDrainLimit 为复用连接最多读取并丢弃的响应内容
+	webhookDrainLimit = 64 << 10
+	// Watch出错后重试的等待时间，每次翻倍
+	webhookMinBackoff = time.Second
+	webhookMaxBackoff = time.Minute
+)
+
+// WebhookPayload 投递的请求体
+type WebhookPayload struct {
+	ID         string            `json:"id"` // 事件ID，重新投递时不变，可用于去重
+	Event      string            `json:"event"`
+	Timestamp  time.Time         `json:"timestamp"`
+	WebhookID  uint              `json:"webhook_id"`
+	Connection WebhookConnection `json:"connection"`
+	Data       interface{}       `json:"data"`
+}
+
+// WebhookConnection 事件所属的连接
+type WebhookConnection struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebhookKeyChange key.changed事件中的一个变更，value只在开启include_values时返回
+type WebhookKeyChange struct {
+	Type     string  `json:"type"` // put 或 delete
+	Key      string  `json:"key"`
+	Value    *string `json:"value,omitempty"`
+	Revision int64   `json:"revision"`
+	Version  int64   `json:"version,omitempty"`
+}
+
+// WebhookService 出站Webhook：Watch订阅了key.changed的前缀，记录管理操作事件，并在后台投递
+// 投递记录保存在数据库中，失败后按指数退避重试，重启后继续投递未完成的记录
+type WebhookService struct {
+	cfg         config.WebhookConfig
+	etcdService *EtcdService
+	client      *http.Client
+
+	ctx    context.Context // 服务停止时取消Watch和进行中的投递
+	cancel context.CancelFunc
+	wake   chan struct{}
+
+	mu       sync.Mutex
+	watchers map[uint]context.CancelFunc // webhook_id -> 停止Watch
+	inflight map[uint]bool               // 正在投递的记录
+}
+
+// NewWebhookService 创建Webhook服务
+func NewWebhookService(cfg *config.Config, etcdService *EtcdService) *WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+	dialer := &net.Dialer{Timeout: cfg.Webhook.Timeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.Webhook.AllowPrivate {
+		// 在DNS解析之后检查实际连接的地址，域名解析到内部地址（包括DNS重绑定）同样会被拒绝
+		dialer.Control = webhookDialControl
+		// 经过代理时无法检查最终地址
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &WebhookService{
+		cfg:         cfg.Webhook,
+		etcdService: etcdService,
+		client: &http.Client{
+			Timeout:   cfg.Webhook.Timeout,
+			Transport: transport,
+			// 不跟随重定向，签名只对配置的URL有效
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ctx:      ctx,
+		cancel:   cancel,
+		wake:     make(chan struct{}, 1),
+		watchers: make(map[uint]context.CancelFunc),
+		inflight: make(map[uint]bool),
+	}
+}
+
+// Start 启动投递循环，并为已启用的Webhook开始Watch
+func (s *WebhookService) Start() error {
+	var webhooks []models.Webhook
+	if err := database.GetDB().Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	for i := range webhooks {
+		s.Reload(&webhooks[i])
+	}
+
+	go s.deliverLoop()
+	return nil
+}
+
+// Stop 停止Watch和投递
+func (s *WebhookService) Stop() {
+	s.cancel()
+}
+
+// ValidateWebhook 校验Webhook配置，未设置密钥时生成一个
+func (s *WebhookService) ValidateWebhook(webhook *models.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	// 域名在投递时解析后检查，这里只能提前拒绝IP地址和localhost
+	if !s.cfg.AllowPrivate {
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhook, ErrWebhookAddressBlocked)
+		}
+		if addr, err := netip.ParseAddr(host); err == nil && !webhookAddressAllowed(addr) {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhook, ErrWebhookAddressBlocked)
+		}
+	}
+	for _, pattern := range webhook.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: invalid event pattern %q", ErrInvalidWebhook, pattern)
+		}
+		known := false
+		for _, event := range WebhookEvents {
+			if ok, _ := path.Match(pattern, event); ok {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, pattern)
+		}
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = "whsec_" + randomHex(24)
+	}
+	return nil
+}
+
+// Reload Webhook创建或修改后更新Watch，未启用或未订阅key.changed时停止Watch
+func (s *WebhookService) Reload(webhook *models.Webhook) {
+	s.Remove(webhook.ID)
+	if !webhook.Enabled || !webhookSubscribes(webhook, WebhookEventKeyChanged) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.watchers[webhook.ID] = cancel
+	s.mu.Unlock()
+
+	w := *webhook
+	go s.watch(ctx, &w)
+}
+
+// Remove 停止Webhook的Watch
+func (s *WebhookService) Remove(webhookID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, exists := s.watchers[webhookID]; exists {
+		cancel()
+		delete(s.watchers, webhookID)
+	}
+}
+
+// Delete 删除Webhook及其投递记录
+func (s *WebhookService) Delete(webhook *models.Webhook) error {
+	s.Remove(webhook.ID)
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+// Emit 记录连接上的事件并投递给订阅了该事件的Webhook
+// key不为空时只投递给前缀匹配的Webhook，失败只记录日志，不影响调用方
+func (s *WebhookService) Emit(connectionID uint, event, key string, data interface{}) {
+	var webhooks []models.Webhook
+	if err := database.GetDB().Where("connection_id = ? AND enabled = ?", connectionID, true).Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to load webhooks of connection %d: %v", connectionID, err)
+		return
+	}
+	var conn models.Connection
+	if len(webhooks) > 0 {
+		if err := database.GetDB().First(&conn, connectionID).Error; err != nil {
+			log.Printf("Failed to load connection %d: %v", connectionID, err)
+			return
+		}
+	}
+	s.emit(webhooks, &conn, event, key, data)
+}
+
+// EmitConnection 记录连接本身的创建、修改或删除，投递给所有连接上订阅了该事件的Webhook
+// 新建的连接上还没有Webhook，删除的连接上的Webhook也不再使用，因此不限于事件所属的连接
+func (s *WebhookService) EmitConnection(conn *models.Connection, event string, data interface{}) {
+	var webhooks []models.Webhook
+	if err := database.GetDB().Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to load webhooks: %v", err)
+		return
+	}
+	s.emit(webhooks, conn, event, "", data)
+}
+
+// emit 为订阅了事件的Webhook保存待投递的记录，同一事件的各投递使用相同的事件ID
+func (s *WebhookService) emit(webhooks []models.Webhook, conn *models.Connection, event, key string, data interface{}) {
+	eventID := randomHex(16)
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if !webhookSubscribes(webhook, event) || (key != "" && !strings.HasPrefix(key, webhook.Prefix)) {
+			continue
+		}
+		if _, err := s.enqueue(webhook, conn, eventID, event, data, false); err != nil {
+			log.Printf("Failed to queue %s for webhook %d: %v", event, webhook.ID, err)
+		}
+	}
+}
+
+// Test 同步发送一次webhook.test事件，不重试，返回投递记录
+func (s *WebhookService) Test(ctx context.Context, webhook *models.Webhook) (*models.WebhookDelivery, error) {
+	var conn models.Connection
+	if err := database.GetDB().First(&conn, webhook.ConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("connection not found: %w", err)
+	}
+	delivery, err := s.enqueue(webhook, &conn, randomHex(16), WebhookEventTest, map[string]interface{}{"message": "This is a test delivery"}, true)
+	if err != nil {
+		return nil, err
+	}
+	s.attempt(ctx, webhook, delivery)
+	return delivery, nil
+}
+
+// Redeliver 以相同的事件ID和请求体重新投递，返回新的投递记录
+func (s *WebhookService) Redeliver(delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	redelivery := &models.WebhookDelivery{
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := database.GetDB().Create(redelivery).Error; err != nil {
+		return nil, err
+	}
+	s.notify()
+	return redelivery, nil
+}
+
+// enqueue 保存待投递的记录，test为true时由调用方直接投递
+func (s *WebhookService) enqueue(webhook *models.Webhook, conn *models.Connection, eventID, event string, data interface{}, test bool) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(WebhookPayload{
+		ID:         eventID,
+		Event:      event,
+		Timestamp:  time.Now().UTC(),
+		WebhookID:  webhook.ID,
+		Connection: WebhookConnection{ID: conn.ID, Name: conn.Name},
+		Data:       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   eventID,
+		Event:     event,
+		Payload:   string(payload),
+		Status:    models.WebhookDeliveryPending,
+		Test:      test,
+	}
+	if !test {
+		now := time.Now()
+		delivery.NextAttemptAt = &now
+	}
+	if err := database.GetDB().Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	if !test {
+		s.notify()
+	}
+	return delivery, nil
+}
+
+// notify 唤醒投递循环
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverLoop 投递到期的记录，然后等待到下一条记录到期或有新的记录，并定期清理过期的投递记录
+func (s *WebhookService) deliverLoop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	sem := make(chan struct{}, webhookWorkers)
+	lastCleanup := time.Time{}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+
+		if time.Since(lastCleanup) >= webhookCleanupInterval {
+			s.cleanup()
+			lastCleanup = time.Now()
+		}
+
+		due, wait, err := s.dueDeliveries()
+		if err != nil {
+			log.Printf("Failed to load webhook deliveries: %v", err)
+		}
+		timer.Reset(wait)
+		for i := range due {
+			delivery := due[i]
+			s.mu.Lock()
+			if s.inflight[delivery.ID] {
+				s.mu.Unlock()
+				continue
+			}
+			s.inflight[delivery.ID] = true
+			s.mu.Unlock()
+
+			select {
+			case sem <- struct{}{}:
+			case <-s.ctx.Done():
+				return
+			}
+			go func() {
+				defer func() {
+					s.mu.Lock()
+					delete(s.inflight, delivery.ID)
+					s.mu.Unlock()
+					<-sem
+				}()
+				s.deliver(&delivery)
+			}()
+		}
+	}
+}
+
+// dueDeliveries 返回已到期的待投递记录，以及到下一条记录到期的等待时间
+func (s *WebhookService) dueDeliveries() ([]models.WebhookDelivery, time.Duration, error) {
+	now := time.Now()
+	var due []models.WebhookDelivery
+	err := database.GetDB().Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("id").Limit(100).Find(&due).Error
+	if err != nil {
+		return nil, webhookPollInterval, err
+	}
+	if len(due) == 100 {
+		return due, 0, nil
+	}
+
+	var next []models.WebhookDelivery
+	err = database.GetDB().Select("next_attempt_at").Where("status = ? AND next_attempt_at > ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at").Limit(1).Find(&next).Error
+	if err != nil {
+		return due, webhookPollInterval, err
+	}
+	wait := webhookPollInterval
+	if len(next) > 0 {
+		wait = min(next[0].NextAttemptAt.Sub(now), wait)
+	}
+	return due, wait, nil
+}
+
+// deliver 加载Webhook并投递一次，Webhook已删除或停用时不再重试
+func (s *WebhookService) deliver(delivery *models.WebhookDelivery) {
+	var webhook models.Webhook
+	err := database.GetDB().First(&webhook, delivery.WebhookID).Error
+	if err == nil && !webhook.Enabled {
+		err = errors.New("webhook is disabled")
+	}
+	if err != nil {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+		s.saveDelivery(delivery)
+		return
+	}
+	s.attempt(s.ctx, &webhook, delivery)
+}
+
+// attempt 发送请求并记录结果，失败时按退避时间安排下次重试
+func (s *WebhookService) attempt(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	status, err := s.post(ctx, webhook, delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	if err == nil && (status < 200 || status >= 300) {
+		err = fmt.Errorf("endpoint responded with status %d", status)
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliverySuccess
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Test || delivery.Attempts >= s.cfg.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(webhookBackoff(s.cfg, delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+	s.saveDelivery(delivery)
+	if delivery.NextAttemptAt != nil {
+		s.notify()
+	}
+
+	lastStatus := models.WebhookDeliverySuccess
+	if err != nil {
+		lastStatus = models.WebhookDeliveryFailed
+	}
+	if err := database.GetDB().Model(webhook).Updates(map[string]interface{}{
+		"last_delivery_at": now,
+		"last_status":      lastStatus,
+	}).Error; err != nil {
+		log.Printf("Failed to update webhook %d: %v", webhook.ID, err)
+	}
+}
+
+// post 发送签名的请求，返回响应状态码；响应内容不保存，避免通过投递记录读取内部服务的响应
+func (s *WebhookService) post(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "etcd-admin-webhook")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+WebhookSignature(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// 读完响应内容以便复用连接
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookDrainLimit))
+	return resp.StatusCode, nil
+}
+
+// webhookDialControl 连接前检查解析后的地址，拒绝内部地址
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+	}
+	if !webhookAddressAllowed(addr) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, addr)
+	}
+	return nil
+}
+
+// webhookAddressAllowed 地址是否为可以投递的公网地址
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Zone() != "" || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveDelivery 保存投递结果
+func (s *WebhookService) saveDelivery(delivery *models.WebhookDelivery) {
+	err := database.GetDB().Model(delivery).
+		Select("status", "attempts", "response_status", "error", "next_attempt_at", "delivered_at").
+		Updates(delivery).Error
+	if err != nil {
+		log.Printf("Failed to update webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// cleanup 删除超过保留时间的已结束投递记录
+func (s *WebhookService) cleanup() {
+	if s.cfg.DeliveryRetention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.cfg.DeliveryRetention)
+	if err := database.GetDB().Where("status <> ? AND created_at < ?", models.WebhookDeliveryPending, cutoff).
+		Delete(&models.WebhookDelivery{}).Error; err != nil {
+		log.Printf("Failed to clean up webhook deliveries: %v", err)
+	}
+}
+
+// watch Watch前缀并为变更生成key.changed事件，出错时按指数退避重试
+// 服务重启期间的变更不会补发
+func (s *WebhookService) watch(ctx context.Context, webhook *models.Webhook) {
+	var revision int64
+	backoff := webhookMinBackoff
+	for {
+		startedAt := time.Now()
+		err := s.watchOnce(ctx, webhook, &revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrClientRetired) {
+			// 连接配置变更或客户端被回收，立即用新的客户端继续
+			backoff = webhookMinBackoff
+			continue
+		}
+		log.Printf("Webhook %d watch failed: %v", webhook.ID, err)
+
+		// 运行了较长时间后才出错时从最短的等待时间开始
+		if time.Since(startedAt) > webhookMaxBackoff {
+			backoff = webhookMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
+
+// watchOnce 从revision之后开始Watch，revision为0时从当前开始，处理过的revision写回revision
+func (s *WebhookService) watchOnce(ctx context.Context, webhook *models.Webhook, revision *int64) error {
+	var conn models.Connection
+	if err := database.GetDB().First(&conn, webhook.ConnectionID).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+	client, release, err := s.etcdService.Acquire(ctx, &conn)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if *revision > 0 {
+		opts = append(opts, clientv3.WithRev(*revision+1))
+	}
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	// 连接配置变更或健康检查失败后客户端被移出连接池，结束Watch并用新的客户端从已处理的revision继续
+	retired := s.etcdService.Retired(client)
+	go func() {
+		select {
+		case <-watchCtx.Done():
+		case <-retired:
+			cancel()
+		}
+	}()
+
+	for resp := range client.Watch(watchCtx, webhook.Prefix, opts...) {
+		if resp.CompactRevision != 0 {
+			// 需要的历史已被压缩，跳过这段变更从当前继续
+			*revision = 0
+			return fmt.Errorf("revision %d has been compacted, skipping to the current revision", resp.CompactRevision)
+		}
+		if err := resp.Err(); err != nil {
+			if isClosed(retired) {
+				return ErrClientRetired
+			}
+			return classifyError(err)
+		}
+
+		for start := 0; start < len(resp.Events); start += webhookChangeBatch {
+			events := resp.Events[start:min(start+webhookChangeBatch, len(resp.Events))]
+			changes := make([]WebhookKeyChange, 0, len(events))
+			for _, ev := range events {
+				change := WebhookKeyChange{
+					Type:     "put",
+					Key:      string(ev.Kv.Key),
+					Revision: ev.Kv.ModRevision,
+					Version:  ev.Kv.Version,
+				}
+				if ev.Type == clientv3.EventTypeDelete {
+					change.Type = "delete"
+				} else if webhook.IncludeValues {
+					value := string(ev.Kv.Value)
+					change.Value = &value
+				}
+				changes = append(changes, change)
+			}
+			data := map[string]interface{}{"prefix": webhook.Prefix, "revision": resp.Header.Revision, "changes": changes}
+			if _, err := s.enqueue(webhook, &conn, randomHex(16), WebhookEventKeyChanged, data, false); err != nil {
+				return err
+			}
+		}
+		if len(resp.Events) > 0 {
+			*revision = resp.Events[len(resp.Events)-1].Kv.ModRevision
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if isClosed(retired) {
+		return ErrClientRetired
+	}
+	return errors.New("watch channel closed")
+}
+
+// isClosed channel是否已关闭
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// WebhookSignature 计算请求签名：HMAC-SHA256(secret, timestamp + "." + body)的十六进制
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 第attempts次失败后到下次重试的等待时间
+func webhookBackoff(cfg config.WebhookConfig, attempts int) time.Duration {
+	backoff := cfg.BackoffBase
+	for i := 1; i < attempts && backoff < cfg.BackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, cfg.BackoffMax)
+}
+
+// webhookSubscribes Webhook是否订阅了事件，未设置事件时订阅全部，测试事件总是投递
+func webhookSubscribes(webhook *models.Webhook, event string) bool {
+	if len(webhook.Events) == 0 || event == WebhookEventTest {
+		return true
+	}
+	for _, pattern := range webhook.Events {
+		if ok, _ := path.Match(pattern, event); ok {
+			return true
+		}
+	}
+	return false
+}
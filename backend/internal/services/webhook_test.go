@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/database"
+)
+
+// testWebhookReceiver 记录收到的请求，前failures个请求返回500
+type testWebhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	requests []testWebhookRequest
+}
+
+type testWebhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestWebhookReceiver(t *testing.T, failures int) *testWebhookReceiver {
+	r := &testWebhookReceiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, testWebhookRequest{header: req.Header.Clone(), body: body})
+		if len(r.requests) <= r.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testWebhookReceiver) received() []testWebhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]testWebhookRequest(nil), r.requests...)
+}
+
+func newTestWebhookService(t *testing.T, allowPrivate bool) *WebhookService {
+	service := NewWebhookService(&config.Config{Webhook: config.WebhookConfig{
+		Timeout:      5 * time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  10 * time.Millisecond,
+		BackoffMax:   40 * time.Millisecond,
+		AllowPrivate: allowPrivate,
+	}}, nil)
+	t.Cleanup(service.Stop)
+	return service
+}
+
+// newTestWebhook 在一个新连接上保存指向url的Webhook，连接只用于事件中的名称，不需要etcd
+func newTestWebhook(t *testing.T, url string, events ...string) *models.Webhook {
+	t.Helper()
+	conn := &models.Connection{Name: "webhook-" + randomHex(4), Endpoints: `["127.0.0.1:2379"]`, IsActive: true}
+	if err := database.GetDB().Create(conn).Error; err != nil {
+		t.Fatal(err)
+	}
+	webhook := &models.Webhook{
+		ConnectionID: conn.ID,
+		Name:         "test",
+		URL:          url,
+		Secret:       "whsec_test",
+		Events:       events,
+		Enabled:      true,
+	}
+	if err := database.GetDB().Create(webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+// waitTestDelivery 等待Webhook的第一条投递记录结束
+func waitTestDelivery(t *testing.T, webhookID uint) *models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var delivery models.WebhookDelivery
+		err := database.GetDB().Where("webhook_id = ?", webhookID).Order("id").First(&delivery).Error
+		if err == nil && delivery.Status != models.WebhookDeliveryPending {
+			return &delivery
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivery of webhook %d did not finish", webhookID)
+	return nil
+}
+
+func TestWebhookSignature(t *testing.T) {
+	newTestDB(t)
+	receiver := newTestWebhookReceiver(t, 0)
+	service := newTestWebhookService(t, true)
+	webhook := newTestWebhook(t, receiver.URL)
+
+	delivery, err := service.Test(context.Background(), webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != models.WebhookDeliverySuccess || delivery.ResponseStatus != http.StatusOK {
+		t.Fatalf("delivery = %s (%d), want success: %s", delivery.Status, delivery.ResponseStatus, delivery.Error)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	timestamp := req.header.Get("X-Webhook-Timestamp")
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(timestamp + "." + string(req.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.header.Get("X-Webhook-Signature") != want {
+		t.Errorf("signature = %q, want %q", req.header.Get("X-Webhook-Signature"), want)
+	}
+	if req.header.Get("X-Webhook-Event") != WebhookEventTest || req.header.Get("X-Webhook-ID") != delivery.EventID {
+		t.Errorf("event headers = %q %q", req.header.Get("X-Webhook-Event"), req.header.Get("X-Webhook-ID"))
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != WebhookEventTest || payload.WebhookID != webhook.ID || payload.Connection.ID != webhook.ConnectionID {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// 密钥或请求体不同时签名不同
+	for _, tt := range []struct {
+		secret, timestamp, body string
+	}{
+		{"whsec_other", timestamp, string(req.body)},
+		{"whsec_test", timestamp + "0", string(req.body)},
+		{"whsec_test", timestamp, string(req.body) + " "},
+	} {
+		if WebhookSignature(tt.secret, tt.timestamp, []byte(tt.body)) == strings.TrimPrefix(req.header.Get("X-Webhook-Signature"), "sha256=") {
+			t.Errorf("signature did not change for secret %q, timestamp %q", tt.secret, tt.timestamp)
+		}
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"succeeds first time", 0, models.WebhookDeliverySuccess, 1},
+		{"succeeds after retries", 2, models.WebhookDeliverySuccess, 3},
+		{"gives up after max attempts", 5, models.WebhookDeliveryFailed, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			receiver := newTestWebhookReceiver(t, tt.failures)
+			service := newTestWebhookService(t, true)
+			webhook := newTestWebhook(t, receiver.URL, "backup.*")
+			if err := service.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			// 未订阅的事件不投递
+			service.Emit(webhook.ConnectionID, WebhookEventTransferCompleted, "", nil)
+			service.Emit(webhook.ConnectionID, WebhookEventBackupCompleted, "", map[string]string{"id": "1"})
+			delivery := waitTestDelivery(t, webhook.ID)
+			if delivery.Event != WebhookEventBackupCompleted {
+				t.Fatalf("delivered %s, want %s", delivery.Event, WebhookEventBackupCompleted)
+			}
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts {
+				t.Errorf("delivery = %s after %d attempts, want %s after %d", delivery.Status, delivery.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if delivery.Status == models.WebhookDeliveryFailed && delivery.NextAttemptAt != nil {
+				t.Errorf("failed delivery is still scheduled at %v", delivery.NextAttemptAt)
+			}
+
+			// 重试使用相同的事件ID和请求体
+			requests := receiver.received()
+			if len(requests) != tt.wantAttempts {
+				t.Fatalf("received %d requests, want %d", len(requests), tt.wantAttempts)
+			}
+			for _, req := range requests[1:] {
+				if string(req.body) != string(requests[0].body) || req.header.Get("X-Webhook-ID") != delivery.EventID {
+					t.Errorf("retry changed the event: %s", req.body)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cfg := config.WebhookConfig{BackoffBase: time.Second, BackoffMax: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(cfg, tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookAddressAllowed(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"2002:a00:1::", false},
+	}
+	for _, tt := range tests {
+		if got := webhookAddressAllowed(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("webhookAddressAllowed(%s) = %v, want %v", tt.addr, got, tt.allowed)
+		}
+	}
+}
+
+func TestWebhookRejectsPrivateDestinations(t *testing.T) {
+	newTestDB(t)
+	service := newTestWebhookService(t, false)
+
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.example.com/etcd", true},
+		{"http://93.184.216.34/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://api.localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::ffff:192.168.0.1]/hook", false},
+		{"ftp://hooks.example.com/etcd", false},
+		{"/relative", false},
+	}
+	for _, tt := range tests {
+		err := service.ValidateWebhook(&models.Webhook{URL: tt.url})
+		if tt.valid && err != nil {
+			t.Errorf("ValidateWebhook(%q) = %v, want nil", tt.url, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("ValidateWebhook(%q) = %v, want ErrInvalidWebhook", tt.url, err)
+		}
+	}
+
+	// 域名在校验时不解析，投递时解析到内部地址同样被拒绝，请求不会到达
+	receiver := newTestWebhookReceiver(t, 0)
+	for _, url := range []string{receiver.URL, strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)} {
+		webhook := newTestWebhook(t, url)
+		delivery, err := service.Test(context.Background(), webhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status != models.WebhookDeliveryFailed || !strings.Contains(delivery.Error, ErrWebhookAddressBlocked.Error()) {
+			t.Errorf("delivery to %s = %s: %s, want blocked", url, delivery.Status, delivery.Error)
+		}
+	}
+	if n := len(receiver.received()); n != 0 {
+		t.Errorf("receiver got %d requests, want 0", n)
+	}
+}
+
+func TestWebhookEmitConnection(t *testing.T) {
+	newTestDB(t)
+	receiver := newTestWebhookReceiver(t, 0)
+	service := newTestWebhookService(t, true)
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 连接事件投递给其他连接上订阅了该事件的Webhook
+	subscribed := newTestWebhook(t, receiver.URL, "connection.*")
+	other := newTestWebhook(t, receiver.URL, "key.*")
+
+	conn := &models.Connection{ID: 999, Name: "deleted-connection"}
+	service.EmitConnection(conn, WebhookEventConnectionDeleted, map[string]interface{}{"connection": conn})
+	delivery := waitTestDelivery(t, subscribed.ID)
+	if delivery.Status != models.WebhookDeliverySuccess || delivery.Event != WebhookEventConnectionDeleted {
+		t.Errorf("delivery = %s %s", delivery.Event, delivery.Status)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Connection.ID != 999 || payload.Connection.Name != "deleted-connection" {
+		t.Errorf("payload connection = %+v", payload.Connection)
+	}
+
+	var count int64
+	database.GetDB().Model(&models.WebhookDelivery{}).Where("webhook_id = ?", other.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("webhook subscribed to key.* got %d deliveries", count)
+	}
+}
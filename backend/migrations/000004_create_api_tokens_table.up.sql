@@ -0,0 +1,20 @@
+-- Create api_tokens table for personal access tokens
+CREATE TABLE `api_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `token_prefix` varchar(16) NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `scopes` varchar(100) NOT NULL,
+  `connection_ids` varchar(255) NULL,
+  `expires_at` timestamp NULL,
+  `last_used_at` timestamp NULL,
+  `last_used_ip` varchar(64) NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_api_tokens_token_hash` (`token_hash`),
+  KEY `idx_api_tokens_user_id` (`user_id`),
+  KEY `idx_api_tokens_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS `settings`;
+ALTER TABLE connections DROP COLUMN is_production;
+ALTER TABLE users DROP COLUMN mfa_recovery_codes;
+ALTER TABLE users DROP COLUMN mfa_last_step;
+ALTER TABLE users DROP COLUMN mfa_secret;
+ALTER TABLE users DROP COLUMN mfa_enabled;
@@ -0,0 +1,16 @@
+-- Add TOTP fields to users table
+ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN mfa_secret VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN mfa_last_step BIGINT DEFAULT 0;
+ALTER TABLE users ADD COLUMN mfa_recovery_codes TEXT NULL;
+
+-- Add production flag to connections table
+ALTER TABLE connections ADD COLUMN is_production BOOLEAN DEFAULT FALSE;
+
+-- Create settings table for admin policies
+CREATE TABLE `settings` (
+  `key` varchar(100) NOT NULL,
+  `value` text,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
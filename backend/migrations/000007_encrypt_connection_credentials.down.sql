@@ -0,0 +1,4 @@
+ALTER TABLE connections DROP COLUMN tls_key;
+ALTER TABLE connections DROP COLUMN tls_cert;
+ALTER TABLE connections DROP COLUMN tls_ca_cert;
+ALTER TABLE connections MODIFY COLUMN password VARCHAR(255) NULL;
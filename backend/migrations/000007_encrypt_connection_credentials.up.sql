@@ -0,0 +1,7 @@
+-- Encrypted credentials are longer than the original column
+ALTER TABLE connections MODIFY COLUMN password TEXT NULL;
+
+-- Add inline TLS material to connections table
+ALTER TABLE connections ADD COLUMN tls_ca_cert TEXT NULL;
+ALTER TABLE connections ADD COLUMN tls_cert TEXT NULL;
+ALTER TABLE connections ADD COLUMN tls_key TEXT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE connections DROP COLUMN request_timeout;
+ALTER TABLE connections DROP COLUMN dial_timeout;
@@ -0,0 +1,3 @@
+-- Add per-connection etcd timeouts (seconds)
+ALTER TABLE connections ADD COLUMN dial_timeout INT DEFAULT 5;
+ALTER TABLE connections ADD COLUMN request_timeout INT DEFAULT 10;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `backup_runs`;
+DROP TABLE IF EXISTS `backup_jobs`;
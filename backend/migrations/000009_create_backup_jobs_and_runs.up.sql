@@ -0,0 +1,43 @@
+-- Create backup_jobs table for scheduled backups
+CREATE TABLE `backup_jobs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `connection_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `schedule` varchar(100) NOT NULL,
+  `type` varchar(20) NOT NULL DEFAULT 'export',
+  `prefix` varchar(255) NULL,
+  `format` varchar(20) NULL,
+  `gzip` tinyint(1) NOT NULL DEFAULT 1,
+  `enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `keep_last` int NOT NULL DEFAULT 0,
+  `keep_daily_days` int NOT NULL DEFAULT 0,
+  `created_by` bigint unsigned NULL,
+  `last_run_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_backup_jobs_connection_id` (`connection_id`),
+  KEY `idx_backup_jobs_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Create backup_runs table for backup run history and stored files
+CREATE TABLE `backup_runs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `job_id` bigint unsigned NOT NULL,
+  `connection_id` bigint unsigned NOT NULL,
+  `status` varchar(20) NOT NULL,
+  `trigger` varchar(20) NULL,
+  `file_name` varchar(255) NULL,
+  `file_path` varchar(500) NULL,
+  `size` bigint NOT NULL DEFAULT 0,
+  `key_count` bigint NOT NULL DEFAULT 0,
+  `revision` bigint NOT NULL DEFAULT 0,
+  `error` text NULL,
+  `pruned` tinyint(1) NOT NULL DEFAULT 0,
+  `started_at` timestamp NULL,
+  `finished_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_backup_runs_job_id` (`job_id`),
+  KEY `idx_backup_runs_connection_id` (`connection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
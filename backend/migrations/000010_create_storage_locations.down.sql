@@ -0,0 +1,8 @@
+ALTER TABLE `backup_runs`
+  DROP COLUMN `checksum`,
+  DROP COLUMN `storage_id`;
+
+ALTER TABLE `backup_jobs`
+  DROP COLUMN `storage_id`;
+
+DROP TABLE IF EXISTS `storage_locations`;
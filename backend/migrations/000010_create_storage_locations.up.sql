@@ -0,0 +1,31 @@
+-- Create storage_locations table for named backup storage
+CREATE TABLE `storage_locations` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `type` varchar(20) NOT NULL,
+  `description` text NULL,
+  `path` varchar(500) NULL,
+  `endpoint` varchar(255) NULL,
+  `region` varchar(50) NULL,
+  `bucket` varchar(100) NULL,
+  `prefix` varchar(255) NULL,
+  `access_key` varchar(255) NULL,
+  `secret_key` text NULL,
+  `use_ssl` tinyint(1) NOT NULL DEFAULT 0,
+  `path_style` tinyint(1) NOT NULL DEFAULT 0,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `deleted_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_storage_locations_name` (`name`),
+  KEY `idx_storage_locations_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Backups can target a storage location, 0 is the built-in BACKUP_DIR
+ALTER TABLE `backup_jobs`
+  ADD COLUMN `storage_id` bigint unsigned NOT NULL DEFAULT 0 AFTER `prefix`;
+
+ALTER TABLE `backup_runs`
+  ADD COLUMN `storage_id` bigint unsigned NOT NULL DEFAULT 0 AFTER `trigger`,
+  ADD COLUMN `checksum` varchar(64) NULL AFTER `file_path`;
@@ -0,0 +1 @@
+ALTER TABLE backup_jobs DROP COLUMN encrypt;
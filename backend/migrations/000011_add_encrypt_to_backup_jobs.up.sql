@@ -0,0 +1,2 @@
+-- Scheduled backups can be encrypted to BACKUP_AGE_RECIPIENTS
+ALTER TABLE backup_jobs ADD COLUMN encrypt TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,29 @@
+-- Create transfer_jobs table for background transfers between connections
+CREATE TABLE `transfer_jobs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `source_connection_id` bigint unsigned NOT NULL,
+  `target_connection_id` bigint unsigned NOT NULL,
+  `status` varchar(20) NOT NULL,
+  `prefix` varchar(255) NULL,
+  `keys` text NULL,
+  `overwrite` tinyint(1) NOT NULL DEFAULT 0,
+  `mapping` text NULL,
+  `revision` bigint NOT NULL DEFAULT 0,
+  `total` bigint NOT NULL DEFAULT 0,
+  `processed` bigint NOT NULL DEFAULT 0,
+  `success_count` bigint NOT NULL DEFAULT 0,
+  `skipped_count` bigint NOT NULL DEFAULT 0,
+  `unchanged_count` bigint NOT NULL DEFAULT 0,
+  `filtered_count` bigint NOT NULL DEFAULT 0,
+  `missing_count` bigint NOT NULL DEFAULT 0,
+  `error` text NULL,
+  `created_by` bigint unsigned NULL,
+  `started_at` timestamp NULL,
+  `finished_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_transfer_jobs_source_connection_id` (`source_connection_id`),
+  KEY `idx_transfer_jobs_target_connection_id` (`target_connection_id`),
+  KEY `idx_transfer_jobs_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
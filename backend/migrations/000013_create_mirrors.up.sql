@@ -0,0 +1,19 @@
+-- Create mirrors table for continuous one-way mirroring between connections
+CREATE TABLE `mirrors` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `source_connection_id` bigint unsigned NOT NULL,
+  `target_connection_id` bigint unsigned NOT NULL,
+  `source_prefix` varchar(255) NULL,
+  `target_prefix` varchar(255) NULL,
+  `status` varchar(20) NOT NULL,
+  `revision` bigint NOT NULL DEFAULT 0,
+  `last_error` text NULL,
+  `last_synced_at` timestamp NULL,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_mirrors_source_connection_id` (`source_connection_id`),
+  KEY `idx_mirrors_target_connection_id` (`target_connection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS `transfer_job_keys`;
+
+ALTER TABLE `transfer_jobs`
+  DROP COLUMN `merged_count`,
+  DROP COLUMN `timestamp_field`,
+  DROP COLUMN `conflict_policy`;
@@ -0,0 +1,16 @@
+-- Add conflict policies to transfer jobs and record the decision taken for each key
+ALTER TABLE `transfer_jobs`
+  ADD COLUMN `conflict_policy` varchar(30) NULL AFTER `overwrite`,
+  ADD COLUMN `timestamp_field` varchar(255) NULL AFTER `conflict_policy`,
+  ADD COLUMN `merged_count` bigint NOT NULL DEFAULT 0 AFTER `success_count`;
+
+CREATE TABLE `transfer_job_keys` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `job_id` bigint unsigned NOT NULL,
+  `key` varchar(1024) NOT NULL,
+  `source_key` varchar(1024) NULL,
+  `decision` varchar(20) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_transfer_job_keys_job_decision` (`job_id`, `decision`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,8 @@
+ALTER TABLE `transfer_jobs`
+  DROP COLUMN `rolled_back_at`;
+
+ALTER TABLE `transfer_job_keys`
+  DROP COLUMN `rolled_back`,
+  DROP COLUMN `written_revision`,
+  DROP COLUMN `previous_value`,
+  DROP COLUMN `previous_exists`;
@@ -0,0 +1,9 @@
+-- Record the previous target value of each written key so transfers can be rolled back
+ALTER TABLE `transfer_job_keys`
+  ADD COLUMN `previous_exists` tinyint(1) NOT NULL DEFAULT 0 AFTER `decision`,
+  ADD COLUMN `previous_value` mediumblob NULL AFTER `previous_exists`,
+  ADD COLUMN `written_revision` bigint NOT NULL DEFAULT 0 AFTER `previous_value`,
+  ADD COLUMN `rolled_back` tinyint(1) NOT NULL DEFAULT 0 AFTER `written_revision`;
+
+ALTER TABLE `transfer_jobs`
+  ADD COLUMN `rolled_back_at` timestamp NULL AFTER `finished_at`;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `promotion_items`;
+DROP TABLE IF EXISTS `promotions`;
+DROP TABLE IF EXISTS `pipelines`;
@@ -0,0 +1,48 @@
+-- Create pipelines of ordered environments and the promotions between them
+CREATE TABLE `pipelines` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `description` varchar(255) NULL,
+  `environments` text NULL,
+  `ignore` text NULL,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_pipelines_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `promotions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `pipeline_id` bigint unsigned NOT NULL,
+  `from_environment` varchar(100) NOT NULL,
+  `to_environment` varchar(100) NOT NULL,
+  `source_connection_id` bigint unsigned NOT NULL,
+  `target_connection_id` bigint unsigned NOT NULL,
+  `source_prefix` varchar(255) NULL,
+  `target_prefix` varchar(255) NULL,
+  `source_revision` bigint NOT NULL DEFAULT 0,
+  `target_revision` bigint NOT NULL DEFAULT 0,
+  `status` varchar(20) NOT NULL,
+  `created_by` bigint unsigned NULL,
+  `applied_by` bigint unsigned NULL,
+  `applied_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_promotions_pipeline_id` (`pipeline_id`),
+  KEY `idx_promotions_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `promotion_items` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `promotion_id` bigint unsigned NOT NULL,
+  `key` varchar(1024) NOT NULL,
+  `action` varchar(20) NOT NULL,
+  `source_value` mediumblob NULL,
+  `target_value` mediumblob NULL,
+  `target_mod_revision` bigint NOT NULL DEFAULT 0,
+  `status` varchar(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_promotion_items_promotion_id` (`promotion_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `drift_reports`;
+DROP TABLE IF EXISTS `baselines`;
+DELETE FROM `kv_items` WHERE `baseline_id` IS NOT NULL;
@@ -0,0 +1,48 @@
+-- Create drift detection baselines and reports; kv_items holds the desired state of each baseline
+CREATE TABLE IF NOT EXISTS `kv_items` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `connection_id` bigint unsigned NOT NULL,
+  `baseline_id` bigint unsigned NULL,
+  `key` varchar(1024) NOT NULL,
+  `value` mediumtext NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_kv_items_connection_id` (`connection_id`),
+  KEY `idx_kv_items_baseline_id` (`baseline_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `baselines` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `connection_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(255) NULL,
+  `source` varchar(20) NOT NULL,
+  `key_count` bigint NOT NULL DEFAULT 0,
+  `schedule` varchar(100) NULL,
+  `enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `captured_at` timestamp NULL,
+  `last_checked_at` timestamp NULL,
+  `last_status` varchar(20) NULL,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_baselines_connection_id` (`connection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `drift_reports` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `baseline_id` bigint unsigned NOT NULL,
+  `status` varchar(20) NOT NULL,
+  `missing_count` int NOT NULL DEFAULT 0,
+  `unexpected_count` int NOT NULL DEFAULT 0,
+  `changed_count` int NOT NULL DEFAULT 0,
+  `missing` mediumtext NULL,
+  `unexpected` mediumtext NULL,
+  `changed` mediumtext NULL,
+  `error` text NULL,
+  `checked_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_drift_reports_baseline_id` (`baseline_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,44 @@
+-- Create git sync bindings and their pull/push runs
+CREATE TABLE `git_syncs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `connection_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(255) NULL,
+  `repo_url` varchar(500) NOT NULL,
+  `branch` varchar(100) NOT NULL,
+  `path` varchar(255) NULL,
+  `format` varchar(20) NOT NULL,
+  `mode` varchar(20) NOT NULL,
+  `prune` tinyint(1) NOT NULL DEFAULT 0,
+  `schedule` varchar(100) NULL,
+  `enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `last_commit` varchar(40) NULL,
+  `last_sync_at` timestamp NULL,
+  `last_status` varchar(20) NULL,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_git_syncs_connection_id` (`connection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `git_sync_runs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `sync_id` bigint unsigned NOT NULL,
+  `direction` varchar(10) NOT NULL,
+  `trigger` varchar(20) NULL,
+  `dry_run` tinyint(1) NOT NULL DEFAULT 0,
+  `status` varchar(20) NOT NULL,
+  `commit` varchar(40) NULL,
+  `added` int NOT NULL DEFAULT 0,
+  `changed` int NOT NULL DEFAULT 0,
+  `deleted` int NOT NULL DEFAULT 0,
+  `unchanged` int NOT NULL DEFAULT 0,
+  `changes` mediumtext NULL,
+  `error` text NULL,
+  `triggered_by` bigint unsigned NULL,
+  `started_at` timestamp NULL,
+  `finished_at` timestamp NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_git_sync_runs_sync_id` (`sync_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,41 @@
+-- Create outgoing webhooks and their delivery log
+CREATE TABLE `webhooks` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `connection_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `url` varchar(500) NOT NULL,
+  `secret` text NULL,
+  `prefix` varchar(255) NULL,
+  `events` text NULL,
+  `include_values` tinyint(1) NOT NULL DEFAULT 0,
+  `enabled` tinyint(1) NOT NULL DEFAULT 1,
+  `last_delivery_at` timestamp NULL,
+  `last_status` varchar(20) NULL,
+  `created_by` bigint unsigned NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhooks_connection_id` (`connection_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE `webhook_deliveries` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `webhook_id` bigint unsigned NOT NULL,
+  `event_id` varchar(32) NOT NULL,
+  `event` varchar(50) NOT NULL,
+  `payload` mediumtext NULL,
+  `status` varchar(20) NOT NULL,
+  `test` tinyint(1) NOT NULL DEFAULT 0,
+  `attempts` int NOT NULL DEFAULT 0,
+  `response_status` int NOT NULL DEFAULT 0,
+  `response_body` text NULL,
+  `error` text NULL,
+  `next_attempt_at` timestamp NULL,
+  `delivered_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_deliveries_webhook_id` (`webhook_id`),
+  KEY `idx_webhook_deliveries_status` (`status`),
+  KEY `idx_webhook_deliveries_next_attempt_at` (`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
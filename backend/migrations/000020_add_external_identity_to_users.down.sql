@@ -0,0 +1,5 @@
+-- Remove external identity fields from users table
+DROP INDEX idx_users_external ON users;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN external_id;
+ALTER TABLE users DROP COLUMN auth_provider;
@@ -0,0 +1,5 @@
+-- Add external identity fields to users table
+ALTER TABLE users ADD COLUMN auth_provider VARCHAR(20) NOT NULL DEFAULT 'local';
+ALTER TABLE users ADD COLUMN external_id VARCHAR(255) NULL;
+ALTER TABLE users ADD COLUMN avatar_url VARCHAR(255) NULL;
+CREATE INDEX idx_users_external ON users (auth_provider, external_id);
@@ -0,0 +1,2 @@
+-- Webhook deliveries keep only the response status code
+ALTER TABLE `webhook_deliveries` DROP COLUMN `response_body`;
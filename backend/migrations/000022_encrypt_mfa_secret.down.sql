@@ -0,0 +1 @@
+ALTER TABLE users MODIFY COLUMN mfa_secret VARCHAR(64) NULL;
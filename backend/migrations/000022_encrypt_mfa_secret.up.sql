@@ -0,0 +1,2 @@
+-- Encrypted TOTP secrets do not fit in VARCHAR(64)
+ALTER TABLE users MODIFY COLUMN mfa_secret TEXT NULL;
@@ -40,7 +40,30 @@ func InitDatabase(cfg *config.Config) error {
 	}
 
 	// AutoMigrate 新模型
-	if err := db.AutoMigrate(&models.User{}, &models.Connection{}, &models.KVItem{}); err != nil {
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Connection{},
+		&models.KVItem{},
+		&models.APIToken{},
+		&models.Setting{},
+		&models.LoginAttempt{},
+		&models.AuditLog{},
+		&models.BackupJob{},
+		&models.BackupRun{},
+		&models.StorageLocation{},
+		&models.TransferJob{},
+		&models.TransferJobKey{},
+		&models.Mirror{},
+		&models.Pipeline{},
+		&models.Promotion{},
+		&models.PromotionItem{},
+		&models.Baseline{},
+		&models.DriftReport{},
+		&models.GitSync{},
+		&models.GitSyncRun{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+	); err != nil {
 		return fmt.Errorf("auto migrate failed: %w", err)
 	}
 
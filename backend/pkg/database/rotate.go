@@ -0,0 +1,207 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"etcd-admin-backend/internal/config"
+	"etcd-admin-backend/internal/models"
+	"etcd-admin-backend/pkg/secrets"
+)
+
+// connectionSecrets 连接凭据的原始列，不经过模型钩子
+type connectionSecrets struct {
+	ID       uint
+	Password string
+	TLSKey   string
+}
+
+// storageSecrets 存储位置密钥的原始列
+type storageSecrets struct {
+	ID        uint
+	SecretKey string
+}
+
+// webhookSecrets Webhook签名密钥的原始列
+type webhookSecrets struct {
+	ID     uint
+	Secret string
+}
+
+// userSecrets 用户TOTP密钥的原始列
+type userSecrets struct {
+	ID        uint
+	MFASecret string
+}
+
+// driftReportChanges 漂移报告中变更键值的原始列
+type driftReportChanges struct {
+	ID      uint
+	Changed string
+}
+
+// RotateEncryptionKeys 使用当前主密钥重新加密所有连接凭据、存储位置密钥、Webhook签名密钥、TOTP密钥和漂移报告中的键值
+// 旧密钥需通过 ENCRYPTION_PREVIOUS_KEYS 提供，明文的历史数据也会被加密
+func RotateEncryptionKeys(cfg *config.Config) (int, error) {
+	if secrets.Default() == nil {
+		return 0, secrets.ErrNoKey
+	}
+
+	if err := InitDatabase(cfg); err != nil {
+		return 0, fmt.Errorf("failed to initialize database for key rotation: %w", err)
+	}
+
+	// 直接读取表数据，包含已软删除的记录
+	var rows []connectionSecrets
+	if err := DB.Table("connections").Select("id, password, tls_key").Find(&rows).Error; err != nil {
+		return 0, fmt.Errorf("failed to load connections: %w", err)
+	}
+
+	var storages []storageSecrets
+	if err := DB.Table("storage_locations").Select("id, secret_key").Find(&storages).Error; err != nil {
+		return 0, fmt.Errorf("failed to load storage locations: %w", err)
+	}
+
+	var webhooks []webhookSecrets
+	if err := DB.Table("webhooks").Select("id, secret").Find(&webhooks).Error; err != nil {
+		return 0, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	var users []userSecrets
+	if err := DB.Table("users").Select("id, mfa_secret").Where("mfa_secret IS NOT NULL AND mfa_secret <> ''").Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	rotated := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if !secrets.NeedsRotation(row.Password) && !secrets.NeedsRotation(row.TLSKey) {
+				continue
+			}
+
+			password, err := secrets.Reencrypt(row.Password)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt password of connection %d: %w", row.ID, err)
+			}
+			tlsKey, err := secrets.Reencrypt(row.TLSKey)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt TLS key of connection %d: %w", row.ID, err)
+			}
+
+			if err := tx.Table("connections").Where("id = ?", row.ID).UpdateColumns(map[string]interface{}{
+				"password": password,
+				"tls_key":  tlsKey,
+			}).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		for _, row := range storages {
+			if !secrets.NeedsRotation(row.SecretKey) {
+				continue
+			}
+
+			secretKey, err := secrets.Reencrypt(row.SecretKey)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt secret key of storage location %d: %w", row.ID, err)
+			}
+			if err := tx.Table("storage_locations").Where("id = ?", row.ID).UpdateColumn("secret_key", secretKey).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		for _, row := range webhooks {
+			if !secrets.NeedsRotation(row.Secret) {
+				continue
+			}
+
+			secret, err := secrets.Reencrypt(row.Secret)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt secret of webhook %d: %w", row.ID, err)
+			}
+			if err := tx.Table("webhooks").Where("id = ?", row.ID).UpdateColumn("secret", secret).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		for _, row := range users {
+			if !secrets.NeedsRotation(row.MFASecret) {
+				continue
+			}
+
+			mfaSecret, err := secrets.Reencrypt(row.MFASecret)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt mfa secret of user %d: %w", row.ID, err)
+			}
+			if err := tx.Table("users").Where("id = ?", row.ID).UpdateColumn("mfa_secret", mfaSecret).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		// 漂移报告可能很多，分批处理
+		var reports []driftReportChanges
+		return tx.Table("drift_reports").Select("id, changed").Where("changed_count > 0").
+			FindInBatches(&reports, 100, func(batch *gorm.DB, _ int) error {
+				for _, row := range reports {
+					changed, ok, err := rotateDriftChanges(row.Changed)
+					if err != nil {
+						return fmt.Errorf("failed to re-encrypt drift report %d: %w", row.ID, err)
+					}
+					if !ok {
+						continue
+					}
+					if err := tx.Table("drift_reports").Where("id = ?", row.ID).UpdateColumn("changed", changed).Error; err != nil {
+						return err
+					}
+					rotated++
+				}
+				return nil
+			}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Re-encrypted %d credentials with key %s", rotated, secrets.Default().ActiveKeyID())
+	return rotated, nil
+}
+
+// rotateDriftChanges 重新加密漂移报告中的期望值和实际值，没有需要轮换的值时返回false
+func rotateDriftChanges(raw string) (string, bool, error) {
+	var changes []models.DriftChange
+	if err := json.Unmarshal([]byte(raw), &changes); err != nil {
+		return "", false, err
+	}
+
+	rotate := false
+	for i := range changes {
+		change := &changes[i]
+		if !secrets.NeedsRotation(change.Expected) && !secrets.NeedsRotation(change.Actual) {
+			continue
+		}
+		var err error
+		if change.Expected, err = secrets.Reencrypt(change.Expected); err != nil {
+			return "", false, err
+		}
+		if change.Actual, err = secrets.Reencrypt(change.Actual); err != nil {
+			return "", false, err
+		}
+		rotate = true
+	}
+	if !rotate {
+		return "", false, nil
+	}
+
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded), true, nil
+}
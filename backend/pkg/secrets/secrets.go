@@ -0,0 +1,275 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"etcd-admin-backend/internal/config"
+)
+
+// 密文前缀，格式为 enc:v1:<密钥ID>:<加密后的数据密钥>:<加密后的数据>
+const encryptedPrefix = "enc:v1:"
+
+var (
+	// ErrNoKey 未配置主密钥
+	ErrNoKey = errors.New("encryption key is not configured")
+	// ErrUnknownKey 密文使用的主密钥不在密钥环中
+	ErrUnknownKey = errors.New("ciphertext was encrypted with an unknown key")
+	// ErrMalformed 密文格式错误
+	ErrMalformed = errors.New("malformed ciphertext")
+)
+
+// Keyring 主密钥环，使用当前密钥加密，可用任一密钥解密
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultKeyring *Keyring
+)
+
+// LoadKeyring 从配置加载密钥环，未配置主密钥时返回nil
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	active, err := loadKey(cfg.Key, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, nil
+	}
+
+	keyring := &Keyring{keys: make(map[string][]byte)}
+	keyring.activeID = keyring.add(active)
+
+	for _, encoded := range cfg.PreviousKeys {
+		key, err := loadKey(encoded, "")
+		if err != nil {
+			return nil, err
+		}
+		keyring.add(key)
+	}
+	for _, path := range cfg.PreviousKeyFiles {
+		key, err := loadKey("", path)
+		if err != nil {
+			return nil, err
+		}
+		keyring.add(key)
+	}
+
+	return keyring, nil
+}
+
+// SetDefault 设置全局密钥环
+func SetDefault(keyring *Keyring) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultKeyring = keyring
+}
+
+// Default 获取全局密钥环
+func Default() *Keyring {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultKeyring
+}
+
+// ActiveKeyID 返回当前用于加密的密钥ID
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// IsEncrypted 判断值是否为密文
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt 使用全局密钥环加密，空值保持为空；未配置密钥时原样返回
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	keyring := Default()
+	if keyring == nil {
+		return plaintext, nil
+	}
+	return keyring.Encrypt(plaintext)
+}
+
+// Decrypt 使用全局密钥环解密，明文（未加密的历史数据）原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyring := Default()
+	if keyring == nil {
+		return "", ErrNoKey
+	}
+	return keyring.Decrypt(value)
+}
+
+// NeedsRotation 判断值是否需要用当前密钥重新加密
+func NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	keyring := Default()
+	if keyring == nil {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 3)
+	return len(parts) != 3 || parts[0] != keyring.activeID
+}
+
+// Reencrypt 解密后使用当前密钥重新加密，明文的历史数据会被加密
+func Reencrypt(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	keyring := Default()
+	if keyring == nil {
+		return "", ErrNoKey
+	}
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Encrypt(plaintext)
+}
+
+// Encrypt 生成随机数据密钥加密数据，再用主密钥加密数据密钥
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(k.keys[k.activeID], dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + k.activeID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt 解密密文
+func (k *Keyring) Decrypt(value string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 3)
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// add 加入密钥，密钥ID为密钥SHA-256的前8位十六进制
+func (k *Keyring) add(key []byte) string {
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:4])
+	k.keys[id] = key
+	return id
+}
+
+// seal AES-256-GCM加密，输出 nonce||ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open AES-256-GCM解密
+func open(key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// loadKey 读取base64编码的32字节密钥，文件中可以是base64或原始字节
+func loadKey(encoded, path string) ([]byte, error) {
+	if encoded == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		if len(content) == 32 {
+			return content, nil
+		}
+		encoded = strings.TrimSpace(string(content))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}